@@ -8,7 +8,9 @@ package main
 import (
 	"bufio"
 	"fmt"
+	"io"
 	"log"
+	"net"
 	"os"
 	"strings"
 	"syscall"
@@ -91,6 +93,31 @@ func doMkcerts(configFile string, quiet bool) {
 	}
 }
 
+// implements the `ergo console` command
+func doConsole(configFile string) {
+	config, err := irc.LoadRawConfig(configFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	path := config.Server.AdminConsole.Path
+	if !config.Server.AdminConsole.Enabled || path == "" {
+		log.Fatal("The admin console is not enabled in ", configFile)
+	}
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		log.Fatal("Couldn't connect to the admin console: ", err.Error())
+	}
+	defer conn.Close()
+	go func() {
+		io.Copy(conn, os.Stdin)
+		// half-close, so we still read the response to the final command
+		if uconn, ok := conn.(*net.UnixConn); ok {
+			uconn.CloseWrite()
+		}
+	}()
+	io.Copy(os.Stdout, conn)
+}
+
 func main() {
 	irc.SetVersionString(version, commit)
 	usage := `ergo.
@@ -98,9 +125,11 @@ Usage:
 	ergo initdb [--conf <filename>] [--quiet]
 	ergo upgradedb [--conf <filename>] [--quiet]
 	ergo importdb <database.json> [--conf <filename>] [--quiet]
+	ergo restoredb <backup.db> [--conf <filename>] [--quiet]
 	ergo genpasswd [--conf <filename>] [--quiet]
 	ergo mkcerts [--conf <filename>] [--quiet]
 	ergo run [--conf <filename>] [--quiet] [--smoke]
+	ergo console [--conf <filename>]
 	ergo -h | --help
 	ergo --version
 Options:
@@ -140,6 +169,9 @@ Options:
 	} else if arguments["mkcerts"].(bool) {
 		doMkcerts(arguments["--conf"].(string), arguments["--quiet"].(bool))
 		return
+	} else if arguments["console"].(bool) {
+		doConsole(arguments["--conf"].(string))
+		return
 	}
 
 	configfile := arguments["--conf"].(string)
@@ -177,6 +209,14 @@ Options:
 		if err != nil {
 			log.Fatal("Error while importing db:", err.Error())
 		}
+	} else if arguments["restoredb"].(bool) {
+		err = irc.RestoreDB(config, arguments["<backup.db>"].(string))
+		if err != nil {
+			log.Fatal("Error while restoring db:", err.Error())
+		}
+		if !arguments["--quiet"].(bool) {
+			log.Println("database restored: ", config.Datastore.Path)
+		}
 	} else if arguments["run"].(bool) {
 		if !arguments["--quiet"].(bool) {
 			logman.Info("server", fmt.Sprintf("%s starting", irc.Ver))
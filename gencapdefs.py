@@ -183,6 +183,18 @@ CAPDEFS = [
         url="https://github.com/ircv3/ircv3-specifications/pull/466",
         standard="draft IRCv3",
     ),
+    CapDef(
+        identifier="Metadata",
+        name="draft/metadata-2",
+        url="https://github.com/ircv3/ircv3-specifications/pull/501",
+        standard="draft IRCv3",
+    ),
+    CapDef(
+        identifier="MessageRedaction",
+        name="draft/message-redaction",
+        url="https://github.com/ircv3/ircv3-specifications/pull/524",
+        standard="draft IRCv3",
+    ),
 ]
 
 def validate_defs():
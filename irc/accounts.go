@@ -43,12 +43,25 @@ const (
 	keyAccountLastSeen         = "account.lastseen %s"
 	keyAccountModes            = "account.modes %s"     // user modes for the always-on client as a string
 	keyAccountRealname         = "account.realname %s"  // client realname stored as string
+	keyAccountAwayMessage      = "account.away %s"      // away message for the always-on client
+	keyAccountMetadata         = "account.metadata %s"  // draft/metadata-2 key-value data, as JSON
 	keyAccountSuspended        = "account.suspended %s" // client realname stored as string
 	keyAccountPwReset          = "account.pwreset %s"
 	keyAccountEmailChange      = "account.emailchange %s"
+	// time of the last login or logout, as unix nanoseconds:
+	keyAccountLastConnected = "account.lastconnected %s"
+	// the quit message from the account's last disconnection, for NS SEEN:
+	keyAccountLastQuit = "account.lastquit %s"
+	// the last-connected time for which a channel expiration warning was sent:
+	keyAccountChannelExpiryWarning = "account.channelexpirywarning %s"
 	// for an always-on client, a map of channel names they're in to their current modes
 	// (not to be confused with their amodes, which a non-always-on client can have):
 	keyAccountChannelToModes = "account.channeltomodes %s"
+	// MemoServ inbox and ignore list, as JSON:
+	keyAccountMemos       = "account.memos %s"
+	keyAccountMemoIgnores = "account.memoignores %s"
+	// for an always-on client, the last membership of each channel they left, as JSON:
+	keyAccountDepartedChannels = "account.departedchannels %s"
 
 	maxCertfpsPerAccount = 5
 )
@@ -132,6 +145,7 @@ func (am *AccountManager) createAlwaysOnClients(config *Config) {
 				am.loadLastSeen(accountName),
 				am.loadModes(accountName),
 				am.loadRealname(accountName),
+				am.loadAwayMessage(accountName),
 			)
 		}
 	}
@@ -661,6 +675,49 @@ func (am *AccountManager) saveLastSeen(account string, lastSeen map[string]time.
 	}
 }
 
+// saveLastConnected records that the account is or was just now connected,
+// for display in WHOIS and NickServ INFO after it disconnects
+func (am *AccountManager) saveLastConnected(casefoldedAccount string) {
+	existsKey := fmt.Sprintf(keyAccountExists, casefoldedAccount)
+	key := fmt.Sprintf(keyAccountLastConnected, casefoldedAccount)
+	val := strconv.FormatInt(time.Now().UnixNano(), 10)
+	err := am.server.store.Update(func(tx *buntdb.Tx) error {
+		if _, err := tx.Get(existsKey); err != nil {
+			return nil
+		}
+		_, _, err := tx.Set(key, val, nil)
+		return err
+	})
+	if err != nil {
+		am.server.logger.Error("internal", "error persisting last connected time", casefoldedAccount, err.Error())
+	}
+}
+
+// saveLastQuit records the quit message of the account's final disconnection
+func (am *AccountManager) saveLastQuit(casefoldedAccount, quitMessage string) {
+	existsKey := fmt.Sprintf(keyAccountExists, casefoldedAccount)
+	key := fmt.Sprintf(keyAccountLastQuit, casefoldedAccount)
+	err := am.server.store.Update(func(tx *buntdb.Tx) error {
+		if _, err := tx.Get(existsKey); err != nil {
+			return nil
+		}
+		_, _, err := tx.Set(key, quitMessage, nil)
+		return err
+	})
+	if err != nil {
+		am.server.logger.Error("internal", "error persisting quit message", casefoldedAccount, err.Error())
+	}
+}
+
+func (am *AccountManager) loadLastQuit(casefoldedAccount string) (quitMessage string) {
+	key := fmt.Sprintf(keyAccountLastQuit, casefoldedAccount)
+	am.server.store.View(func(tx *buntdb.Tx) error {
+		quitMessage, _ = tx.Get(key)
+		return nil
+	})
+	return
+}
+
 func (am *AccountManager) loadLastSeen(account string) (lastSeen map[string]time.Time) {
 	key := fmt.Sprintf(keyAccountLastSeen, account)
 	var lsText string
@@ -699,6 +756,121 @@ func (am *AccountManager) loadRealname(account string) (realname string) {
 	return
 }
 
+func (am *AccountManager) saveAwayMessage(account string, awayMessage string) {
+	key := fmt.Sprintf(keyAccountAwayMessage, account)
+	am.server.store.Update(func(tx *buntdb.Tx) error {
+		if awayMessage != "" {
+			tx.Set(key, awayMessage, nil)
+		} else {
+			tx.Delete(key)
+		}
+		return nil
+	})
+}
+
+func (am *AccountManager) loadAwayMessage(account string) (awayMessage string) {
+	key := fmt.Sprintf(keyAccountAwayMessage, account)
+	am.server.store.View(func(tx *buntdb.Tx) error {
+		awayMessage, _ = tx.Get(key)
+		return nil
+	})
+	return
+}
+
+func (am *AccountManager) saveMetadata(account string, metadata map[string]string) {
+	key := fmt.Sprintf(keyAccountMetadata, account)
+	var serialized []byte
+	if len(metadata) != 0 {
+		serialized, _ = json.Marshal(metadata)
+	}
+	am.server.store.Update(func(tx *buntdb.Tx) error {
+		if serialized != nil {
+			tx.Set(key, string(serialized), nil)
+		} else {
+			tx.Delete(key)
+		}
+		return nil
+	})
+}
+
+func (am *AccountManager) loadMetadata(account string) (metadata map[string]string) {
+	key := fmt.Sprintf(keyAccountMetadata, account)
+	var serialized string
+	am.server.store.View(func(tx *buntdb.Tx) error {
+		serialized, _ = tx.Get(key)
+		return nil
+	})
+	if serialized != "" {
+		json.Unmarshal([]byte(serialized), &metadata)
+	}
+	return
+}
+
+// AccountExport is everything stored about an account, as exported at the
+// request of the account holder. Secrets (passphrase hashes, SCRAM credentials,
+// verification codes) and internal bookkeeping are omitted. When adding a new
+// per-account key to the datastore, add its contents here as well.
+type AccountExport struct {
+	Name               string
+	RegisteredAt       time.Time
+	Suspended          *AccountSuspension `json:",omitempty"`
+	HasPassphrase      bool
+	Certfps            []string
+	AdditionalNicks    []string
+	VHost              VHostInfo
+	Settings           AccountSettings
+	RegisteredChannels []string
+	AlwaysOnChannels   map[string]alwaysOnChannelStatus `json:",omitempty"`
+	LastSeen           map[string]time.Time             `json:",omitempty"`
+	UserModes          string                           `json:",omitempty"`
+	Realname           string                           `json:",omitempty"`
+	AwayMessage        string                           `json:",omitempty"`
+	LastConnected      time.Time
+	LastQuit           string                        `json:",omitempty"`
+	Metadata           map[string]string             `json:",omitempty"`
+	Memos              []Memo                        `json:",omitempty"`
+	MemoIgnores        []string                      `json:",omitempty"`
+	DepartedChannels   map[string]departedMembership `json:",omitempty"`
+}
+
+func (am *AccountManager) Export(accountName string) (result AccountExport, err error) {
+	account, err := am.LoadAccount(accountName)
+	if err != nil {
+		return
+	}
+	if !account.Verified {
+		err = errAccountUnverified
+		return
+	}
+	cfName := account.NameCasefolded
+	result = AccountExport{
+		Name:               account.Name,
+		RegisteredAt:       account.RegisteredAt,
+		Suspended:          account.Suspended,
+		HasPassphrase:      len(account.Credentials.PassphraseHash) != 0,
+		Certfps:            account.Credentials.Certfps,
+		AdditionalNicks:    account.AdditionalNicks,
+		VHost:              account.VHost,
+		Settings:           account.Settings,
+		RegisteredChannels: am.ChannelsForAccount(cfName),
+		AlwaysOnChannels:   am.loadChannels(cfName),
+		LastSeen:           am.loadLastSeen(cfName),
+		UserModes:          am.loadModes(cfName).String(),
+		Realname:           am.loadRealname(cfName),
+		AwayMessage:        am.loadAwayMessage(cfName),
+		LastConnected:      account.LastConnected,
+		LastQuit:           am.loadLastQuit(cfName),
+		Metadata:           am.loadMetadata(cfName),
+	}
+	am.server.store.View(func(tx *buntdb.Tx) error {
+		result.Memos = am.loadMemos(tx, cfName)
+		result.MemoIgnores = am.loadMemoIgnores(tx, cfName)
+		result.DepartedChannels = am.loadDepartedChannels(tx, cfName)
+		return nil
+	})
+	return
+}
+
 func (am *AccountManager) addRemoveCertfp(account, certfp string, add bool, hasPrivs bool) (err error) {
 	certfp, err = utils.NormalizeCertfp(certfp)
 	if err != nil {
@@ -1516,6 +1688,10 @@ func (am *AccountManager) deserializeRawAccount(raw rawClientAccount, cfName str
 			am.server.logger.Warning("internal", "could not unmarshal settings for account", result.Name, e.Error())
 		}
 	}
+	if raw.LastConnected != "" {
+		lastConnected, _ := strconv.ParseInt(raw.LastConnected, 10, 64)
+		result.LastConnected = time.Unix(0, lastConnected).UTC()
+	}
 	if raw.Suspended != "" {
 		sus := new(AccountSuspension)
 		e := json.Unmarshal([]byte(raw.Suspended), sus)
@@ -1538,6 +1714,7 @@ func (am *AccountManager) loadRawAccount(tx *buntdb.Tx, casefoldedAccount string
 	vhostKey := fmt.Sprintf(keyAccountVHost, casefoldedAccount)
 	settingsKey := fmt.Sprintf(keyAccountSettings, casefoldedAccount)
 	suspendedKey := fmt.Sprintf(keyAccountSuspended, casefoldedAccount)
+	lastConnectedKey := fmt.Sprintf(keyAccountLastConnected, casefoldedAccount)
 
 	_, e := tx.Get(accountKey)
 	if e == buntdb.ErrNotFound {
@@ -1552,6 +1729,7 @@ func (am *AccountManager) loadRawAccount(tx *buntdb.Tx, casefoldedAccount string
 	result.VHost, _ = tx.Get(vhostKey)
 	result.Settings, _ = tx.Get(settingsKey)
 	result.Suspended, _ = tx.Get(suspendedKey)
+	result.LastConnected, _ = tx.Get(lastConnectedKey)
 
 	if _, e = tx.Get(verifiedKey); e == nil {
 		result.Verified = true
@@ -1735,9 +1913,17 @@ func (am *AccountManager) Unregister(account string, erase bool) error {
 	channelsKey := fmt.Sprintf(keyAccountChannels, casefoldedAccount)
 	joinedChannelsKey := fmt.Sprintf(keyAccountChannelToModes, casefoldedAccount)
 	lastSeenKey := fmt.Sprintf(keyAccountLastSeen, casefoldedAccount)
+	lastConnectedKey := fmt.Sprintf(keyAccountLastConnected, casefoldedAccount)
+	lastQuitKey := fmt.Sprintf(keyAccountLastQuit, casefoldedAccount)
+	expiryWarningKey := fmt.Sprintf(keyAccountChannelExpiryWarning, casefoldedAccount)
+	memosKey := fmt.Sprintf(keyAccountMemos, casefoldedAccount)
+	memoIgnoresKey := fmt.Sprintf(keyAccountMemoIgnores, casefoldedAccount)
+	departedChannelsKey := fmt.Sprintf(keyAccountDepartedChannels, casefoldedAccount)
 	unregisteredKey := fmt.Sprintf(keyAccountUnregistered, casefoldedAccount)
 	modesKey := fmt.Sprintf(keyAccountModes, casefoldedAccount)
 	realnameKey := fmt.Sprintf(keyAccountRealname, casefoldedAccount)
+	awayMessageKey := fmt.Sprintf(keyAccountAwayMessage, casefoldedAccount)
+	metadataKey := fmt.Sprintf(keyAccountMetadata, casefoldedAccount)
 	suspendedKey := fmt.Sprintf(keyAccountSuspended, casefoldedAccount)
 	pwResetKey := fmt.Sprintf(keyAccountPwReset, casefoldedAccount)
 	emailChangeKey := fmt.Sprintf(keyAccountEmailChange, casefoldedAccount)
@@ -1751,11 +1937,21 @@ func (am *AccountManager) Unregister(account string, erase bool) error {
 	// on our way out, unregister all the account's channels and delete them from the db
 	defer func() {
 		for _, channelName := range registeredChannels {
+			if channel := am.server.channels.Get(channelName); channel != nil {
+				if successor := channel.transferToSuccessor(casefoldedAccount); successor != "" {
+					am.server.logger.Info("services", fmt.Sprintf("Channel %s transferred to successor %s after founder %s was unregistered", channelName, successor, casefoldedAccount))
+					continue
+				}
+			}
 			err := am.server.channels.SetUnregistered(channelName, casefoldedAccount)
 			if err != nil {
 				am.server.logger.Error("internal", "couldn't unregister channel", channelName, err.Error())
 			}
 		}
+		// drop the account's amodes on channels registered to others
+		for _, channel := range am.server.channels.Channels() {
+			channel.RemoveAccountAmode(casefoldedAccount)
+		}
 	}()
 
 	var credText string
@@ -1767,6 +1963,14 @@ func (am *AccountManager) Unregister(account string, erase bool) error {
 	var accountName string
 	var channelsStr string
 	keepProtections := false
+	if erase {
+		// erasing an account also deletes the messages it sent
+		defer func() {
+			if accountName != "" {
+				am.server.ForgetHistory(accountName)
+			}
+		}()
+	}
 	am.server.store.Update(func(tx *buntdb.Tx) error {
 		// get the unfolded account name; for an active account, this is
 		// stored under accountNameKey, for an unregistered account under unregisteredKey
@@ -1797,8 +2001,16 @@ func (am *AccountManager) Unregister(account string, erase bool) error {
 		tx.Delete(channelsKey)
 		tx.Delete(joinedChannelsKey)
 		tx.Delete(lastSeenKey)
+		tx.Delete(lastConnectedKey)
+		tx.Delete(lastQuitKey)
+		tx.Delete(expiryWarningKey)
+		tx.Delete(memosKey)
+		tx.Delete(memoIgnoresKey)
+		tx.Delete(departedChannelsKey)
 		tx.Delete(modesKey)
 		tx.Delete(realnameKey)
+		tx.Delete(awayMessageKey)
+		tx.Delete(metadataKey)
 		tx.Delete(suspendedKey)
 		tx.Delete(pwResetKey)
 		tx.Delete(emailChangeKey)
@@ -1911,17 +2123,7 @@ func (am *AccountManager) AuthenticateByCertificate(client *Client, certfp strin
 		}
 	}
 
-	var account string
-	certFPKey := fmt.Sprintf(keyCertToAccount, certfp)
-
-	err = am.server.store.View(func(tx *buntdb.Tx) error {
-		account, _ = tx.Get(certFPKey)
-		if account == "" {
-			return errAccountInvalidCredentials
-		}
-		return nil
-	})
-
+	account, err := am.AccountForCertfp(certfp)
 	if err != nil {
 		return err
 	}
@@ -1935,6 +2137,20 @@ func (am *AccountManager) AuthenticateByCertificate(client *Client, certfp strin
 	return err
 }
 
+// AccountForCertfp returns the account that the certificate fingerprint
+// has been added to, if any.
+func (am *AccountManager) AccountForCertfp(certfp string) (account string, err error) {
+	certFPKey := fmt.Sprintf(keyCertToAccount, certfp)
+	err = am.server.store.View(func(tx *buntdb.Tx) error {
+		account, _ = tx.Get(certFPKey)
+		if account == "" {
+			return errAccountInvalidCredentials
+		}
+		return nil
+	})
+	return
+}
+
 type settingsMunger func(input AccountSettings) (output AccountSettings, err error)
 
 func (am *AccountManager) ModifyAccountSettings(account string, munger settingsMunger) (newSettings AccountSettings, err error) {
@@ -2061,7 +2277,8 @@ func (am *AccountManager) performVHostChange(account string, munger vhostMunger)
 func (am *AccountManager) applyVHostInfo(client *Client, info VHostInfo) {
 	// if hostserv is disabled in config, then don't grant vhosts
 	// that were previously approved while it was enabled
-	if !am.server.Config().Accounts.VHosts.Enabled {
+	config := am.server.Config()
+	if !config.Accounts.VHosts.Enabled {
 		return
 	}
 
@@ -2069,6 +2286,9 @@ func (am *AccountManager) applyVHostInfo(client *Client, info VHostInfo) {
 	if info.Enabled {
 		vhost = info.ApprovedVHost
 	}
+	if vhost == "" {
+		vhost = config.Accounts.VHosts.autoVHost(client.AccountName())
+	}
 	oldNickmask := client.NickMaskString()
 	updated := client.SetVHost(vhost)
 	if updated && client.Registered() {
@@ -2088,24 +2308,30 @@ func (am *AccountManager) applyVhostToClients(account string, result VHostInfo)
 }
 
 func (am *AccountManager) Login(client *Client, account ClientAccount) {
+	// SASL reauthentication: leave the previous account first
+	am.Logout(client)
 	client.Login(account)
 
 	am.applyVHostInfo(client, account.VHost)
+	am.applyMetadata(client, account.NameCasefolded)
 
 	casefoldedAccount := client.Account()
+	am.saveLastConnected(casefoldedAccount)
+
 	am.Lock()
 	defer am.Unlock()
 	am.accountToClients[casefoldedAccount] = append(am.accountToClients[casefoldedAccount], client)
 }
 
 func (am *AccountManager) Logout(client *Client) {
-	am.Lock()
-	defer am.Unlock()
-
 	casefoldedAccount := client.Account()
 	if casefoldedAccount == "" {
 		return
 	}
+	am.saveLastConnected(casefoldedAccount)
+
+	am.Lock()
+	defer am.Unlock()
 
 	client.Logout()
 
@@ -2311,6 +2537,40 @@ func replayJoinsSettingFromString(str string) (result ReplayJoinsSetting, err er
 	return
 }
 
+// controls who may send direct messages to the user
+type DMPolicy uint
+
+const (
+	DMPolicyAnyone        DMPolicy = iota // no restrictions
+	DMPolicyRegistered                    // sender must be logged into an account
+	DMPolicySharedChannel                 // sender must share a channel with the user
+)
+
+func dmPolicyFromString(str string) (result DMPolicy, err error) {
+	switch strings.ToLower(str) {
+	case "anyone", "default":
+		result = DMPolicyAnyone
+	case "registered":
+		result = DMPolicyRegistered
+	case "shared-channel":
+		result = DMPolicySharedChannel
+	default:
+		err = errInvalidParams
+	}
+	return
+}
+
+func dmPolicyToString(policy DMPolicy) string {
+	switch policy {
+	case DMPolicyRegistered:
+		return "registered"
+	case DMPolicySharedChannel:
+		return "shared-channel"
+	default:
+		return "anyone"
+	}
+}
+
 // XXX: AllowBouncer cannot be renamed AllowMulticlient because it is stored in
 // persistent JSON blobs in the database
 type AccountSettings struct {
@@ -2323,6 +2583,11 @@ type AccountSettings struct {
 	DMHistory        HistoryStatus
 	AutoAway         PersistentStatus
 	Email            string
+	DMPolicy         DMPolicy
+	HideLastSeen     bool
+	IdleAway         time.Duration
+	Silence          []string // SILENCE masks, canonicalized
+	LoginNotifyEmail bool
 }
 
 // ClientAccount represents a user account.
@@ -2337,6 +2602,13 @@ type ClientAccount struct {
 	AdditionalNicks []string
 	VHost           VHostInfo
 	Settings        AccountSettings
+	LastConnected   time.Time // zero if unknown
+}
+
+// lastConnectedVisibleTo returns whether `client` may see when the account was
+// last connected; users can hide this, except from themselves and operators
+func (account *ClientAccount) lastConnectedVisibleTo(client *Client) bool {
+	return !account.Settings.HideLastSeen || client.Account() == account.NameCasefolded || client.HasRoleCapabs("accreg")
 }
 
 // convenience for passing around raw serialized account data
@@ -2349,4 +2621,5 @@ type rawClientAccount struct {
 	VHost           string
 	Settings        string
 	Suspended       string
+	LastConnected   string
 }
@@ -0,0 +1,61 @@
+// Copyright (c) 2021 Shivaram Lingamneni <slingamn@cs.stanford.edu>
+// released under the MIT license
+
+package irc
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ergochat/irc-go/ircmsg"
+)
+
+// a command alias turns a short command into a PRIVMSG, typically to a
+// service or bot: with the alias `ID: "NickServ IDENTIFY"`, the command
+// `ID hunter2` is handled as `PRIVMSG NickServ :IDENTIFY hunter2`.
+type commandAlias struct {
+	target string
+	prefix string
+}
+
+// parseCommandAliases validates the `command-aliases` config section
+func parseCommandAliases(config map[string]string) (result map[string]commandAlias, err error) {
+	if len(config) == 0 {
+		return nil, nil
+	}
+	result = make(map[string]commandAlias, len(config))
+	for name, expansion := range config {
+		name = strings.ToUpper(name)
+		if name == "" || strings.ContainsAny(name, " :") {
+			return nil, fmt.Errorf("invalid command alias name: `%s`", name)
+		}
+		if _, ok := Commands[name]; ok {
+			return nil, fmt.Errorf("command alias %s conflicts with an existing command", name)
+		}
+		fields := strings.Fields(expansion)
+		if len(fields) == 0 {
+			return nil, fmt.Errorf("command alias %s has no target", name)
+		}
+		result[name] = commandAlias{
+			target: fields[0],
+			prefix: strings.Join(fields[1:], " "),
+		}
+	}
+	return
+}
+
+// expand rewrites a message sent with this alias into the equivalent PRIVMSG
+func (alias commandAlias) expand(msg ircmsg.Message) (result ircmsg.Message) {
+	text := strings.Join(msg.Params, " ")
+	if alias.prefix != "" {
+		if text != "" {
+			text = alias.prefix + " " + text
+		} else {
+			text = alias.prefix
+		}
+	}
+	result = msg
+	result.Command = "PRIVMSG"
+	result.Params = []string{alias.target, text}
+	return
+}
@@ -0,0 +1,45 @@
+// Copyright (c) 2021 Shivaram Lingamneni <slingamn@cs.stanford.edu>
+// released under the MIT license
+
+package irc
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ergochat/irc-go/ircmsg"
+)
+
+func TestParseCommandAliases(t *testing.T) {
+	aliases, err := parseCommandAliases(map[string]string{
+		"id": "NickServ  IDENTIFY",
+		"OS": "OperServ",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(aliases["ID"], commandAlias{target: "NickServ", prefix: "IDENTIFY"}, t)
+	assertEqual(aliases["OS"], commandAlias{target: "OperServ"}, t)
+
+	if _, err := parseCommandAliases(map[string]string{"privmsg": "NickServ"}); err == nil {
+		t.Errorf("alias shadowing a built-in command should be rejected")
+	}
+	if _, err := parseCommandAliases(map[string]string{"ID": " "}); err == nil {
+		t.Errorf("alias without a target should be rejected")
+	}
+}
+
+func TestExpandCommandAlias(t *testing.T) {
+	alias := commandAlias{target: "NickServ", prefix: "IDENTIFY"}
+	msg := ircmsg.MakeMessage(nil, "", "ID", "alice", "hunter2")
+	expanded := alias.expand(msg)
+	assertEqual(expanded.Command, "PRIVMSG", t)
+	if !reflect.DeepEqual(expanded.Params, []string{"NickServ", "IDENTIFY alice hunter2"}) {
+		t.Errorf("bad expansion: %#v", expanded.Params)
+	}
+
+	expanded = commandAlias{target: "OperServ"}.expand(ircmsg.MakeMessage(nil, "", "OS", "HELP"))
+	if !reflect.DeepEqual(expanded.Params, []string{"OperServ", "HELP"}) {
+		t.Errorf("bad expansion: %#v", expanded.Params)
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright (c) 2021 Shivaram Lingamneni <slingamn@cs.stanford.edu>
+// released under the MIT license
+
+package irc
+
+import (
+	"sync"
+	"time"
+)
+
+// automatic replies are replies generated on a user's behalf, rather than
+// at their explicit request: RPL_AWAY in response to a message or INVITE,
+// and the CTCP responses of the services. All of them go through
+// AutoReplyLimiter, which enforces two rules:
+// 1. never reply automatically to a NOTICE (as per RFC 1459, this is what
+//    prevents two automated clients from getting stuck in a reply loop)
+// 2. send at most one reply of each kind per interval, for each pair of
+//    (client that triggered it, client or service on whose behalf it is sent)
+
+const (
+	autoReplyInterval = 30 * time.Second
+	// above this many entries, expired entries are purged on insertion
+	autoReplyPurgeThreshold = 1024
+)
+
+type autoReplyKind uint
+
+const (
+	autoReplyAway autoReplyKind = iota
+	autoReplyCTCP
+)
+
+type autoReplyKey struct {
+	kind      autoReplyKind
+	source    string // casefolded nick of the client the reply is sent to
+	recipient string // casefolded name of the client or service replying
+}
+
+type AutoReplyLimiter struct {
+	sync.Mutex // tier 1
+
+	lastReply map[autoReplyKey]time.Time
+}
+
+func (arl *AutoReplyLimiter) Initialize() {
+	arl.lastReply = make(map[autoReplyKey]time.Time)
+}
+
+// Allow decides whether an automatic reply of type `kind` may be sent
+// to `source`, who sent `command` to `recipient`.
+func (arl *AutoReplyLimiter) Allow(kind autoReplyKind, command, source, recipient string) bool {
+	if command == "NOTICE" {
+		return false
+	}
+	return arl.allow(kind, source, recipient, time.Now())
+}
+
+func (arl *AutoReplyLimiter) allow(kind autoReplyKind, source, recipient string, now time.Time) bool {
+	key := autoReplyKey{kind: kind, source: source, recipient: recipient}
+
+	arl.Lock()
+	defer arl.Unlock()
+
+	if last, ok := arl.lastReply[key]; ok && now.Sub(last) < autoReplyInterval {
+		return false
+	}
+	if autoReplyPurgeThreshold <= len(arl.lastReply) {
+		for k, last := range arl.lastReply {
+			if autoReplyInterval <= now.Sub(last) {
+				delete(arl.lastReply, k)
+			}
+		}
+	}
+	arl.lastReply[key] = now
+	return true
+}
+
+// addAwayReply sends RPL_AWAY to the client that sent `command` to `target`,
+// if the target is away and the auto-reply policy allows it.
+func addAwayReply(rb *ResponseBuffer, command string, client, target *Client) {
+	away, awayMessage := target.Away()
+	if !away {
+		return
+	}
+	if !client.server.autoReplies.Allow(autoReplyAway, command, client.NickCasefolded(), target.NickCasefolded()) {
+		return
+	}
+	rb.Add(nil, client.server.name, RPL_AWAY, client.Nick(), target.Nick(), awayMessage)
+}
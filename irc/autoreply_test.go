@@ -0,0 +1,27 @@
+// Copyright (c) 2021 Shivaram Lingamneni <slingamn@cs.stanford.edu>
+// released under the MIT license
+
+package irc
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAutoReplyLimiter(t *testing.T) {
+	var arl AutoReplyLimiter
+	arl.Initialize()
+
+	if arl.Allow(autoReplyAway, "NOTICE", "alice", "bob") {
+		t.Error("automatic replies to NOTICE must never be allowed")
+	}
+
+	now := time.Now()
+	assertEqual(arl.allow(autoReplyAway, "alice", "bob", now), true, t)
+	assertEqual(arl.allow(autoReplyAway, "alice", "bob", now.Add(time.Second)), false, t)
+	// other pairs and other kinds of reply are tracked separately:
+	assertEqual(arl.allow(autoReplyAway, "bob", "alice", now), true, t)
+	assertEqual(arl.allow(autoReplyAway, "carol", "bob", now), true, t)
+	assertEqual(arl.allow(autoReplyCTCP, "alice", "bob", now), true, t)
+	assertEqual(arl.allow(autoReplyAway, "alice", "bob", now.Add(autoReplyInterval)), true, t)
+}
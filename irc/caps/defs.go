@@ -7,7 +7,7 @@ package caps
 
 const (
 	// number of recognized capabilities:
-	numCapabs = 28
+	numCapabs = 30
 	// length of the uint64 array that represents the bitset:
 	bitsetLen = 1
 )
@@ -61,6 +61,14 @@ const (
 	// https://gist.github.com/DanielOaks/8126122f74b26012a3de37db80e4e0c6
 	Languages Capability = iota
 
+	// MessageRedaction is the draft IRCv3 capability named "draft/message-redaction":
+	// https://github.com/ircv3/ircv3-specifications/pull/524
+	MessageRedaction Capability = iota
+
+	// Metadata is the draft IRCv3 capability named "draft/metadata-2":
+	// https://github.com/ircv3/ircv3-specifications/pull/501
+	Metadata Capability = iota
+
 	// Multiline is the proposed IRCv3 capability named "draft/multiline":
 	// https://github.com/ircv3/ircv3-specifications/pull/398
 	Multiline Capability = iota
@@ -141,6 +149,8 @@ var (
 		"draft/event-playback",
 		"draft/extended-monitor",
 		"draft/languages",
+		"draft/message-redaction",
+		"draft/metadata-2",
 		"draft/multiline",
 		"draft/relaymsg",
 		"echo-message",
@@ -0,0 +1,182 @@
+// Copyright (c) 2021 Shivaram Lingamneni <slingamn@cs.stanford.edu>
+// released under the MIT license
+
+package irc
+
+import (
+	"fmt"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tidwall/buntdb"
+
+	"github.com/ergochat/ergo/irc/email"
+	"github.com/ergochat/ergo/irc/sno"
+)
+
+// a founder can designate a successor account for a registered channel
+// (CS SET SUCCESSOR), which takes over the channel instead of it being
+// dropped, if the founder's account is unregistered or if the registration
+// expires. registrations expire when the founder hasn't connected for
+// channels.registration.expiration.founder-inactivity; founders with an
+// e-mail address are warned some time in advance.
+
+const (
+	channelExpirationPollPeriod = time.Hour
+)
+
+// transferToSuccessor makes the designated successor the founder of the
+// channel, if `founder` is still the founder and the successor is valid.
+// it returns the successor, or the empty string if there was none.
+func (channel *Channel) transferToSuccessor(founder string) (successor string) {
+	settings := channel.Settings()
+	if settings.Successor == "" || settings.Successor == founder {
+		return ""
+	}
+	account, err := channel.server.accounts.LoadAccount(settings.Successor)
+	if err != nil || !account.Verified || account.Suspended != nil {
+		return ""
+	}
+
+	channel.stateMutex.Lock()
+	if channel.registeredFounder != founder {
+		channel.stateMutex.Unlock()
+		return ""
+	}
+	channel.transferOwnership(account.NameCasefolded)
+	channel.stateMutex.Unlock()
+
+	channel.Store(IncludeAllAttrs)
+	return account.NameCasefolded
+}
+
+func (server *Server) handleChannelExpirations() {
+	defer func() {
+		if r := recover(); r != nil {
+			server.logger.Error("internal",
+				fmt.Sprintf("Panic in channel expiration: %v\n%s", r, debug.Stack()))
+		}
+		// either way, reschedule
+		time.AfterFunc(channelExpirationPollPeriod, server.handleChannelExpirations)
+	}()
+
+	config := server.Config()
+	expiration := time.Duration(config.Channels.Registration.Expiration.FounderInactivity)
+	if expiration == 0 || !config.Channels.Registration.Enabled {
+		return
+	}
+	warningPeriod := time.Duration(config.Channels.Registration.Expiration.WarningPeriod)
+
+	founderToChannels := make(map[string][]*Channel)
+	for _, channel := range server.channels.Channels() {
+		if founder := channel.Founder(); founder != "" {
+			founderToChannels[founder] = append(founderToChannels[founder], channel)
+		}
+	}
+
+	server.logger.Info("services", "Checking registered channels for expiration")
+	for founder, channels := range founderToChannels {
+		if len(server.accounts.AccountToClients(founder)) != 0 {
+			continue // currently connected
+		}
+		account, err := server.accounts.LoadAccount(founder)
+		if err != nil {
+			continue
+		}
+		if account.LastConnected.IsZero() {
+			// no record, e.g., the founder hasn't connected since this was
+			// first tracked; start counting from now
+			server.accounts.saveLastConnected(founder)
+			continue
+		}
+		inactive := time.Since(account.LastConnected)
+		if expiration <= inactive {
+			for _, channel := range channels {
+				server.expireChannel(channel, founder)
+			}
+		} else if warningPeriod != 0 && expiration-warningPeriod <= inactive {
+			server.accounts.sendChannelExpiryWarning(account, channels, account.LastConnected.Add(expiration))
+		}
+	}
+}
+
+// expireChannel hands the channel to its successor, or failing that,
+// unregisters it
+func (server *Server) expireChannel(channel *Channel, founder string) {
+	chname := channel.Name()
+	if successor := channel.transferToSuccessor(founder); successor != "" {
+		message := fmt.Sprintf("Channel %s transferred to successor %s because founder %s was inactive", chname, successor, founder)
+		server.logger.Info("services", message)
+		server.snomasks.Send(sno.LocalChannels, message)
+		return
+	}
+	if err := server.channels.SetUnregistered(chname, founder); err != nil {
+		server.logger.Error("internal", "couldn't expire channel registration", chname, err.Error())
+		return
+	}
+	message := fmt.Sprintf("Channel %s unregistered because founder %s was inactive", chname, founder)
+	server.logger.Info("services", message)
+	server.snomasks.Send(sno.LocalChannels, message)
+}
+
+// sendChannelExpiryWarning warns the founder (by memo and e-mail) that their
+// channels are about to expire, at most once per period of inactivity
+func (am *AccountManager) sendChannelExpiryWarning(account ClientAccount, channels []*Channel, expiresAt time.Time) {
+	config := am.server.Config()
+	emailConfig := config.Accounts.Registration.EmailVerification
+	sendMemo := memoservEnabled(config)
+	sendEmail := emailConfig.Enabled && account.Settings.Email != ""
+	if !sendMemo && !sendEmail {
+		return
+	}
+
+	key := fmt.Sprintf(keyAccountChannelExpiryWarning, account.NameCasefolded)
+	val := strconv.FormatInt(account.LastConnected.UnixNano(), 10)
+	alreadySent := false
+	am.server.store.Update(func(tx *buntdb.Tx) error {
+		if existing, err := tx.Get(key); err == nil && existing == val {
+			alreadySent = true
+		} else {
+			tx.Set(key, val, nil)
+		}
+		return nil
+	})
+	if alreadySent {
+		return
+	}
+
+	chnames := make([]string, len(channels))
+	for i, channel := range channels {
+		chnames[i] = channel.Name()
+	}
+	sort.Strings(chnames)
+
+	if sendMemo {
+		text := fmt.Sprintf("Unless you reconnect before %s, your registrations of these channels will expire: %s", expiresAt.Format(time.RFC1123), strings.Join(chnames, ", "))
+		if _, _, err := am.SendMemo("", "ChanServ", account.NameCasefolded, text); err != nil {
+			am.server.logger.Info("services", fmt.Sprintf("Couldn't send channel expiration memo to %s: %v", account.Name, err))
+		}
+	}
+	if !sendEmail {
+		return
+	}
+
+	subject := fmt.Sprintf("Your channel registrations on %s will expire soon", am.server.name)
+	message := email.ComposeMail(emailConfig, account.Settings.Email, subject)
+	fmt.Fprintf(&message, "You haven't connected to %s with account %s since %s.\r\n", am.server.name, account.Name, account.LastConnected.Format(time.RFC1123))
+	fmt.Fprintf(&message, "Unless you reconnect before %s, your registrations of the following channels will expire:\r\n", expiresAt.Format(time.RFC1123))
+	message.WriteString("\r\n")
+	message.WriteString(strings.Join(chnames, "\r\n"))
+	message.WriteString("\r\n")
+	message.WriteString("\r\n")
+	message.WriteString("Channels with a designated successor (/CS SET #channel SUCCESSOR) will be transferred to it instead.\r\n")
+
+	if err := email.SendMail(emailConfig, account.Settings.Email, message.Bytes()); err != nil {
+		am.server.logger.Error("internal", "Failed to dispatch channel expiration warning to", account.Settings.Email, err.Error())
+	} else {
+		am.server.logger.Info("services", "sent channel expiration warning for account", account.Name)
+	}
+}
@@ -10,12 +10,15 @@ import (
 	"strconv"
 	"strings"
 	"time"
+	"unicode"
 
 	"sync"
 
+	"github.com/ergochat/irc-go/ircfmt"
 	"github.com/ergochat/irc-go/ircutils"
 
 	"github.com/ergochat/ergo/irc/caps"
+	"github.com/ergochat/ergo/irc/connection_limits"
 	"github.com/ergochat/ergo/irc/history"
 	"github.com/ergochat/ergo/irc/modes"
 	"github.com/ergochat/ergo/irc/utils"
@@ -24,6 +27,18 @@ import (
 type ChannelSettings struct {
 	History     HistoryStatus
 	QueryCutoff HistoryCutoff
+	// casefolded account that inherits the channel if the founder's account
+	// is unregistered, or the registration expires:
+	Successor string `json:",omitempty"`
+	// whether quit, part, and kick messages are filtered (see reasonfilter.go):
+	ReasonFilter PersistentStatus `json:",omitempty"`
+	// how long manually granted +o lasts (see opexpiry.go); 0 for no limit:
+	OpExpiry time.Duration `json:",omitempty"`
+	// public information about the channel, shown by CS INFO; the URL
+	// is also sent to joining users, as is the entry message:
+	URL          string `json:",omitempty"`
+	Description  string `json:",omitempty"`
+	EntryMessage string `json:",omitempty"`
 }
 
 // Channel represents a channel that clients can join.
@@ -32,6 +47,9 @@ type Channel struct {
 	lists             map[modes.Mode]*UserMaskSet
 	key               string
 	forward           string
+	joinThrottle      connection_limits.GenericThrottle // +j; a Limit of 0 disables it
+	repeatLimit       connection_limits.GenericThrottle // +K; a Limit of 0 disables it
+	slowMode          time.Duration                     // +S; 0 disables it
 	members           MemberSet
 	membersCache      []*Client // allow iteration over channel members without holding the lock
 	name              string
@@ -44,15 +62,21 @@ type Channel struct {
 	topic             string
 	topicSetBy        string
 	topicSetTime      time.Time
+	topicHistory      []TopicHistoryEntry
+	lockdownTimer     *time.Timer // set while CS LOCKDOWN is in effect
+	lockdownUntil     time.Time
+	lockdownSerial    uint64 // identifies the lockdown in effect, see armLockdown
 	userLimit         int
 	accountToUMode    map[string]modes.Mode
 	history           history.Buffer
 	stateMutex        sync.RWMutex    // tier 1
 	writerSemaphore   utils.Semaphore // tier 1.5
 	joinPartMutex     sync.Mutex      // tier 3
+	modeMutex         sync.Mutex      // tier 3; serializes MODE commands
 	ensureLoaded      utils.Once      // manages loading stored registration info from the database
 	dirtyBits         uint
 	settings          ChannelSettings
+	metadata          map[string]string
 }
 
 // NewChannel creates a new channel from a `Server` and a `name`
@@ -132,22 +156,32 @@ func (channel *Channel) applyRegInfo(chanReg RegisteredChannel) {
 	channel.topic = chanReg.Topic
 	channel.topicSetBy = chanReg.TopicSetBy
 	channel.topicSetTime = chanReg.TopicSetTime
+	channel.topicHistory = chanReg.TopicHistory
 	channel.name = chanReg.Name
 	channel.createdTime = chanReg.RegisteredAt
 	channel.key = chanReg.Key
 	channel.userLimit = chanReg.UserLimit
 	channel.settings = chanReg.Settings
 	channel.forward = chanReg.Forward
+	channel.joinThrottle.Limit, channel.joinThrottle.Duration, _ = parseJoinThrottle(chanReg.JoinThrottle)
+	channel.repeatLimit.Limit, channel.repeatLimit.Duration, _ = parseRepeatLimit(chanReg.RepeatLimit)
+	channel.slowMode, _ = parseSlowMode(chanReg.SlowMode)
 
 	for _, mode := range chanReg.Modes {
 		channel.flags.SetMode(mode, true)
 	}
+	if !chanReg.LockdownUntil.IsZero() {
+		// resume a CS LOCKDOWN that was in progress (if it has already
+		// expired, this lifts it right away)
+		channel.armLockdown(chanReg.LockdownUntil, chanservService.prefix)
+	}
 	for account, mode := range chanReg.AccountToUMode {
 		channel.accountToUMode[account] = mode
 	}
 	channel.lists[modes.BanMask].SetMasks(chanReg.Bans)
 	channel.lists[modes.InviteMask].SetMasks(chanReg.Invites)
 	channel.lists[modes.ExceptMask].SetMasks(chanReg.Excepts)
+	channel.metadata = chanReg.Metadata
 }
 
 // obtain a consistent snapshot of the channel state that can be persisted to the DB
@@ -164,6 +198,8 @@ func (channel *Channel) ExportRegistration(includeFlags uint) (info RegisteredCh
 		info.Topic = channel.topic
 		info.TopicSetBy = channel.topicSetBy
 		info.TopicSetTime = channel.topicSetTime
+		info.TopicHistory = make([]TopicHistoryEntry, len(channel.topicHistory))
+		copy(info.TopicHistory, channel.topicHistory)
 	}
 
 	if includeFlags&IncludeModes != 0 {
@@ -171,6 +207,10 @@ func (channel *Channel) ExportRegistration(includeFlags uint) (info RegisteredCh
 		info.Forward = channel.forward
 		info.Modes = channel.flags.AllModes()
 		info.UserLimit = channel.userLimit
+		info.JoinThrottle = channel.joinThrottleString()
+		info.RepeatLimit = channel.repeatLimitString()
+		info.SlowMode = channel.slowModeString()
+		info.LockdownUntil = channel.lockdownUntil
 	}
 
 	if includeFlags&IncludeLists != 0 {
@@ -187,6 +227,10 @@ func (channel *Channel) ExportRegistration(includeFlags uint) (info RegisteredCh
 		info.Settings = channel.settings
 	}
 
+	if includeFlags&IncludeMetadata != 0 {
+		info.Metadata = copyMetadata(channel.metadata)
+	}
+
 	return
 }
 
@@ -207,6 +251,19 @@ func (channel *Channel) MarkDirty(dirtyBits uint) {
 	channel.wakeWriter()
 }
 
+// RemoveAccountAmode drops the persistent channel mode (amode) of an account,
+// e.g., because the account was unregistered
+func (channel *Channel) RemoveAccountAmode(account string) {
+	channel.stateMutex.Lock()
+	_, present := channel.accountToUMode[account]
+	delete(channel.accountToUMode, account)
+	channel.stateMutex.Unlock()
+
+	if present {
+		channel.MarkDirty(IncludeLists)
+	}
+}
+
 // IsClean returns whether a channel can be safely removed from the server.
 // To avoid the obvious TOCTOU race condition, it must be called while holding
 // ChannelManager's lock (that way, no one can join and make the channel dirty again
@@ -398,6 +455,9 @@ func (channel *Channel) transferOwnership(newOwner string) {
 	channel.registeredFounder = newOwner
 	channel.accountToUMode[channel.registeredFounder] = modes.ChannelFounder
 	channel.transferPendingTo = ""
+	if channel.settings.Successor == newOwner {
+		channel.settings.Successor = ""
+	}
 }
 
 // AcceptTransfer implements `CS TRANSFER #chan ACCEPT`
@@ -618,6 +678,9 @@ func (channel *Channel) modeStrings(client *Client) (result []string) {
 	showKey := isMember && (channel.key != "")
 	showUserLimit := channel.userLimit > 0
 	showForward := channel.forward != ""
+	showJoinThrottle := channel.joinThrottle.Limit != 0
+	showRepeatLimit := channel.repeatLimit.Limit != 0
+	showSlowMode := channel.slowMode != 0
 
 	var mods strings.Builder
 	mods.WriteRune('+')
@@ -632,6 +695,15 @@ func (channel *Channel) modeStrings(client *Client) (result []string) {
 	if showForward {
 		mods.WriteRune(rune(modes.Forward))
 	}
+	if showJoinThrottle {
+		mods.WriteRune(rune(modes.JoinThrottle))
+	}
+	if showRepeatLimit {
+		mods.WriteRune(rune(modes.RepeatLimit))
+	}
+	if showSlowMode {
+		mods.WriteRune(rune(modes.SlowMode))
+	}
 
 	for _, m := range channel.flags.AllModes() {
 		mods.WriteRune(rune(m))
@@ -650,10 +722,236 @@ func (channel *Channel) modeStrings(client *Client) (result []string) {
 	if showForward {
 		result = append(result, channel.forward)
 	}
+	if showJoinThrottle {
+		result = append(result, channel.joinThrottleString())
+	}
+	if showRepeatLimit {
+		result = append(result, channel.repeatLimitString())
+	}
+	if showSlowMode {
+		result = append(result, channel.slowModeString())
+	}
 
 	return
 }
 
+// parseJoinThrottle parses a +j parameter, `joins:seconds`
+// (the +K parameter, `lines:seconds`, has the same format)
+func parseJoinThrottle(param string) (limit int, duration time.Duration, err error) {
+	colonIndex := strings.IndexByte(param, ':')
+	if colonIndex == -1 {
+		return 0, 0, errInvalidParams
+	}
+	limit, err = strconv.Atoi(param[:colonIndex])
+	if err != nil || limit <= 0 {
+		return 0, 0, errInvalidParams
+	}
+	seconds, err := strconv.Atoi(param[colonIndex+1:])
+	if err != nil || seconds <= 0 {
+		return 0, 0, errInvalidParams
+	}
+	return limit, time.Duration(seconds) * time.Second, nil
+}
+
+// joinThrottleString returns the +j parameter; call with the state mutex held
+func (channel *Channel) joinThrottleString() string {
+	if channel.joinThrottle.Limit == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%d:%d", channel.joinThrottle.Limit, int(channel.joinThrottle.Duration/time.Second))
+}
+
+func (channel *Channel) setJoinThrottle(limit int, duration time.Duration) {
+	channel.stateMutex.Lock()
+	defer channel.stateMutex.Unlock()
+	channel.joinThrottle = connection_limits.GenericThrottle{
+		Limit:    limit,
+		Duration: duration,
+	}
+}
+
+// checkJoinThrottle records a join against the +j limit, returning
+// whether the join should be refused
+func (channel *Channel) checkJoinThrottle() (throttled bool) {
+	channel.stateMutex.Lock()
+	defer channel.stateMutex.Unlock()
+	throttled, _ = channel.joinThrottle.Touch()
+	return
+}
+
+// parseRepeatLimit parses a +K parameter, `lines:seconds`: the number of times
+// the same message may be sent, and the window within which it is counted
+func parseRepeatLimit(param string) (lines int, duration time.Duration, err error) {
+	colonIndex := strings.IndexByte(param, ':')
+	if colonIndex == -1 {
+		return 0, 0, errInvalidParams
+	}
+	lines, err = strconv.Atoi(param[:colonIndex])
+	if err != nil || lines <= 0 {
+		return 0, 0, errInvalidParams
+	}
+	seconds, err := strconv.Atoi(param[colonIndex+1:])
+	if err != nil || seconds <= 0 {
+		return 0, 0, errInvalidParams
+	}
+	return lines, time.Duration(seconds) * time.Second, nil
+}
+
+// repeatLimitString returns the +K parameter; call with the state mutex held
+func (channel *Channel) repeatLimitString() string {
+	if channel.repeatLimit.Limit == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%d:%d", channel.repeatLimit.Limit, int(channel.repeatLimit.Duration/time.Second))
+}
+
+func (channel *Channel) setRepeatLimit(limit int, duration time.Duration) {
+	channel.stateMutex.Lock()
+	defer channel.stateMutex.Unlock()
+	channel.repeatLimit = connection_limits.GenericThrottle{
+		Limit:    limit,
+		Duration: duration,
+	}
+}
+
+// repeatState tracks the messages a channel member has recently repeated,
+// for enforcing +K
+type repeatState struct {
+	lastMessage string
+	count       int
+	windowStart time.Time
+	mutedUntil  time.Time
+}
+
+// normalizeRepeatedMessage reduces a message to its letters and digits, so that
+// changes to formatting, case, spacing or punctuation don't evade +K. a message
+// with no letters or digits (e.g., only punctuation or emoji) is reduced to
+// everything but its whitespace instead, so that it's still counted.
+func normalizeRepeatedMessage(message string) string {
+	var buf strings.Builder
+	stripped := ircfmt.Strip(message)
+	for _, r := range stripped {
+		if unicode.IsLetter(r) || unicode.IsNumber(r) {
+			buf.WriteRune(unicode.ToLower(r))
+		}
+	}
+	if buf.Len() == 0 {
+		for _, r := range stripped {
+			if !unicode.IsSpace(r) {
+				buf.WriteRune(r)
+			}
+		}
+	}
+	return buf.String()
+}
+
+// check records a message, returning whether it should be refused. A client
+// that sends the same message more than `limit` times within `duration` is
+// muted for `duration`.
+func (rs *repeatState) check(message string, limit int, duration time.Duration, now time.Time) (muted bool) {
+	if now.Before(rs.mutedUntil) {
+		return true
+	}
+	if message == "" || message != rs.lastMessage || duration <= now.Sub(rs.windowStart) {
+		rs.lastMessage = message
+		rs.count = 1
+		rs.windowStart = now
+		return false
+	}
+	rs.count++
+	if limit < rs.count {
+		rs.lastMessage = ""
+		rs.count = 0
+		rs.mutedUntil = now.Add(duration)
+		return true
+	}
+	return false
+}
+
+// checkRepeatLimit records a message from a channel member against the +K limit,
+// returning whether it should be refused
+func (channel *Channel) checkRepeatLimit(client *Client, message utils.SplitMessage) (muted bool) {
+	var text string
+	if message.Is512() {
+		text = message.Message
+	} else {
+		var buf strings.Builder
+		for _, pair := range message.Split {
+			buf.WriteString(pair.Message)
+		}
+		text = buf.String()
+	}
+	text = normalizeRepeatedMessage(text)
+
+	channel.stateMutex.Lock()
+	defer channel.stateMutex.Unlock()
+	if channel.repeatLimit.Limit == 0 {
+		return false
+	}
+	memberData, ok := channel.members[client]
+	if !ok {
+		return false
+	}
+	// halfops and above are exempt
+	if highest := memberData.modes.HighestChannelUserMode(); highest == modes.Halfop || umodeGreaterThan(highest, modes.Halfop) {
+		return false
+	}
+	muted = memberData.repeats.check(text, channel.repeatLimit.Limit, channel.repeatLimit.Duration, time.Now())
+	channel.members[client] = memberData
+	return
+}
+
+// parseSlowMode parses a +S parameter, the minimum number of seconds
+// between messages
+func parseSlowMode(param string) (interval time.Duration, err error) {
+	seconds, err := strconv.Atoi(param)
+	if err != nil || seconds <= 0 {
+		return 0, errInvalidParams
+	}
+	return time.Duration(seconds) * time.Second, nil
+}
+
+// slowModeString returns the +S parameter; call with the state mutex held
+func (channel *Channel) slowModeString() string {
+	if channel.slowMode == 0 {
+		return ""
+	}
+	return strconv.Itoa(int(channel.slowMode / time.Second))
+}
+
+func (channel *Channel) setSlowMode(interval time.Duration) {
+	channel.stateMutex.Lock()
+	defer channel.stateMutex.Unlock()
+	channel.slowMode = interval
+}
+
+// checkSlowMode records a message from a channel member against the +S
+// interval (or channels.default-slow-mode, if +S is unset); if the message
+// should be refused, it returns how much longer the member has to wait
+func (channel *Channel) checkSlowMode(client *Client, config *Config) (wait time.Duration) {
+	now := time.Now()
+
+	channel.stateMutex.Lock()
+	defer channel.stateMutex.Unlock()
+	interval := channel.slowMode
+	if interval == 0 {
+		interval = time.Duration(config.Channels.DefaultSlowMode)
+	}
+	if interval == 0 {
+		return 0
+	}
+	memberData, ok := channel.members[client]
+	if !ok || memberData.modes.HighestChannelUserMode() != modes.Mode(0) {
+		return 0
+	}
+	if wait = memberData.lastMsg.Add(interval).Sub(now); 0 < wait {
+		return wait
+	}
+	memberData.lastMsg = now
+	channel.members[client] = memberData
+	return 0
+}
+
 func (channel *Channel) IsEmpty() bool {
 	channel.stateMutex.RLock()
 	defer channel.stateMutex.RUnlock()
@@ -757,7 +1055,7 @@ func (channel *Channel) Join(client *Client, key string, isSajoin bool, rb *Resp
 	// 3. people invited with INVITE can join
 	hasPrivs := isSajoin || (founder != "" && founder == details.account) ||
 		(persistentMode != 0 && persistentMode != modes.Voice) ||
-		client.CheckInvited(chcfname, createdAt)
+		channel.server.invites.Consume(chcfname, createdAt, client, time.Duration(channel.server.Config().Channels.InviteExpiration))
 	if !hasPrivs {
 		if limit != 0 && chcount >= limit {
 			return errLimitExceeded, forward
@@ -783,6 +1081,11 @@ func (channel *Channel) Join(client *Client, key string, isSajoin bool, rb *Resp
 			(channel.flags.HasMode(modes.RegisteredOnly) || channel.server.Defcon() <= 2) {
 			return errRegisteredOnly, forward
 		}
+
+		// this must be the last check, so that only successful joins are counted
+		if channel.checkJoinThrottle() {
+			return errJoinThrottled, forward
+		}
 	}
 
 	if joinErr := client.addChannel(channel, rb == nil); joinErr != nil {
@@ -886,12 +1189,14 @@ func (channel *Channel) Join(client *Client, key string, isSajoin bool, rb *Resp
 		// don't send topic and names for a SAJOIN of a different client
 		channel.SendTopic(client, rb, false)
 		channel.Names(client, rb)
+		channel.sendEntryInfo(client, rb)
 	} else {
 		// ensure that SAJOIN sends a MODE line to the originating client, if applicable
 		if givenMode != 0 {
 			rb.Add(nil, client.server.name, "MODE", chname, modestr, details.nick)
 		}
 	}
+	channel.syncJoinMetadata(client, rb)
 
 	// TODO #259 can be implemented as Flush(false) (i.e., nonblocking) while holding joinPartMutex
 	rb.Flush(true)
@@ -975,6 +1280,18 @@ func (channel *Channel) playJoinForSession(session *Session) {
 	sessionRb.Send(false)
 }
 
+// sendEntryInfo sends the channel URL and entry message (see CS SET) to a joining client
+func (channel *Channel) sendEntryInfo(client *Client, rb *ResponseBuffer) {
+	settings := channel.Settings()
+	chname := channel.Name()
+	if settings.URL != "" {
+		rb.Add(nil, client.server.name, RPL_CHANNEL_URL, client.Nick(), chname, settings.URL)
+	}
+	if settings.EntryMessage != "" {
+		rb.Add(nil, chanservService.prefix, "NOTICE", client.Nick(), fmt.Sprintf("[%s] %s", chname, settings.EntryMessage))
+	}
+}
+
 // Part parts the given client from this channel, with the given message.
 func (channel *Channel) Part(client *Client, message string, rb *ResponseBuffer) {
 	channel.stateMutex.RLock()
@@ -989,6 +1306,7 @@ func (channel *Channel) Part(client *Client, message string, rb *ResponseBuffer)
 
 	channel.Quit(client)
 
+	message = channel.filterReason(client.server.Config(), message)
 	splitMessage := utils.MakeMessage(message)
 
 	details := client.Details()
@@ -1182,22 +1500,34 @@ func (channel *Channel) SetTopic(client *Client, topic string, rb *ResponseBuffe
 		return
 	}
 
-	topic = ircutils.TruncateUTF8Safe(topic, client.server.Config().Limits.TopicLen)
+	channel.applyTopic(client, topic, rb)
+}
+
+// applyTopic sets the topic without any permission checks and announces it;
+// rb may be nil if the client isn't acting on the channel directly
+func (channel *Channel) applyTopic(client *Client, topic string, rb *ResponseBuffer) {
+	config := client.server.Config()
+	topic = ircutils.SanitizeText(topic, config.Limits.TopicLen)
+	details := client.Details()
 
 	channel.stateMutex.Lock()
 	chname := channel.name
+	channel.recordTopicReplacementNoMutex(config.Channels.Registration.TopicHistoryLength)
 	channel.topic = topic
-	channel.topicSetBy = client.nickMaskString
+	channel.topicSetBy = details.nickMask
 	channel.topicSetTime = time.Now().UTC()
 	channel.stateMutex.Unlock()
 
-	details := client.Details()
 	isBot := client.HasMode(modes.Bot)
 	message := utils.MakeMessage(topic)
-	rb.AddFromClient(message.Time, message.Msgid, details.nickMask, details.accountName, isBot, nil, "TOPIC", chname, topic)
+	var rbSession *Session
+	if rb != nil {
+		rb.AddFromClient(message.Time, message.Msgid, details.nickMask, details.accountName, isBot, nil, "TOPIC", chname, topic)
+		rbSession = rb.session
+	}
 	for _, member := range channel.Members() {
 		for _, session := range member.Sessions() {
-			if session != rb.session {
+			if session != rbSession {
 				session.sendFromClientInternal(false, message.Time, message.Msgid, details.nickMask, details.accountName, isBot, nil, "TOPIC", chname, topic)
 			}
 		}
@@ -1291,6 +1621,23 @@ func (channel *Channel) SendSplitMessage(command string, minPrefixMode modes.Mod
 		return
 	}
 
+	if histType != history.Tagmsg && channel.checkRepeatLimit(client, message) {
+		if histType != history.Notice {
+			rb.Add(nil, client.server.name, ERR_CANNOTSENDTOCHAN, client.Nick(), channel.Name(), fmt.Sprintf(client.t("Cannot send to channel (+%s)"), "K"))
+		}
+		return
+	}
+
+	if histType != history.Tagmsg {
+		if wait := channel.checkSlowMode(client, client.server.Config()); wait != 0 {
+			if histType != history.Notice {
+				seconds := int((wait + time.Second - 1) / time.Second)
+				rb.Add(nil, client.server.name, ERR_CANNOTSENDTOCHAN, client.Nick(), channel.Name(), fmt.Sprintf(client.t("Cannot send to channel (+%[1]s): slow mode is enabled, you can speak again in %[2]d seconds"), "S", seconds))
+			}
+			return
+		}
+	}
+
 	details := client.Details()
 	isBot := client.HasMode(modes.Bot)
 	chname := channel.Name()
@@ -1383,6 +1730,22 @@ func (channel *Channel) applyModeToMember(client *Client, change modes.ModeChang
 	return
 }
 
+// applyAmodes grants a client that logged in after joining channels its
+// persistent channel modes (AMODE) in those channels
+func (client *Client) applyAmodes(rb *ResponseBuffer) {
+	account, nick := client.Account(), client.Nick()
+	for _, channel := range client.Channels() {
+		amode := channel.getAmode(account)
+		if amode == modes.Mode(0) {
+			continue
+		}
+		change := modes.ModeChange{Op: modes.Add, Mode: amode, Arg: nick}
+		if applied, change := channel.applyModeToMember(client, change, rb); applied {
+			announceCmodeChanges(channel, modes.ModeChanges{change}, client.server.name, "*", "", false, rb)
+		}
+	}
+}
+
 // ShowMaskList shows the given list to the client.
 func (channel *Channel) ShowMaskList(client *Client, mode modes.Mode, rb *ResponseBuffer) {
 	// choose appropriate modes
@@ -1409,21 +1772,28 @@ func (channel *Channel) ShowMaskList(client *Client, mode modes.Mode, rb *Respon
 
 // Quit removes the given client from the channel
 func (channel *Channel) Quit(client *Client) {
-	channelEmpty := func() bool {
+	var joinTime int64
+	wasMember, channelEmpty := func() (bool, bool) {
 		channel.joinPartMutex.Lock()
 		defer channel.joinPartMutex.Unlock()
 
 		channel.stateMutex.Lock()
+		memberData, wasMember := channel.members[client]
+		joinTime = memberData.joinTime
 		channel.members.Remove(client)
 		channelEmpty := len(channel.members) == 0
 		channel.stateMutex.Unlock()
 		channel.regenerateMembersCache()
-		return channelEmpty
+		return wasMember, channelEmpty
 	}()
 
 	if channelEmpty {
 		client.server.channels.Cleanup(channel)
 	}
+	// always-on clients retain access to the history of their membership
+	if wasMember && client.AlwaysOn() {
+		client.server.accounts.saveDepartedChannel(client.Account(), channel.NameCasefolded(), time.Unix(0, joinTime).UTC())
+	}
 	client.removeChannel(channel)
 }
 
@@ -1439,7 +1809,11 @@ func (channel *Channel) Kick(client *Client, target *Client, comment string, rb
 		return
 	}
 
-	comment = ircutils.TruncateUTF8Safe(comment, channel.server.Config().Limits.KickLen)
+	config := channel.server.Config()
+	comment = ircutils.SanitizeText(comment, config.Limits.KickLen)
+	if comment = channel.filterReason(config, comment); comment == "" {
+		comment = client.Nick()
+	}
 
 	message := utils.MakeMessage(comment)
 	details := client.Details()
@@ -1521,11 +1895,11 @@ func (channel *Channel) Invite(invitee *Client, inviter *Client, rb *ResponseBuf
 		return
 	}
 
+	details := inviter.Details()
 	if inviteOnly {
-		invitee.Invite(chcfname, createdAt)
+		channel.server.invites.Add(chcfname, createdAt, invitee, details.nickMask)
 	}
 
-	details := inviter.Details()
 	isBot := inviter.HasMode(modes.Bot)
 	tDetails := invitee.Details()
 	tnick := invitee.Nick()
@@ -1542,22 +1916,27 @@ func (channel *Channel) Invite(invitee *Client, inviter *Client, rb *ResponseBuf
 		for _, session := range member.Sessions() {
 			if session.capabilities.Has(caps.InviteNotify) {
 				session.sendFromClientInternal(false, message.Time, message.Msgid, details.nickMask, details.accountName, isBot, nil, "INVITE", tnick, chname)
+			} else {
+				// sessions without invite-notify are told with RPL_INVITED
+				session.Send(nil, inviter.server.name, RPL_INVITED, member.Nick(), chname, tnick, details.nick, fmt.Sprintf(member.t("%[1]s has been invited by %[2]s"), tnick, details.nick))
 			}
 		}
 	}
 
 	rb.Add(nil, inviter.server.name, RPL_INVITING, details.nick, tnick, chname)
+	if invitee.isSilencing(inviter) {
+		return
+	}
 	for _, iSession := range invitee.Sessions() {
 		iSession.sendFromClientInternal(false, message.Time, message.Msgid, details.nickMask, details.accountName, isBot, nil, "INVITE", tnick, chname)
 	}
-	if away, awayMessage := invitee.Away(); away {
-		rb.Add(nil, inviter.server.name, RPL_AWAY, details.nick, tnick, awayMessage)
-	}
+	addAwayReply(rb, "INVITE", inviter, invitee)
 	inviter.addHistoryItem(invitee, item, &details, &tDetails, channel.server.Config())
 }
 
 // Uninvite rescinds a channel invitation, if the inviter can do so.
-func (channel *Channel) Uninvite(invitee *Client, inviter *Client, rb *ResponseBuffer) {
+// The invitee need not be online.
+func (channel *Channel) Uninvite(nickname string, inviter *Client, rb *ResponseBuffer) {
 	if !channel.flags.HasMode(modes.InviteOnly) {
 		rb.Add(nil, channel.server.name, "FAIL", "UNINVITE", "NOT_INVITE_ONLY", channel.Name(), inviter.t("Channel is not invite-only"))
 		return
@@ -1568,8 +1947,37 @@ func (channel *Channel) Uninvite(invitee *Client, inviter *Client, rb *ResponseB
 		return
 	}
 
-	invitee.Uninvite(channel.NameCasefolded())
-	rb.Add(nil, channel.server.name, "UNINVITE", invitee.Nick(), channel.Name())
+	// look up who the nickname belongs to now: an online client, or else
+	// an account that can use the invite after reconnecting
+	var invitee *Client
+	var account string
+	if target := channel.server.clients.Get(nickname); target != nil {
+		invitee, account = target, target.Account()
+	} else {
+		account, _ = CasefoldName(nickname)
+	}
+	if (invitee == nil && account == "") || !channel.server.invites.Remove(channel.NameCasefolded(), channel.Ctime(), invitee, account) {
+		rb.Add(nil, channel.server.name, "FAIL", "UNINVITE", "NOT_INVITED", utils.SafeErrorParam(nickname), channel.Name(), inviter.t("That user has no pending invite to the channel"))
+		return
+	}
+	rb.Add(nil, channel.server.name, "UNINVITE", nickname, channel.Name())
+}
+
+// listInvites shows the channel's pending invites to a channel operator.
+func (channel *Channel) listInvites(client *Client, rb *ResponseBuffer) {
+	if !channel.ClientIsAtLeast(client, modes.ChannelOperator) {
+		rb.Add(nil, channel.server.name, ERR_CHANOPRIVSNEEDED, client.Nick(), channel.Name(), client.t("You're not a channel operator"))
+		return
+	}
+
+	invites := channel.server.invites.List(channel.NameCasefolded(), channel.Ctime(), time.Duration(channel.server.Config().Channels.InviteExpiration))
+	if len(invites) == 0 {
+		rb.Notice(fmt.Sprintf(client.t("There are no pending invites to %s"), channel.Name()))
+		return
+	}
+	for _, invite := range invites {
+		rb.Notice(fmt.Sprintf(client.t("%[1]s was invited to %[2]s by %[3]s at %[4]s"), invite.invitee, channel.Name(), invite.inviter, invite.invitedAt.Format(time.RFC1123)))
+	}
 }
 
 // returns who the client can "see" in the channel, respecting the auditorium mode
@@ -191,6 +191,8 @@ func (cm *ChannelManager) maybeCleanupInternal(cfname string, entry *channelMana
 		if entry.skeleton != "" {
 			delete(cm.chansSkeletons, entry.skeleton)
 		}
+		// the channel can't come back with the same ctime, so its invites are useless now:
+		cm.server.invites.ClearChannel(cfname)
 	}
 }
 
@@ -360,6 +362,7 @@ func (cm *ChannelManager) Rename(name string, newName string) (err error) {
 	}
 
 	delete(cm.chans, oldCfname)
+	cm.server.invites.ClearChannel(oldCfname)
 	if !registered {
 		entry.skeleton = newSkeleton
 	}
@@ -420,6 +423,7 @@ func (cm *ChannelManager) Purge(chname string, record ChannelPurgeRecord) (err e
 		}
 	}
 	cm.Unlock()
+	cm.server.invites.ClearChannel(chname)
 
 	cm.server.channelRegistry.PurgeChannel(chname, record)
 	if entry != nil {
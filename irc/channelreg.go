@@ -27,6 +27,7 @@ const (
 	keyChannelTopic          = "channel.topic %s"
 	keyChannelTopicSetBy     = "channel.topic.setby %s"
 	keyChannelTopicSetTime   = "channel.topic.settime %s"
+	keyChannelTopicHistory   = "channel.topic.history %s"
 	keyChannelBanlist        = "channel.banlist %s"
 	keyChannelExceptlist     = "channel.exceptlist %s"
 	keyChannelInvitelist     = "channel.invitelist %s"
@@ -36,6 +37,11 @@ const (
 	keyChannelUserLimit      = "channel.userlimit %s"
 	keyChannelSettings       = "channel.settings %s"
 	keyChannelForward        = "channel.forward %s"
+	keyChannelJoinThrottle   = "channel.jointhrottle %s"
+	keyChannelRepeatLimit    = "channel.repeatlimit %s"
+	keyChannelSlowMode       = "channel.slowmode %s"
+	keyChannelLockdown       = "channel.lockdown %s"
+	keyChannelMetadata       = "channel.metadata %s"
 
 	keyChannelPurged = "channel.purged %s"
 )
@@ -49,6 +55,7 @@ var (
 		keyChannelTopic,
 		keyChannelTopicSetBy,
 		keyChannelTopicSetTime,
+		keyChannelTopicHistory,
 		keyChannelBanlist,
 		keyChannelExceptlist,
 		keyChannelInvitelist,
@@ -58,6 +65,11 @@ var (
 		keyChannelUserLimit,
 		keyChannelSettings,
 		keyChannelForward,
+		keyChannelJoinThrottle,
+		keyChannelRepeatLimit,
+		keyChannelSlowMode,
+		keyChannelLockdown,
+		keyChannelMetadata,
 	}
 )
 
@@ -69,6 +81,7 @@ const (
 	IncludeModes
 	IncludeLists
 	IncludeSettings
+	IncludeMetadata
 )
 
 // this is an OR of all possible flags
@@ -92,6 +105,8 @@ type RegisteredChannel struct {
 	TopicSetBy string
 	// TopicSetTime represents the time the topic was set.
 	TopicSetTime time.Time
+	// TopicHistory holds the topics that were replaced, newest first.
+	TopicHistory []TopicHistoryEntry
 	// Modes represents the channel modes
 	Modes []modes.Mode
 	// Key represents the channel key / password
@@ -100,6 +115,14 @@ type RegisteredChannel struct {
 	Forward string
 	// UserLimit is the user limit (0 for no limit)
 	UserLimit int
+	// JoinThrottle is the join throttle (+j) parameter, e.g., "5:10"
+	JoinThrottle string
+	// RepeatLimit is the repeated message limit (+K) parameter, e.g., "3:30"
+	RepeatLimit string
+	// SlowMode is the slow mode (+S) parameter, in seconds
+	SlowMode string
+	// LockdownUntil is the expiration of a CS LOCKDOWN in progress, if any
+	LockdownUntil time.Time
 	// AccountToUMode maps user accounts to their persistent channel modes (e.g., +q, +h)
 	AccountToUMode map[string]modes.Mode
 	// Bans represents the bans set on the channel.
@@ -110,6 +133,8 @@ type RegisteredChannel struct {
 	Invites map[string]MaskInfo
 	// Settings are the chanserv-modifiable settings
 	Settings ChannelSettings
+	// Metadata is the draft/metadata-2 key-value data
+	Metadata map[string]string
 }
 
 type ChannelPurgeRecord struct {
@@ -209,15 +234,25 @@ func (reg *ChannelRegistry) LoadChannel(nameCasefolded string) (info RegisteredC
 		if topicSetTimeInt, topicSetTimeErr := strconv.ParseInt(topicSetTimeStr, 10, 64); topicSetTimeErr == nil {
 			topicSetTime = time.Unix(0, topicSetTimeInt).UTC()
 		}
+		topicHistoryString, _ := tx.Get(fmt.Sprintf(keyChannelTopicHistory, channelKey))
 		password, _ := tx.Get(fmt.Sprintf(keyChannelPassword, channelKey))
 		modeString, _ := tx.Get(fmt.Sprintf(keyChannelModes, channelKey))
 		userLimitString, _ := tx.Get(fmt.Sprintf(keyChannelUserLimit, channelKey))
 		forward, _ := tx.Get(fmt.Sprintf(keyChannelForward, channelKey))
+		joinThrottle, _ := tx.Get(fmt.Sprintf(keyChannelJoinThrottle, channelKey))
+		repeatLimit, _ := tx.Get(fmt.Sprintf(keyChannelRepeatLimit, channelKey))
+		slowMode, _ := tx.Get(fmt.Sprintf(keyChannelSlowMode, channelKey))
+		var lockdownUntil time.Time
+		lockdownString, _ := tx.Get(fmt.Sprintf(keyChannelLockdown, channelKey))
+		if lockdownInt, lockdownErr := strconv.ParseInt(lockdownString, 10, 64); lockdownErr == nil {
+			lockdownUntil = time.Unix(0, lockdownInt).UTC()
+		}
 		banlistString, _ := tx.Get(fmt.Sprintf(keyChannelBanlist, channelKey))
 		exceptlistString, _ := tx.Get(fmt.Sprintf(keyChannelExceptlist, channelKey))
 		invitelistString, _ := tx.Get(fmt.Sprintf(keyChannelInvitelist, channelKey))
 		accountToUModeString, _ := tx.Get(fmt.Sprintf(keyChannelAccountToUMode, channelKey))
 		settingsString, _ := tx.Get(fmt.Sprintf(keyChannelSettings, channelKey))
+		metadataString, _ := tx.Get(fmt.Sprintf(keyChannelMetadata, channelKey))
 
 		modeSlice := make([]modes.Mode, len(modeString))
 		for i, mode := range modeString {
@@ -237,6 +272,10 @@ func (reg *ChannelRegistry) LoadChannel(nameCasefolded string) (info RegisteredC
 
 		var settings ChannelSettings
 		_ = json.Unmarshal([]byte(settingsString), &settings)
+		var metadata map[string]string
+		_ = json.Unmarshal([]byte(metadataString), &metadata)
+		var topicHistory []TopicHistoryEntry
+		_ = json.Unmarshal([]byte(topicHistoryString), &topicHistory)
 
 		info = RegisteredChannel{
 			Name:           name,
@@ -246,6 +285,7 @@ func (reg *ChannelRegistry) LoadChannel(nameCasefolded string) (info RegisteredC
 			Topic:          topic,
 			TopicSetBy:     topicSetBy,
 			TopicSetTime:   topicSetTime,
+			TopicHistory:   topicHistory,
 			Key:            password,
 			Modes:          modeSlice,
 			Bans:           banlist,
@@ -255,6 +295,11 @@ func (reg *ChannelRegistry) LoadChannel(nameCasefolded string) (info RegisteredC
 			UserLimit:      int(userLimit),
 			Settings:       settings,
 			Forward:        forward,
+			JoinThrottle:   joinThrottle,
+			RepeatLimit:    repeatLimit,
+			SlowMode:       slowMode,
+			LockdownUntil:  lockdownUntil,
+			Metadata:       metadata,
 		}
 		return nil
 	})
@@ -324,9 +369,14 @@ func (reg *ChannelRegistry) updateAccountToChannelMapping(tx *buntdb.Tx, channel
 		tx.Set(accountChannelsKey, newChannels, nil)
 	}
 	if existsErr == nil && founder != channelInfo.Founder {
-		// remove from old founder's list
+		// remove from old founder's list, unless it's already gone
+		// (e.g., the channel is passing to its successor because the
+		// old founder's account was unregistered)
 		accountChannelsKey := fmt.Sprintf(keyAccountChannels, founder)
-		alreadyChannelsRaw, _ := tx.Get(accountChannelsKey)
+		alreadyChannelsRaw, err := tx.Get(accountChannelsKey)
+		if err == buntdb.ErrNotFound {
+			return
+		}
 		var newChannels []string
 		if alreadyChannelsRaw != "" {
 			for _, chname := range strings.Split(alreadyChannelsRaw, ",") {
@@ -360,6 +410,12 @@ func (reg *ChannelRegistry) saveChannel(tx *buntdb.Tx, channelInfo RegisteredCha
 		}
 		tx.Set(fmt.Sprintf(keyChannelTopicSetTime, channelKey), topicSetTimeStr, nil)
 		tx.Set(fmt.Sprintf(keyChannelTopicSetBy, channelKey), channelInfo.TopicSetBy, nil)
+		if len(channelInfo.TopicHistory) != 0 {
+			topicHistoryString, _ := json.Marshal(channelInfo.TopicHistory)
+			tx.Set(fmt.Sprintf(keyChannelTopicHistory, channelKey), string(topicHistoryString), nil)
+		} else {
+			tx.Delete(fmt.Sprintf(keyChannelTopicHistory, channelKey))
+		}
 	}
 
 	if includeFlags&IncludeModes != 0 {
@@ -368,6 +424,14 @@ func (reg *ChannelRegistry) saveChannel(tx *buntdb.Tx, channelInfo RegisteredCha
 		tx.Set(fmt.Sprintf(keyChannelModes, channelKey), modeString, nil)
 		tx.Set(fmt.Sprintf(keyChannelUserLimit, channelKey), strconv.Itoa(channelInfo.UserLimit), nil)
 		tx.Set(fmt.Sprintf(keyChannelForward, channelKey), channelInfo.Forward, nil)
+		tx.Set(fmt.Sprintf(keyChannelJoinThrottle, channelKey), channelInfo.JoinThrottle, nil)
+		tx.Set(fmt.Sprintf(keyChannelRepeatLimit, channelKey), channelInfo.RepeatLimit, nil)
+		tx.Set(fmt.Sprintf(keyChannelSlowMode, channelKey), channelInfo.SlowMode, nil)
+		if channelInfo.LockdownUntil.IsZero() {
+			tx.Delete(fmt.Sprintf(keyChannelLockdown, channelKey))
+		} else {
+			tx.Set(fmt.Sprintf(keyChannelLockdown, channelKey), strconv.FormatInt(channelInfo.LockdownUntil.UnixNano(), 10), nil)
+		}
 	}
 
 	if includeFlags&IncludeLists != 0 {
@@ -385,6 +449,15 @@ func (reg *ChannelRegistry) saveChannel(tx *buntdb.Tx, channelInfo RegisteredCha
 		settingsString, _ := json.Marshal(channelInfo.Settings)
 		tx.Set(fmt.Sprintf(keyChannelSettings, channelKey), string(settingsString), nil)
 	}
+
+	if includeFlags&IncludeMetadata != 0 {
+		if len(channelInfo.Metadata) != 0 {
+			metadataString, _ := json.Marshal(channelInfo.Metadata)
+			tx.Set(fmt.Sprintf(keyChannelMetadata, channelKey), string(metadataString), nil)
+		} else {
+			tx.Delete(fmt.Sprintf(keyChannelMetadata, channelKey))
+		}
+	}
 }
 
 // PurgeChannel records a channel purge.
@@ -10,10 +10,12 @@ import (
 	"strings"
 	"time"
 
+	"github.com/ergochat/ergo/irc/custime"
 	"github.com/ergochat/ergo/irc/modes"
 	"github.com/ergochat/ergo/irc/sno"
 	"github.com/ergochat/ergo/irc/utils"
 	"github.com/ergochat/irc-go/ircfmt"
+	"github.com/ergochat/irc-go/ircutils"
 )
 
 const chanservHelp = `ChanServ lets you register and manage channels.`
@@ -93,12 +95,28 @@ the ordinary /MODE command.`,
 CLEAR removes users or settings from a channel. Specifically:
 
 $bCLEAR #channel users$b kicks all users except for you.
+$bCLEAR #channel unregistered$b kicks all users who aren't logged in.
+$bCLEAR #channel bans$b removes all bans.
+$bCLEAR #channel ops$b removes founder, admin, operator and halfop status
+from everyone who isn't entitled to it by the channel's access list (CS AMODE).
 $bCLEAR #channel access$b resets all stored bans, invites, ban exceptions,
 and persistent user-mode grants made with CS AMODE.`,
 			helpShort: `$bCLEAR$b removes users or settings from a channel.`,
 			enabled:   chanregEnabled,
 			minParams: 2,
 		},
+		"lockdown": {
+			handler: csLockdownHandler,
+			help: `Syntax: $bLOCKDOWN #channel <duration | OFF>$b
+
+LOCKDOWN moderates a channel (mode +m) for a limited time, e.g., during a
+spam attack, so that only voiced users and operators can speak. For example,
+$bLOCKDOWN #channel 10m$b sets +m and removes it again after 10 minutes;
+$bLOCKDOWN #channel OFF$b ends the lockdown early.`,
+			helpShort: `$bLOCKDOWN$b temporarily moderates a channel.`,
+			enabled:   chanregEnabled,
+			minParams: 2,
+		},
 		"transfer": {
 			handler: csTransferHandler,
 			help: `Syntax: $bTRANSFER [accept] #channel user [code]$b
@@ -171,7 +189,9 @@ SET modifies a channel's settings. The following settings are available:`,
 1. 'off'        [no history]
 2. 'ephemeral'  [a limited amount of temporary history, not stored on disk]
 3. 'on'         [history stored in a permanent database, if available]
-4. 'default'    [use the server default]`,
+4. 'default'    [use the server default]
+Only current members can retrieve the history; always-on clients can also
+retrieve the history of the period they were present in channels they've left.`,
 				`$bQUERY-CUTOFF$b
 'query-cutoff' lets you restrict how much channel history can be retrieved
 by unprivileged users. Your options are:
@@ -182,9 +202,46 @@ by unprivileged users. Your options are:
                          channel; note that history will be effectively
                          unavailable to clients that are not always-on]
 4. 'default'            [use the server default]`,
+				`$bSUCCESSOR$b
+'successor' designates an account that will become the channel's founder
+if your account is unregistered, or if the channel's registration expires
+because you haven't connected to the server in a long time. Your options
+are an account name, or 'none'.`,
+				`$bREASON-FILTER$b
+'reason-filter' controls whether quit, part, and kick messages shown in the
+channel are scrubbed of URLs, formatting codes, and spam. Your options are
+'on', 'off', and 'default' [use the server default].`,
+				`$bOP-EXPIRY$b
+'op-expiry' makes operator status granted with /MODE +o temporary: it is
+removed automatically after the given duration (e.g., '2h'). Operator status
+from the access list (see $bAMODE$b) is unaffected. Your options are a
+duration, or 'off'.`,
+				`$bURL$b
+'url' sets a website for the channel, which is sent to users when they join
+and shown by $bINFO$b. Your options are a URL, or 'none'.`,
+				`$bDESCRIPTION$b
+'description' sets a description of the channel, shown by $bINFO$b. Your
+options are any text, or 'none'.`,
+				`$bENTRYMSG$b
+'entrymsg' sets a message that ChanServ sends to users when they join the
+channel. Your options are any text, or 'none'.`,
 			},
+			enabled:           chanregEnabled,
+			minParams:         3,
+			maxParams:         3,
+			unsplitFinalParam: true,
+		},
+		"topic": {
+			handler: csTopicHandler,
+			help: `Syntax: $bTOPIC #channel HISTORY$b
+        $bTOPIC #channel RESTORE [number]$b
+
+TOPIC HISTORY lists the previous topics of a registered channel, newest
+first. TOPIC RESTORE, which requires channel operator privileges, sets the
+topic back to one of them (by default, the most recent one).`,
+			helpShort: `$bTOPIC$b shows and restores previous channel topics.`,
 			enabled:   chanregEnabled,
-			minParams: 3,
+			minParams: 2,
 		},
 		"howtoban": {
 			handler:   csHowToBanHandler,
@@ -510,7 +567,8 @@ func csClearHandler(service *ircService, server *Server, client *Client, command
 		return
 	}
 
-	switch strings.ToLower(params[1]) {
+	target := strings.ToLower(params[1])
+	switch target {
 	case "access":
 		channel.resetAccess()
 		service.Notice(rb, client.t("Successfully reset channel access"))
@@ -520,10 +578,32 @@ func csClearHandler(service *ircService, server *Server, client *Client, command
 				channel.Kick(client, target, "Cleared by ChanServ", rb, true)
 			}
 		}
+	case "unregistered":
+		for _, target := range channel.Members() {
+			if target != client && target.Account() == "" {
+				channel.Kick(client, target, "Cleared by ChanServ", rb, true)
+			}
+		}
+	case "bans":
+		removed := channel.clearBans()
+		changes := make(modes.ModeChanges, len(removed))
+		for i, mask := range removed {
+			changes[i] = modes.ModeChange{Op: modes.Remove, Mode: modes.BanMask, Arg: mask}
+		}
+		announceModeChangesInBatches(channel, changes, service.prefix)
+		service.Notice(rb, fmt.Sprintf(client.t("Removed %d bans"), len(removed)))
+	case "ops":
+		changes, deopped := channel.deopUnlisted()
+		for _, member := range deopped {
+			member.markDirty(IncludeChannels)
+		}
+		announceModeChangesInBatches(channel, changes, service.prefix)
+		service.Notice(rb, fmt.Sprintf(client.t("Removed channel privileges from %d users"), len(deopped)))
 	default:
 		service.Notice(rb, client.t("Invalid parameters"))
+		return
 	}
-
+	logMassModeration(server, client, "CLEAR "+strings.ToUpper(target), channel.Name())
 }
 
 func csTransferHandler(service *ircService, server *Server, client *Client, command string, params []string, rb *ResponseBuffer) {
@@ -776,7 +856,7 @@ func csInfoHandler(service *ircService, server *Server, client *Client, command
 	var chinfo RegisteredChannel
 	channel := server.channels.Get(params[0])
 	if channel != nil {
-		chinfo = channel.ExportRegistration(0)
+		chinfo = channel.ExportRegistration(IncludeSettings)
 	} else {
 		chinfo, err = server.channelRegistry.LoadChannel(chname)
 		if err != nil && !(err == errNoSuchChannel || err == errFeatureDisabled) {
@@ -793,6 +873,12 @@ func csInfoHandler(service *ircService, server *Server, client *Client, command
 	service.Notice(rb, fmt.Sprintf(client.t("Channel %s is registered"), chinfo.Name))
 	service.Notice(rb, fmt.Sprintf(client.t("Founder: %s"), chinfo.Founder))
 	service.Notice(rb, fmt.Sprintf(client.t("Registered at: %s"), chinfo.RegisteredAt.Format(time.RFC1123)))
+	if chinfo.Settings.Description != "" {
+		service.Notice(rb, fmt.Sprintf(client.t("Description: %s"), chinfo.Settings.Description))
+	}
+	if chinfo.Settings.URL != "" {
+		service.Notice(rb, fmt.Sprintf(client.t("URL: %s"), chinfo.Settings.URL))
+	}
 }
 
 func displayChannelSetting(service *ircService, settingName string, settings ChannelSettings, client *Client, rb *ResponseBuffer) {
@@ -810,6 +896,43 @@ func displayChannelSetting(service *ircService, settingName string, settings Cha
 		}
 		service.Notice(rb, fmt.Sprintf(client.t("The stored channel history query cutoff setting is: %s"), historyCutoffToString(settings.QueryCutoff)))
 		service.Notice(rb, fmt.Sprintf(client.t("Given current server settings, the channel history query cutoff setting is: %s"), historyCutoffToString(effectiveValue)))
+	case "reason-filter":
+		service.Notice(rb, fmt.Sprintf(client.t("The stored channel reason filtering setting is: %s"), userPersistentStatusToString(settings.ReasonFilter)))
+		if persistenceEnabled(config.Channels.ReasonFiltering.Enabled, settings.ReasonFilter) {
+			service.Notice(rb, client.t("Given current server settings, quit, part, and kick messages in the channel are filtered"))
+		} else {
+			service.Notice(rb, client.t("Given current server settings, quit, part, and kick messages in the channel are not filtered"))
+		}
+	case "op-expiry":
+		if settings.OpExpiry == 0 {
+			service.Notice(rb, client.t("Operator status granted with /MODE does not expire"))
+		} else {
+			service.Notice(rb, fmt.Sprintf(client.t("Operator status granted with /MODE expires after %v"), settings.OpExpiry))
+		}
+	case "url":
+		if settings.URL == "" {
+			service.Notice(rb, client.t("The channel has no URL"))
+		} else {
+			service.Notice(rb, fmt.Sprintf(client.t("The channel's URL is: %s"), settings.URL))
+		}
+	case "description":
+		if settings.Description == "" {
+			service.Notice(rb, client.t("The channel has no description"))
+		} else {
+			service.Notice(rb, fmt.Sprintf(client.t("The channel's description is: %s"), settings.Description))
+		}
+	case "entrymsg":
+		if settings.EntryMessage == "" {
+			service.Notice(rb, client.t("The channel has no entry message"))
+		} else {
+			service.Notice(rb, fmt.Sprintf(client.t("The channel's entry message is: %s"), settings.EntryMessage))
+		}
+	case "successor":
+		if settings.Successor == "" {
+			service.Notice(rb, client.t("The channel has no designated successor"))
+		} else {
+			service.Notice(rb, fmt.Sprintf(client.t("The channel's designated successor is: %s"), client.server.accounts.AccountToAccountName(settings.Successor)))
+		}
 	default:
 		service.Notice(rb, client.t("Invalid params"))
 	}
@@ -860,6 +983,54 @@ func csSetHandler(service *ircService, server *Server, client *Client, command s
 			break
 		}
 		channel.SetSettings(settings)
+	case "reason-filter":
+		settings.ReasonFilter, err = persistentStatusFromString(value)
+		if err != nil {
+			err = errInvalidParams
+			break
+		}
+		channel.SetSettings(settings)
+	case "op-expiry":
+		if enabled, boolErr := utils.StringToBool(value); boolErr == nil && !enabled {
+			settings.OpExpiry = 0
+		} else {
+			settings.OpExpiry, err = custime.ParseDuration(value)
+			if err != nil || settings.OpExpiry < 0 {
+				err = errInvalidParams
+				break
+			}
+		}
+		channel.SetSettings(settings)
+	case "url", "description", "entrymsg":
+		if strings.ToLower(value) == "none" {
+			value = ""
+		}
+		value = ircutils.SanitizeText(value, server.Config().Limits.TopicLen)
+		switch strings.ToLower(setting) {
+		case "url":
+			settings.URL = value
+		case "description":
+			settings.Description = value
+		case "entrymsg":
+			settings.EntryMessage = value
+		}
+		channel.SetSettings(settings)
+	case "successor":
+		if strings.ToLower(value) == "none" {
+			settings.Successor = ""
+		} else {
+			var successor ClientAccount
+			successor, err = server.accounts.LoadAccount(value)
+			if err != nil || !successor.Verified {
+				err = errAccountDoesNotExist
+				break
+			} else if successor.NameCasefolded == info.Founder {
+				err = errInvalidParams
+				break
+			}
+			settings.Successor = successor.NameCasefolded
+		}
+		channel.SetSettings(settings)
 	}
 
 	switch err {
@@ -868,6 +1039,8 @@ func csSetHandler(service *ircService, server *Server, client *Client, command s
 		displayChannelSetting(service, setting, settings, client, rb)
 	case errInvalidParams:
 		service.Notice(rb, client.t("Invalid parameters"))
+	case errAccountDoesNotExist:
+		service.Notice(rb, client.t("Account does not exist"))
 	default:
 		server.logger.Error("internal", "CS SET error:", err.Error())
 		service.Notice(rb, client.t("An error occurred"))
@@ -0,0 +1,185 @@
+// Copyright (c) 2021 Shivaram Lingamneni <slingamn@cs.stanford.edu>
+// released under the MIT license
+
+package irc
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ergochat/irc-go/ircmsg"
+
+	"github.com/ergochat/ergo/irc/utils"
+)
+
+// CHECK <nickname | channel | ip/cidr | nickmask>
+func checkHandler(server *Server, client *Client, msg ircmsg.Message, rb *ResponseBuffer) bool {
+	param := msg.Params[0]
+
+	if _, err := CasefoldChannel(param); err == nil {
+		channel := server.channels.Get(param)
+		if channel == nil {
+			rb.Add(nil, server.name, ERR_NOSUCHCHANNEL, client.Nick(), utils.SafeErrorParam(param), client.t("No such channel"))
+			return false
+		}
+		checkChannel(client, channel, rb)
+		return false
+	}
+
+	target, err := parseUbanTarget(param)
+	if err != nil {
+		rb.Add(nil, server.name, "FAIL", "CHECK", "INVALID_PARAMS", client.t("Couldn't parse target"))
+		return false
+	}
+	switch target.banType {
+	case ubanCIDR:
+		rb.Notice(fmt.Sprintf(client.t("Information for IP or network %s:"), target.cidr.HumanReadableString()))
+		ubanInfoCIDR(client, target, rb)
+	case ubanNickmask:
+		checkNickmask(client, target, rb)
+	case ubanNick:
+		mcl := server.clients.Get(target.nickOrMask)
+		if mcl == nil {
+			rb.Add(nil, server.name, ERR_NOSUCHNICK, client.Nick(), utils.SafeErrorParam(param), client.t("No such nick"))
+			return false
+		}
+		checkClient(client, mcl, rb)
+	}
+	return false
+}
+
+func checkClient(client *Client, target *Client, rb *ResponseBuffer) {
+	details := target.Details()
+	rb.Notice(fmt.Sprintf(client.t("Information for client %s:"), details.nick))
+	rb.Notice(fmt.Sprintf(client.t("Nickmask:    %s"), details.nickMask))
+	rb.Notice(fmt.Sprintf(client.t("Realname:    %s"), details.realname))
+	if details.account != "" {
+		rb.Notice(fmt.Sprintf(client.t("Account:     %s"), details.accountName))
+	}
+	rb.Notice(fmt.Sprintf(client.t("User modes:  %s"), target.ModeString()))
+	if oper := target.Oper(); oper != nil {
+		rb.Notice(fmt.Sprintf(client.t("Operator:    %[1]s (class %[2]s)"), oper.Name, oper.Class.Title))
+	}
+	if isAway, awayMessage := target.Away(); isAway {
+		rb.Notice(fmt.Sprintf(client.t("Away:        %s"), awayMessage))
+	}
+	if target.AlwaysOn() {
+		rb.Notice(client.t("Always-on:   enabled"))
+	}
+
+	channels := target.Channels()
+	chanNames := make([]string, 0, len(channels))
+	for _, channel := range channels {
+		chanNames = append(chanNames, channel.ClientPrefixes(target, true)+channel.Name())
+	}
+	sort.Strings(chanNames)
+	rb.Notice(fmt.Sprintf(client.t("Channels:    %d"), len(chanNames)))
+	for _, line := range utils.BuildTokenLines(400, chanNames, " ") {
+		rb.Notice(line)
+	}
+
+	sessionData, _ := target.AllSessionData(nil, true)
+	rb.Notice(fmt.Sprintf(client.t("Sessions:    %d"), len(sessionData)))
+	for _, session := range sessionData {
+		rb.Notice(fmt.Sprintf(client.t("Client %d:"), session.sessionID))
+		if session.deviceID != "" {
+			rb.Notice(fmt.Sprintf(client.t("Device ID:   %s"), session.deviceID))
+		}
+		rb.Notice(fmt.Sprintf(client.t("IP address:  %s"), session.ip.String()))
+		rb.Notice(fmt.Sprintf(client.t("Hostname:    %s"), session.hostname))
+		rb.Notice(fmt.Sprintf(client.t("Connection:  %s"), session.connInfo))
+		rb.Notice(fmt.Sprintf(client.t("Created at:  %s"), session.ctime.Format(time.RFC1123)))
+		rb.Notice(fmt.Sprintf(client.t("Last active: %s"), session.atime.Format(time.RFC1123)))
+		rb.Notice(fmt.Sprintf(client.t("SendQ:       %d bytes"), session.sendQ))
+		if session.connClass != "" {
+			rb.Notice(fmt.Sprintf(client.t("Conn class:  %s"), session.connClass))
+		}
+		if session.latency != 0 {
+			rb.Notice(fmt.Sprintf(client.t("Latency:     %s"), session.latency))
+		}
+		if session.certfp != "" {
+			rb.Notice(fmt.Sprintf(client.t("Certfp:      %s"), session.certfp))
+		}
+		for _, capStr := range session.caps {
+			if capStr != "" {
+				rb.Notice(fmt.Sprintf(client.t("IRCv3 CAPs:  %s"), capStr))
+			}
+		}
+	}
+}
+
+func checkChannel(client *Client, channel *Channel, rb *ResponseBuffer) {
+	info := channel.ExportRegistration(IncludeTopic | IncludeLists)
+	rb.Notice(fmt.Sprintf(client.t("Information for channel %s:"), info.Name))
+	rb.Notice(fmt.Sprintf(client.t("Created at:  %s"), channel.Ctime().Format(time.RFC1123)))
+	rb.Notice(fmt.Sprintf(client.t("Modes:       %s"), strings.Join(channel.modeStrings(client), " ")))
+	if info.Topic != "" {
+		rb.Notice(fmt.Sprintf(client.t("Topic:       %s"), info.Topic))
+		rb.Notice(fmt.Sprintf(client.t("Topic set:   by %[1]s at %[2]s"), info.TopicSetBy, info.TopicSetTime.Format(time.RFC1123)))
+	}
+	if info.Founder != "" {
+		rb.Notice(fmt.Sprintf(client.t("Founder:     %[1]s (registered at %[2]s)"), info.Founder, info.RegisteredAt.Format(time.RFC1123)))
+	} else {
+		rb.Notice(client.t("Founder:     (channel is not registered)"))
+	}
+
+	checkMaskList := func(format string, masks map[string]MaskInfo) {
+		rb.Notice(fmt.Sprintf(format, len(masks)))
+		for mask, maskInfo := range masks {
+			rb.Notice(fmt.Sprintf(client.t("%[1]s (set by %[2]s at %[3]s)"), mask, maskInfo.CreatorNickmask, maskInfo.TimeCreated.Format(time.RFC1123)))
+		}
+	}
+	checkMaskList(client.t("Bans:        %d"), info.Bans)
+	checkMaskList(client.t("Exceptions:  %d"), info.Excepts)
+	checkMaskList(client.t("Invex:       %d"), info.Invites)
+
+	if len(info.AccountToUMode) != 0 {
+		amodes := make([]string, 0, len(info.AccountToUMode))
+		for account, mode := range info.AccountToUMode {
+			amodes = append(amodes, fmt.Sprintf("%s:+%s", account, string(mode)))
+		}
+		sort.Strings(amodes)
+		rb.Notice(fmt.Sprintf(client.t("Amodes:      %d"), len(amodes)))
+		for _, line := range utils.BuildTokenLines(400, amodes, " ") {
+			rb.Notice(line)
+		}
+	}
+
+	members := channel.Members()
+	memberNames := make([]string, 0, len(members))
+	for _, member := range members {
+		memberNames = append(memberNames, channel.ClientPrefixes(member, true)+member.Nick())
+	}
+	sort.Strings(memberNames)
+	rb.Notice(fmt.Sprintf(client.t("Members:     %d"), len(memberNames)))
+	for _, line := range utils.BuildTokenLines(400, memberNames, " ") {
+		rb.Notice(line)
+	}
+}
+
+func checkNickmask(client *Client, target ubanTarget, rb *ResponseBuffer) {
+	rb.Notice(fmt.Sprintf(client.t("Information for nickmask %s:"), target.nickOrMask))
+	isBanned, info := client.server.klines.ContainsMask(target.nickOrMask)
+	if isBanned {
+		rb.Notice(formatBanForListing(client, target.nickOrMask, info))
+	} else {
+		rb.Notice(fmt.Sprintf(client.t("No ban exists for %[1]s"), target.nickOrMask))
+	}
+
+	var nicks []string
+	for _, mcl := range client.server.clients.AllClients() {
+		for _, mask := range mcl.AllNickmasks() {
+			if target.matcher.MatchString(mask) {
+				nicks = append(nicks, mcl.Nick())
+				break
+			}
+		}
+	}
+	sort.Strings(nicks)
+	rb.Notice(fmt.Sprintf(client.t("There are %[1]d active client(s) matching %[2]s:"), len(nicks), target.nickOrMask))
+	for _, line := range utils.BuildTokenLines(400, nicks, " ") {
+		rb.Notice(line)
+	}
+}
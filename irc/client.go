@@ -6,9 +6,11 @@
 package irc
 
 import (
+	"crypto/tls"
 	"crypto/x509"
 	"fmt"
 	"net"
+	"regexp"
 	"runtime/debug"
 	"strconv"
 	"strings"
@@ -40,6 +42,10 @@ const (
 	IRCv3TimestampFormat = utils.IRCv3TimestampFormat
 	// limit the number of device IDs a client can use, as a DoS mitigation
 	maxDeviceIDsPerClient = 64
+	// limit the size of the caller-ID (+g) accept list
+	maxAcceptListEntries = 128
+	// a +g client is notified of blocked messages at most this often
+	callerIDNotifyInterval = time.Minute
 	// controls how often often we write an autoreplay-missed client's
 	// deviceid->lastseentime mapping to the database
 	lastSeenWriteInterval = time.Hour
@@ -48,6 +54,8 @@ const (
 const (
 	// RegisterTimeout is how long clients have to register before we disconnect them
 	RegisterTimeout = time.Minute
+	// RegistrationBurstWindow is the window for limits.registration-burst
+	RegistrationBurstWindow = time.Second
 	// DefaultIdleTimeout is how long without traffic before we send the client a PING
 	DefaultIdleTimeout = time.Minute + 30*time.Second
 	// For Tor clients, we send a PING at least every 30 seconds, as a workaround for this bug
@@ -68,23 +76,31 @@ var (
 
 // Client is an IRC client.
 type Client struct {
+	acceptList         ClientSet // caller-ID (+g) accept list; keyed by client, not nick, so it isn't inherited by whoever takes the nick
+	acceptedBy         ClientSet // clients with this client on their accept list
+	silenceMasks       []string  // SILENCE list, mirroring accountSettings.Silence if logged in
+	silenceRegexp      *regexp.Regexp
 	account            string
 	accountName        string // display name of the account: uncasefolded, '*' if not logged in
 	accountRegDate     time.Time
 	accountSettings    AccountSettings
 	awayMessage        string
+	metadata           map[string]string
+	callerIDNotified   time.Time // last time we notified the client of a message blocked by +g
 	channels           ChannelSet
+	connectionClass    string // connection class of the session that registered the client
 	ctime              time.Time
 	destroyed          bool
 	modes              modes.ModeSet
 	hostname           string
-	invitedTo          map[string]channelInvite
 	isSTSOnly          bool
 	languages          []string
-	lastActive         time.Time            // last time they sent a command that wasn't PONG or similar
+	lastActive         time.Time            // last non-CTCP PRIVMSG sent by any session (see UpdateActive)
 	lastSeen           map[string]time.Time // maps device ID (including "") to time of last received command
 	lastSeenLastWrite  time.Time            // last time `lastSeen` was written to the datastore
 	loginThrottle      connection_limits.GenericThrottle
+	commandThrottles   map[string]*connection_limits.GenericThrottle
+	nickChangeThrottle connection_limits.GenericThrottle
 	nextSessionID      int64 // Incremented when a new session is established
 	nick               string
 	nickCasefolded     string
@@ -145,9 +161,12 @@ type Session struct {
 	lastActive time.Time // last non-CTCP PRIVMSG sent; updates publicly visible idle time
 	lastTouch  time.Time // last line sent; updates timer for idle timeouts
 	idleTimer  *time.Timer
-	pingSent   bool // we sent PING to a putatively idle connection and we're waiting for PONG
+	pingSent   bool          // we sent PING to a putatively idle connection and we're waiting for PONG
+	pingSentAt time.Time     // when the outstanding keepalive PING was sent, if any
+	latency    time.Duration // round-trip time of the last keepalive PING
 
 	sessionID   int64
+	connID      uint64 // server-wide unique, see connevents.go
 	socket      *Socket
 	realIP      net.IP
 	proxiedIP   net.IP
@@ -155,11 +174,15 @@ type Session struct {
 	isTor       bool
 	hideSTS     bool
 
+	listener        string // address of the listener that accepted the connection
+	connectionClass string
+
 	fakelag              Fakelag
 	deferredFakelagCount int
 
 	certfp     string
 	peerCerts  []*x509.Certificate
+	tlsInfo    string // negotiated TLS parameters, for opers
 	sasl       saslStatus
 	passStatus serverPassStatus
 
@@ -169,12 +192,19 @@ type Session struct {
 
 	awayMessage string
 	awayAt      time.Time
+	idleAway    bool // awayMessage was set automatically by idle-away
 
 	capabilities caps.Set
-	capState     caps.State
 	capVersion   caps.Version
 
+	metadataSubscriptions utils.StringSet
+
+	registration         registrationState
 	registrationMessages int
+	registrationBurst    connection_limits.GenericThrottle
+	// closed when the hostname lookup, which runs concurrently with the
+	// rest of registration, has completed:
+	hostnameLookup chan struct{}
 
 	zncPlaybackTimes      *zncPlaybackTimes
 	autoreplayMissedSince time.Time
@@ -286,13 +316,27 @@ type ClientDetails struct {
 }
 
 // RunClient sets up a new client and runs its goroutine.
-func (server *Server) RunClient(conn IRCConn) {
+func (server *Server) RunClient(conn IRCConn, listenerAddr string) {
+	if server.rejectForMaintenance(conn, listenerAddr) {
+		return
+	}
+
 	config := server.Config()
 	wConn := conn.UnderlyingConn()
 	var isBanned, requireSASL bool
 	var banMsg string
 	realIP := utils.AddrToIP(wConn.RemoteAddr())
 	var proxiedIP net.IP
+
+	// this precedes the ban checks, so the connection isn't counted against the limits.
+	// STS-only listeners must stay reachable over plaintext, to serve the STS policy
+	if !wConn.Secure && !wConn.Config.STSOnly && (wConn.Config.RejectInsecure || config.Server.InsecureConnections.Reject) {
+		server.logger.Info("connect-ip", fmt.Sprintf("Rejecting insecure connection from %v", realIP))
+		conn.WriteLine([]byte(fmt.Sprintf(errorMsg, "This server does not accept plaintext connections; please reconnect using TLS")))
+		conn.Close()
+		return
+	}
+
 	if wConn.Config.Tor {
 		// cover up details of the tor proxying infrastructure (not a user privacy concern,
 		// but a hardening measure):
@@ -321,8 +365,14 @@ func (server *Server) RunClient(conn IRCConn) {
 	server.logger.Info("connect-ip", fmt.Sprintf("Client connecting: real IP %v, proxied IP %v", realIP, proxiedIP))
 
 	now := time.Now().UTC()
+	classIP := realIP
+	if proxiedIP != nil {
+		classIP = proxiedIP
+	}
+	connectionClass := config.classifyConnection(listenerAddr, classIP, false)
+	limits := config.connectionLimits(connectionClass)
 	// give them 1k of grace over the limit:
-	socket := NewSocket(conn, config.Server.MaxSendQBytes)
+	socket := NewSocket(conn, limits.maxSendQBytes)
 	client := &Client{
 		lastActive: now,
 		channels:   make(ChannelSet),
@@ -352,13 +402,20 @@ func (server *Server) RunClient(conn IRCConn) {
 		client:     client,
 		socket:     socket,
 		capVersion: caps.Cap301,
-		capState:   caps.NoneState,
 		ctime:      now,
 		lastActive: now,
 		realIP:     realIP,
 		proxiedIP:  proxiedIP,
 		isTor:      wConn.Config.Tor,
 		hideSTS:    wConn.Config.Tor || wConn.Config.HideSTS,
+
+		listener:        listenerAddr,
+		connectionClass: connectionClass,
+
+		registrationBurst: connection_limits.GenericThrottle{
+			Duration: RegistrationBurstWindow,
+			Limit:    config.Limits.RegistrationBurst,
+		},
 	}
 	client.sessions = []*Session{session}
 
@@ -368,26 +425,55 @@ func (server *Server) RunClient(conn IRCConn) {
 		client.SetMode(modes.TLS, true)
 	}
 
+	if tlsConn, ok := wConn.Conn.(*tls.Conn); ok {
+		// complete the handshake up front so we can measure it
+		start := time.Now()
+		tlsConn.SetDeadline(start.Add(RegisterTimeout))
+		err := tlsConn.Handshake()
+		tlsConn.SetDeadline(time.Time{})
+		server.tlsStats.Record(tlsConn, time.Since(start), err)
+	}
+
 	if wConn.Config.TLSConfig != nil {
 		// error is not useful to us here anyways so we can ignore it
 		session.certfp, session.peerCerts, _ = utils.GetCertFP(wConn.Conn, RegisterTimeout)
+		session.tlsInfo = utils.TLSDescription(wConn.Conn)
+	}
+
+	if wConn.Config.RequireCertAccount {
+		if _, err := server.accounts.AccountForCertfp(session.certfp); session.certfp == "" || err != nil {
+			conn.WriteLine([]byte(fmt.Sprintf(errorMsg, "This port requires a client certificate associated with an account")))
+			conn.Close()
+			server.releaseConnectionLimits(session)
+			return
+		}
 	}
 
 	if session.isTor {
 		session.rawHostname = config.Server.TorListeners.Vhost
 		client.rawHostname = session.rawHostname
 	} else {
-		if config.Server.CheckIdent {
+		if limits.checkIdent {
 			client.doIdentLookup(wConn.Conn)
 		}
 	}
 
+	session.connID = server.connEvents.NextID()
+	transport := "plaintext"
+	if wConn.Config.TLSConfig != nil {
+		transport = "tls"
+	}
+	if wConn.Config.WebSocket {
+		transport = "websocket-" + transport
+	}
+	server.connectionEvent(session, connStageAccepted, transport)
+
 	client.registrationTimer = time.AfterFunc(RegisterTimeout, client.handleRegisterTimeout)
 	server.stats.Add()
 	client.run(session)
 }
 
-func (server *Server) AddAlwaysOnClient(account ClientAccount, channelToStatus map[string]alwaysOnChannelStatus, lastSeen map[string]time.Time, uModes modes.Modes, realname string) {
+func (server *Server) AddAlwaysOnClient(account ClientAccount, channelToStatus map[string]alwaysOnChannelStatus, lastSeen map[string]time.Time, uModes modes.Modes, realname, awayMessage string) {
 	now := time.Now().UTC()
 	config := server.Config()
 	if lastSeen == nil && account.Settings.AutoreplayMissed {
@@ -431,6 +517,7 @@ func (server *Server) AddAlwaysOnClient(account ClientAccount, channelToStatus m
 	}
 
 	client.SetMode(modes.TLS, true)
+	client.SetMode(modes.Cloaked, cloakedHostname != "")
 	for _, m := range uModes {
 		client.SetMode(m, true)
 	}
@@ -464,6 +551,8 @@ func (server *Server) AddAlwaysOnClient(account ClientAccount, channelToStatus m
 
 	if persistenceEnabled(config.Accounts.Multiclient.AutoAway, client.accountSettings.AutoAway) {
 		client.setAutoAwayNoMutex(config)
+	} else {
+		client.awayMessage = awayMessage
 	}
 }
 
@@ -489,36 +578,28 @@ func (client *Client) lookupHostname(session *Session, overwrite bool) {
 		ip = session.proxiedIP
 	}
 	ipString := ip.String()
+	lookupHostnames := config.connectionLimits(session.connectionClass).lookupHostnames
 
-	var hostname, candidate string
-	if config.Server.lookupHostnames {
+	var hostname string
+	if lookupHostnames {
 		session.Notice("*** Looking up your hostname...")
 
-		names, err := net.LookupAddr(ipString)
-		if err == nil && 0 < len(names) {
-			candidate = strings.TrimSuffix(names[0], ".")
-		}
-		if utils.IsHostname(candidate) {
-			if config.Server.ForwardConfirmHostnames {
-				addrs, err := net.LookupHost(candidate)
-				if err == nil {
-					for _, addr := range addrs {
-						if addr == ipString {
-							hostname = candidate // successful forward confirmation
-							break
-						}
-					}
-				}
-			} else {
-				hostname = candidate
+		var cached bool
+		hostname, cached = client.server.hostnameCache.Get(ipString)
+		if !cached {
+			hostname = config.Server.resolver.LookupHostname(ipString, config.Server.ForwardConfirmHostnames)
+			ttl := config.Server.LookupCache.TTL
+			if hostname == "" {
+				ttl = config.Server.LookupCache.NegativeTTL
 			}
+			client.server.hostnameCache.Set(ipString, hostname, ttl)
 		}
 	}
 
 	if hostname != "" {
 		session.Notice("*** Found your hostname")
 	} else {
-		if config.Server.lookupHostnames {
+		if lookupHostnames {
 			session.Notice("*** Couldn't look up your hostname")
 		}
 		hostname = utils.IPStringToHostname(ipString)
@@ -536,6 +617,21 @@ func (client *Client) lookupHostname(session *Session, overwrite bool) {
 	}
 }
 
+// releaseConnectionLimits undoes the accounting of the session's connection
+// against the connection limits, returning a description of its source
+func (server *Server) releaseConnectionLimits(session *Session) (source string) {
+	if session.isTor {
+		server.torLimiter.RemoveClient()
+		return "tor"
+	}
+	ip := session.realIP
+	if session.proxiedIP != nil {
+		ip = session.proxiedIP
+	}
+	server.connectionLimiter.RemoveClient(flatip.FromNetIP(ip))
+	return ip.String()
+}
+
 func (client *Client) doIdentLookup(conn net.Conn) {
 	localTCPAddr, ok := conn.LocalAddr().(*net.TCPAddr)
 	if !ok {
@@ -549,7 +645,17 @@ func (client *Client) doIdentLookup(conn net.Conn) {
 	clientPort := remoteTCPAddr.Port
 
 	client.Notice(client.t("*** Looking up your username"))
-	resp, err := ident.Query(remoteTCPAddr.IP.String(), serverPort, clientPort, IdentTimeout)
+	// only failures are cached: on a multi-user host, each connection
+	// from the same IP may legitimately have a different username
+	ipString := remoteTCPAddr.IP.String()
+	if _, failedRecently := client.server.identCache.Get(ipString); failedRecently {
+		client.Notice(client.t("*** Could not find your username"))
+		return
+	}
+	resp, err := ident.Query(ipString, serverPort, clientPort, IdentTimeout)
+	if err != nil {
+		client.server.identCache.Set(ipString, "", client.server.Config().Server.LookupCache.NegativeTTL)
+	}
 	if err == nil {
 		err := client.SetNames(resp.Identifier, "", true)
 		if err == nil {
@@ -575,7 +681,7 @@ const (
 func (client *Client) isAuthorized(server *Server, config *Config, session *Session, forceRequireSASL bool) AuthOutcome {
 	saslSent := client.account != ""
 	// PASS requirement
-	if (config.Server.passwordBytes != nil) && session.passStatus != serverPassSuccessful && !(config.Accounts.SkipServerPassword && saslSent) {
+	if (session.serverPassword(config) != nil) && session.passStatus != serverPassSuccessful && !(config.Accounts.SkipServerPassword && saslSent) {
 		return authFailPass
 	}
 	// Tor connections may be required to authenticate with SASL
@@ -590,8 +696,17 @@ func (client *Client) isAuthorized(server *Server, config *Config, session *Sess
 	return authSuccess
 }
 
+// serverPassword returns the hashed password that the session must send via PASS,
+// if any. A listener-specific password takes precedence over server.password.
+func (session *Session) serverPassword(config *Config) []byte {
+	if listenerPassword := session.socket.conn.UnderlyingConn().Config.Password; listenerPassword != nil {
+		return listenerPassword
+	}
+	return config.Server.passwordBytes
+}
+
 func (session *Session) resetFakelag() {
-	var flc FakelagConfig = session.client.server.Config().Fakelag
+	var flc FakelagConfig = session.client.server.Config().connectionLimits(session.connectionClass).fakelag
 	flc.Enabled = flc.Enabled && !session.client.HasRoleCapabs("nofakelag")
 	session.fakelag.Initialize(flc)
 }
@@ -699,6 +814,10 @@ func (client *Client) run(session *Session) {
 				client.Send(nil, client.server.name, ERR_UNKNOWNERROR, "*", client.t("You have sent too many registration messages"))
 				break
 			}
+			if throttled, _ := session.registrationBurst.Touch(); throttled {
+				client.Send(nil, client.server.name, ERR_UNKNOWNERROR, "*", client.t("You have sent too many registration messages too quickly"))
+				break
+			}
 		}
 
 		msg, err := ircmsg.ParseLineStrict(line, true, MaxLineLen)
@@ -717,6 +836,10 @@ func (client *Client) run(session *Session) {
 			break
 		}
 
+		if alias, ok := client.server.Config().Server.commandAliases[msg.Command]; ok {
+			msg = alias.expand(msg)
+		}
+
 		cmd, exists := Commands[msg.Command]
 		if !exists {
 			cmd = unknownCommand
@@ -836,6 +959,7 @@ func (session *Session) handleIdleTimeout() {
 	if !shouldDestroy {
 		if shouldSendPing {
 			session.pingSent = true
+			session.pingSentAt = now
 		}
 		// check in again at the minimum of these 3 possible intervals:
 		// 1. the ping timeout (assuming we PING and they reply immediately with PONG)
@@ -871,7 +995,7 @@ func (session *Session) stopIdleTimer() {
 
 // Ping sends the client a PING message.
 func (session *Session) Ping() {
-	session.Send(nil, "", "PING", session.client.Nick())
+	session.SendPriority("", "PING", session.client.Nick())
 }
 
 func (client *Client) replayPrivmsgHistory(rb *ResponseBuffer, items []history.Item, target string) {
@@ -1009,40 +1133,67 @@ func (client *Client) ModeString() (str string) {
 	return "+" + client.modes.String()
 }
 
+// acceptsDirectMessageFrom checks the recipient's dm-policy account setting;
+// if the message is refused, it returns an (untranslated) explanation.
+func (client *Client) acceptsDirectMessageFrom(sender *Client, senderAccount string) (allowed bool, reason string) {
+	if sender == client || sender.Oper() != nil || client.AcceptListContains(sender) {
+		return true, ""
+	}
+	switch client.AccountSettings().DMPolicy {
+	case DMPolicyRegistered:
+		if senderAccount == "" {
+			return false, "This user only accepts direct messages from users who are logged into an account"
+		}
+	case DMPolicySharedChannel:
+		for _, channel := range client.Channels() {
+			if channel.hasClient(sender) {
+				return true, ""
+			}
+		}
+		return false, "This user only accepts direct messages from users who share a channel with them"
+	}
+	return true, ""
+}
+
+// callerIDAccepts checks whether the sender can message the client despite +g
+func (client *Client) callerIDAccepts(sender *Client) bool {
+	return sender == client || sender.Oper() != nil || client.AcceptListContains(sender)
+}
+
+// checkCallerIDNotify rate-limits the notifications that a +g client receives
+// about blocked messages
+func (client *Client) checkCallerIDNotify() bool {
+	now := time.Now().UTC()
+	client.stateMutex.Lock()
+	defer client.stateMutex.Unlock()
+	if now.Sub(client.callerIDNotified) < callerIDNotifyInterval {
+		return false
+	}
+	client.callerIDNotified = now
+	return true
+}
+
 // Friends refers to clients that share a channel with this client.
-func (client *Client) Friends(capabs ...caps.Capability) (result map[*Session]empty) {
-	result = make(map[*Session]empty)
+func (client *Client) Friends(capabs ...caps.Capability) (result SessionSet) {
+	result = make(SessionSet)
 
 	// look at the client's own sessions
-	addFriendsToSet(result, client, capabs...)
+	result.AddClient(client, capabs...)
 
 	for _, channel := range client.Channels() {
-		for _, member := range channel.auditoriumFriends(client) {
-			addFriendsToSet(result, member, capabs...)
-		}
+		result.AddChannelFriends(channel, client, capabs...)
 	}
 
 	return
 }
 
 // Friends refers to clients that share a channel or extended-monitor this client.
-func (client *Client) FriendsMonitors(capabs ...caps.Capability) (result map[*Session]empty) {
+func (client *Client) FriendsMonitors(capabs ...caps.Capability) (result SessionSet) {
 	result = client.Friends(capabs...)
 	client.server.monitorManager.AddMonitors(result, client.nickCasefolded, capabs...)
 	return
 }
 
-// helper for Friends
-func addFriendsToSet(set map[*Session]empty, client *Client, capabs ...caps.Capability) {
-	client.stateMutex.RLock()
-	defer client.stateMutex.RUnlock()
-	for _, session := range client.sessions {
-		if session.capabilities.HasAll(capabs...) {
-			set[session] = empty{}
-		}
-	}
-}
-
 func (client *Client) SetOper(oper *Oper) {
 	client.stateMutex.Lock()
 	defer client.stateMutex.Unlock()
@@ -1085,6 +1236,19 @@ func (client *Client) SetVHost(vhost string) (updated bool) {
 	return
 }
 
+// SetCloaked sets or unsets user mode +x, which displays the client's IP cloak
+// (if it has one) in place of its real hostname
+func (client *Client) SetCloaked(on bool) (updated bool) {
+	client.stateMutex.Lock()
+	defer client.stateMutex.Unlock()
+	if on && client.cloakedHostname == "" {
+		on = false
+	}
+	updated = client.modes.SetMode(modes.Cloaked, on)
+	client.updateNickMaskNoMutex()
+	return
+}
+
 // SetNick gives the client a nickname and marks it as registered, if necessary
 func (client *Client) SetNick(nick, nickCasefolded, skeleton string) (success bool) {
 	client.stateMutex.Lock()
@@ -1113,11 +1277,11 @@ func (client *Client) updateNickMaskNoMutex() {
 	}
 
 	client.hostname = client.getVHostNoMutex()
-	if client.hostname == "" {
+	if client.hostname == "" && client.modes.HasMode(modes.Cloaked) {
 		client.hostname = client.cloakedHostname
-		if client.hostname == "" {
-			client.hostname = client.rawHostname
-		}
+	}
+	if client.hostname == "" {
+		client.hostname = client.rawHostname
 	}
 
 	cfhostname := strings.ToLower(client.hostname)
@@ -1205,6 +1369,12 @@ func (client *Client) Quit(message string, session *Session) {
 // otherwise, destroys one specific session, only destroying the client if it
 // has no more sessions.
 func (client *Client) destroy(session *Session) {
+	client.destroyInBatch(session, nil)
+}
+
+// destroyInBatch is like destroy, but if `qb` is non-nil, the resulting QUIT
+// is relayed as part of a netsplit batch, for mass disconnections.
+func (client *Client) destroyInBatch(session *Session, qb *quitBatch) {
 	config := client.server.Config()
 	var sessionsToDestroy []*Session
 	var saveLastSeen bool
@@ -1306,22 +1476,12 @@ func (client *Client) destroy(session *Session) {
 		client.server.monitorManager.RemoveAll(session)
 
 		// remove from connection limits
-		var source string
-		if session.isTor {
-			client.server.torLimiter.RemoveClient()
-			source = "tor"
-		} else {
-			ip := session.realIP
-			if session.proxiedIP != nil {
-				ip = session.proxiedIP
-			}
-			client.server.connectionLimiter.RemoveClient(flatip.FromNetIP(ip))
-			source = ip.String()
-		}
+		source := client.server.releaseConnectionLimits(session)
 		if !shouldDestroy {
 			client.server.snomasks.Send(sno.LocalDisconnects, fmt.Sprintf(ircfmt.Unescape("Client session disconnected for [a:%s] [h:%s] [ip:%s]"), details.accountName, session.rawHostname, source))
 		}
 		client.server.logger.Info("connect-ip", fmt.Sprintf("disconnecting session of %s from %s", details.nick, source))
+		client.server.connectionEvent(session, connStageQuit, quitMessage)
 	}
 
 	// decrement stats if we have no more sessions, even if the client will not be destroyed
@@ -1368,18 +1528,20 @@ func (client *Client) destroy(session *Session) {
 
 	// clean up channels
 	// (note that if this is a reattach, client has no channels and therefore no friends)
-	friends := make(ClientSet)
+	friends := make(SessionSet)
 	channels = client.Channels()
 	for _, channel := range channels {
-		for _, member := range channel.auditoriumFriends(client) {
-			friends.Add(member)
-		}
+		friends.AddChannelFriends(channel, client)
 		channel.Quit(client)
 	}
-	friends.Remove(client)
 
 	// clean up server
 	client.server.clients.Remove(client)
+	client.server.invites.RemoveClient(client)
+	client.clearAcceptLists()
+	if nickDelay := config.Accounts.NickReservation.NickDelay; nickDelay != 0 && registered && !wasReattach && details.account != "" {
+		client.server.clients.DelayNick(details.nickCasefolded, details.account, nickDelay)
+	}
 
 	// clean up self
 	client.server.accounts.Logout(client)
@@ -1387,6 +1549,9 @@ func (client *Client) destroy(session *Session) {
 	if quitMessage == "" {
 		quitMessage = "Exited"
 	}
+	if registered && details.account != "" {
+		client.server.accounts.saveLastQuit(details.account, quitMessage)
+	}
 	splitQuitMessage := utils.MakeMessage(quitMessage)
 	isBot := client.HasMode(modes.Bot)
 	quitItem = history.Item{
@@ -1398,10 +1563,8 @@ func (client *Client) destroy(session *Session) {
 	}
 	var cache MessageCache
 	cache.Initialize(client.server, splitQuitMessage.Time, splitQuitMessage.Msgid, details.nickMask, details.accountName, isBot, nil, "QUIT", quitMessage)
-	for friend := range friends {
-		for _, session := range friend.Sessions() {
-			cache.Send(session)
-		}
+	for session := range friends {
+		qb.Send(session, &cache)
 	}
 
 	if registered {
@@ -1561,6 +1724,23 @@ func (session *Session) Send(tags map[string]string, prefix string, command stri
 	return session.SendRawMessage(msg, false)
 }
 
+// SendPriority is like Send, but queues the line in the priority lane of the
+// session's outbound queue, ahead of any pending output. It must only be used
+// for lines whose ordering relative to other lines doesn't matter (PING, PONG).
+func (session *Session) SendPriority(prefix string, command string, params ...string) (err error) {
+	msg := ircmsg.MakeMessage(nil, prefix, command, params...)
+	session.setTimeTag(&msg, time.Time{})
+	line, err := msg.LineBytesStrict(false, MaxLineLen)
+	if err != nil {
+		return
+	}
+	if session.client.server.logger.IsLoggingRawIO() {
+		logline := string(line[:len(line)-2]) // strip "\r\n"
+		session.client.server.logger.Debug("useroutput", session.client.Nick(), " ->", logline)
+	}
+	return session.socket.WritePriority(line)
+}
+
 func (session *Session) setTimeTag(msg *ircmsg.Message, serverTime time.Time) {
 	if session.capabilities.Has(caps.ServerTime) && !msg.HasTag("time") {
 		if serverTime.IsZero() {
@@ -1588,7 +1768,7 @@ func (client *Client) addChannel(channel *Channel, simulated bool) (err error) {
 	alwaysOn := client.alwaysOn
 	if client.destroyed {
 		err = errClientDestroyed
-	} else if client.oper == nil && len(client.channels) >= config.Channels.MaxChannelsPerClient {
+	} else if client.oper == nil && len(client.channels) >= config.connectionLimits(client.connectionClass).maxChannels {
 		err = errTooManyChannels
 	} else {
 		client.channels[channel] = empty{} // success
@@ -1612,54 +1792,6 @@ func (client *Client) removeChannel(channel *Channel) {
 	}
 }
 
-type channelInvite struct {
-	channelCreatedAt time.Time
-	invitedAt        time.Time
-}
-
-// Records that the client has been invited to join an invite-only channel
-func (client *Client) Invite(casefoldedChannel string, channelCreatedAt time.Time) {
-	now := time.Now().UTC()
-	client.stateMutex.Lock()
-	defer client.stateMutex.Unlock()
-
-	if client.invitedTo == nil {
-		client.invitedTo = make(map[string]channelInvite)
-	}
-
-	client.invitedTo[casefoldedChannel] = channelInvite{
-		channelCreatedAt: channelCreatedAt,
-		invitedAt:        now,
-	}
-
-	return
-}
-
-func (client *Client) Uninvite(casefoldedChannel string) {
-	client.stateMutex.Lock()
-	defer client.stateMutex.Unlock()
-	delete(client.invitedTo, casefoldedChannel)
-}
-
-// Checks that the client was invited to join a given channel
-func (client *Client) CheckInvited(casefoldedChannel string, createdTime time.Time) (invited bool) {
-	config := client.server.Config()
-	expTime := time.Duration(config.Channels.InviteExpiration)
-	now := time.Now().UTC()
-
-	client.stateMutex.Lock()
-	defer client.stateMutex.Unlock()
-
-	curInvite, ok := client.invitedTo[casefoldedChannel]
-	if ok {
-		// joining an invited channel "uses up" your invite, so you can't rejoin on kick
-		delete(client.invitedTo, casefoldedChannel)
-	}
-	invited = ok && (expTime == time.Duration(0) || now.Sub(curInvite.invitedAt) < expTime) &&
-		createdTime.Equal(curInvite.channelCreatedAt)
-	return
-}
-
 // Implements auto-oper by certfp (scans for an auto-eligible operator block that matches
 // the client's cert, then applies it).
 func (client *Client) attemptAutoOper(session *Session) {
@@ -1814,6 +1946,7 @@ const (
 	IncludeLastSeen
 	IncludeUserModes
 	IncludeRealname
+	IncludeAwayMessage
 )
 
 func (client *Client) markDirty(dirtyBits uint) {
@@ -1889,6 +2022,9 @@ func (client *Client) performWrite(additionalDirtyBits uint) {
 	if (dirtyBits & IncludeRealname) != 0 {
 		client.server.accounts.saveRealname(account, client.realname)
 	}
+	if (dirtyBits & IncludeAwayMessage) != 0 {
+		client.server.accounts.saveAwayMessage(account, client.AwayMessage())
+	}
 }
 
 // Blocking store; see Channel.Store and Socket.BlockingWrite
@@ -5,25 +5,41 @@
 package irc
 
 import (
+	"fmt"
+	"runtime/debug"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/ergochat/ergo/irc/caps"
 	"github.com/ergochat/ergo/irc/modes"
 	"github.com/ergochat/ergo/irc/utils"
 )
 
+const (
+	delayedNickPurgePeriod = 10 * time.Minute
+)
+
+// a nickname released by a disconnecting client, which only its account can
+// claim until it expires (see `nick-delay`)
+type delayedNick struct {
+	account string
+	expires time.Time
+}
+
 // ClientManager keeps track of clients by nick, enforcing uniqueness of casefolded nicks
 type ClientManager struct {
 	sync.RWMutex // tier 2
 	byNick       map[string]*Client
 	bySkeleton   map[string]*Client
+	delayedNicks map[string]delayedNick
 }
 
 // Initialize initializes a ClientManager.
 func (clients *ClientManager) Initialize() {
 	clients.byNick = make(map[string]*Client)
 	clients.bySkeleton = make(map[string]*Client)
+	clients.delayedNicks = make(map[string]delayedNick)
 }
 
 // Get retrieves a client from the manager, if they exist.
@@ -81,6 +97,56 @@ func (clients *ClientManager) Remove(client *Client) error {
 	return clients.removeInternal(client, oldcfnick, oldskeleton)
 }
 
+// DelayNick makes a nickname unavailable to anyone but `account` for `duration`
+func (clients *ClientManager) DelayNick(cfnick, account string, duration time.Duration) {
+	clients.Lock()
+	defer clients.Unlock()
+	clients.delayedNicks[cfnick] = delayedNick{
+		account: account,
+		expires: time.Now().Add(duration),
+	}
+}
+
+// purgeDelayedNicks deletes expired nick delays that were never looked up
+// (the ones that were are deleted by checkDelayedNick)
+func (clients *ClientManager) purgeDelayedNicks() {
+	now := time.Now()
+	clients.Lock()
+	defer clients.Unlock()
+	for nick, delayed := range clients.delayedNicks {
+		if now.After(delayed.expires) {
+			delete(clients.delayedNicks, nick)
+		}
+	}
+}
+
+func (server *Server) handleDelayedNickExpirations() {
+	defer func() {
+		if r := recover(); r != nil {
+			server.logger.Error("internal",
+				fmt.Sprintf("Panic in nick delay expiration: %v\n%s", r, debug.Stack()))
+		}
+		// either way, reschedule
+		time.AfterFunc(delayedNickPurgePeriod, server.handleDelayedNickExpirations)
+	}()
+
+	server.clients.purgeDelayedNicks()
+}
+
+// checkDelayedNick returns whether a delayed nickname is unavailable to `account`;
+// call with the lock held
+func (clients *ClientManager) checkDelayedNick(cfnick, account string) (unavailable bool) {
+	delayed, ok := clients.delayedNicks[cfnick]
+	if !ok {
+		return false
+	}
+	if time.Now().After(delayed.expires) {
+		delete(clients.delayedNicks, cfnick)
+		return false
+	}
+	return delayed.account != account
+}
+
 // SetNick sets a client's nickname, validating it against nicknames in use
 // XXX: dryRun validates a client's ability to claim a nick, without
 // actually claiming it
@@ -196,8 +262,10 @@ func (clients *ClientManager) SetNick(client *Client, session *Session, newNick
 				return "", errNicknameInUse, false
 			}
 		}
-		reattachSuccessful, numSessions, lastSeen, back := currentClient.AddSession(session)
-		if !reattachSuccessful {
+		reattachSuccessful, numSessions, lastSeen, back, err := currentClient.AddSession(session)
+		if err != nil {
+			return "", err, false
+		} else if !reattachSuccessful {
 			return "", errNicknameInUse, false
 		}
 		if numSessions == 1 {
@@ -220,6 +288,9 @@ func (clients *ClientManager) SetNick(client *Client, session *Session, newNick
 	if skeletonHolder != nil && skeletonHolder != client {
 		return "", errNicknameInUse, false
 	}
+	if clients.checkDelayedNick(newCfNick, account) {
+		return "", errNicknameReserved, false
+	}
 
 	if dryRun {
 		return "", nil, false
@@ -6,6 +6,7 @@ package irc
 import (
 	"testing"
 
+	"github.com/ergochat/ergo/irc/caps"
 	"github.com/ergochat/ergo/irc/utils"
 )
 
@@ -88,3 +89,80 @@ func TestWhoFields(t *testing.T) {
 		t.Error("failed to set and get")
 	}
 }
+
+func makeTestClient(capabs ...caps.Capability) (client *Client, session *Session) {
+	client = &Client{channels: make(ChannelSet)}
+	session = &Session{client: client}
+	session.capabilities.Enable(capabs...)
+	client.sessions = []*Session{session}
+	return
+}
+
+func makeTestChannel(members ...*Client) (channel *Channel) {
+	channel = &Channel{members: make(MemberSet)}
+	for _, member := range members {
+		channel.members.Add(member)
+		member.channels[channel] = empty{}
+	}
+	channel.regenerateMembersCache()
+	return
+}
+
+func TestFriendsDeduplication(t *testing.T) {
+	alice, aliceSession := makeTestClient(caps.AwayNotify)
+	bob, bobSession := makeTestClient(caps.AwayNotify)
+	carol, _ := makeTestClient()
+	bobSecond := &Session{client: bob}
+	bob.sessions = append(bob.sessions, bobSecond)
+
+	// alice shares two channels with bob and one with carol
+	makeTestChannel(alice, bob, carol)
+	makeTestChannel(alice, bob)
+	makeTestChannel(bob, carol)
+
+	friends := alice.Friends()
+	assertEqual(len(friends), 4, t)
+	for _, session := range []*Session{aliceSession, bobSession, bobSecond, carol.sessions[0]} {
+		if _, ok := friends[session]; !ok {
+			t.Errorf("missing recipient session")
+		}
+	}
+
+	// only sessions with the capability:
+	friends = alice.Friends(caps.AwayNotify)
+	assertEqual(len(friends), 2, t)
+	if _, ok := friends[bobSecond]; ok {
+		t.Errorf("session without the capability should be excluded")
+	}
+
+	// channel friends exclude the source
+	recipients := make(SessionSet)
+	for _, channel := range alice.Channels() {
+		recipients.AddChannelFriends(channel, alice)
+	}
+	assertEqual(len(recipients), 3, t)
+	if _, ok := recipients[aliceSession]; ok {
+		t.Errorf("source should be excluded")
+	}
+}
+
+func TestSetCloaked(t *testing.T) {
+	client, _ := makeTestClient()
+	client.nick, client.nickCasefolded, client.username = "alice", "alice", "~u"
+	client.rawHostname = "host.example.com"
+
+	// no cloak, so +x can't be set
+	assertEqual(client.SetCloaked(true), false, t)
+	assertEqual(client.Hostname(), "host.example.com", t)
+
+	client.cloakedHostname = "k5nmchkj2tcd4.irc"
+	assertEqual(client.SetCloaked(true), true, t)
+	assertEqual(client.NickMaskString(), "alice!~u@k5nmchkj2tcd4.irc", t)
+	assertEqual(client.SetCloaked(false), true, t)
+	assertEqual(client.NickMaskString(), "alice!~u@host.example.com", t)
+
+	// a vhost takes precedence over the cloak
+	client.SetCloaked(true)
+	client.SetVHost("vhost.example.com")
+	assertEqual(client.Hostname(), "vhost.example.com", t)
+}
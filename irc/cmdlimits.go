@@ -0,0 +1,64 @@
+// Copyright (c) 2021 Shivaram Lingamneni <slingamn@cs.stanford.edu>
+// released under the MIT license
+
+package irc
+
+import (
+	"strings"
+	"time"
+
+	"github.com/ergochat/irc-go/ircmsg"
+
+	"github.com/ergochat/ergo/irc/connection_limits"
+)
+
+// checkCommandRate records a use of an expensive command, as configured in
+// `limits.command-rates`, returning whether the client has exceeded its limit.
+// This is independent of fakelag, which applies to all commands equally.
+func (client *Client) checkCommandRate(config *Config, msg ircmsg.Message) (throttled bool, remainingTime time.Duration) {
+	limit, ok := config.Limits.CommandRates[msg.Command]
+	if !ok {
+		return
+	}
+	// for MONITOR, only changes to the list are limited, not queries
+	if msg.Command == "MONITOR" && 0 < len(msg.Params) {
+		switch strings.ToUpper(msg.Params[0]) {
+		case "L", "S":
+			return
+		}
+	}
+	if client.HasRoleCapabs("nofakelag") {
+		return
+	}
+
+	client.stateMutex.Lock()
+	defer client.stateMutex.Unlock()
+
+	if client.commandThrottles == nil {
+		client.commandThrottles = make(map[string]*connection_limits.GenericThrottle)
+	}
+	throttle := client.commandThrottles[msg.Command]
+	if throttle == nil {
+		throttle = new(connection_limits.GenericThrottle)
+		client.commandThrottles[msg.Command] = throttle
+	}
+	// pick up any changes from a rehash
+	throttle.Duration, throttle.Limit = limit.Window, limit.MaxUses
+	return throttle.Touch()
+}
+
+// checkNickChangeRate records an attempt by a registered client to change
+// its nickname, returning whether it has exceeded `limits.nick-changes`.
+// Opers are exempt.
+func (client *Client) checkNickChangeRate(config *Config) (throttled bool, remainingTime time.Duration) {
+	limit := config.Limits.NickChanges
+	if limit.MaxUses == 0 || client.Oper() != nil {
+		return
+	}
+
+	client.stateMutex.Lock()
+	defer client.stateMutex.Unlock()
+
+	client.nickChangeThrottle.Duration, client.nickChangeThrottle.Limit = limit.Window, limit.MaxUses
+	return client.nickChangeThrottle.Touch()
+}
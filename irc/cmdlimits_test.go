@@ -0,0 +1,45 @@
+// Copyright (c) 2021 Shivaram Lingamneni <slingamn@cs.stanford.edu>
+// released under the MIT license
+
+package irc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ergochat/irc-go/ircmsg"
+)
+
+func TestCheckCommandRate(t *testing.T) {
+	config := new(Config)
+	config.Limits.CommandRates = map[string]CommandRateLimit{
+		"LIST":    {MaxUses: 2, Window: time.Minute},
+		"MONITOR": {MaxUses: 1, Window: time.Minute},
+	}
+	client := new(Client)
+
+	list := ircmsg.MakeMessage(nil, "", "LIST")
+	for i := 0; i < 2; i++ {
+		throttled, _ := client.checkCommandRate(config, list)
+		assertEqual(throttled, false, t)
+	}
+	throttled, remaining := client.checkCommandRate(config, list)
+	assertEqual(throttled, true, t)
+	if !(0 < remaining && remaining <= time.Minute) {
+		t.Errorf("bad remaining time %v", remaining)
+	}
+
+	// other commands are unaffected
+	throttled, _ = client.checkCommandRate(config, ircmsg.MakeMessage(nil, "", "WHO", "#chan"))
+	assertEqual(throttled, false, t)
+
+	// MONITOR queries aren't limited, only changes
+	throttled, _ = client.checkCommandRate(config, ircmsg.MakeMessage(nil, "", "MONITOR", "+", "alice"))
+	assertEqual(throttled, false, t)
+	for i := 0; i < 3; i++ {
+		throttled, _ = client.checkCommandRate(config, ircmsg.MakeMessage(nil, "", "MONITOR", "L"))
+		assertEqual(throttled, false, t)
+	}
+	throttled, _ = client.checkCommandRate(config, ircmsg.MakeMessage(nil, "", "MONITOR", "-", "alice"))
+	assertEqual(throttled, true, t)
+}
@@ -0,0 +1,156 @@
+// Copyright (c) 2021 Shivaram Lingamneni <slingamn@cs.stanford.edu>
+// released under the MIT license
+
+package irc
+
+import (
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// upper bounds of the buckets of the command latency histogram;
+// there is an additional, implicit bucket for everything slower than the last one
+var commandLatencyBuckets = []time.Duration{
+	time.Millisecond,
+	10 * time.Millisecond,
+	100 * time.Millisecond,
+	time.Second,
+}
+
+// the counters for all unrecognized commands are aggregated under this name;
+// they reach Record via the fake unknownCommand (see (*Client).run)
+const unknownCommandStatsName = "*"
+
+// CommandMetrics is a snapshot of the counters for a single command.
+type CommandMetrics struct {
+	Command     string
+	Invocations uint64
+	Errors      uint64
+	TotalTime   time.Duration
+	Histogram   []uint64 // len(commandLatencyBuckets) + 1 buckets
+}
+
+// MeanLatency returns the mean time taken to handle the command.
+func (m *CommandMetrics) MeanLatency() time.Duration {
+	if m.Invocations == 0 {
+		return 0
+	}
+	return m.TotalTime / time.Duration(m.Invocations)
+}
+
+type commandCounters struct {
+	invocations uint64
+	errors      uint64
+	totalNanos  uint64
+	histogram   []uint64
+}
+
+// CommandStats tracks invocation counts, error counts, and latency histograms
+// for every command. The set of commands is fixed at initialization time,
+// so the hot path is lock-free.
+type CommandStats struct {
+	counters map[string]*commandCounters
+}
+
+func (cs *CommandStats) Initialize() {
+	cs.counters = make(map[string]*commandCounters, len(Commands)+1)
+	for name := range Commands {
+		cs.counters[name] = newCommandCounters()
+	}
+	cs.counters[unknownCommandStatsName] = newCommandCounters()
+}
+
+func newCommandCounters() *commandCounters {
+	return &commandCounters{
+		histogram: make([]uint64, len(commandLatencyBuckets)+1),
+	}
+}
+
+func latencyBucket(elapsed time.Duration) int {
+	for i, bound := range commandLatencyBuckets {
+		if elapsed < bound {
+			return i
+		}
+	}
+	return len(commandLatencyBuckets)
+}
+
+// Record records a single invocation of `command`.
+func (cs *CommandStats) Record(command string, elapsed time.Duration, failed bool) {
+	counters, ok := cs.counters[command]
+	if !ok {
+		counters = cs.counters[unknownCommandStatsName]
+	}
+	atomic.AddUint64(&counters.invocations, 1)
+	if failed {
+		atomic.AddUint64(&counters.errors, 1)
+	}
+	if elapsed < 0 {
+		elapsed = 0
+	}
+	atomic.AddUint64(&counters.totalNanos, uint64(elapsed))
+	atomic.AddUint64(&counters.histogram[latencyBucket(elapsed)], 1)
+}
+
+// Snapshot returns the metrics for every command that has been invoked at
+// least once, sorted by decreasing number of invocations.
+func (cs *CommandStats) Snapshot() (result []CommandMetrics) {
+	for name, counters := range cs.counters {
+		invocations := atomic.LoadUint64(&counters.invocations)
+		if invocations == 0 {
+			continue
+		}
+		metrics := CommandMetrics{
+			Command:     name,
+			Invocations: invocations,
+			Errors:      atomic.LoadUint64(&counters.errors),
+			TotalTime:   time.Duration(atomic.LoadUint64(&counters.totalNanos)),
+			Histogram:   make([]uint64, len(counters.histogram)),
+		}
+		for i := range counters.histogram {
+			metrics.Histogram[i] = atomic.LoadUint64(&counters.histogram[i])
+		}
+		result = append(result, metrics)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Invocations != result[j].Invocations {
+			return result[i].Invocations > result[j].Invocations
+		}
+		return result[i].Command < result[j].Command
+	})
+	return
+}
+
+// ExpvarValue is the JSON-serializable representation of the metrics,
+// exported via expvar on the pprof listener.
+func (cs *CommandStats) ExpvarValue() interface{} {
+	type expvarMetrics struct {
+		Invocations  uint64            `json:"invocations"`
+		Errors       uint64            `json:"errors"`
+		TotalSeconds float64           `json:"total_seconds"`
+		Latency      map[string]uint64 `json:"latency"`
+	}
+	snapshot := cs.Snapshot()
+	result := make(map[string]expvarMetrics, len(snapshot))
+	for _, metrics := range snapshot {
+		latency := make(map[string]uint64, len(metrics.Histogram))
+		for i, count := range metrics.Histogram {
+			latency[latencyBucketName(i)] = count
+		}
+		result[metrics.Command] = expvarMetrics{
+			Invocations:  metrics.Invocations,
+			Errors:       metrics.Errors,
+			TotalSeconds: metrics.TotalTime.Seconds(),
+			Latency:      latency,
+		}
+	}
+	return result
+}
+
+func latencyBucketName(i int) string {
+	if i < len(commandLatencyBuckets) {
+		return "<" + commandLatencyBuckets[i].String()
+	}
+	return ">=" + commandLatencyBuckets[len(commandLatencyBuckets)-1].String()
+}
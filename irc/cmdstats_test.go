@@ -0,0 +1,40 @@
+// Copyright (c) 2021 Shivaram Lingamneni <slingamn@cs.stanford.edu>
+// released under the MIT license
+
+package irc
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLatencyBucket(t *testing.T) {
+	assertEqual(latencyBucket(0), 0, t)
+	assertEqual(latencyBucket(500*time.Microsecond), 0, t)
+	assertEqual(latencyBucket(time.Millisecond), 1, t)
+	assertEqual(latencyBucket(50*time.Millisecond), 2, t)
+	assertEqual(latencyBucket(time.Minute), len(commandLatencyBuckets), t)
+}
+
+func TestCommandStats(t *testing.T) {
+	var cs CommandStats
+	cs.Initialize()
+
+	cs.Record("PRIVMSG", 2*time.Millisecond, false)
+	cs.Record("PRIVMSG", 4*time.Millisecond, true)
+	cs.Record("JOIN", 3*time.Second, false)
+	cs.Record("NOTACOMMAND", time.Microsecond, true)
+
+	snapshot := cs.Snapshot()
+	assertEqual(len(snapshot), 3, t)
+	privmsg := snapshot[0]
+	assertEqual(privmsg.Command, "PRIVMSG", t)
+	assertEqual(privmsg.Invocations, uint64(2), t)
+	assertEqual(privmsg.Errors, uint64(1), t)
+	assertEqual(privmsg.MeanLatency(), 3*time.Millisecond, t)
+	assertEqual(privmsg.Histogram[1], uint64(2), t)
+	// ties are broken alphabetically; unknown commands are aggregated under "*"
+	assertEqual(snapshot[1].Command, unknownCommandStatsName, t)
+	assertEqual(snapshot[2].Command, "JOIN", t)
+	assertEqual(snapshot[2].Histogram[len(commandLatencyBuckets)], uint64(1), t)
+}
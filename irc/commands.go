@@ -6,10 +6,17 @@
 package irc
 
 import (
+	"fmt"
+	"time"
+
 	"github.com/ergochat/irc-go/ircmsg"
 )
 
 // Command represents a command accepted from a client.
+// usablePreReg marks the commands accepted before registration completes:
+// CAP, NICK, USER, PASS, AUTHENTICATE, WEBIRC, PING/PONG and QUIT, plus a
+// few that are meaningful before connecting (LANGUAGE, PROTOCTL, REGISTER,
+// VERIFY). anything else gets ERR_NOTREGISTERED.
 type Command struct {
 	handler        func(server *Server, client *Client, msg ircmsg.Message, rb *ResponseBuffer) bool
 	usablePreReg   bool
@@ -23,6 +30,7 @@ func (cmd *Command) Run(server *Server, client *Client, session *Session, msg ir
 	rb := NewResponseBuffer(session)
 	rb.Label = GetLabel(msg)
 
+	start := time.Now()
 	exiting = func() bool {
 		defer rb.Send(true)
 
@@ -30,6 +38,9 @@ func (cmd *Command) Run(server *Server, client *Client, session *Session, msg ir
 			rb.Add(nil, server.name, ERR_NOTREGISTERED, "*", client.t("You need to register before you can use that command"))
 			return false
 		}
+		if server.isShunned(client, msg.Command) {
+			return false
+		}
 		if len(cmd.capabs) > 0 && !client.HasRoleCapabs(cmd.capabs...) {
 			rb.Add(nil, server.name, ERR_NOPRIVILEGES, client.Nick(), client.t("Permission Denied"))
 			return false
@@ -43,10 +54,16 @@ func (cmd *Command) Run(server *Server, client *Client, session *Session, msg ir
 			session.EndMultilineBatch("")
 			return false
 		}
+		if throttled, remainingTime := client.checkCommandRate(server.Config(), msg); throttled {
+			rb.Add(nil, server.name, RPL_TRYAGAIN, client.Nick(), msg.Command, fmt.Sprintf(client.t("Please wait at least %v and try again"), remainingTime))
+			return false
+		}
 
 		return cmd.handler(server, client, msg, rb)
 	}()
 
+	server.commandStats.Record(msg.Command, time.Since(start), rb.sawError)
+
 	// after each command, see if we can send registration to the client
 	if !exiting && !client.registered {
 		exiting = server.tryRegister(client, session)
@@ -75,6 +92,14 @@ var Commands map[string]Command
 
 func init() {
 	Commands = map[string]Command{
+		"ACCEPT": {
+			handler:   acceptHandler,
+			minParams: 1,
+		},
+		"ADMIN": {
+			handler:   adminHandler,
+			minParams: 0,
+		},
 		"AMBIANCE": {
 			handler:   sceneHandler,
 			minParams: 2,
@@ -88,6 +113,11 @@ func init() {
 			handler:   awayHandler,
 			minParams: 0,
 		},
+		"BACKUP": {
+			handler:   backupHandler,
+			minParams: 0,
+			capabs:    []string{"rehash"},
+		},
 		"BATCH": {
 			handler:        batchHandler,
 			minParams:      1,
@@ -102,6 +132,11 @@ func init() {
 			handler:   chathistoryHandler,
 			minParams: 4,
 		},
+		"CHECK": {
+			handler:   checkHandler,
+			minParams: 1,
+			capabs:    []string{"ban"},
+		},
 		"DEBUG": {
 			handler:   debugHandler,
 			minParams: 1,
@@ -141,7 +176,7 @@ func init() {
 		},
 		"INVITE": {
 			handler:   inviteHandler,
-			minParams: 2,
+			minParams: 1,
 		},
 		"ISON": {
 			handler:   isonHandler,
@@ -178,6 +213,14 @@ func init() {
 			handler:   lusersHandler,
 			minParams: 0,
 		},
+		"MAINTENANCE": {
+			handler: maintenanceHandler,
+			capabs:  []string{"rehash"},
+		},
+		"METADATA": {
+			handler:   metadataHandler,
+			minParams: 2,
+		},
 		"MODE": {
 			handler:   modeHandler,
 			minParams: 1,
@@ -240,6 +283,15 @@ func init() {
 			minParams:      2,
 			allowedInBatch: true,
 		},
+		"PROTOCTL": {
+			handler:      protoctlHandler,
+			usablePreReg: true,
+			minParams:    1,
+		},
+		"REDACT": {
+			handler:   redactHandler,
+			minParams: 2,
+		},
 		"RELAYMSG": {
 			handler:   relaymsgHandler,
 			minParams: 3,
@@ -253,6 +305,10 @@ func init() {
 			handler:   renameHandler,
 			minParams: 2,
 		},
+		"RULES": {
+			handler:   rulesHandler,
+			minParams: 0,
+		},
 		"SAJOIN": {
 			handler:   sajoinHandler,
 			minParams: 1,
@@ -276,6 +332,19 @@ func init() {
 			handler:   setnameHandler,
 			minParams: 1,
 		},
+		"SILENCE": {
+			handler:   silenceHandler,
+			minParams: 0,
+		},
+		"SHUN": {
+			handler:   shunHandler,
+			minParams: 1,
+			capabs:    []string{"ban"},
+		},
+		"STATS": {
+			handler:   statsHandler,
+			minParams: 1,
+		},
 		"SUMMON": {
 			handler: summonHandler,
 		},
@@ -320,6 +389,11 @@ func init() {
 			minParams: 1,
 			capabs:    []string{"ban"},
 		},
+		"UNSHUN": {
+			handler:   unshunHandler,
+			minParams: 1,
+			capabs:    []string{"ban"},
+		},
 		"USER": {
 			handler:      userHandler,
 			usablePreReg: true,
@@ -61,11 +61,37 @@ type listenerConfigBlock struct {
 	// SNI configuration, with multiple certificates:
 	TLSCertificates []TLSListenConfig `yaml:"tls-certificates"`
 	MinTLSVersion   string            `yaml:"min-tls-version"`
-	Proxy           bool
-	Tor             bool
-	STSOnly         bool `yaml:"sts-only"`
-	WebSocket       bool
-	HideSTS         bool `yaml:"hide-sts"`
+	// cipher suites and curves in order of preference, and ALPN protocols:
+	CipherSuites     []string `yaml:"cipher-suites"`
+	CurvePreferences []string `yaml:"curve-preferences"`
+	ALPNProtocols    []string `yaml:"alpn-protocols"`
+	Proxy            bool
+	Tor              bool
+	STSOnly          bool `yaml:"sts-only"`
+	WebSocket        bool
+	HideSTS          bool `yaml:"hide-sts"`
+	// mutual TLS: clients must present a certificate during the handshake,
+	// optionally one whose fingerprint was added to an account:
+	RequireClientCert  bool `yaml:"require-client-cert"`
+	RequireCertAccount bool `yaml:"require-cert-account"`
+	// reject insecure connections (see server.insecure-connections):
+	RejectInsecure bool `yaml:"reject-insecure"`
+	// overrides server.password for connections to this listener:
+	Password string
+}
+
+// InsecureConnectionsConfig is the policy for plaintext connections
+// that aren't from loopback or secure-nets.
+type InsecureConnectionsConfig struct {
+	Reject  bool
+	Warning string
+}
+
+// AdminInfoConfig is the information returned by the ADMIN command.
+type AdminInfoConfig struct {
+	Location     string
+	Organization string
+	Email        string
 }
 
 type HistoryCutoff uint
@@ -275,6 +301,8 @@ type MulticlientConfig struct {
 	AlwaysOn           PersistentStatus `yaml:"always-on"`
 	AutoAway           PersistentStatus `yaml:"auto-away"`
 	AlwaysOnExpiration custime.Duration `yaml:"always-on-expiration"`
+	MaxSessions        int              `yaml:"max-sessions"`
+	MaxSessionsPerIP   int              `yaml:"max-sessions-per-ip"`
 }
 
 type throttleConfig struct {
@@ -324,13 +352,16 @@ type AccountConfig struct {
 		GuestFormat            string `yaml:"guest-nickname-format"`
 		guestRegexp            *regexp.Regexp
 		guestRegexpFolded      *regexp.Regexp
-		ForceGuestFormat       bool `yaml:"force-guest-format"`
-		ForceNickEqualsAccount bool `yaml:"force-nick-equals-account"`
-		ForbidAnonNickChanges  bool `yaml:"forbid-anonymous-nick-changes"`
+		ForceGuestFormat       bool          `yaml:"force-guest-format"`
+		ForceNickEqualsAccount bool          `yaml:"force-nick-equals-account"`
+		ForbidAnonNickChanges  bool          `yaml:"forbid-anonymous-nick-changes"`
+		NickDelay              time.Duration `yaml:"nick-delay"`
 	} `yaml:"nick-reservation"`
 	Multiclient MulticlientConfig
 	Bouncer     *MulticlientConfig // # handle old name for 'multiclient'
 	VHosts      VHostConfig
+	Memos       MemosConfig
+	IdleAway    IdleAwayConfig   `yaml:"idle-away"`
 	AuthScript  AuthScriptConfig `yaml:"auth-script"`
 }
 
@@ -369,6 +400,17 @@ type VHostConfig struct {
 	MaxLength      int    `yaml:"max-length"`
 	ValidRegexpRaw string `yaml:"valid-regexp"`
 	validRegexp    *regexp.Regexp
+
+	AutoVHost struct {
+		Enabled  bool
+		Template string
+	} `yaml:"auto-vhost"`
+}
+
+type MemosConfig struct {
+	Enabled   bool
+	MaxMemos  int `yaml:"max-memos"`
+	MaxLength int `yaml:"max-length"`
 }
 
 type NickEnforcementMethod int
@@ -458,6 +500,7 @@ type OperClassConfig struct {
 	WhoisLine    string
 	Extends      string
 	Capabilities []string
+	Vhost        string
 }
 
 // OperConfig defines a specific operator's configuration.
@@ -481,14 +524,25 @@ type Limits struct {
 	IdentLen             int `yaml:"identlen"`
 	KickLen              int `yaml:"kicklen"`
 	MonitorEntries       int `yaml:"monitor-entries"`
+	SilenceEntries       int `yaml:"silence-entries"`
+	Modes                int
 	NickLen              int `yaml:"nicklen"`
 	TopicLen             int `yaml:"topiclen"`
 	WhowasEntries        int `yaml:"whowas-entries"`
 	RegistrationMessages int `yaml:"registration-messages"`
+	RegistrationBurst    int `yaml:"registration-burst"`
 	Multiline            struct {
 		MaxBytes int `yaml:"max-bytes"`
 		MaxLines int `yaml:"max-lines"`
 	}
+	CommandRates map[string]CommandRateLimit `yaml:"command-rates"`
+	NickChanges  CommandRateLimit            `yaml:"nick-changes"`
+}
+
+// CommandRateLimit limits how often a single client can use a command.
+type CommandRateLimit struct {
+	MaxUses int `yaml:"max-uses"`
+	Window  time.Duration
 }
 
 // STSConfig controls the STS configuration/
@@ -513,6 +567,25 @@ func (sts *STSConfig) Value() string {
 	return val
 }
 
+// LookupCacheConfig controls the caching of hostname and ident lookups.
+type LookupCacheConfig struct {
+	TTL         time.Duration
+	NegativeTTL time.Duration `yaml:"negative-ttl"`
+}
+
+// MetadataConfig controls the draft/metadata-2 extension.
+type MetadataConfig struct {
+	Enabled       bool
+	MaxSubs       int `yaml:"max-subs"`
+	MaxKeys       int `yaml:"max-keys"`
+	MaxValueBytes int `yaml:"max-value-bytes"`
+}
+
+type ChannelExpirationConfig struct {
+	FounderInactivity custime.Duration `yaml:"founder-inactivity"`
+	WarningPeriod     custime.Duration `yaml:"warning-period"`
+}
+
 type FakelagConfig struct {
 	Enabled           bool
 	Window            time.Duration
@@ -555,12 +628,23 @@ type Config struct {
 		STS                     STSConfig
 		LookupHostnames         *bool `yaml:"lookup-hostnames"`
 		lookupHostnames         bool
-		ForwardConfirmHostnames bool   `yaml:"forward-confirm-hostnames"`
-		CheckIdent              bool   `yaml:"check-ident"`
+		ForwardConfirmHostnames bool              `yaml:"forward-confirm-hostnames"`
+		CheckIdent              bool              `yaml:"check-ident"`
+		LookupCache             LookupCacheConfig `yaml:"lookup-cache"`
+		DNSResolver             ResolverConfig    `yaml:"dns-resolver"`
+		resolver                *dnsResolver
 		CoerceIdent             string `yaml:"coerce-ident"`
 		MOTD                    string
 		motdLines               []string
-		MOTDFormatting          bool `yaml:"motd-formatting"`
+		Rules                   string
+		rulesLines              []string
+		MOTDFormatting          bool              `yaml:"motd-formatting"`
+		RulesOnConnect          bool              `yaml:"rules-on-connect"`
+		AdminInfo               AdminInfoConfig   `yaml:"admin-info"`
+		CommandAliases          map[string]string `yaml:"command-aliases"`
+		commandAliases          map[string]commandAlias
+		UnknownCommandHints     map[string]string `yaml:"unknown-command-hints"`
+		unknownCommandHints     map[string]string
 		Relaymsg                struct {
 			Enabled            bool
 			Separators         string
@@ -580,18 +664,23 @@ type Config struct {
 		}
 		isupport                 isupport.List
 		IPLimits                 connection_limits.LimiterConfig `yaml:"ip-limits"`
+		ConnectionClasses        []ConnectionClassConfig         `yaml:"connection-classes"`
 		Cloaks                   cloaks.CloakConfig              `yaml:"ip-cloaking"`
 		SecureNetDefs            []string                        `yaml:"secure-nets"`
 		secureNets               []net.IPNet
+		InsecureConnections      InsecureConnectionsConfig `yaml:"insecure-connections"`
+		defaultConnectionLimits  connectionLimits
 		supportedCaps            *caps.Set
 		supportedCapsWithoutSTS  *caps.Set
 		capValues                caps.Values
 		Casemapping              Casemapping
-		EnforceUtf8              bool         `yaml:"enforce-utf8"`
-		OutputPath               string       `yaml:"output-path"`
-		IPCheckScript            ScriptConfig `yaml:"ip-check-script"`
-		OverrideServicesHostname string       `yaml:"override-services-hostname"`
-		MaxLineLen               int          `yaml:"max-line-len"`
+		EnforceUtf8              bool               `yaml:"enforce-utf8"`
+		OutputPath               string             `yaml:"output-path"`
+		IPCheckScript            ScriptConfig       `yaml:"ip-check-script"`
+		OverrideServicesHostname string             `yaml:"override-services-hostname"`
+		WhoisNotifications       bool               `yaml:"whois-notifications"`
+		MaxLineLen               int                `yaml:"max-line-len"`
+		AdminConsole             AdminConsoleConfig `yaml:"admin-console"`
 	}
 
 	Roleplay struct {
@@ -602,6 +691,8 @@ type Config struct {
 		addSuffix      bool
 	}
 
+	Metadata MetadataConfig
+
 	Extjwt struct {
 		Default  jwt.JwtServiceConfig            `yaml:",inline"`
 		Services map[string]jwt.JwtServiceConfig `yaml:"services"`
@@ -632,9 +723,14 @@ type Config struct {
 			Enabled               bool
 			OperatorOnly          bool `yaml:"operator-only"`
 			MaxChannelsPerAccount int  `yaml:"max-channels-per-account"`
+			TopicHistoryLength    int  `yaml:"topic-history-length"`
+			Expiration            ChannelExpirationConfig
 		}
 		ListDelay        time.Duration    `yaml:"list-delay"`
 		InviteExpiration custime.Duration `yaml:"invite-expiration"`
+		DefaultSlowMode  custime.Duration `yaml:"default-slow-mode"`
+
+		ReasonFiltering ReasonFilterConfig `yaml:"reason-filtering"`
 	}
 
 	OperClasses map[string]*OperClassConfig `yaml:"oper-classes"`
@@ -651,6 +747,7 @@ type Config struct {
 		RecoverFromErrors *bool `yaml:"recover-from-errors"`
 		recoverFromErrors bool
 		PprofListener     *string `yaml:"pprof-listener"`
+		StatusPage        bool    `yaml:"status-page"`
 	}
 
 	Limits Limits
@@ -688,6 +785,11 @@ type Config struct {
 			Whitelist []string
 			Blacklist []string
 		} `yaml:"tagmsg-storage"`
+		Redaction struct {
+			Enabled        bool
+			Window         custime.Duration
+			AllowOperators bool `yaml:"allow-operators"`
+		}
 	}
 
 	Filename string
@@ -698,6 +800,7 @@ type OperClass struct {
 	Title        string
 	WhoisLine    string          `yaml:"whois-line"`
 	Capabilities utils.StringSet // map to make lookups much easier
+	Vhost        string          // default vhost for opers of this class
 }
 
 // OperatorClasses returns a map of assembled operator classes from the given config.
@@ -744,6 +847,7 @@ func (conf *Config) OperatorClasses() (map[string]*OperClass, error) {
 				for capab := range einfo.Capabilities {
 					oc.Capabilities.Add(fixupCapability(capab))
 				}
+				oc.Vhost = einfo.Vhost
 			}
 
 			// add our own info
@@ -754,6 +858,12 @@ func (conf *Config) OperatorClasses() (map[string]*OperClass, error) {
 			for _, capab := range info.Capabilities {
 				oc.Capabilities.Add(fixupCapability(capab))
 			}
+			if info.Vhost != "" {
+				if !conf.Accounts.VHosts.validRegexp.MatchString(info.Vhost) {
+					return nil, fmt.Errorf("Operclass [%s] has an invalid vhost: `%s`", name, info.Vhost)
+				}
+				oc.Vhost = info.Vhost
+			}
 			if len(info.WhoisLine) > 0 {
 				oc.WhoisLine = info.WhoisLine
 			} else {
@@ -839,6 +949,9 @@ func (conf *Config) Operators(oc map[string]*OperClass) (map[string]*Oper, error
 			return nil, fmt.Errorf("Could not load operator [%s] - they use operclass [%s] which does not exist", name, opConf.Class)
 		}
 		oper.Class = class
+		if oper.Vhost == "" {
+			oper.Vhost = class.Vhost
+		}
 		if len(opConf.WhoisLine) > 0 {
 			oper.WhoisLine = opConf.WhoisLine
 		} else {
@@ -864,7 +977,7 @@ func loadTlsConfig(config listenerConfigBlock) (tlsConfig *tls.Config, err error
 		for _, certPairConf := range config.TLSCertificates {
 			cert, err := loadCertWithLeaf(certPairConf.Cert, certPairConf.Key)
 			if err != nil {
-				return nil, err
+				return nil, &CertKeyError{Err: err}
 			}
 			certificates = append(certificates, cert)
 		}
@@ -872,15 +985,29 @@ func loadTlsConfig(config listenerConfigBlock) (tlsConfig *tls.Config, err error
 		// normal configuration with one certificate
 		cert, err := loadCertWithLeaf(config.TLS.Cert, config.TLS.Key)
 		if err != nil {
-			return nil, err
+			return nil, &CertKeyError{Err: err}
 		}
 		certificates = append(certificates, cert)
 	} else {
 		// plaintext!
 		return nil, nil
 	}
+	cipherSuites, err := tlsCipherSuitesFromStrings(config.CipherSuites)
+	if err != nil {
+		return nil, err
+	}
+	curvePreferences, err := tlsCurvesFromStrings(config.CurvePreferences)
+	if err != nil {
+		return nil, err
+	}
 	clientAuth := tls.RequestClientCert
-	if config.WebSocket {
+	if config.RequireClientCert || config.RequireCertAccount {
+		if config.WebSocket {
+			return nil, errors.New("client certificates cannot be required on websocket listeners")
+		}
+		// we don't verify the certificate chain, only the fingerprint:
+		clientAuth = tls.RequireAnyClientCert
+	} else if config.WebSocket {
 		// if Chrome receives a server request for a client certificate
 		// on a websocket connection, it will immediately disconnect:
 		// https://bugs.chromium.org/p/chromium/issues/detail?id=329884
@@ -888,13 +1015,56 @@ func loadTlsConfig(config listenerConfigBlock) (tlsConfig *tls.Config, err error
 		clientAuth = tls.NoClientCert
 	}
 	result := tls.Config{
-		Certificates: certificates,
-		ClientAuth:   clientAuth,
-		MinVersion:   tlsMinVersionFromString(config.MinTLSVersion),
+		Certificates:     certificates,
+		ClientAuth:       clientAuth,
+		MinVersion:       tlsMinVersionFromString(config.MinTLSVersion),
+		CipherSuites:     cipherSuites,
+		CurvePreferences: curvePreferences,
+		NextProtos:       config.ALPNProtocols,
 	}
 	return &result, nil
 }
 
+// tlsCipherSuitesFromStrings looks up cipher suites by their standard names,
+// e.g., TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256. suites that the tls package
+// considers insecure are rejected. (TLS 1.3 suites are not configurable.)
+func tlsCipherSuitesFromStrings(names []string) (result []uint16, err error) {
+	if len(names) == 0 {
+		return nil, nil // use the tls package defaults
+	}
+	suites := make(map[string]uint16)
+	for _, suite := range tls.CipherSuites() {
+		suites[suite.Name] = suite.ID
+	}
+	for _, name := range names {
+		id, ok := suites[strings.ToUpper(name)]
+		if !ok {
+			return nil, fmt.Errorf("unknown or insecure TLS cipher suite: %s", name)
+		}
+		result = append(result, id)
+	}
+	return
+}
+
+// tlsCurvesFromStrings looks up elliptic curves by name: X25519, P256, P384, or P521
+func tlsCurvesFromStrings(names []string) (result []tls.CurveID, err error) {
+	for _, name := range names {
+		switch strings.ToUpper(strings.Replace(name, "-", "", -1)) {
+		case "X25519":
+			result = append(result, tls.X25519)
+		case "P256":
+			result = append(result, tls.CurveP256)
+		case "P384":
+			result = append(result, tls.CurveP384)
+		case "P521":
+			result = append(result, tls.CurveP521)
+		default:
+			return nil, fmt.Errorf("unknown TLS curve: %s", name)
+		}
+	}
+	return
+}
+
 func tlsMinVersionFromString(version string) uint16 {
 	version = strings.ToLower(version)
 	version = strings.TrimPrefix(version, "v")
@@ -944,7 +1114,7 @@ func (conf *Config) prepareListeners() (err error) {
 		}
 		lconf.TLSConfig, err = loadTlsConfig(block)
 		if err != nil {
-			return &CertKeyError{Err: err}
+			return err
 		}
 		lconf.RequireProxy = block.TLS.Proxy || block.Proxy
 		lconf.WebSocket = block.WebSocket
@@ -952,6 +1122,22 @@ func (conf *Config) prepareListeners() (err error) {
 			return fmt.Errorf("enabling a websocket listener requires the use of server.enforce-utf8")
 		}
 		lconf.HideSTS = block.HideSTS
+		if (block.RequireClientCert || block.RequireCertAccount) && lconf.TLSConfig == nil {
+			return fmt.Errorf("%s requires client certificates, but does not have TLS enabled", addr)
+		}
+		lconf.RequireCertAccount = block.RequireCertAccount
+		lconf.RejectInsecure = block.RejectInsecure
+		if block.Password != "" {
+			lconf.Password, err = decodeLegacyPasswordHash(block.Password)
+			if err != nil {
+				return fmt.Errorf("invalid password hash for listener %s: %w", addr, err)
+			}
+			if conf.Accounts.LoginViaPassCommand && !conf.Accounts.SkipServerPassword {
+				return errors.New("Using a server password and login-via-pass-command requires skip-server-password as well")
+			}
+			// #1634: see the corresponding comment on server.password
+			conf.Accounts.Registration.AllowBeforeConnect = false
+		}
 		conf.Server.trueListeners[addr] = lconf
 	}
 	return nil
@@ -1143,6 +1329,12 @@ func LoadConfig(filename string) (config *Config, err error) {
 	if config.Limits.RegistrationMessages == 0 {
 		config.Limits.RegistrationMessages = 1024
 	}
+	if config.Limits.Modes == 0 {
+		config.Limits.Modes = 20
+	}
+	if config.Limits.RegistrationBurst == 0 {
+		config.Limits.RegistrationBurst = 32
+	}
 	if config.Server.MaxLineLen < DefaultMaxLineLen {
 		config.Server.MaxLineLen = DefaultMaxLineLen
 	}
@@ -1199,6 +1391,10 @@ func LoadConfig(filename string) (config *Config, err error) {
 	config.Server.capValues[caps.STS] = config.Server.STS.Value()
 
 	config.Server.lookupHostnames = utils.BoolDefaultTrue(config.Server.LookupHostnames)
+	config.Server.resolver, err = newDNSResolver(config.Server.DNSResolver)
+	if err != nil {
+		return nil, err
+	}
 
 	// process webirc blocks
 	var newWebIRC []webircConfig
@@ -1379,6 +1575,22 @@ func LoadConfig(filename string) (config *Config, err error) {
 	if config.Accounts.VHosts.validRegexp == nil {
 		config.Accounts.VHosts.validRegexp = defaultValidVhostRegex
 	}
+	if config.Accounts.VHosts.AutoVHost.Enabled && !strings.Contains(config.Accounts.VHosts.AutoVHost.Template, autoVHostPlaceholder) {
+		return nil, fmt.Errorf("auto-vhost template must contain %s", autoVHostPlaceholder)
+	}
+
+	if config.Accounts.Memos.MaxMemos <= 0 {
+		config.Accounts.Memos.MaxMemos = 30
+	}
+	if config.Accounts.Memos.MaxLength <= 0 {
+		config.Accounts.Memos.MaxLength = 400
+	}
+	if config.Accounts.IdleAway.MinimumIdle <= 0 {
+		config.Accounts.IdleAway.MinimumIdle = 5 * time.Minute
+	}
+	if config.Accounts.IdleAway.Message == "" {
+		config.Accounts.IdleAway.Message = "Idle"
+	}
 
 	saslCapValue := "PLAIN,EXTERNAL,SCRAM-SHA-256"
 	// TODO(#1782) clean this up:
@@ -1420,6 +1632,40 @@ func LoadConfig(filename string) (config *Config, err error) {
 	}
 	config.Server.capValues[caps.Languages] = config.languageManager.CapValue()
 
+	config.Server.commandAliases, err = parseCommandAliases(config.Server.CommandAliases)
+	if err != nil {
+		return nil, err
+	}
+	if len(config.Server.UnknownCommandHints) != 0 {
+		config.Server.unknownCommandHints = make(map[string]string, len(config.Server.UnknownCommandHints))
+		for command, hint := range config.Server.UnknownCommandHints {
+			command = strings.ToUpper(command)
+			if _, ok := Commands[command]; ok {
+				return nil, fmt.Errorf("unknown-command-hints entry %s is an existing command", command)
+			}
+			config.Server.unknownCommandHints[command] = hint
+		}
+	}
+
+	if len(config.Limits.CommandRates) != 0 {
+		commandRates := make(map[string]CommandRateLimit, len(config.Limits.CommandRates))
+		for command, limit := range config.Limits.CommandRates {
+			command = strings.ToUpper(command)
+			if _, ok := Commands[command]; !ok {
+				return nil, fmt.Errorf("unknown command in limits.command-rates: %s", command)
+			}
+			if limit.MaxUses <= 0 || limit.Window <= 0 {
+				return nil, fmt.Errorf("limits.command-rates for %s must specify a positive max-uses and window", command)
+			}
+			commandRates[command] = limit
+		}
+		config.Limits.CommandRates = commandRates
+	}
+
+	if config.Limits.NickChanges.MaxUses < 0 || (config.Limits.NickChanges.MaxUses != 0 && config.Limits.NickChanges.Window <= 0) {
+		return nil, fmt.Errorf("limits.nick-changes must specify a positive max-uses and window")
+	}
+
 	if config.Server.Relaymsg.Enabled {
 		for _, char := range protocolBreakingNameCharacters {
 			if strings.ContainsRune(config.Server.Relaymsg.Separators, char) {
@@ -1431,6 +1677,22 @@ func LoadConfig(filename string) (config *Config, err error) {
 		config.Server.supportedCaps.Disable(caps.Relaymsg)
 	}
 
+	if config.Metadata.Enabled {
+		if config.Metadata.MaxSubs <= 0 {
+			config.Metadata.MaxSubs = defaultMetadataMaxSubs
+		}
+		if config.Metadata.MaxKeys <= 0 {
+			config.Metadata.MaxKeys = defaultMetadataMaxKeys
+		}
+		if config.Metadata.MaxValueBytes <= 0 {
+			config.Metadata.MaxValueBytes = defaultMetadataMaxValueBytes
+		}
+		config.Server.capValues[caps.Metadata] = fmt.Sprintf("max-subs=%d,max-keys=%d,max-value-bytes=%d",
+			config.Metadata.MaxSubs, config.Metadata.MaxKeys, config.Metadata.MaxValueBytes)
+	} else {
+		config.Server.supportedCaps.Disable(caps.Metadata)
+	}
+
 	config.Debug.recoverFromErrors = utils.BoolDefaultTrue(config.Debug.RecoverFromErrors)
 
 	// process operator definitions, store them to config.operators
@@ -1454,14 +1716,30 @@ func LoadConfig(filename string) (config *Config, err error) {
 	if config.Channels.MaxChannelsPerClient == 0 {
 		config.Channels.MaxChannelsPerClient = 100
 	}
+	if config.Limits.SilenceEntries == 0 {
+		config.Limits.SilenceEntries = 32
+	}
 	if config.Channels.Registration.MaxChannelsPerAccount == 0 {
 		config.Channels.Registration.MaxChannelsPerAccount = 15
 	}
+	if expiration := config.Channels.Registration.Expiration; expiration.FounderInactivity != 0 && expiration.FounderInactivity <= expiration.WarningPeriod {
+		return nil, errors.New("channels.registration.expiration.warning-period must be shorter than founder-inactivity")
+	}
+	err = config.Channels.ReasonFiltering.prepare()
+	if err != nil {
+		return nil, err
+	}
+
+	err = config.prepareConnectionClasses()
+	if err != nil {
+		return nil, err
+	}
 
 	config.Server.Compatibility.forceTrailing = utils.BoolDefaultTrue(config.Server.Compatibility.ForceTrailing)
 	config.Server.Compatibility.allowTruncation = utils.BoolDefaultTrue(config.Server.Compatibility.AllowTruncation)
 
 	config.loadMOTD()
+	config.loadRules()
 
 	// in the current implementation, we disable history by creating a history buffer
 	// with zero capacity. but the `enabled` config option MUST be respected regardless
@@ -1481,6 +1759,10 @@ func LoadConfig(filename string) (config *Config, err error) {
 		config.History.Persistent.DirectMessages = PersistentDisabled
 	}
 
+	if !config.History.Redaction.Enabled {
+		config.Server.supportedCaps.Disable(caps.MessageRedaction)
+	}
+
 	if config.History.Persistent.Enabled && !config.Datastore.MySQL.Enabled {
 		return nil, fmt.Errorf("You must configure a MySQL server in order to enable persistent history")
 	}
@@ -1565,6 +1847,7 @@ func (config *Config) generateISupport() (err error) {
 	isupport.Initialize()
 	isupport.Add("AWAYLEN", strconv.Itoa(config.Limits.AwayLen))
 	isupport.Add("BOT", "B")
+	isupport.Add("CALLERID", "g")
 	isupport.Add("CASEMAPPING", "ascii")
 	isupport.Add("CHANLIMIT", fmt.Sprintf("%s:%d", chanTypes, config.Channels.MaxChannelsPerClient))
 	isupport.Add("CHANMODES", chanmodesToken)
@@ -1573,29 +1856,36 @@ func (config *Config) generateISupport() (err error) {
 	}
 	isupport.Add("CHANNELLEN", strconv.Itoa(config.Limits.ChannelLen))
 	isupport.Add("CHANTYPES", chanTypes)
-	isupport.Add("ELIST", "U")
-	isupport.Add("EXCEPTS", "")
+	isupport.Add("ELIST", elistToken())
+	isupport.Add("EXCEPTS", string(modes.ExceptMask))
 	if config.Extjwt.Default.Enabled() || len(config.Extjwt.Services) != 0 {
 		isupport.Add("EXTJWT", "1")
 	}
-	isupport.Add("EXTBAN", ",m")
+	isupport.Add("EXTBAN", extbanToken())
 	isupport.Add("FORWARD", "f")
-	isupport.Add("INVEX", "")
+	isupport.Add("INVEX", string(modes.InviteMask))
 	isupport.Add("KICKLEN", strconv.Itoa(config.Limits.KickLen))
-	isupport.Add("MAXLIST", fmt.Sprintf("beI:%s", strconv.Itoa(config.Limits.ChanListModes)))
+	isupport.Add("MAXLIST", modes.MaxlistToken(config.Limits.ChanListModes))
 	isupport.Add("MAXTARGETS", maxTargetsString)
-	isupport.Add("MODES", "")
+	isupport.Add("MODES", strconv.Itoa(config.Limits.Modes))
 	isupport.Add("MONITOR", strconv.Itoa(config.Limits.MonitorEntries))
+	isupport.Add("NAMESX", "")
 	isupport.Add("NETWORK", config.Network.Name)
 	isupport.Add("NICKLEN", strconv.Itoa(config.Limits.NickLen))
-	isupport.Add("PREFIX", "(qaohv)~&@%+")
+	isupport.Add("PREFIX", modes.PrefixToken())
 	if config.Roleplay.Enabled {
 		isupport.Add("RPCHAN", "E")
 		isupport.Add("RPUSER", "E")
 	}
-	isupport.Add("STATUSMSG", "~&@%+")
+	if config.Server.Rules != "" {
+		isupport.Add("RULES", "")
+	}
+	isupport.Add("SAFELIST", "")
+	isupport.Add("SILENCE", strconv.Itoa(config.Limits.SilenceEntries))
+	isupport.Add("STATUSMSG", modes.StatusmsgToken())
 	isupport.Add("TARGMAX", fmt.Sprintf("NAMES:1,LIST:1,KICK:,WHOIS:1,USERHOST:10,PRIVMSG:%s,TAGMSG:%s,NOTICE:%s,MONITOR:%d", maxTargetsString, maxTargetsString, maxTargetsString, config.Limits.MonitorEntries))
 	isupport.Add("TOPICLEN", strconv.Itoa(config.Limits.TopicLen))
+	isupport.Add("UHNAMES", "")
 	if config.Server.Casemapping == CasemappingPRECIS {
 		isupport.Add("UTF8MAPPING", precisUTF8MappingToken)
 	}
@@ -1682,33 +1972,45 @@ func compileGuestRegexp(guestFormat string, casemapping Casemapping) (standard,
 	return
 }
 
-func (config *Config) loadMOTD() error {
-	if config.Server.MOTD != "" {
-		file, err := os.Open(config.Server.MOTD)
-		if err != nil {
-			return err
-		}
-		defer file.Close()
-		contents, err := io.ReadAll(file)
-		if err != nil {
-			return err
-		}
+func (config *Config) loadMOTD() (err error) {
+	config.Server.motdLines, err = loadMOTDFile(config.Server.MOTD, config.Server.MOTDFormatting)
+	return
+}
 
-		lines := bytes.Split(contents, []byte{'\n'})
-		for i, line := range lines {
-			lineToSend := string(bytes.TrimRight(line, "\r\n"))
-			if len(lineToSend) == 0 && i == len(lines)-1 {
-				// if the last line of the MOTD was properly terminated with \n,
-				// there's no need to send a blank line to clients
-				continue
-			}
-			if config.Server.MOTDFormatting {
-				lineToSend = ircfmt.Unescape(lineToSend)
-			}
-			// "- " is the required prefix for MOTD
-			lineToSend = fmt.Sprintf("- %s", lineToSend)
-			config.Server.motdLines = append(config.Server.motdLines, lineToSend)
+// the rules file has the same format as the MOTD, including formatting codes
+func (config *Config) loadRules() (err error) {
+	config.Server.rulesLines, err = loadMOTDFile(config.Server.Rules, config.Server.MOTDFormatting)
+	return
+}
+
+func loadMOTDFile(filename string, formatting bool) (result []string, err error) {
+	if filename == "" {
+		return
+	}
+	file, err := os.Open(filename)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+	contents, err := io.ReadAll(file)
+	if err != nil {
+		return
+	}
+
+	lines := bytes.Split(contents, []byte{'\n'})
+	for i, line := range lines {
+		lineToSend := string(bytes.TrimRight(line, "\r\n"))
+		if len(lineToSend) == 0 && i == len(lines)-1 {
+			// if the last line of the MOTD was properly terminated with \n,
+			// there's no need to send a blank line to clients
+			continue
 		}
+		if formatting {
+			lineToSend = ircfmt.Unescape(lineToSend)
+		}
+		// "- " is the required prefix for MOTD
+		lineToSend = fmt.Sprintf("- %s", lineToSend)
+		result = append(result, lineToSend)
 	}
-	return nil
+	return
 }
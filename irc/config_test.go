@@ -4,6 +4,7 @@
 package irc
 
 import (
+	"crypto/tls"
 	"reflect"
 	"testing"
 )
@@ -99,3 +100,26 @@ func TestEnvironmentOverrideErrors(t *testing.T) {
 		}
 	}
 }
+
+func TestTLSCipherSuitesAndCurves(t *testing.T) {
+	suites, err := tlsCipherSuitesFromStrings([]string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256", "tls_ecdhe_ecdsa_with_aes_256_gcm_sha384"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(suites, []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384}, t)
+	if _, err := tlsCipherSuitesFromStrings([]string{"TLS_RSA_WITH_RC4_128_SHA"}); err == nil {
+		t.Errorf("accepted an insecure cipher suite")
+	}
+	if _, err := tlsCipherSuitesFromStrings([]string{"TLS_NONEXISTENT"}); err == nil {
+		t.Errorf("accepted an unknown cipher suite")
+	}
+
+	curves, err := tlsCurvesFromStrings([]string{"x25519", "P-256", "P384"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(curves, []tls.CurveID{tls.X25519, tls.CurveP256, tls.CurveP384}, t)
+	if _, err := tlsCurvesFromStrings([]string{"P224"}); err == nil {
+		t.Errorf("accepted an unsupported curve")
+	}
+}
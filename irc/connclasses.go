@@ -0,0 +1,161 @@
+// Copyright (c) 2021 Shivaram Lingamneni <slingamn@cs.stanford.edu>
+// released under the MIT license
+
+package irc
+
+import (
+	"errors"
+	"fmt"
+	"net"
+
+	"code.cloudfoundry.org/bytefmt"
+
+	"github.com/ergochat/ergo/irc/utils"
+)
+
+// a connection class bundles per-connection resource limits, so that (for
+// example) Tor users, web users, and trusted bots can get distinct policies.
+// each session is assigned the first class whose criteria it matches, or the
+// server-wide defaults if none do. the class is assigned when the connection
+// is accepted, then recomputed during registration, once the final IP (after
+// WEBIRC) and the account (after SASL) are known.
+
+type ConnectionClassConfig struct {
+	Name string
+	// criteria; a connection must match all of the ones that are set:
+	Listeners []string
+	Nets      []string
+	LoggedIn  bool `yaml:"logged-in"`
+	// limits; unset values fall back to the server-wide defaults:
+	MaxSendQString  string `yaml:"max-sendq"`
+	Fakelag         *FakelagConfig
+	MaxChannels     int   `yaml:"max-channels"`
+	LookupHostnames *bool `yaml:"lookup-hostnames"`
+	CheckIdent      *bool `yaml:"check-ident"`
+
+	listeners utils.StringSet
+	nets      []net.IPNet
+	limits    connectionLimits
+}
+
+// connectionLimits are the effective limits for a connection class
+type connectionLimits struct {
+	maxSendQBytes   int
+	fakelag         FakelagConfig
+	maxChannels     int
+	lookupHostnames bool
+	checkIdent      bool
+}
+
+func (class *ConnectionClassConfig) matches(listener string, ip net.IP, loggedIn bool) bool {
+	if class.LoggedIn && !loggedIn {
+		return false
+	}
+	if len(class.nets) != 0 && (ip == nil || !utils.IPInNets(ip, class.nets)) {
+		return false
+	}
+	if len(class.Listeners) != 0 && !class.listeners.Has(listener) {
+		return false
+	}
+	return true
+}
+
+// prepareConnectionClasses validates the connection classes and computes
+// their effective limits; it must run after the server-wide defaults and
+// the listeners have been processed.
+func (config *Config) prepareConnectionClasses() (err error) {
+	config.Server.defaultConnectionLimits = connectionLimits{
+		maxSendQBytes:   config.Server.MaxSendQBytes,
+		fakelag:         config.Fakelag,
+		maxChannels:     config.Channels.MaxChannelsPerClient,
+		lookupHostnames: config.Server.lookupHostnames,
+		checkIdent:      config.Server.CheckIdent,
+	}
+
+	names := make(map[string]bool)
+	for i := range config.Server.ConnectionClasses {
+		class := &config.Server.ConnectionClasses[i]
+		if class.Name == "" {
+			return errors.New("connection classes must have a name")
+		}
+		if names[class.Name] {
+			return fmt.Errorf("duplicate connection class name: %s", class.Name)
+		}
+		names[class.Name] = true
+
+		class.listeners = make(utils.StringSet)
+		for _, listener := range class.Listeners {
+			if _, ok := config.Server.trueListeners[listener]; !ok {
+				return fmt.Errorf("connection class %s refers to a nonexistent listener: %s", class.Name, listener)
+			}
+			class.listeners.Add(listener)
+		}
+		class.nets, err = utils.ParseNetList(class.Nets)
+		if err != nil {
+			return fmt.Errorf("could not parse nets for connection class %s: %w", class.Name, err)
+		}
+
+		class.limits = config.Server.defaultConnectionLimits
+		if class.MaxSendQString != "" {
+			maxSendQBytes, err := bytefmt.ToBytes(class.MaxSendQString)
+			if err != nil {
+				return fmt.Errorf("could not parse max-sendq for connection class %s: %w", class.Name, err)
+			}
+			class.limits.maxSendQBytes = int(maxSendQBytes)
+		}
+		if class.Fakelag != nil {
+			class.limits.fakelag = *class.Fakelag
+		}
+		if class.MaxChannels != 0 {
+			class.limits.maxChannels = class.MaxChannels
+		}
+		if class.LookupHostnames != nil {
+			class.limits.lookupHostnames = *class.LookupHostnames
+		}
+		if class.CheckIdent != nil {
+			class.limits.checkIdent = *class.CheckIdent
+			if class.limits.checkIdent && config.Server.CoerceIdent != "" {
+				return fmt.Errorf("connection class %s can't enable check-ident while coerce-ident is configured", class.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// classifyConnection returns the name of the first connection class that
+// matches, or the empty string for the server-wide defaults
+func (config *Config) classifyConnection(listener string, ip net.IP, loggedIn bool) string {
+	for i := range config.Server.ConnectionClasses {
+		class := &config.Server.ConnectionClasses[i]
+		if class.matches(listener, ip, loggedIn) {
+			return class.Name
+		}
+	}
+	return ""
+}
+
+// connectionLimits returns the limits for a class; classes that no longer
+// exist (e.g., after a rehash) get the server-wide defaults
+func (config *Config) connectionLimits(className string) connectionLimits {
+	if className != "" {
+		for i := range config.Server.ConnectionClasses {
+			if config.Server.ConnectionClasses[i].Name == className {
+				return config.Server.ConnectionClasses[i].limits
+			}
+		}
+	}
+	return config.Server.defaultConnectionLimits
+}
+
+// updateConnectionClass recomputes the session's connection class, applying
+// the class's sendq and fakelag limits if it changed
+func (session *Session) updateConnectionClass(config *Config) {
+	className := config.classifyConnection(session.listener, session.IP(), session.client.Account() != "")
+	if className == session.connectionClass {
+		return
+	}
+	session.connectionClass = className
+	limits := config.connectionLimits(className)
+	session.socket.SetMaxSendQ(limits.maxSendQBytes)
+	session.resetFakelag()
+}
@@ -0,0 +1,81 @@
+// Copyright (c) 2021 Shivaram Lingamneni <slingamn@cs.stanford.edu>
+// released under the MIT license
+
+package irc
+
+import (
+	"net"
+	"testing"
+
+	"github.com/ergochat/ergo/irc/utils"
+)
+
+func connectionClassTestConfig(t *testing.T, classes []ConnectionClassConfig) *Config {
+	var config Config
+	config.Server.MaxSendQBytes = 96000
+	config.Channels.MaxChannelsPerClient = 100
+	config.Server.lookupHostnames = true
+	config.Server.trueListeners = map[string]utils.ListenerConfig{
+		":6667":                                 {},
+		"/hidden_service_sockets/ergo_tor_sock": {Tor: true},
+	}
+	config.Server.ConnectionClasses = classes
+	if err := config.prepareConnectionClasses(); err != nil {
+		t.Fatal(err)
+	}
+	return &config
+}
+
+func TestConnectionClasses(t *testing.T) {
+	lookupHostnames := false
+	config := connectionClassTestConfig(t, []ConnectionClassConfig{
+		{
+			Name:            "tor",
+			Listeners:       []string{"/hidden_service_sockets/ergo_tor_sock"},
+			MaxSendQString:  "16k",
+			MaxChannels:     10,
+			LookupHostnames: &lookupHostnames,
+		},
+		{
+			Name:        "bots",
+			Nets:        []string{"10.0.0.0/8"},
+			LoggedIn:    true,
+			MaxChannels: 500,
+			Fakelag:     &FakelagConfig{Enabled: false},
+		},
+	})
+
+	botIP := net.ParseIP("10.1.2.3")
+	assertEqual(config.classifyConnection("/hidden_service_sockets/ergo_tor_sock", utils.IPv4LoopbackAddress, false), "tor", t)
+	assertEqual(config.classifyConnection(":6667", botIP, true), "bots", t)
+	// all criteria must match:
+	assertEqual(config.classifyConnection(":6667", botIP, false), "", t)
+	assertEqual(config.classifyConnection(":6667", net.ParseIP("192.168.1.1"), true), "", t)
+
+	tor := config.connectionLimits("tor")
+	assertEqual(tor.maxSendQBytes, 16*1024, t)
+	assertEqual(tor.maxChannels, 10, t)
+	assertEqual(tor.lookupHostnames, false, t)
+
+	bots := config.connectionLimits("bots")
+	assertEqual(bots.maxSendQBytes, 96000, t)
+	assertEqual(bots.maxChannels, 500, t)
+	assertEqual(bots.lookupHostnames, true, t)
+
+	// unknown classes (e.g., removed by a rehash) get the defaults:
+	assertEqual(config.connectionLimits("nonexistent"), config.Server.defaultConnectionLimits, t)
+	assertEqual(config.connectionLimits("").maxChannels, 100, t)
+}
+
+func TestConnectionClassValidation(t *testing.T) {
+	var config Config
+	config.Server.ConnectionClasses = []ConnectionClassConfig{{Name: "web", Listeners: []string{":8097"}}}
+	if config.prepareConnectionClasses() == nil {
+		t.Errorf("nonexistent listener should be rejected")
+	}
+
+	config.Server.ConnectionClasses = []ConnectionClassConfig{{Name: "a"}, {Name: "a"}}
+	if config.prepareConnectionClasses() == nil {
+		t.Errorf("duplicate class names should be rejected")
+	}
+}
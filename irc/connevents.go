@@ -0,0 +1,142 @@
+// Copyright (c) 2021 Shivaram Lingamneni <slingamn@cs.stanford.edu>
+// released under the MIT license
+
+package irc
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/ergochat/ergo/irc/sno"
+)
+
+// every connection passes through a sequence of lifecycle stages (accepted,
+// hostname lookup finished, registered, authenticated, quit). each stage is
+// recorded as an event: it is logged (with the `connection-events` log type),
+// sent to the +e snomask, and counted per listener. every connection gets a
+// server-wide unique ID, so that its events can be correlated afterwards.
+
+type connectionStage uint
+
+const (
+	connStageAccepted connectionStage = iota
+	connStageLookupFinished
+	connStageRegistered
+	connStageAuthenticated
+	connStageQuit
+
+	numConnStages
+)
+
+var connStageNames = [numConnStages]string{
+	"accepted",
+	"lookup-finished",
+	"registered",
+	"authenticated",
+	"quit",
+}
+
+// ListenerConnectionMetrics is a snapshot of the counters for one listener.
+type ListenerConnectionMetrics struct {
+	Listener string
+	Stages   map[string]uint64
+	Open     uint64 // connections accepted and not yet quit
+}
+
+// ConnectionEvents assigns connection IDs and counts lifecycle events.
+type ConnectionEvents struct {
+	nextID uint64 // atomic
+
+	sync.Mutex // tier 1
+	counters   map[string]*[numConnStages]uint64
+}
+
+func (ce *ConnectionEvents) Initialize() {
+	ce.counters = make(map[string]*[numConnStages]uint64)
+}
+
+// NextID returns a new connection ID
+func (ce *ConnectionEvents) NextID() uint64 {
+	return atomic.AddUint64(&ce.nextID, 1)
+}
+
+func (ce *ConnectionEvents) record(listener string, stage connectionStage) {
+	ce.Lock()
+	defer ce.Unlock()
+	counters := ce.counters[listener]
+	if counters == nil {
+		counters = new([numConnStages]uint64)
+		ce.counters[listener] = counters
+	}
+	counters[stage]++
+}
+
+// Snapshot returns the counters for each listener, sorted by address
+func (ce *ConnectionEvents) Snapshot() (result []ListenerConnectionMetrics) {
+	ce.Lock()
+	defer ce.Unlock()
+	result = make([]ListenerConnectionMetrics, 0, len(ce.counters))
+	for listener, counters := range ce.counters {
+		metrics := ListenerConnectionMetrics{
+			Listener: listener,
+			Stages:   make(map[string]uint64, numConnStages),
+			Open:     counters[connStageAccepted] - counters[connStageQuit],
+		}
+		for stage, count := range counters {
+			metrics.Stages[connStageNames[stage]] = count
+		}
+		result = append(result, metrics)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Listener < result[j].Listener })
+	return
+}
+
+// OpenConnections returns the number of connections currently open on a
+// listener, or on all listeners if it is empty, e.g., to monitor draining
+// during maintenance
+func (ce *ConnectionEvents) OpenConnections(listener string) (result uint64) {
+	ce.Lock()
+	defer ce.Unlock()
+	for addr, counters := range ce.counters {
+		if listener == "" || listener == addr {
+			result += counters[connStageAccepted] - counters[connStageQuit]
+		}
+	}
+	return
+}
+
+// ExpvarValue returns the connection metrics, exported via expvar on the
+// pprof listener.
+func (ce *ConnectionEvents) ExpvarValue() interface{} {
+	type expvarMetrics struct {
+		Stages map[string]uint64 `json:"stages"`
+		Open   uint64            `json:"open"`
+	}
+	snapshot := ce.Snapshot()
+	result := make(map[string]expvarMetrics, len(snapshot))
+	for _, metrics := range snapshot {
+		result[metrics.Listener] = expvarMetrics{
+			Stages: metrics.Stages,
+			Open:   metrics.Open,
+		}
+	}
+	return result
+}
+
+// connectionEvent records a lifecycle event for a session
+func (server *Server) connectionEvent(session *Session, stage connectionStage, detail string) {
+	server.connEvents.record(session.listener, stage)
+
+	source := session.IP().String()
+	if session.isTor {
+		source = "tor"
+	}
+	message := fmt.Sprintf("Connection %d [l:%s] [ip:%s] %s", session.connID, session.listener, source, connStageNames[stage])
+	if detail != "" {
+		message = fmt.Sprintf("%s: %s", message, detail)
+	}
+	server.logger.Info("connection-events", message)
+	server.snomasks.Send(sno.LocalConnEvents, message)
+}
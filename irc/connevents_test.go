@@ -0,0 +1,36 @@
+// Copyright (c) 2021 Shivaram Lingamneni <slingamn@cs.stanford.edu>
+// released under the MIT license
+
+package irc
+
+import (
+	"testing"
+)
+
+func TestConnectionEvents(t *testing.T) {
+	var ce ConnectionEvents
+	ce.Initialize()
+
+	assertEqual(ce.NextID(), uint64(1), t)
+	assertEqual(ce.NextID(), uint64(2), t)
+
+	ce.record(":6697", connStageAccepted)
+	ce.record(":6697", connStageAccepted)
+	ce.record(":6697", connStageRegistered)
+	ce.record(":6697", connStageQuit)
+	ce.record(":8097", connStageAccepted)
+
+	assertEqual(ce.OpenConnections(":6697"), uint64(1), t)
+	assertEqual(ce.OpenConnections(":8097"), uint64(1), t)
+	assertEqual(ce.OpenConnections(":6667"), uint64(0), t)
+	assertEqual(ce.OpenConnections(""), uint64(2), t)
+
+	snapshot := ce.Snapshot()
+	assertEqual(len(snapshot), 2, t)
+	assertEqual(snapshot[0].Listener, ":6697", t)
+	assertEqual(snapshot[0].Stages["accepted"], uint64(2), t)
+	assertEqual(snapshot[0].Stages["registered"], uint64(1), t)
+	assertEqual(snapshot[0].Stages["authenticated"], uint64(0), t)
+	assertEqual(snapshot[0].Open, uint64(1), t)
+	assertEqual(snapshot[1].Listener, ":8097", t)
+}
@@ -0,0 +1,356 @@
+// Copyright (c) 2021 Shivaram Lingamneni <slingamn@cs.stanford.edu>
+// released under the MIT license
+
+package irc
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ergochat/irc-go/ircfmt"
+
+	"github.com/ergochat/ergo/irc/sno"
+	"github.com/ergochat/ergo/irc/utils"
+)
+
+// the admin console is a line-oriented administrative interface, served
+// over a unix domain socket. There is no authentication: access control
+// is entirely a matter of the filesystem permissions on the socket.
+// Each command produces zero or more lines of output, followed by a
+// terminating line that is either `OK` or `ERROR <description>`.
+
+const (
+	consoleMaxLineLen = 4096
+)
+
+type AdminConsoleConfig struct {
+	Enabled  bool
+	Path     string
+	BindMode os.FileMode `yaml:"bind-mode"`
+}
+
+type consoleCommand struct {
+	handler   func(server *Server, params []string, out *consoleOutput) error
+	help      string
+	minParams int
+	maxParams int // optional; if set, the final param contains the unsplit remainder of the line
+}
+
+type consoleOutput struct {
+	writer *bufio.Writer
+}
+
+func (out *consoleOutput) Line(line string) {
+	out.writer.WriteString(line)
+	out.writer.WriteString("\n")
+}
+
+func (out *consoleOutput) Linef(format string, args ...interface{}) {
+	out.Line(fmt.Sprintf(format, args...))
+}
+
+var consoleCommands map[string]consoleCommand
+
+func init() {
+	consoleCommands = map[string]consoleCommand{
+		"HELP": {
+			handler: consoleHelpHandler,
+			help:    "HELP: list available commands",
+		},
+		"STATUS": {
+			handler: consoleStatusHandler,
+			help:    "STATUS: show version, uptime, and client counts",
+		},
+		"REHASH": {
+			handler: consoleRehashHandler,
+			help:    "REHASH: reload the configuration file",
+		},
+		"BACKUP": {
+			handler:   consoleBackupHandler,
+			help:      "BACKUP [path]: write a snapshot of the datastore, by default under server.output-path",
+			maxParams: 1,
+		},
+		"USERS": {
+			handler: consoleUsersHandler,
+			help:    "USERS [mask]: list connected users, optionally filtered by a nickmask",
+		},
+		"CHANNELS": {
+			handler: consoleChannelsHandler,
+			help:    "CHANNELS: list channels and their member counts",
+		},
+		"KILL": {
+			handler:   consoleKillHandler,
+			help:      "KILL <nick> [reason]: disconnect a user",
+			minParams: 1,
+			maxParams: 2,
+		},
+		"DEFCON": {
+			handler: consoleDefconHandler,
+			help:    "DEFCON [level]: show or set the DEFCON level",
+		},
+		"SNOTICE": {
+			handler:   consoleSnoticeHandler,
+			help:      "SNOTICE <message>: send a server notice to operators subscribed to announcements",
+			minParams: 1,
+			maxParams: 1,
+		},
+	}
+}
+
+type adminConsole struct {
+	server   *Server
+	listener net.Listener
+	path     string
+}
+
+func (server *Server) setupAdminConsole(config *Config) {
+	conf := config.Server.AdminConsole
+	if server.adminConsole != nil {
+		if !conf.Enabled || conf.Path != server.adminConsole.path {
+			server.logger.Info("server", "Stopping admin console", server.adminConsole.path)
+			server.adminConsole.Stop()
+			server.adminConsole = nil
+		}
+	}
+	if conf.Enabled && server.adminConsole == nil {
+		console, err := newAdminConsole(server, conf)
+		if err != nil {
+			server.logger.Error("server", "couldn't start admin console", conf.Path, err.Error())
+			return
+		}
+		server.adminConsole = console
+		server.logger.Info("server", "Started admin console", conf.Path)
+	} else if conf.Enabled && conf.BindMode != 0 {
+		// path is unchanged, but the mode may have been
+		os.Chmod(conf.Path, conf.BindMode)
+	}
+}
+
+func newAdminConsole(server *Server, conf AdminConsoleConfig) (console *adminConsole, err error) {
+	// https://stackoverflow.com/a/34881585
+	os.Remove(conf.Path)
+	listener, err := net.Listen("unix", conf.Path)
+	if err != nil {
+		return
+	}
+	bindMode := conf.BindMode
+	if bindMode == 0 {
+		bindMode = 0600
+	}
+	if err = os.Chmod(conf.Path, bindMode); err != nil {
+		listener.Close()
+		return
+	}
+	console = &adminConsole{
+		server:   server,
+		listener: listener,
+		path:     conf.Path,
+	}
+	go console.serve()
+	return
+}
+
+func (console *adminConsole) Stop() error {
+	return console.listener.Close()
+}
+
+func (console *adminConsole) serve() {
+	for {
+		conn, err := console.listener.Accept()
+		if err == nil {
+			go console.handleConn(conn)
+		} else if errors.Is(err, net.ErrClosed) {
+			return
+		} else {
+			console.server.logger.Error("internal", "admin console accept error", err.Error())
+			return
+		}
+	}
+}
+
+func (console *adminConsole) handleConn(conn net.Conn) {
+	server := console.server
+	defer func() {
+		if r := recover(); r != nil {
+			server.logger.Error("internal",
+				fmt.Sprintf("Panic in admin console: %v\n%s", r, debug.Stack()))
+		}
+		conn.Close()
+	}()
+
+	server.logger.Info("opers", "Admin console session opened")
+	defer server.logger.Info("opers", "Admin console session closed")
+
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 0, 512), consoleMaxLineLen)
+	out := &consoleOutput{writer: bufio.NewWriter(conn)}
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		command, rest := line, ""
+		if idx := strings.IndexByte(line, ' '); idx != -1 {
+			command, rest = line[:idx], strings.TrimSpace(line[idx+1:])
+		}
+		command = strings.ToUpper(command)
+		if command == "QUIT" || command == "EXIT" {
+			out.Line("OK")
+			out.writer.Flush()
+			return
+		}
+		err := console.runCommand(command, rest, out)
+		if err == nil {
+			out.Line("OK")
+		} else {
+			out.Linef("ERROR %s", err.Error())
+		}
+		if out.writer.Flush() != nil {
+			return
+		}
+	}
+}
+
+func (console *adminConsole) runCommand(command, rest string, out *consoleOutput) error {
+	cmd, ok := consoleCommands[command]
+	if !ok {
+		return fmt.Errorf("Unknown command %s; try HELP", command)
+	}
+	var params []string
+	if cmd.maxParams != 0 {
+		params = utils.FieldsN(rest, cmd.maxParams)
+	} else {
+		params = strings.Fields(rest)
+	}
+	if len(params) < cmd.minParams {
+		return fmt.Errorf("Not enough parameters; usage is %s", cmd.help)
+	}
+	console.server.logger.Info("opers", "Admin console command", command)
+	return cmd.handler(console.server, params, out)
+}
+
+func consoleHelpHandler(server *Server, params []string, out *consoleOutput) error {
+	names := make([]string, 0, len(consoleCommands))
+	for name := range consoleCommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		out.Line(consoleCommands[name].help)
+	}
+	out.Line("QUIT: close the console session")
+	return nil
+}
+
+func consoleStatusHandler(server *Server, params []string, out *consoleOutput) error {
+	stats := server.stats.GetValues()
+	out.Linef("version: %s", Ver)
+	out.Linef("server: %s", server.name)
+	out.Linef("uptime: %s", time.Since(server.ctime).Truncate(time.Second))
+	out.Linef("users: %d (invisible %d, max %d)", stats.Total, stats.Invisible, stats.Max)
+	out.Linef("unregistered: %d", stats.Unknown)
+	out.Linef("operators: %d", stats.Operators)
+	out.Linef("channels: %d", server.channels.Len())
+	out.Linef("defcon: %d", server.Defcon())
+	return nil
+}
+
+func consoleRehashHandler(server *Server, params []string, out *consoleOutput) error {
+	server.logger.Info("server", "REHASH requested via admin console")
+	return server.rehash()
+}
+
+func consoleBackupHandler(server *Server, params []string, out *consoleOutput) error {
+	var path string
+	if len(params) != 0 {
+		path = params[0]
+	}
+	path, err := server.backupDatastore(path)
+	if err != nil {
+		return err
+	}
+	out.Line(path)
+	return nil
+}
+
+func consoleUsersHandler(server *Server, params []string, out *consoleOutput) error {
+	var matcher func(*Client) bool
+	if len(params) != 0 {
+		mask, err := CanonicalizeMaskWildcard(params[0])
+		if err != nil {
+			return err
+		}
+		maskRe, err := utils.CompileGlob(mask, false)
+		if err != nil {
+			return err
+		}
+		matcher = func(client *Client) bool {
+			for _, nickmask := range client.AllNickmasks() {
+				if maskRe.MatchString(nickmask) {
+					return true
+				}
+			}
+			return false
+		}
+	}
+	for _, client := range server.clients.AllClients() {
+		if matcher != nil && !matcher(client) {
+			continue
+		}
+		details := client.Details()
+		out.Linef("%s account=%s ip=%s sessions=%d channels=%d", details.nickMask, details.accountName, client.IPString(), len(client.Sessions()), client.NumChannels())
+	}
+	return nil
+}
+
+func consoleChannelsHandler(server *Server, params []string, out *consoleOutput) error {
+	for _, channel := range server.channels.Channels() {
+		out.Linef("%s %d", channel.Name(), len(channel.Members()))
+	}
+	return nil
+}
+
+func consoleKillHandler(server *Server, params []string, out *consoleOutput) error {
+	nickname := params[0]
+	comment := "<no reason supplied>"
+	if len(params) > 1 {
+		comment = params[1]
+	}
+	target := server.clients.Get(nickname)
+	if target == nil {
+		return errNoSuchNick
+	}
+	if target.AlwaysOn() {
+		out.Linef("%s is always-on and cannot be fully removed by KILL", target.Nick())
+	}
+	server.snomasks.Send(sno.LocalKills, fmt.Sprintf(ircfmt.Unescape("%s$r was killed by the admin console $c[grey][$r%s$c[grey]]"), target.Nick(), comment))
+	target.Quit(fmt.Sprintf("Killed (%s (%s))", server.name, comment), nil)
+	target.destroy(nil)
+	return nil
+}
+
+func consoleDefconHandler(server *Server, params []string, out *consoleOutput) error {
+	if len(params) != 0 {
+		level, err := strconv.Atoi(params[0])
+		if err != nil || level < 1 || 5 < level {
+			return errInvalidParams
+		}
+		server.SetDefcon(uint32(level))
+		server.snomasks.Send(sno.LocalAnnouncements, fmt.Sprintf("The admin console set DEFCON level to %d", level))
+	}
+	out.Linef("defcon: %d", server.Defcon())
+	return nil
+}
+
+func consoleSnoticeHandler(server *Server, params []string, out *consoleOutput) error {
+	server.snomasks.Send(sno.LocalAnnouncements, params[0])
+	return nil
+}
@@ -11,4 +11,7 @@ const (
 	maxLastArgLength = 400
 	// maxTargets is the maximum number of targets for PRIVMSG and NOTICE.
 	maxTargets = 4
+	// listFlushInterval is how many RPL_LIST lines are sent between flushes,
+	// so that LIST output can't overflow the sendq (SAFELIST).
+	listFlushInterval = 100
 )
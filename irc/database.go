@@ -150,6 +150,59 @@ func performAutoUpgrade(currentVersion int, config *Config) (err error) {
 	return err
 }
 
+// BackupDB writes a consistent snapshot of a live datastore to a new file.
+func BackupDB(db *buntdb.DB, path string) (err error) {
+	outfile, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return
+	}
+	// buntdb serializes Save against concurrent writers, so the snapshot
+	// is consistent without stopping the server:
+	err = db.Save(outfile)
+	if err == nil {
+		err = outfile.Sync()
+	}
+	closeErr := outfile.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+	}
+	return
+}
+
+// RestoreDB installs a backup created by BackupDB as the datastore,
+// implementing the `ergo restoredb` command.
+func RestoreDB(config *Config, backupPath string) (err error) {
+	path := config.Datastore.Path
+	if err = checkDBReadyForInit(path); err != nil {
+		return
+	}
+	if err = utils.CopyFile(backupPath, path); err != nil {
+		return
+	}
+
+	// sanity check that we restored a valid datastore; an older schema version
+	// is fine, since it will be upgraded on startup as usual
+	db, err := buntdb.Open(path)
+	if err == nil {
+		err = db.View(func(tx *buntdb.Tx) error {
+			vStr, err := tx.Get(keySchemaVersion)
+			if err == nil {
+				_, err = strconv.Atoi(vStr)
+			}
+			return err
+		})
+		db.Close()
+	}
+	if err != nil {
+		os.Remove(path)
+		return fmt.Errorf("Backup file %s is not a valid datastore: %w", backupPath, err)
+	}
+	return
+}
+
 // UpgradeDB upgrades the datastore to the latest schema.
 func UpgradeDB(config *Config) (err error) {
 	// #715: test that the database exists
@@ -0,0 +1,55 @@
+// Copyright (c) 2021 Shivaram Lingamneni <slingamn@cs.stanford.edu>
+// released under the MIT license
+
+package irc
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/tidwall/buntdb"
+)
+
+func TestBackupAndRestoreDB(t *testing.T) {
+	dir := t.TempDir()
+	db, err := buntdb.Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.Update(func(tx *buntdb.Tx) error {
+		tx.Set(keySchemaVersion, "21", nil)
+		tx.Set("account.exists alice", "1", nil)
+		return nil
+	})
+
+	backupPath := filepath.Join(dir, "backup.db")
+	if err := BackupDB(db, backupPath); err != nil {
+		t.Fatal(err)
+	}
+	// refuse to overwrite an existing file
+	if BackupDB(db, backupPath) == nil {
+		t.Error("backup should not overwrite an existing file")
+	}
+
+	var config Config
+	config.Datastore.Path = filepath.Join(dir, "restored.db")
+	if err := RestoreDB(&config, backupPath); err != nil {
+		t.Fatal(err)
+	}
+	if RestoreDB(&config, backupPath) == nil {
+		t.Error("restore should not overwrite an existing datastore")
+	}
+
+	restored, err := buntdb.Open(config.Datastore.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restored.Close()
+	var value string
+	restored.View(func(tx *buntdb.Tx) error {
+		value, _ = tx.Get("account.exists alice")
+		return nil
+	})
+	assertEqual(value, "1", t)
+}
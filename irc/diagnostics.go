@@ -0,0 +1,193 @@
+// Copyright (c) 2021 Shivaram Lingamneni <slingamn@cs.stanford.edu>
+// released under the MIT license
+
+package irc
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/tidwall/buntdb"
+)
+
+// self-test of the server's environment, run in the background at startup
+// and on demand with DEBUG DIAGNOSTICS. each check reports a problem that
+// wouldn't otherwise surface until it affected users (e.g., a certificate
+// about to expire, or an unreachable MTA). results are logged, and
+// the latest ones are exported as the `diagnostics` expvar.
+
+const (
+	diagnosticsTimeout   = 10 * time.Second
+	certificateExpiryDue = 14 * 24 * time.Hour
+)
+
+// DiagnosticResult is the outcome of a single diagnostic check.
+type DiagnosticResult struct {
+	Check   string
+	OK      bool
+	Message string
+}
+
+type diagnosticsState struct {
+	sync.Mutex
+	results []DiagnosticResult
+	ranAt   time.Time
+}
+
+// Diagnostics runs all the diagnostic checks, logs and stores the results,
+// and returns them.
+func (server *Server) Diagnostics() (results []DiagnosticResult) {
+	config := server.Config()
+	results = append(results, server.checkDatastore())
+	results = append(results, checkCertificates(config, time.Now())...)
+	results = append(results, checkServerNameResolves(config))
+	results = append(results, checkSMTP(config))
+
+	for _, result := range results {
+		if result.OK {
+			server.logger.Info("diagnostics", result.Check, result.Message)
+		} else {
+			server.logger.Warning("diagnostics", result.Check, result.Message)
+		}
+	}
+
+	server.diagnostics.Lock()
+	server.diagnostics.results = results
+	server.diagnostics.ranAt = time.Now().UTC()
+	server.diagnostics.Unlock()
+	return
+}
+
+// checkDatastore verifies that the schema version is current; it doesn't
+// walk the records, since that would block writes to the datastore
+func (server *Server) checkDatastore() (result DiagnosticResult) {
+	result.Check = "datastore"
+	var version, count int
+	err := server.store.View(func(tx *buntdb.Tx) (err error) {
+		vStr, err := tx.Get(keySchemaVersion)
+		if err != nil {
+			return fmt.Errorf("couldn't read schema version: %w", err)
+		}
+		version, err = strconv.Atoi(vStr)
+		if err != nil {
+			return fmt.Errorf("invalid schema version %#v", vStr)
+		}
+		count, err = tx.Len()
+		return
+	})
+	switch {
+	case err != nil:
+		result.Message = err.Error()
+	case version != latestDbSchema:
+		result.Message = fmt.Sprintf("schema version is %d, expected %d", version, latestDbSchema)
+	default:
+		result.OK = true
+		result.Message = fmt.Sprintf("schema version %d, %d records", version, count)
+	}
+	return
+}
+
+// checkCertificates reports the expiration of the TLS certificates
+// of each listener
+func checkCertificates(config *Config, now time.Time) (results []DiagnosticResult) {
+	addrs := make([]string, 0, len(config.Server.trueListeners))
+	for addr := range config.Server.trueListeners {
+		addrs = append(addrs, addr)
+	}
+	sort.Strings(addrs)
+
+	for _, addr := range addrs {
+		tlsConfig := config.Server.trueListeners[addr].TLSConfig
+		if tlsConfig == nil {
+			continue
+		}
+		for _, cert := range tlsConfig.Certificates {
+			if cert.Leaf == nil {
+				continue
+			}
+			result := DiagnosticResult{Check: fmt.Sprintf("certificate %s", addr)}
+			name := cert.Leaf.Subject.CommonName
+			if name == "" && len(cert.Leaf.DNSNames) != 0 {
+				name = cert.Leaf.DNSNames[0]
+			}
+			if name != "" {
+				result.Check += fmt.Sprintf(" (%s)", name)
+			}
+			notAfter := cert.Leaf.NotAfter
+			switch {
+			case !now.Before(notAfter):
+				result.Message = fmt.Sprintf("expired at %s", notAfter.Format(time.RFC1123))
+			case notAfter.Sub(now) < certificateExpiryDue:
+				result.Message = fmt.Sprintf("expires soon, at %s", notAfter.Format(time.RFC1123))
+			default:
+				result.OK = true
+				result.Message = fmt.Sprintf("expires at %s", notAfter.Format(time.RFC1123))
+			}
+			results = append(results, result)
+		}
+	}
+	return
+}
+
+// checkServerNameResolves checks that the server name is a resolvable hostname
+func checkServerNameResolves(config *Config) (result DiagnosticResult) {
+	result.Check = "server name"
+	ctx, cancel := context.WithTimeout(context.Background(), diagnosticsTimeout)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupHost(ctx, config.Server.Name)
+	if err != nil {
+		result.Message = fmt.Sprintf("%s doesn't resolve: %v", config.Server.Name, err)
+		return
+	}
+	result.OK = true
+	result.Message = fmt.Sprintf("%s resolves to %v", config.Server.Name, addrs)
+	return
+}
+
+// checkSMTP checks that the MTA, if one is configured, accepts connections
+func checkSMTP(config *Config) (result DiagnosticResult) {
+	result.Check = "smtp"
+	result.OK = true
+	emailConfig := config.Accounts.Registration.EmailVerification
+	if !emailConfig.Enabled {
+		result.Message = "e-mail is disabled"
+		return
+	} else if emailConfig.DirectSendingEnabled() {
+		result.Message = "e-mail is sent directly to recipients' MX hosts, not tested"
+		return
+	}
+
+	addr := net.JoinHostPort(emailConfig.MTAReal.Server, strconv.Itoa(emailConfig.MTAReal.Port))
+	conn, err := net.DialTimeout("tcp", addr, diagnosticsTimeout)
+	if err != nil {
+		result.OK = false
+		result.Message = fmt.Sprintf("couldn't connect to MTA %s: %v", addr, err)
+		return
+	}
+	conn.Close()
+	result.Message = fmt.Sprintf("MTA %s is reachable", addr)
+	return
+}
+
+// ExpvarValue is the JSON-serializable representation of the latest results.
+func (ds *diagnosticsState) ExpvarValue() interface{} {
+	ds.Lock()
+	defer ds.Unlock()
+	results := make([]map[string]interface{}, len(ds.results))
+	for i, result := range ds.results {
+		results[i] = map[string]interface{}{
+			"check":   result.Check,
+			"ok":      result.OK,
+			"message": result.Message,
+		}
+	}
+	return map[string]interface{}{
+		"ran_at":  ds.ranAt,
+		"results": results,
+	}
+}
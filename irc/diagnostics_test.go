@@ -0,0 +1,40 @@
+// Copyright (c) 2021 Shivaram Lingamneni <slingamn@cs.stanford.edu>
+// released under the MIT license
+
+package irc
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"testing"
+	"time"
+
+	"github.com/ergochat/ergo/irc/utils"
+)
+
+func TestCheckCertificates(t *testing.T) {
+	now := time.Now()
+	makeCert := func(name string, notAfter time.Time) tls.Certificate {
+		return tls.Certificate{Leaf: &x509.Certificate{Subject: pkix.Name{CommonName: name}, NotAfter: notAfter}}
+	}
+	var config Config
+	config.Server.trueListeners = map[string]utils.ListenerConfig{
+		":6667": {},
+		":6697": {TLSConfig: &tls.Config{Certificates: []tls.Certificate{
+			makeCert("good.example.com", now.Add(90*24*time.Hour)),
+			makeCert("soon.example.com", now.Add(24*time.Hour)),
+		}}},
+		":7000": {TLSConfig: &tls.Config{Certificates: []tls.Certificate{
+			makeCert("expired.example.com", now.Add(-time.Hour)),
+		}}},
+	}
+
+	results := checkCertificates(&config, now)
+	assertEqual(len(results), 3, t)
+	assertEqual(results[0].Check, "certificate :6697 (good.example.com)", t)
+	assertEqual(results[0].OK, true, t)
+	assertEqual(results[1].OK, false, t)
+	assertEqual(results[2].Check, "certificate :7000 (expired.example.com)", t)
+	assertEqual(results[2].OK, false, t)
+}
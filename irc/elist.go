@@ -0,0 +1,196 @@
+// Copyright (c) 2021 Shivaram Lingamneni <slingamn@cs.stanford.edu>
+// released under the MIT license
+
+package irc
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ergochat/ergo/irc/utils"
+)
+
+// LIST accepts search conditions (`ELIST` in ISUPPORT) such as `>10` (more
+// than 10 users) or `C<60` (created less than 60 minutes ago). Each supported
+// condition is described in elistConditions, which also generates the token.
+// It also accepts channel name masks, e.g., `#ergo-*` (ELIST M), and masks
+// for names to exclude, e.g., `!*-test` (ELIST N).
+
+// elistData is the subset of a channel's state that ELIST conditions examine
+type elistData struct {
+	nameCasefolded string
+	members        int
+	createdTime    time.Time
+	topicSetTime   time.Time
+}
+
+type elistCondition struct {
+	// the ELIST isupport flag:
+	flag byte
+	// the prefix of the condition, before the < or >:
+	prefix string
+	// `greater` is whether the condition was `>val` as opposed to `<val`
+	compile func(greater bool, val int) func(data *elistData) bool
+}
+
+// compare the age of a timestamp, in minutes, against a bound
+func elistAgeCondition(getTime func(data *elistData) time.Time) func(greater bool, val int) func(data *elistData) bool {
+	return func(greater bool, val int) func(data *elistData) bool {
+		bound := time.Duration(val) * time.Minute
+		return func(data *elistData) bool {
+			t := getTime(data)
+			if t.IsZero() {
+				return false
+			}
+			age := time.Since(t)
+			if greater {
+				return age > bound
+			}
+			return age < bound
+		}
+	}
+}
+
+var elistConditions = []elistCondition{
+	{
+		// user count, e.g., >10 or <50
+		flag: 'U',
+		compile: func(greater bool, val int) func(data *elistData) bool {
+			return func(data *elistData) bool {
+				if greater {
+					return data.members > val
+				}
+				return data.members < val
+			}
+		},
+	},
+	{
+		// channel creation time, in minutes ago, e.g., C<60
+		flag:   'C',
+		prefix: "C",
+		compile: elistAgeCondition(func(data *elistData) time.Time {
+			return data.createdTime
+		}),
+	},
+	{
+		// topic change time, in minutes ago, e.g., T>1440
+		flag:   'T',
+		prefix: "T",
+		compile: elistAgeCondition(func(data *elistData) time.Time {
+			return data.topicSetTime
+		}),
+	},
+}
+
+// elistToken returns the value of the ELIST isupport token
+func elistToken() string {
+	flags := []string{"M", "N"}
+	for _, condition := range elistConditions {
+		flags = append(flags, string(condition.flag))
+	}
+	sort.Strings(flags)
+	return strings.Join(flags, "")
+}
+
+// elistMatcher takes and matches ELIST conditions. a channel matches if it
+// satisfies all the conditions, matches any of the masks (if there are any),
+// and matches none of the exclusion masks.
+type elistMatcher struct {
+	conditions   []func(data *elistData) bool
+	masks        []*regexp.Regexp
+	excludeMasks []*regexp.Regexp
+}
+
+// Add parses a single condition, e.g., `>10` or `C<60`, returning whether it was valid
+func (matcher *elistMatcher) Add(param string) bool {
+	for _, condition := range elistConditions {
+		if !strings.HasPrefix(param, condition.prefix) {
+			continue
+		}
+		rest := param[len(condition.prefix):]
+		if len(rest) < 2 || (rest[0] != '<' && rest[0] != '>') {
+			continue
+		}
+		val, err := strconv.Atoi(rest[1:])
+		if err != nil || val < 0 {
+			return false
+		}
+		matcher.conditions = append(matcher.conditions, condition.compile(rest[0] == '>', val))
+		return true
+	}
+	return false
+}
+
+// isElistMask returns whether a LIST parameter is a channel name mask,
+// as opposed to a channel name or a condition
+func isElistMask(param string) bool {
+	return strings.HasPrefix(param, "!") || strings.ContainsAny(param, "*?")
+}
+
+// AddMask parses a channel name mask, e.g., `#ergo-*`, or a mask prefixed
+// with ! for channel names to exclude, returning whether it was valid
+func (matcher *elistMatcher) AddMask(param string) bool {
+	exclude := strings.HasPrefix(param, "!")
+	mask := strings.TrimPrefix(param, "!")
+	if mask == "" {
+		return false
+	}
+	casefoldedMask, err := CasefoldChannel(mask)
+	if err != nil {
+		casefoldedMask = strings.ToLower(mask)
+	}
+	compiled, err := utils.CompileGlob(casefoldedMask, false)
+	if err != nil {
+		return false
+	}
+	if exclude {
+		matcher.excludeMasks = append(matcher.excludeMasks, compiled)
+	} else {
+		matcher.masks = append(matcher.masks, compiled)
+	}
+	return true
+}
+
+// Matches checks whether the given channel matches all our conditions.
+func (matcher *elistMatcher) Matches(channel *Channel) bool {
+	if len(matcher.conditions) == 0 && len(matcher.masks) == 0 && len(matcher.excludeMasks) == 0 {
+		return true
+	}
+	data := channel.elistData()
+	return matcher.matchData(&data)
+}
+
+func (matcher *elistMatcher) matchData(data *elistData) bool {
+	for _, condition := range matcher.conditions {
+		if !condition(data) {
+			return false
+		}
+	}
+	for _, mask := range matcher.excludeMasks {
+		if mask.MatchString(data.nameCasefolded) {
+			return false
+		}
+	}
+	if len(matcher.masks) == 0 {
+		return true
+	}
+	for _, mask := range matcher.masks {
+		if mask.MatchString(data.nameCasefolded) {
+			return true
+		}
+	}
+	return false
+}
+
+func (channel *Channel) elistData() (data elistData) {
+	channel.stateMutex.RLock()
+	defer channel.stateMutex.RUnlock()
+	data.nameCasefolded = channel.nameCasefolded
+	data.members = len(channel.members)
+	data.createdTime = channel.createdTime
+	data.topicSetTime = channel.topicSetTime
+	return
+}
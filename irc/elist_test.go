@@ -0,0 +1,68 @@
+// Copyright (c) 2021 Shivaram Lingamneni <slingamn@cs.stanford.edu>
+// released under the MIT license
+
+package irc
+
+import (
+	"testing"
+	"time"
+)
+
+func TestElistToken(t *testing.T) {
+	assertEqual(elistToken(), "CMNTU", t)
+}
+
+func matchData(matcher *elistMatcher, data elistData) bool {
+	return matcher.matchData(&data)
+}
+
+func TestElistMatcher(t *testing.T) {
+	var matcher elistMatcher
+	assertEqual(matcher.Add(">2"), true, t)
+	assertEqual(matcher.Add("<10"), true, t)
+	assertEqual(matcher.Add("C<60"), true, t)
+	assertEqual(matcher.Add("X<60"), false, t)
+	assertEqual(matcher.Add(">"), false, t)
+	assertEqual(matcher.Add("T>abc"), false, t)
+	assertEqual(len(matcher.conditions), 3, t)
+
+	now := time.Now().UTC()
+	assertEqual(matchData(&matcher, elistData{members: 5, createdTime: now}), true, t)
+	assertEqual(matchData(&matcher, elistData{members: 2, createdTime: now}), false, t)
+	assertEqual(matchData(&matcher, elistData{members: 10, createdTime: now}), false, t)
+	assertEqual(matchData(&matcher, elistData{members: 5, createdTime: now.Add(-2 * time.Hour)}), false, t)
+
+	var topicMatcher elistMatcher
+	topicMatcher.Add("T>30")
+	// channels with no topic never match topic conditions
+	assertEqual(matchData(&topicMatcher, elistData{}), false, t)
+	assertEqual(matchData(&topicMatcher, elistData{topicSetTime: now.Add(-time.Hour)}), true, t)
+}
+
+func TestElistMasks(t *testing.T) {
+	assertEqual(isElistMask("#ergo-*"), true, t)
+	assertEqual(isElistMask("!#test"), true, t)
+	assertEqual(isElistMask("#ergo"), false, t)
+	assertEqual(isElistMask(">10"), false, t)
+
+	var matcher elistMatcher
+	assertEqual(matcher.AddMask("#Ergo-*"), true, t)
+	assertEqual(matcher.AddMask("!*-test"), true, t)
+	assertEqual(matcher.AddMask("!"), false, t)
+	assertEqual(len(matcher.masks), 1, t)
+	assertEqual(len(matcher.excludeMasks), 1, t)
+
+	assertEqual(matchData(&matcher, elistData{nameCasefolded: "#ergo-dev"}), true, t)
+	assertEqual(matchData(&matcher, elistData{nameCasefolded: "#ergo-test"}), false, t)
+	assertEqual(matchData(&matcher, elistData{nameCasefolded: "#other"}), false, t)
+
+	// a channel matching any of several masks is listed:
+	matcher = elistMatcher{}
+	assertEqual(matcher.AddMask("#a*"), true, t)
+	assertEqual(matcher.AddMask("#b*"), true, t)
+	assertEqual(matcher.AddMask("!#bad"), true, t)
+	assertEqual(matchData(&matcher, elistData{nameCasefolded: "#apple"}), true, t)
+	assertEqual(matchData(&matcher, elistData{nameCasefolded: "#banana"}), true, t)
+	assertEqual(matchData(&matcher, elistData{nameCasefolded: "#bad"}), false, t)
+	assertEqual(matchData(&matcher, elistData{nameCasefolded: "#cherry"}), false, t)
+}
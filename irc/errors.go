@@ -46,10 +46,12 @@ var (
 	errNicknameInvalid                = errors.New("invalid nickname")
 	errNicknameInUse                  = errors.New("nickname in use")
 	errInsecureReattach               = errors.New("insecure reattach")
+	errTooManySessions                = errors.New("Too many sessions are attached to this account")
 	errNicknameReserved               = errors.New("nickname is reserved")
 	errNickAccountMismatch            = errors.New(`Your nickname must match your account name; try logging out and logging back in with SASL`)
 	errNoExistingBan                  = errors.New("Ban does not exist")
 	errNoSuchChannel                  = errors.New(`No such channel`)
+	errNoSuchNick                     = errors.New(`No such nick`)
 	errChannelPurged                  = errors.New(`This channel was purged by the server operators and cannot be used`)
 	errConfusableIdentifier           = errors.New("This identifier is confusable with one already in use")
 	errInsufficientPrivs              = errors.New("Insufficient privileges")
@@ -59,7 +61,10 @@ var (
 	errInvalidParams                  = utils.ErrInvalidParams
 	errNoVhost                        = errors.New(`You do not have an approved vhost`)
 	errLimitExceeded                  = errors.New("Limit exceeded")
+	errJoinThrottled                  = errors.New("Too many recent joins")
 	errNoop                           = errors.New("Action was a no-op")
+	errRedactForbidden                = errors.New("You are not authorized to redact this message")
+	errRedactWindowExpired            = errors.New("This message is too old to be redacted")
 	errCASFailed                      = errors.New("Compare-and-swap update of database value failed")
 	errEmptyCredentials               = errors.New("No more credentials are approved")
 	errCredsExternallyManaged         = errors.New("Credentials are externally managed and cannot be changed here")
@@ -74,6 +79,9 @@ var (
 	errRegisteredOnly                 = errors.New("Cannot join registered-only channel without an account")
 	errValidEmailRequired             = errors.New("A valid email address is required for account registration")
 	errInvalidAccountRename           = errors.New("Account renames can only change the casefolding of the account name")
+	errAlreadyRegistered              = errors.New("You may not reregister")
+	errRegistrationIncomplete         = errors.New("Registration is not complete")
+	errInvalidRegistrationTransition  = errors.New("Invalid registration state transition")
 )
 
 // String Errors
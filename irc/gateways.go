@@ -67,8 +67,9 @@ func (wc *webircConfig) Populate() (err error) {
 func (client *Client) ApplyProxiedIP(session *Session, proxiedIP net.IP, tls bool) (err error, quitMsg string) {
 	// PROXY and WEBIRC are never accepted from a Tor listener, even if the address itself
 	// is whitelisted. Furthermore, don't accept PROXY or WEBIRC if we already accepted
-	// a proxied IP from any source (PROXY, WEBIRC, or X-Forwarded-For):
-	if session.isTor || session.proxiedIP != nil {
+	// a proxied IP from any source (PROXY, WEBIRC, or X-Forwarded-For),
+	// or if the hostname lookup for the real IP is already underway:
+	if session.isTor || session.proxiedIP != nil || session.hostnameLookup != nil {
 		return errBadProxyLine, ""
 	}
 
@@ -64,6 +64,9 @@ type SessionData struct {
 	connInfo  string
 	sessionID int64
 	caps      []string
+	sendQ     int
+	latency   time.Duration
+	connClass string
 }
 
 func (client *Client) AllSessionData(currentSession *Session, hasPrivs bool) (data []SessionData, currentIndex int) {
@@ -91,13 +94,28 @@ func (client *Client) AllSessionData(currentSession *Session, hasPrivs bool) (da
 		}
 		if hasPrivs {
 			data[i].connInfo = utils.DescribeConn(session.socket.conn.UnderlyingConn().Conn)
+			data[i].sendQ = session.socket.SendQLength()
+			data[i].latency = session.latency
+			data[i].connClass = session.connectionClass
 		}
 		data[i].caps = session.capabilities.Strings(caps.Cap302, nil, 300)
 	}
 	return
 }
 
-func (client *Client) AddSession(session *Session) (success bool, numSessions int, lastSeen time.Time, back bool) {
+// DeviceLastSeen returns a copy of the per-device last-seen times, which
+// determine the playback position of each device ID when it reattaches.
+func (client *Client) DeviceLastSeen() (result map[string]time.Time) {
+	client.stateMutex.RLock()
+	defer client.stateMutex.RUnlock()
+	result = make(map[string]time.Time, len(client.lastSeen))
+	for deviceID, lastSeen := range client.lastSeen {
+		result[deviceID] = lastSeen
+	}
+	return
+}
+
+func (client *Client) AddSession(session *Session) (success bool, numSessions int, lastSeen time.Time, back bool, err error) {
 	config := client.server.Config()
 	client.stateMutex.Lock()
 	defer client.stateMutex.Unlock()
@@ -106,6 +124,24 @@ func (client *Client) AddSession(session *Session) (success bool, numSessions in
 	if client.destroyed {
 		return
 	}
+	// bound the fan-out of messages to the client's sessions
+	if maxSessions := config.Accounts.Multiclient.MaxSessions; maxSessions != 0 && maxSessions <= len(client.sessions) {
+		err = errTooManySessions
+		return
+	}
+	if maxPerIP := config.Accounts.Multiclient.MaxSessionsPerIP; maxPerIP != 0 {
+		ip := session.IP()
+		sessionsFromIP := 0
+		for _, existing := range client.sessions {
+			if existing.IP().Equal(ip) {
+				sessionsFromIP++
+			}
+		}
+		if maxPerIP <= sessionsFromIP {
+			err = errTooManySessions
+			return
+		}
+	}
 	// success, attach the new session to the client
 	session.client = client
 	session.sessionID = client.nextSessionID
@@ -125,7 +161,7 @@ func (client *Client) AddSession(session *Session) (success bool, numSessions in
 			back = true
 		}
 	}
-	return true, len(client.sessions), lastSeen, back
+	return true, len(client.sessions), lastSeen, back, nil
 }
 
 func (client *Client) removeSession(session *Session) (success bool, length int) {
@@ -201,14 +237,27 @@ func (client *Client) Away() (result bool, message string) {
 }
 
 func (session *Session) SetAway(awayMessage string) {
+	session.setAway(awayMessage, false)
+}
+
+// setAway updates the session's away status and the client's aggregate one.
+// if idle is set, this is an automatic change made by idle-away, and it
+// returns false without doing anything if it would override an away status
+// that the session set explicitly.
+func (session *Session) setAway(awayMessage string, idle bool) (changed bool) {
 	client := session.client
 	config := client.server.Config()
 
 	client.stateMutex.Lock()
-	defer client.stateMutex.Unlock()
-
+	if idle {
+		if (awayMessage != "" && session.awayMessage != "") || (awayMessage == "" && !session.idleAway) {
+			client.stateMutex.Unlock()
+			return false
+		}
+	}
 	session.awayMessage = awayMessage
 	session.awayAt = time.Now().UTC()
+	session.idleAway = idle && awayMessage != ""
 
 	autoAway := client.registered && client.alwaysOn && persistenceEnabled(config.Accounts.Multiclient.AutoAway, client.accountSettings.AutoAway)
 	if autoAway {
@@ -216,7 +265,15 @@ func (session *Session) SetAway(awayMessage string) {
 	} else {
 		client.awayMessage = awayMessage
 	}
-	return
+	// without auto-away, an always-on client's away message is set explicitly,
+	// so it must be restored exactly if the server restarts
+	persist := client.alwaysOn && !autoAway
+	client.stateMutex.Unlock()
+
+	if persist {
+		client.markDirty(IncludeAwayMessage)
+	}
+	return true
 }
 
 func (client *Client) setAutoAwayNoMutex(config *Config) {
@@ -308,6 +365,7 @@ func (client *Client) Login(account ClientAccount) {
 	client.account = account.NameCasefolded
 	client.accountName = account.Name
 	client.accountSettings = account.Settings
+	client.setSilenceNoMutex(account.Settings.Silence)
 	// mark always-on here: it will not be respected until the client is registered
 	client.alwaysOn = alwaysOn
 	client.accountRegDate = account.RegisteredAt
@@ -325,6 +383,7 @@ func (client *Client) setCloakedHostname(cloak string) {
 	client.stateMutex.Lock()
 	defer client.stateMutex.Unlock()
 	client.cloakedHostname = cloak
+	client.modes.SetMode(modes.Cloaked, cloak != "")
 	client.updateNickMaskNoMutex()
 }
 
@@ -352,7 +411,82 @@ func (client *Client) Logout() {
 	client.alwaysOn = false
 	client.accountRegDate = time.Time{}
 	client.accountSettings = AccountSettings{}
+	client.setSilenceNoMutex(nil)
+	client.stateMutex.Unlock()
+}
+
+func (client *Client) AcceptList() (result []*Client) {
+	client.stateMutex.RLock()
+	defer client.stateMutex.RUnlock()
+	result = make([]*Client, 0, len(client.acceptList))
+	for accepted := range client.acceptList {
+		result = append(result, accepted)
+	}
+	return
+}
+
+func (client *Client) AcceptListContains(sender *Client) (result bool) {
+	client.stateMutex.RLock()
+	result = client.acceptList.Has(sender)
+	client.stateMutex.RUnlock()
+	return
+}
+
+func (client *Client) AddToAcceptList(target *Client) (added, full bool) {
+	client.stateMutex.Lock()
+	if client.acceptList.Has(target) {
+		client.stateMutex.Unlock()
+		return false, false
+	}
+	if maxAcceptListEntries <= len(client.acceptList) {
+		client.stateMutex.Unlock()
+		return false, true
+	}
+	if client.acceptList == nil {
+		client.acceptList = make(ClientSet)
+	}
+	client.acceptList.Add(target)
+	client.stateMutex.Unlock()
+
+	target.stateMutex.Lock()
+	if target.acceptedBy == nil {
+		target.acceptedBy = make(ClientSet)
+	}
+	target.acceptedBy.Add(client)
+	target.stateMutex.Unlock()
+	return true, false
+}
+
+func (client *Client) RemoveFromAcceptList(target *Client) (removed bool) {
+	client.stateMutex.Lock()
+	removed = client.acceptList.Has(target)
+	client.acceptList.Remove(target)
 	client.stateMutex.Unlock()
+
+	target.stateMutex.Lock()
+	target.acceptedBy.Remove(client)
+	target.stateMutex.Unlock()
+	return
+}
+
+// clearAcceptLists removes a quitting client from every accept list it is on,
+// and forgets its own accept list
+func (client *Client) clearAcceptLists() {
+	client.stateMutex.Lock()
+	acceptList, acceptedBy := client.acceptList, client.acceptedBy
+	client.acceptList, client.acceptedBy = nil, nil
+	client.stateMutex.Unlock()
+
+	for owner := range acceptedBy {
+		owner.stateMutex.Lock()
+		owner.acceptList.Remove(client)
+		owner.stateMutex.Unlock()
+	}
+	for target := range acceptList {
+		target.stateMutex.Lock()
+		target.acceptedBy.Remove(client)
+		target.stateMutex.Unlock()
+	}
 }
 
 func (client *Client) AccountSettings() (result AccountSettings) {
@@ -374,6 +508,7 @@ func (client *Client) SetAccountSettings(settings AccountSettings) {
 		client.alwaysOn = alwaysOn
 	}
 	client.accountSettings = settings
+	client.setSilenceNoMutex(settings.Silence)
 	client.stateMutex.Unlock()
 	if becameAlwaysOn {
 		client.markDirty(IncludeAllAttrs)
@@ -458,9 +593,20 @@ func (client *Client) detailsNoMutex() (result ClientDetails) {
 func (client *Client) UpdateActive(session *Session) {
 	now := time.Now().UTC()
 	client.stateMutex.Lock()
-	defer client.stateMutex.Unlock()
 	client.lastActive = now
 	session.lastActive = now
+	// activity ends an automatic idle-away:
+	var idleSessions []*Session
+	for _, cSession := range client.sessions {
+		if cSession.idleAway {
+			idleSessions = append(idleSessions, cSession)
+		}
+	}
+	client.stateMutex.Unlock()
+
+	if len(idleSessions) != 0 {
+		client.setIdleAway(idleSessions, "")
+	}
 }
 
 func (client *Client) Realname() string {
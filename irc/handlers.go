@@ -96,6 +96,8 @@ func sendSuccessfulRegResponse(service *ircService, client *Client, rb *Response
 // sendSuccessfulAccountAuth means that an account auth attempt completed successfully, and is used to dispatch messages.
 func sendSuccessfulAccountAuth(service *ircService, client *Client, rb *ResponseBuffer, forSASL bool) {
 	details := client.Details()
+	client.server.connectionEvent(rb.session, connStageAuthenticated, details.accountName)
+	client.server.notifyLogin(client, rb.session)
 
 	if service != nil {
 		service.Notice(rb, fmt.Sprintf(client.t("You're now logged in as %s"), details.accountName))
@@ -108,16 +110,12 @@ func sendSuccessfulAccountAuth(service *ircService, client *Client, rb *Response
 	}
 
 	if client.Registered() {
-		// dispatch account-notify
-		for friend := range client.FriendsMonitors(caps.AccountNotify) {
-			if friend != rb.session {
-				friend.Send(nil, details.nickMask, "ACCOUNT", details.accountName)
-			}
-		}
-		if rb.session.capabilities.Has(caps.AccountNotify) {
-			rb.Add(nil, details.nickMask, "ACCOUNT", details.accountName)
-		}
+		dispatchAccountNotify(client, details.nickMask, details.accountName, rb)
 		client.server.sendLoginSnomask(details.nickMask, details.accountName)
+		client.applyAmodes(rb)
+		if memoNotice := client.server.unreadMemosNotice(client); memoNotice != "" {
+			rb.Add(nil, memoservService.prefix, "NOTICE", details.nick, memoNotice)
+		}
 	}
 
 	// #1479: for Tor clients, replace the hostname with the always-on cloak here
@@ -141,6 +139,118 @@ func (server *Server) sendLoginSnomask(nickMask, accountName string) {
 	server.snomasks.Send(sno.LocalAccounts, fmt.Sprintf(ircfmt.Unescape("Client $c[grey][$r%s$c[grey]] logged into account $c[grey][$r%s$c[grey]]"), nickMask, accountName))
 }
 
+// ACCEPT <nick>{,<nick>}
+// ACCEPT -<nick>{,-<nick>}
+// ACCEPT *
+func acceptHandler(server *Server, client *Client, msg ircmsg.Message, rb *ResponseBuffer) bool {
+	nick := client.Nick()
+	for _, entry := range strings.Split(msg.Params[0], ",") {
+		if entry == "*" {
+			acceptList := liveAcceptList(server, client)
+			sort.Strings(acceptList)
+			for _, line := range utils.BuildTokenLines(400, acceptList, " ") {
+				rb.Add(nil, server.name, RPL_ACCEPTLIST, nick, line)
+			}
+			rb.Add(nil, server.name, RPL_ENDOFACCEPT, nick, client.t("End of /ACCEPT list"))
+			continue
+		}
+
+		remove := strings.HasPrefix(entry, "-")
+		entry = strings.TrimLeft(entry, "+-")
+		if entry == "" {
+			continue
+		}
+		target := server.clients.Get(entry)
+		if remove {
+			if target == nil || !client.RemoveFromAcceptList(target) {
+				rb.Add(nil, server.name, ERR_ACCEPTNOT, nick, utils.SafeErrorParam(entry), client.t("is not on your accept list"))
+			}
+			continue
+		}
+
+		if target == nil {
+			rb.Add(nil, server.name, ERR_NOSUCHNICK, nick, utils.SafeErrorParam(entry), client.t("No such nick"))
+			continue
+		}
+		tDetails := target.Details()
+		added, full := client.AddToAcceptList(target)
+		if full {
+			rb.Add(nil, server.name, ERR_ACCEPTFULL, nick, client.t("Accept list is full"))
+			break
+		} else if !added {
+			rb.Add(nil, server.name, ERR_ACCEPTEXIST, nick, tDetails.nick, client.t("is already on your accept list"))
+		}
+	}
+	return false
+}
+
+// liveAcceptList returns the current nicks of the clients on the accept list,
+// dropping any that quit while being added (clearAcceptLists handles the rest)
+func liveAcceptList(server *Server, client *Client) (nicks []string) {
+	for _, accepted := range client.AcceptList() {
+		if server.clients.Get(accepted.NickCasefolded()) == accepted {
+			nicks = append(nicks, accepted.Nick())
+		} else {
+			client.RemoveFromAcceptList(accepted)
+		}
+	}
+	return
+}
+
+// SILENCE
+// SILENCE <mask>{,<mask>}
+// SILENCE -<mask>{,-<mask>}
+func silenceHandler(server *Server, client *Client, msg ircmsg.Message, rb *ResponseBuffer) bool {
+	nick := client.Nick()
+	if len(msg.Params) == 0 {
+		for _, mask := range client.SilenceList() {
+			rb.Add(nil, server.name, RPL_SILELIST, nick, mask)
+		}
+		rb.Add(nil, server.name, RPL_ENDOFSILELIST, nick, client.t("End of /SILENCE list"))
+		return false
+	}
+
+	for _, entry := range strings.Split(msg.Params[0], ",") {
+		add := !strings.HasPrefix(entry, "-")
+		entry = strings.TrimLeft(entry, "+-")
+		if entry == "" {
+			continue
+		}
+		mask, err := server.modifySilenceList(client, entry, add)
+		switch err {
+		case nil:
+			change := "-" + mask
+			if add {
+				change = "+" + mask
+			}
+			rb.Add(nil, client.NickMaskString(), "SILENCE", change)
+		case errNoop:
+			// no error numeric exists for this; ignore it, as other implementations do
+		case errLimitExceeded:
+			rb.Add(nil, server.name, ERR_SILELISTFULL, nick, mask, client.t("Your silence list is full"))
+			return false
+		default:
+			rb.Add(nil, server.name, "FAIL", "SILENCE", "INVALID_PARAMS", utils.SafeErrorParam(entry), client.t("Invalid mask"))
+		}
+	}
+	return false
+}
+
+// ADMIN [<server>]
+func adminHandler(server *Server, client *Client, msg ircmsg.Message, rb *ResponseBuffer) bool {
+	nick := client.Nick()
+	info := server.Config().Server.AdminInfo
+	if info == (AdminInfoConfig{}) {
+		rb.Add(nil, server.name, ERR_NOADMININFO, nick, server.name, client.t("No administrative info available"))
+		return false
+	}
+	rb.Add(nil, server.name, RPL_ADMINME, nick, server.name, client.t("Administrative info"))
+	rb.Add(nil, server.name, RPL_ADMINLOC1, nick, info.Location)
+	rb.Add(nil, server.name, RPL_ADMINLOC2, nick, info.Organization)
+	rb.Add(nil, server.name, RPL_ADMINEMAIL, nick, info.Email)
+	return false
+}
+
 // AUTHENTICATE [<mechanism>|<data>|*]
 func authenticateHandler(server *Server, client *Client, msg ircmsg.Message, rb *ResponseBuffer) bool {
 	session := rb.session
@@ -152,7 +262,9 @@ func authenticateHandler(server *Server, client *Client, msg ircmsg.Message, rb
 		return false
 	}
 
-	if details.account != "" {
+	// a logged-in client can reauthenticate to switch accounts, unless other
+	// sessions are attached to its current account or it's always-on
+	if details.account != "" && (client.AlwaysOn() || len(client.Sessions()) > 1) {
 		rb.Add(nil, server.name, ERR_SASLALREADY, details.nick, client.t("You're already logged into an account"))
 		return false
 	}
@@ -160,7 +272,7 @@ func authenticateHandler(server *Server, client *Client, msg ircmsg.Message, rb
 	// sasl abort
 	if !config.Accounts.AuthenticationEnabled || len(msg.Params) == 1 && msg.Params[0] == "*" {
 		rb.Add(nil, server.name, ERR_SASLABORTED, details.nick, client.t("SASL authentication aborted"))
-		session.sasl.Clear()
+		session.endSASL()
 		return false
 	}
 
@@ -177,6 +289,7 @@ func authenticateHandler(server *Server, client *Client, msg ircmsg.Message, rb
 
 		if mechanismIsEnabled {
 			session.sasl.mechanism = mechanism
+			session.registration.Transition(regEventSASLStart)
 			if !config.Server.Compatibility.SendUnprefixedSasl {
 				// normal behavior
 				rb.Add(nil, server.name, "AUTHENTICATE", "+")
@@ -197,13 +310,13 @@ func authenticateHandler(server *Server, client *Client, msg ircmsg.Message, rb
 
 	if len(rawData) > 400 {
 		rb.Add(nil, server.name, ERR_SASLTOOLONG, details.nick, client.t("SASL message too long"))
-		session.sasl.Clear()
+		session.endSASL()
 		return false
 	} else if len(rawData) == 400 {
 		// allow 4 'continuation' lines before rejecting for length
 		if len(session.sasl.value) >= 400*4 {
 			rb.Add(nil, server.name, ERR_SASLFAIL, details.nick, client.t("SASL authentication failed: Passphrase too long"))
-			session.sasl.Clear()
+			session.endSASL()
 			return false
 		}
 		session.sasl.value += rawData
@@ -220,7 +333,7 @@ func authenticateHandler(server *Server, client *Client, msg ircmsg.Message, rb
 		session.sasl.value = ""
 		if err != nil {
 			rb.Add(nil, server.name, ERR_SASLFAIL, details.nick, client.t("SASL authentication failed: Invalid b64 encoding"))
-			session.sasl.Clear()
+			session.endSASL()
 			return false
 		}
 	}
@@ -232,7 +345,7 @@ func authenticateHandler(server *Server, client *Client, msg ircmsg.Message, rb
 
 // AUTHENTICATE PLAIN
 func authPlainHandler(server *Server, client *Client, session *Session, value []byte, rb *ResponseBuffer) bool {
-	defer session.sasl.Clear()
+	defer session.endSASL()
 
 	splitValue := bytes.Split(value, []byte{'\000'})
 
@@ -293,7 +406,7 @@ func authErrorToMessage(server *Server, err error) (msg string) {
 
 // AUTHENTICATE EXTERNAL
 func authExternalHandler(server *Server, client *Client, session *Session, value []byte, rb *ResponseBuffer) bool {
-	defer session.sasl.Clear()
+	defer session.endSASL()
 
 	if rb.session.certfp == "" {
 		rb.Add(nil, server.name, ERR_SASLFAIL, client.nick, client.t("SASL authentication failed, you are not connecting with a certificate"))
@@ -341,7 +454,7 @@ func authScramHandler(server *Server, client *Client, session *Session, value []
 	continueAuth := true
 	defer func() {
 		if !continueAuth {
-			session.sasl.Clear()
+			session.endSASL()
 		}
 	}()
 
@@ -401,8 +514,7 @@ func awayHandler(server *Server, client *Client, msg ircmsg.Message, rb *Respons
 	var awayMessage string
 	if len(msg.Params) > 0 {
 		isAway = true
-		awayMessage = msg.Params[0]
-		awayMessage = ircutils.TruncateUTF8Safe(awayMessage, server.Config().Limits.AwayLen)
+		awayMessage = ircutils.SanitizeText(msg.Params[0], server.Config().Limits.AwayLen)
 	}
 
 	rb.session.SetAway(awayMessage)
@@ -430,6 +542,33 @@ func dispatchAwayNotify(client *Client, isAway bool, awayMessage string) {
 	}
 }
 
+// dispatchAccountNotify sends ACCOUNT to friends with account-notify;
+// accountName is "*" for a logout
+func dispatchAccountNotify(client *Client, nickMask, accountName string, rb *ResponseBuffer) {
+	for friend := range client.FriendsMonitors(caps.AccountNotify) {
+		if friend != rb.session {
+			friend.Send(nil, nickMask, "ACCOUNT", accountName)
+		}
+	}
+	if rb.session.capabilities.Has(caps.AccountNotify) {
+		rb.Add(nil, nickMask, "ACCOUNT", accountName)
+	}
+}
+
+// BACKUP
+func backupHandler(server *Server, client *Client, msg ircmsg.Message, rb *ResponseBuffer) bool {
+	server.logger.Info("server", "BACKUP command used by", client.Nick())
+	// operators can't choose the path: the output directory is configured by the admin
+	path, err := server.backupDatastore("")
+	if err == nil {
+		rb.Notice(fmt.Sprintf(client.t("Datastore backup written to %s"), path))
+	} else {
+		server.logger.Error("server", "Couldn't back up datastore", err.Error())
+		rb.Add(nil, server.name, ERR_UNKNOWNERROR, client.Nick(), "BACKUP", client.t("Couldn't back up the datastore"))
+	}
+	return false
+}
+
 // BATCH {+,-}reference-tag type [params...]
 func batchHandler(server *Server, client *Client, msg ircmsg.Message, rb *ResponseBuffer) bool {
 	tag := msg.Params[0]
@@ -532,9 +671,7 @@ func capHandler(server *Server, client *Client, msg ircmsg.Message, rb *Response
 
 	switch subCommand {
 	case "LS":
-		if !client.registered {
-			rb.session.capState = caps.NegotiatingState
-		}
+		rb.session.registration.Transition(regEventCapStart)
 		if 1 < len(msg.Params) {
 			num, err := strconv.Atoi(msg.Params[1])
 			newVersion := caps.Version(num)
@@ -549,9 +686,7 @@ func capHandler(server *Server, client *Client, msg ircmsg.Message, rb *Response
 		sendCapLines(&rb.session.capabilities, nil)
 
 	case "REQ":
-		if !client.registered {
-			rb.session.capState = caps.NegotiatingState
-		}
+		rb.session.registration.Transition(regEventCapStart)
 
 		// make sure all capabilities actually exist
 		// #511, #521: oragono.io/nope is a fake cap to trap bad clients who blindly request
@@ -570,9 +705,7 @@ func capHandler(server *Server, client *Client, msg ircmsg.Message, rb *Response
 		rb.Add(nil, server.name, "CAP", details.nick, "ACK", capString)
 
 	case "END":
-		if !client.registered {
-			rb.session.capState = caps.NegotiatedState
-		}
+		rb.session.registration.Transition(regEventCapEnd)
 
 	default:
 		rb.Add(nil, server.name, ERR_INVALIDCAPCMD, details.nick, subCommand, client.t("Invalid CAP subcommand"))
@@ -691,6 +824,11 @@ func chathistoryHandler(server *Server, client *Client, msg ircmsg.Message, rb *
 				end.Time = roundUp(end.Time)
 			}
 		}
+		// TARGETS only accepts timestamps, since msgids are specific to one target
+		if listTargets && (start.Msgid != "" || end.Msgid != "") {
+			err = utils.ErrInvalidParams
+			return
+		}
 		limit = parseHistoryLimit(paramPos + 2)
 	case "before", "after", "around":
 		start.Msgid, start.Time, err = parseQueryParam(msg.Params[2])
@@ -759,6 +897,15 @@ func debugHandler(server *Server, client *Client, msg ircmsg.Message, rb *Respon
 		rb.Notice(fmt.Sprintf("pause quantiles 75%%:  %s", stats.PauseQuantiles[3]))
 		rb.Notice(fmt.Sprintf("pause quantiles max%%: %s", stats.PauseQuantiles[4]))
 
+	case "DIAGNOSTICS":
+		for _, result := range server.Diagnostics() {
+			status := "OK"
+			if !result.OK {
+				status = "PROBLEM"
+			}
+			rb.Notice(fmt.Sprintf("%s: %s: %s", status, result.Check, result.Message))
+		}
+
 	case "NUMGOROUTINE":
 		count := runtime.NumGoroutine()
 		rb.Notice(fmt.Sprintf("num goroutines: %d", count))
@@ -980,6 +1127,7 @@ func dlineHandler(server *Server, client *Client, msg ircmsg.Message, rb *Respon
 			}
 		}
 
+		qb := newQuitBatch(server)
 		for _, session := range sessionsToKill {
 			mcl := session.client
 			mcl.Quit(fmt.Sprintf(mcl.t("You have been banned from this server (%s)"), reason), session)
@@ -987,9 +1135,10 @@ func dlineHandler(server *Server, client *Client, msg ircmsg.Message, rb *Respon
 				killClient = true
 			} else {
 				// if mcl == client, we kill them below
-				mcl.destroy(session)
+				mcl.destroyInBatch(session, qb)
 			}
 		}
+		qb.End()
 
 		// send snomask
 		sort.Strings(killedClientNicks)
@@ -1170,30 +1319,44 @@ func infoHandler(server *Server, client *Client, msg ircmsg.Message, rb *Respons
 }
 
 // INVITE <nickname> <channel>
+// INVITE <channel>
 // UNINVITE <nickname> <channel>
 func inviteHandler(server *Server, client *Client, msg ircmsg.Message, rb *ResponseBuffer) bool {
 	invite := msg.Command == "INVITE"
-	nickname := msg.Params[0]
-	channelName := msg.Params[1]
-
-	target := server.clients.Get(nickname)
-	if target == nil {
-		rb.Add(nil, server.name, ERR_NOSUCHNICK, client.Nick(), utils.SafeErrorParam(nickname), client.t("No such nick"))
+	if invite && len(msg.Params) == 1 {
+		channel := server.channels.Get(msg.Params[0])
+		if channel == nil {
+			rb.Add(nil, server.name, ERR_NOSUCHCHANNEL, client.Nick(), utils.SafeErrorParam(msg.Params[0]), client.t("No such channel"))
+			return false
+		}
+		channel.listInvites(client, rb)
+		return false
+	} else if len(msg.Params) < 2 {
+		rb.Add(nil, server.name, ERR_NEEDMOREPARAMS, client.Nick(), msg.Command, client.t("Not enough parameters"))
 		return false
 	}
 
+	nickname := msg.Params[0]
+	channelName := msg.Params[1]
+
 	channel := server.channels.Get(channelName)
 	if channel == nil {
 		rb.Add(nil, server.name, ERR_NOSUCHCHANNEL, client.Nick(), utils.SafeErrorParam(channelName), client.t("No such channel"))
 		return false
 	}
 
-	if invite {
-		channel.Invite(target, client, rb)
-	} else {
-		channel.Uninvite(target, client, rb)
+	if !invite {
+		// the invitee may have disconnected since the invite was sent
+		channel.Uninvite(nickname, client, rb)
+		return false
 	}
 
+	target := server.clients.Get(nickname)
+	if target == nil {
+		rb.Add(nil, server.name, ERR_NOSUCHNICK, client.Nick(), utils.SafeErrorParam(nickname), client.t("No such nick"))
+		return false
+	}
+	channel.Invite(target, client, rb)
 	return false
 }
 
@@ -1275,6 +1438,9 @@ func sendJoinError(client *Client, name string, rb *ResponseBuffer, err error) {
 		code, forbiddingMode = ERR_BADCHANNELKEY, "k"
 	case errInviteOnly:
 		code, forbiddingMode = ERR_INVITEONLYCHAN, "i"
+	case errJoinThrottled:
+		// while +j is in effect, the channel is temporarily invite-only
+		code, forbiddingMode = ERR_INVITEONLYCHAN, "j"
 	case errBanned:
 		code, forbiddingMode = ERR_BANNEDFROMCHAN, "b"
 	case errRegisteredOnly:
@@ -1543,15 +1709,17 @@ func klineHandler(server *Server, client *Client, msg ircmsg.Message, rb *Respon
 			}
 		}
 
+		qb := newQuitBatch(server)
 		for _, mcl := range clientsToKill {
 			mcl.Quit(fmt.Sprintf(mcl.t("You have been banned from this server (%s)"), reason), nil)
 			if mcl == client {
 				killClient = true
 			} else {
 				// if mcl == client, we kill them below
-				mcl.destroy(nil)
+				mcl.destroyInBatch(nil, qb)
 			}
 		}
+		qb.End()
 
 		// send snomask
 		sort.Strings(killedClientNicks)
@@ -1625,49 +1793,34 @@ func listHandler(server *Server, client *Client, msg ircmsg.Message, rb *Respons
 		return false
 	}
 
-	// get channels
+	// get channels, channel name masks, and elist conditions
 	var channels []string
-	for _, param := range msg.Params {
-		if 0 < len(param) && param[0] == '#' {
-			for _, channame := range strings.Split(param, ",") {
-				if 0 < len(channame) && channame[0] == '#' {
-					channels = append(channels, channame)
-				}
-			}
-		}
-	}
-
-	// get elist conditions
 	var matcher elistMatcher
 	for _, param := range msg.Params {
-		if len(param) < 1 {
-			continue
-		}
-
-		if param[0] == '<' {
-			param = param[1:]
-			val, err := strconv.Atoi(param)
-			if err != nil {
-				continue
-			}
-			matcher.MaxClientsActive = true
-			matcher.MaxClients = val - 1 // -1 because < means less than the given number
-		}
-		if param[0] == '>' {
-			param = param[1:]
-			val, err := strconv.Atoi(param)
-			if err != nil {
+		for _, item := range strings.Split(param, ",") {
+			if item == "" {
 				continue
+			} else if isElistMask(item) {
+				matcher.AddMask(item)
+			} else if item[0] == '#' {
+				channels = append(channels, item)
+			} else {
+				matcher.Add(item)
 			}
-			matcher.MinClientsActive = true
-			matcher.MinClients = val + 1 // +1 because > means more than the given number
 		}
 	}
 
 	nick := client.Nick()
+	numListed := 0
 	rplList := func(channel *Channel) {
 		members, name, topic := channel.listData()
 		rb.Add(nil, client.server.name, RPL_LIST, nick, name, strconv.Itoa(members), topic)
+		// SAFELIST: send the list in chunks, blocking until each one is written,
+		// so that listing many channels can't exceed the client's sendq
+		numListed++
+		if numListed%listFlushInterval == 0 {
+			rb.Flush(true)
+		}
 	}
 
 	clientIsOp := client.HasRoleCapabs("sajoin")
@@ -1732,6 +1885,7 @@ func cmodeHandler(server *Server, client *Client, msg ircmsg.Message, rb *Respon
 		params := msg.Params[1:]
 		var unknown map[rune]bool
 		changes, unknown = modes.ParseChannelModeChanges(params...)
+		changes = changes.LimitParameters(server.Config().Limits.Modes)
 
 		// alert for unknown mode changes
 		for char := range unknown {
@@ -1750,6 +1904,8 @@ func cmodeHandler(server *Server, client *Client, msg ircmsg.Message, rb *Respon
 	return false
 }
 
+// announceCmodeChanges broadcasts applied mode changes to the channel;
+// rb may be nil for changes the server makes on its own
 func announceCmodeChanges(channel *Channel, applied modes.ModeChanges, source, accountName, account string, isBot bool, rb *ResponseBuffer) {
 	// send out changes
 	if len(applied) > 0 {
@@ -1759,10 +1915,14 @@ func announceCmodeChanges(channel *Channel, applied modes.ModeChanges, source, a
 			message.Split = append(message.Split, utils.MessagePair{Message: changeString})
 		}
 		args := append([]string{channel.name}, changeStrings...)
-		rb.AddFromClient(message.Time, message.Msgid, source, accountName, isBot, nil, "MODE", args...)
+		var rbSession *Session
+		if rb != nil {
+			rb.AddFromClient(message.Time, message.Msgid, source, accountName, isBot, nil, "MODE", args...)
+			rbSession = rb.session
+		}
 		for _, member := range channel.Members() {
 			for _, session := range member.Sessions() {
-				if session != rb.session {
+				if session != rbSession {
 					session.sendFromClientInternal(false, message.Time, message.Msgid, source, accountName, isBot, nil, "MODE", args...)
 				}
 			}
@@ -1990,6 +2150,12 @@ func motdHandler(server *Server, client *Client, msg ircmsg.Message, rb *Respons
 	return false
 }
 
+// RULES [server]
+func rulesHandler(server *Server, client *Client, msg ircmsg.Message, rb *ResponseBuffer) bool {
+	server.Rules(client, rb)
+	return false
+}
+
 // NAMES [<channel>{,<channel>} [target]]
 func namesHandler(server *Server, client *Client, msg ircmsg.Message, rb *ResponseBuffer) bool {
 	var channels []string
@@ -2027,13 +2193,19 @@ func namesHandler(server *Server, client *Client, msg ircmsg.Message, rb *Respon
 // NICK <nickname>
 func nickHandler(server *Server, client *Client, msg ircmsg.Message, rb *ResponseBuffer) bool {
 	if client.registered {
-		if client.account == "" && server.Config().Accounts.NickReservation.ForbidAnonNickChanges {
+		config := server.Config()
+		if client.account == "" && config.Accounts.NickReservation.ForbidAnonNickChanges {
 			rb.Add(nil, server.name, ERR_UNKNOWNERROR, client.Nick(), client.t("You may not change your nickname"))
 			return false
 		}
+		if throttled, remainingTime := client.checkNickChangeRate(config); throttled {
+			rb.Add(nil, server.name, ERR_NICKTOOFAST, client.Nick(), utils.SafeErrorParam(msg.Params[0]), fmt.Sprintf(client.t("Nick change too fast; please wait %v and try again"), remainingTime.Round(time.Second)))
+			return false
+		}
 		performNickChange(server, client, client, nil, msg.Params[0], rb)
 	} else {
 		client.preregNick = msg.Params[0]
+		rb.session.registration.Transition(regEventNick)
 	}
 	return false
 }
@@ -2261,6 +2433,26 @@ func dispatchMessageToTarget(client *Client, tags map[string]string, histType hi
 			rb.Add(nil, server.name, ERR_NEEDREGGEDNICK, client.Nick(), tnick, client.t("You must be registered to send a direct message to this user"))
 			return
 		}
+		if user.HasMode(modes.CallerID) && !user.callerIDAccepts(client) {
+			if histType != history.Notice {
+				rb.Add(nil, server.name, RPL_TARGUMODEG, details.nick, tnick, client.t("is in +g mode (server-side ignore)"))
+				if user.checkCallerIDNotify() {
+					user.Send(nil, server.name, RPL_UMODEGMSG, tnick, details.nick, fmt.Sprintf("%s@%s", details.username, details.hostname), fmt.Sprintf(user.t("is messaging you, and you have user mode +g set. Use /ACCEPT %s to allow."), details.nick))
+					rb.Add(nil, server.name, RPL_TARGNOTIFY, details.nick, tnick, client.t("has been informed that you messaged them"))
+				}
+			}
+			return
+		}
+		if user.isSilencing(client) {
+			// SILENCE drops the message without telling the sender
+			return
+		}
+		if allowed, reason := user.acceptsDirectMessageFrom(client, details.account); !allowed {
+			if histType != history.Notice {
+				rb.Add(nil, server.name, "FAIL", command, "DM_RESTRICTED", tnick, client.t(reason))
+			}
+			return
+		}
 		if !client.server.Config().Server.Compatibility.allowTruncation {
 			if !validateSplitMessageLen(histType, client.NickMaskString(), tnick, message) {
 				rb.Add(nil, server.name, ERR_INPUTTOOLONG, client.Nick(), client.t("Line too long to be relayed without truncation"))
@@ -2297,12 +2489,7 @@ func dispatchMessageToTarget(client *Client, tags map[string]string, histType hi
 
 		// the originating session may get an echo message:
 		rb.addEchoMessage(tags, nickMaskString, accountName, command, tnick, message)
-		if histType != history.Notice {
-			//TODO(dan): possibly implement cooldown of away notifications to users
-			if away, awayMessage := user.Away(); away {
-				rb.Add(nil, server.name, RPL_AWAY, client.Nick(), tnick, awayMessage)
-			}
-		}
+		addAwayReply(rb, command, client, user)
 
 		config := server.Config()
 		if !config.History.Enabled {
@@ -2466,7 +2653,7 @@ func partHandler(server *Server, client *Client, msg ircmsg.Message, rb *Respons
 	channels := strings.Split(msg.Params[0], ",")
 	var reason string
 	if len(msg.Params) > 1 {
-		reason = msg.Params[1]
+		reason = ircutils.SanitizeText(msg.Params[1], MaxLineLen)
 	}
 
 	for _, chname := range channels {
@@ -2483,7 +2670,7 @@ func partHandler(server *Server, client *Client, msg ircmsg.Message, rb *Respons
 
 // PASS <password>
 func passHandler(server *Server, client *Client, msg ircmsg.Message, rb *ResponseBuffer) bool {
-	if client.registered {
+	if err := rb.session.registration.Transition(regEventPass); err != nil {
 		rb.Add(nil, server.name, ERR_ALREADYREGISTRED, client.nick, client.t("You may not reregister"))
 		return false
 	}
@@ -2516,7 +2703,7 @@ func passHandler(server *Server, client *Client, msg ircmsg.Message, rb *Respons
 	// if login-via-PASS failed for any reason, proceed to try and interpret the
 	// provided password as the server password
 
-	serverPassword := config.Server.passwordBytes
+	serverPassword := rb.session.serverPassword(config)
 
 	// if no password exists, skip checking
 	if serverPassword == nil {
@@ -2538,13 +2725,38 @@ func passHandler(server *Server, client *Client, msg ircmsg.Message, rb *Respons
 
 // PING [params...]
 func pingHandler(server *Server, client *Client, msg ircmsg.Message, rb *ResponseBuffer) bool {
-	rb.Add(nil, server.name, "PONG", server.name, msg.Params[0])
+	if rb.Label == "" {
+		// PONG skips ahead of any pending output, so it can't time out behind
+		// a large burst (e.g., history replay)
+		rb.session.SendPriority(server.name, "PONG", server.name, msg.Params[0])
+	} else {
+		rb.Add(nil, server.name, "PONG", server.name, msg.Params[0])
+	}
 	return false
 }
 
 // PONG [params...]
 func pongHandler(server *Server, client *Client, msg ircmsg.Message, rb *ResponseBuffer) bool {
-	// client gets touched when they send this command, so we don't need to do anything
+	// client gets touched when they send this command, so we only need to
+	// record the latency of our keepalive PING
+	rb.session.recordPong(time.Now())
+	return false
+}
+
+// PROTOCTL <token>{ <token>}
+func protoctlHandler(server *Server, client *Client, msg ircmsg.Message, rb *ResponseBuffer) bool {
+	// legacy equivalents of IRCv3 capabilities, as advertised in ISUPPORT;
+	// unknown tokens are ignored
+	for _, param := range msg.Params {
+		for _, token := range strings.Fields(param) {
+			switch strings.ToUpper(token) {
+			case "NAMESX":
+				rb.session.capabilities.Enable(caps.MultiPrefix)
+			case "UHNAMES":
+				rb.session.capabilities.Enable(caps.UserhostInNames)
+			}
+		}
+	}
 	return false
 }
 
@@ -2552,7 +2764,9 @@ func pongHandler(server *Server, client *Client, msg ircmsg.Message, rb *Respons
 func quitHandler(server *Server, client *Client, msg ircmsg.Message, rb *ResponseBuffer) bool {
 	reason := "Quit"
 	if len(msg.Params) > 0 {
-		reason += ": " + msg.Params[0]
+		if message := client.filterQuitReason(server.Config(), ircutils.SanitizeText(msg.Params[0], MaxLineLen)); message != "" {
+			reason += ": " + message
+		}
 	}
 	client.Quit(reason, rb.session)
 	return true
@@ -2699,6 +2913,87 @@ func rehashHandler(server *Server, client *Client, msg ircmsg.Message, rb *Respo
 	return false
 }
 
+// REDACT <target> <msgid> [<reason>]
+func redactHandler(server *Server, client *Client, msg ircmsg.Message, rb *ResponseBuffer) bool {
+	config := server.Config()
+	if !config.History.Redaction.Enabled {
+		rb.Add(nil, server.name, "FAIL", "REDACT", "NOT_ENABLED", client.t("REDACT has been disabled"))
+		return false
+	}
+
+	target, msgid := msg.Params[0], msg.Params[1]
+	var reason string
+	if len(msg.Params) > 2 {
+		reason = msg.Params[2]
+	}
+
+	var channel *Channel
+	var targetClient *Client
+	privileged := client.HasRoleCapabs("history")
+	if strings.HasPrefix(target, "#") {
+		channel = server.channels.Get(target)
+		if channel == nil || !channel.hasClient(client) {
+			rb.Add(nil, server.name, "FAIL", "REDACT", "INVALID_TARGET", utils.SafeErrorParam(target), client.t("You're not on that channel"))
+			return false
+		}
+		target = channel.Name()
+		privileged = privileged || (config.History.Redaction.AllowOperators && channel.ClientIsAtLeast(client, modes.ChannelOperator))
+	} else {
+		targetClient = server.clients.Get(target)
+		if targetClient == nil {
+			rb.Add(nil, server.name, "FAIL", "REDACT", "INVALID_TARGET", utils.SafeErrorParam(target), client.t("No such nick"))
+			return false
+		}
+		target = targetClient.Nick()
+	}
+
+	err := server.RedactMessage(channel, client, targetClient, msgid, reason, privileged)
+	switch err {
+	case nil:
+	case errNoop:
+		rb.Add(nil, server.name, "FAIL", "REDACT", "UNKNOWN_MSGID", target, utils.SafeErrorParam(msgid), client.t("This message does not exist or is too old"))
+		return false
+	case errRedactForbidden:
+		rb.Add(nil, server.name, "FAIL", "REDACT", "REDACT_FORBIDDEN", target, utils.SafeErrorParam(msgid), client.t(err.Error()))
+		return false
+	case errRedactWindowExpired:
+		rb.Add(nil, server.name, "FAIL", "REDACT", "REDACT_WINDOW_EXPIRED", target, utils.SafeErrorParam(msgid), strconv.Itoa(int(time.Duration(config.History.Redaction.Window).Seconds())), client.t(err.Error()))
+		return false
+	default:
+		server.logger.Error("internal", "couldn't redact message", msgid, err.Error())
+		rb.Add(nil, server.name, "FAIL", "REDACT", "UNKNOWN_ERROR", target, utils.SafeErrorParam(msgid), client.t("An error occurred"))
+		return false
+	}
+
+	params := []string{target, msgid}
+	if reason != "" {
+		params = append(params, reason)
+	}
+	var recipients []*Client
+	if channel != nil {
+		recipients = channel.Members()
+	} else {
+		recipients = []*Client{client}
+		if targetClient != client {
+			recipients = append(recipients, targetClient)
+		}
+	}
+	details := client.Details()
+	isBot := client.HasMode(modes.Bot)
+	now := time.Now().UTC()
+	for _, recipient := range recipients {
+		for _, session := range recipient.Sessions() {
+			if session != rb.session && session.capabilities.Has(caps.MessageRedaction) {
+				session.sendFromClientInternal(false, now, "", details.nickMask, details.accountName, isBot, nil, "REDACT", params...)
+			}
+		}
+	}
+	if rb.session.capabilities.Has(caps.MessageRedaction) {
+		rb.AddFromClient(now, "", details.nickMask, details.accountName, isBot, nil, "REDACT", params...)
+	}
+	return false
+}
+
 // RELAYMSG <channel> <spoofed nick> :<message>
 func relaymsgHandler(server *Server, client *Client, msg ircmsg.Message, rb *ResponseBuffer) (result bool) {
 	config := server.Config()
@@ -2916,6 +3211,7 @@ func setnameHandler(server *Server, client *Client, msg ircmsg.Message, rb *Resp
 		// so you can do `/setname Jane Doe` in the client and get the expected result
 		realname = strings.Join(msg.Params, " ")
 	}
+	realname = ircutils.SanitizeText(realname, MaxLineLen)
 	if realname == "" {
 		rb.Add(nil, server.name, "FAIL", "SETNAME", "INVALID_REALNAME", client.t("Realname is not valid"))
 		return false
@@ -2937,6 +3233,141 @@ func setnameHandler(server *Server, client *Client, msg ircmsg.Message, rb *Resp
 	return false
 }
 
+// STATS <query>
+func statsHandler(server *Server, client *Client, msg ircmsg.Message, rb *ResponseBuffer) bool {
+	nick := client.Nick()
+	query := msg.Params[0]
+	if len(query) == 0 {
+		rb.Add(nil, server.name, ERR_NEEDMOREPARAMS, nick, msg.Command, client.t("Not enough parameters"))
+		return false
+	}
+	// only the first character of the query is significant
+	queryChar := query[0:1]
+
+	switch queryChar {
+	case "m":
+		if client.Oper() == nil {
+			rb.Add(nil, server.name, ERR_NOPRIVILEGES, nick, client.t("Permission Denied"))
+			return false
+		}
+		for _, metrics := range server.commandStats.Snapshot() {
+			histogram := make([]string, len(metrics.Histogram))
+			for i, count := range metrics.Histogram {
+				histogram[i] = fmt.Sprintf("%s:%d", latencyBucketName(i), count)
+			}
+			rb.Add(nil, server.name, RPL_STATSCOMMANDS, nick, metrics.Command, strconv.FormatUint(metrics.Invocations, 10), "0", "0",
+				fmt.Sprintf(client.t("errors %[1]d, mean latency %[2]s, latency histogram %[3]s"), metrics.Errors, metrics.MeanLatency(), strings.Join(histogram, " ")))
+		}
+	case "l", "L":
+		if client.Oper() == nil {
+			rb.Add(nil, server.name, ERR_NOPRIVILEGES, nick, client.t("Permission Denied"))
+			return false
+		}
+		var targets []*Client
+		if len(msg.Params) > 1 {
+			target := server.clients.Get(msg.Params[1])
+			if target == nil {
+				rb.Add(nil, server.name, ERR_NOSUCHNICK, nick, utils.SafeErrorParam(msg.Params[1]), client.t("No such nick"))
+				return false
+			}
+			targets = []*Client{target}
+		} else {
+			targets = server.clients.AllClients()
+		}
+		now := time.Now()
+		for _, target := range targets {
+			details := target.Details()
+			sessionData, _ := target.AllSessionData(nil, true)
+			for _, session := range sessionData {
+				latency := client.t("unknown")
+				if session.latency != 0 {
+					latency = session.latency.String()
+				}
+				rb.Add(nil, server.name, RPL_STATSLINKINFO, nick, fmt.Sprintf("%s[%s@%s]", details.nick, details.username, session.hostname),
+					strconv.Itoa(session.sendQ), "0", "0", "0", "0", strconv.FormatInt(int64(now.Sub(session.ctime).Seconds()), 10),
+					fmt.Sprintf(client.t("latency %s"), latency))
+			}
+		}
+	case "u":
+		uptime := time.Since(server.ctime)
+		days := int(uptime / (24 * time.Hour))
+		uptime -= time.Duration(days) * 24 * time.Hour
+		rb.Add(nil, server.name, RPL_STATSUPTIME, nick, fmt.Sprintf(client.t("Server Up %[1]d days %[2]d:%02[3]d:%02[4]d"), days, int(uptime.Hours()), int(uptime.Minutes())%60, int(uptime.Seconds())%60))
+	case "o", "O":
+		if client.Oper() == nil {
+			rb.Add(nil, server.name, ERR_NOPRIVILEGES, nick, client.t("Permission Denied"))
+			return false
+		}
+		config := server.Config()
+		names := make([]string, 0, len(config.operators))
+		for name := range config.operators {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			rb.Add(nil, server.name, RPL_STATSOLINE, nick, "O", "*", "*", name, config.operators[name].Class.Title)
+		}
+	case "k", "K":
+		if !client.HasRoleCapabs("ban") {
+			rb.Add(nil, server.name, ERR_NOPRIVILEGES, nick, client.t("Permission Denied"))
+			return false
+		}
+		bans := server.klines.AllBans()
+		masks := make([]string, 0, len(bans))
+		for mask := range bans {
+			masks = append(masks, mask)
+		}
+		sort.Strings(masks)
+		for _, mask := range masks {
+			rb.Add(nil, server.name, RPL_STATSKLINE, nick, "K", mask, "*", "*", bans[mask].BanMessage("%s"))
+		}
+	case "p", "P":
+		if client.Oper() == nil {
+			rb.Add(nil, server.name, ERR_NOPRIVILEGES, nick, client.t("Permission Denied"))
+			return false
+		}
+		listeners := server.Config().Server.trueListeners
+		addrs := make([]string, 0, len(listeners))
+		for addr := range listeners {
+			addrs = append(addrs, addr)
+		}
+		sort.Strings(addrs)
+		for _, addr := range addrs {
+			// the address may begin with a colon (e.g., ":6697"), so it must be the final parameter
+			rb.Add(nil, server.name, RPL_STATSPLINE, nick, "P", listenerFlags(listeners[addr]), addr)
+		}
+	}
+
+	rb.Add(nil, server.name, RPL_ENDOFSTATS, nick, queryChar, client.t("End of /STATS report"))
+	return false
+}
+
+// listenerFlags describes a listener for STATS P, e.g., "tls,websocket"
+func listenerFlags(conf utils.ListenerConfig) string {
+	var flags []string
+	if conf.TLSConfig != nil {
+		flags = append(flags, "tls")
+	} else {
+		flags = append(flags, "plaintext")
+	}
+	if conf.WebSocket {
+		flags = append(flags, "websocket")
+	}
+	if conf.Tor {
+		flags = append(flags, "tor")
+	}
+	if conf.STSOnly {
+		flags = append(flags, "sts-only")
+	}
+	if conf.RequireProxy {
+		flags = append(flags, "proxy")
+	}
+	if conf.RejectInsecure {
+		flags = append(flags, "reject-insecure")
+	}
+	return strings.Join(flags, ",")
+}
+
 // SUMMON [parameters]
 func summonHandler(server *Server, client *Client, msg ircmsg.Message, rb *ResponseBuffer) bool {
 	rb.Add(nil, server.name, ERR_SUMMONDISABLED, client.Nick(), client.t("SUMMON has been disabled"))
@@ -3030,12 +3461,12 @@ func unKLineHandler(server *Server, client *Client, msg ircmsg.Message, rb *Resp
 
 // USER <username> * 0 <realname>
 func userHandler(server *Server, client *Client, msg ircmsg.Message, rb *ResponseBuffer) bool {
-	if client.registered {
+	if rb.session.registration.Registered() {
 		rb.Add(nil, server.name, ERR_ALREADYREGISTRED, client.Nick(), client.t("You may not reregister"))
 		return false
 	}
 
-	username, realname := msg.Params[0], msg.Params[3]
+	username, realname := msg.Params[0], ircutils.SanitizeText(msg.Params[3], MaxLineLen)
 	if len(realname) == 0 {
 		rb.Add(nil, server.name, ERR_NEEDMOREPARAMS, client.Nick(), "USER", client.t("Not enough parameters"))
 		return false
@@ -3062,12 +3493,15 @@ func userHandler(server *Server, client *Client, msg ircmsg.Message, rb *Respons
 		// if client's using a unicode nick or something weird, let's just set 'em up with a stock username instead.
 		// fixes clients that just use their nick as a username so they can still use the interesting nick
 		if client.preregNick == username {
-			client.SetNames("user", realname, false)
+			err = client.SetNames("user", realname, false)
 		} else {
 			rb.Add(nil, server.name, ERR_INVALIDUSERNAME, client.Nick(), client.t("Malformed username"))
 		}
 	}
 
+	if err == nil {
+		rb.session.registration.Transition(regEventUser)
+	}
 	return false
 }
 
@@ -3460,12 +3894,27 @@ func whoisHandler(server *Server, client *Client, msg ircmsg.Message, rb *Respon
 		return true
 	}
 
+	// for the registered nick of an offline user, say when they were last connected
+	handleOffline := func(nick string) {
+		accountName := server.accounts.NickToAccount(nick)
+		if accountName == "" {
+			return
+		}
+		account, err := server.accounts.LoadAccount(accountName)
+		if err != nil || account.LastConnected.IsZero() || !account.lastConnectedVisibleTo(client) {
+			return
+		}
+		ago := time.Since(account.LastConnected).Truncate(time.Second)
+		rb.Add(nil, client.server.name, RPL_WHOISSPECIAL, client.Nick(), utils.SafeErrorParam(nick), fmt.Sprintf(client.t("is offline; account %[1]s was last seen %[2]s (%[3]v ago)"), account.Name, account.LastConnected.Format(time.RFC1123), ago))
+	}
+
 	hasPrivs := client.HasRoleCapabs("samode")
 	if hasPrivs {
 		for _, mask := range strings.Split(masksString, ",") {
 			matches := server.clients.FindAll(mask)
 			if len(matches) == 0 && !handleService(mask) {
 				rb.Add(nil, client.server.name, ERR_NOSUCHNICK, client.Nick(), utils.SafeErrorParam(mask), client.t("No such nick"))
+				handleOffline(mask)
 				continue
 			}
 			for mclient := range matches {
@@ -3480,6 +3929,7 @@ func whoisHandler(server *Server, client *Client, msg ircmsg.Message, rb *Respon
 			client.getWhoisOf(mclient, hasPrivs, rb)
 		} else if !handleService(nick) {
 			rb.Add(nil, client.server.name, ERR_NOSUCHNICK, client.Nick(), utils.SafeErrorParam(masksString), client.t("No such nick"))
+			handleOffline(nick)
 		}
 		// fall through, ENDOFWHOIS is always sent
 	}
@@ -3540,6 +3990,9 @@ func unknownCommandHandler(server *Server, client *Client, msg ircmsg.Message, r
 	}
 
 	rb.Add(nil, server.name, ERR_UNKNOWNCOMMAND, client.Nick(), utils.SafeErrorParam(msg.Command), message)
+	if hint, ok := server.Config().Server.unknownCommandHints[msg.Command]; ok {
+		rb.Notice(hint)
+	}
 	return false
 }
 
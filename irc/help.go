@@ -43,6 +43,11 @@ Ergo supports the following channel modes:
   +e  |  Client masks that are exempted from bans.
   +I  |  Client masks that are exempted from the invite-only flag.
   +i  |  Invite-only mode, only invited clients can join the channel.
+  +j  |  Join throttle: at most N clients can join in T seconds (e.g., +j 5:10).
+  +K  |  Repeat limit: clients who send the same message more than N times in
+         T seconds are muted for T seconds (e.g., +K 3:30).
+  +S  |  Slow mode: clients can send at most one message every N seconds
+         (e.g., +S 10).
   +k  |  Key required when joining the channel.
   +l  |  Client join limit for the channel.
   +f  |  Users who are unable to join this channel (due to another mode) are forwarded
@@ -80,7 +85,9 @@ Ergo supports the following user modes:
   +Z  |  User is connected via TLS.
   +B  |  User is a bot.
   +E  |  User can receive roleplaying commands.
-  +T  |  CTCP messages to the user are blocked.`
+  +T  |  CTCP messages to the user are blocked.
+  +g  |  User only accepts direct messages from users on their /ACCEPT list.
+  +x  |  User's hostname is replaced with a cloak (if IP cloaking is enabled).`
 	snomaskHelpText = `== Server Notice Masks ==
 
 Ergo supports the following server notice masks for operators:
@@ -88,6 +95,8 @@ Ergo supports the following server notice masks for operators:
   a  |  Local announcements.
   c  |  Local client connections.
   d  |  Local client disconnects.
+  e  |  Local connection lifecycle events (accept, lookup, registration, login,
+        quit). This is very noisy, so +s * leaves it out; set it explicitly.
   j  |  Local channel actions.
   k  |  Local kills.
   n  |  Local nick changes.
@@ -97,6 +106,7 @@ Ergo supports the following server notice masks for operators:
   u  |  Local client account actions.
   x  |  Local X-lines (DLINE/KLINE/etc).
   v  |  Local vhost changes.
+  w  |  /WHOIS requests for you (if enabled by server.whois-notifications).
 
 To set a snomask, do this with your nickname:
 
@@ -104,12 +114,29 @@ To set a snomask, do this with your nickname:
 
 For instance, this would set the kill, oper, account and xline snomasks on dan:
 
-  /MODE dan +s koux`
+  /MODE dan +s koux
+
+To set all snomasks except e, use * instead of the chars.`
 )
 
 // Help contains the help strings distributed with the IRCd.
 var Help = map[string]HelpEntry{
 	// Commands
+	"accept": {
+		text: `ACCEPT <nick>{,<nick>}
+ACCEPT -<nick>{,-<nick>}
+ACCEPT *
+
+ACCEPT manages the list of users who can send you direct messages while you
+have user mode +g (caller ID) set. ACCEPT <nick> adds a user to the list,
+ACCEPT -<nick> removes them, and ACCEPT * shows the current list. Users on
+the list can also message you regardless of your dm-policy account setting.`,
+	},
+	"admin": {
+		text: `ADMIN [<server>]
+
+Shows administrative contact information for the server.`,
+	},
 	"ambiance": {
 		text: `AMBIANCE <target> <text to be sent>
 
@@ -126,6 +153,13 @@ http://ircv3.net/specs/extensions/sasl-3.1.html`,
 
 If [message] is sent, marks you away. If [message] is not sent, marks you no
 longer away.`,
+	},
+	"backup": {
+		oper: true,
+		text: `BACKUP
+
+Writes a consistent snapshot of the datastore to server.output-path without
+interrupting the server. The snapshot can be restored with "ergo restoredb".`,
 	},
 	"batch": {
 		text: `BATCH {+,-}reference-tag type [params...]
@@ -145,7 +179,22 @@ http://ircv3.net/specs/core/capability-negotiation-3.2.html`,
 
 CHATHISTORY is a history replay command associated with the IRCv3
 specification draft/chathistory. See this document:
-https://github.com/ircv3/ircv3-specifications/pull/393`,
+https://github.com/ircv3/ircv3-specifications/pull/393
+
+CHATHISTORY TARGETS <timestamp> <timestamp> <limit> lists the channels and
+direct message conversations with activity between the two timestamps, so
+that a reconnecting client can find out which conversations have new messages.`,
+	},
+	"check": {
+		oper: true,
+		text: `CHECK <nickname | channel | ip/cidr | nickmask>
+
+CHECK shows detailed information about a target, for use in debugging and
+moderation. For a connected client, this includes its user modes, channels,
+and the IP, hostname, capabilities, and sendq depth of each of its sessions.
+For a channel, it includes the modes, topic, registration, ban/exception/invite
+lists, and members with their privileges. For an IP, network, or nickmask, it
+includes any matching bans and the active clients that match.`,
 	},
 	"debug": {
 		oper: true,
@@ -154,6 +203,8 @@ https://github.com/ircv3/ircv3-specifications/pull/393`,
 Provides various debugging commands for the IRCd. <option> can be one of:
 
 * GCSTATS: Garbage control statistics.
+* DIAGNOSTICS: Checks the datastore schema version, TLS certificate
+  expiration, DNS for the server name, and connectivity to the MTA.
 * NUMGOROUTINE: Number of goroutines in use.
 * STARTCPUPROFILE: Starts the CPU profiler.
 * STOPCPUPROFILE: Stops the CPU profiler.
@@ -244,9 +295,14 @@ Sends information about the server, developers, etc.`,
 	},
 	"invite": {
 		text: `INVITE <nickname> <channel>
+INVITE <channel>
 
 Invites the given user to the given channel, so long as you have the
-appropriate channel privs.`,
+appropriate channel privs. For invite-only channels, the invite stays valid
+until it is used or expires, even if you disconnect in the meantime.
+
+With only a channel, INVITE lists the channel's pending invites (channel
+operators only). UNINVITE revokes them.`,
 	},
 	"ison": {
 		text: `ISON <nickname>{ <nickname>}
@@ -311,8 +367,15 @@ Sets your preferred languages to the given ones.`,
 		text: `LIST [<channel>{,<channel>}] [<elistcond>{,<elistcond>}]
 
 Shows information on the given channels (or if none are given, then on all
-channels). <elistcond>s modify how the channels are selected.`,
-		//TODO(dan): Explain <elistcond>s in more specific detail
+channels). <elistcond>s modify how the channels are selected; a channel is
+shown only if it matches all of the conditions and exclusion masks, and any
+one of the masks (if any are given):
+
+    >n / <n    More than / fewer than n users
+    C>n / C<n  Created more than / less than n minutes ago
+    T>n / T<n  Topic changed more than / less than n minutes ago
+    <mask>     Channel name matches the mask, e.g., #ergo-*
+    !<mask>    Channel name doesn't match the mask, e.g., !*-test`,
 	},
 	"lusers": {
 		text: `LUSERS [<mask> [<server>]]
@@ -320,6 +383,42 @@ channels). <elistcond>s modify how the channels are selected.`,
 Shows statistics about the size of the network. If <mask> is given, only
 returns stats for servers matching the given mask.  If <server> is given, the
 command is processed by that server.`,
+	},
+	"maintenance": {
+		oper: true,
+		text: `MAINTENANCE [ON <listener|*> [duration] [reason]]
+MAINTENANCE OFF <listener|*>
+
+MAINTENANCE puts a single listener (specified by its address as given in the
+config file, with * in place of an empty host, e.g., *:6697), or with * the
+whole server, into maintenance mode: new connections are refused with an ERROR
+that includes the reason and, if a duration is given, the estimated time when
+the server will be back. Clients that are already connected are unaffected.
+With no arguments, MAINTENANCE shows which listeners are currently in
+maintenance mode.
+
+Maintenance mode is not persisted across restarts. While the whole server is
+in maintenance mode, /maintenance on the pprof listener returns HTTP 503,
+which can be used as a load balancer health check.`,
+	},
+	"metadata": {
+		text: `METADATA <target> GET <key> [<key> ...]
+METADATA <target> LIST
+METADATA <target> SET <key> [<value>]
+METADATA <target> CLEAR
+METADATA <target> SYNC
+METADATA * SUB <key> [<key> ...]
+METADATA * UNSUB <key> [<key> ...]
+METADATA * SUBS
+
+METADATA implements the draft/metadata-2 extension, which attaches key-value
+data (e.g., an avatar URL or a channel description) to users and channels.
+The target is a nickname, a channel, or * for yourself. You can modify your
+own metadata, and channel operators can modify their channel's; all values
+are public. SET without a value deletes the key.
+
+Clients that negotiate the capability can SUB(scribe) to keys, and will then
+be notified of changes to those keys on users and channels they share.`,
 	},
 	"mode": {
 		text: `MODE <target> [<modestring> [<mode arguments>...]]
@@ -414,6 +513,16 @@ Replies to a PING. Used to check link connectivity.`,
 		text: `PRIVMSG <target>{,<target>} <text to be sent>
 
 Sends the text to the given targets as a PRIVMSG.`,
+	},
+	"redact": {
+		text: `REDACT <target> <msgid> [<reason>]
+
+Retracts a message you sent to a channel or user, identified by its msgid.
+Channel operators can also redact other users' messages in their channel.
+The message is removed from history, and clients that support it will hide it.
+
+For example:
+	REDACT #ircv3 W1TkvdfZj7GpTqrq :oops, wrong channel`,
 	},
 	"relaymsg": {
 		text: `RELAYMSG <channel> <spoofed nick> :<message>
@@ -463,6 +572,48 @@ The SCENE command is used to send a scene notification to the given target.`,
 		text: `SETNAME <realname>
 
 The SETNAME command updates the realname to be the newly-given one.`,
+	},
+	"silence": {
+		text: `SILENCE [+|-<mask>{,+|-<mask>}]
+
+SILENCE manages your server-side ignore list: direct messages and invites
+from users matching a nick!user@host mask on the list are silently dropped.
+With no arguments, it lists the masks; +<mask> (or just <mask>) adds one, and
+-<mask> removes it. If you're logged in, the list is stored in your account and
+applies to all your connections. (NickServ's IGNORE command does the same.)`,
+	},
+	"shun": {
+		oper: true,
+		text: `SHUN [duration] <mask> [reason [| oper reason]]
+SHUN LIST
+
+Shuns a mask: matching clients remain connected, but all of their commands
+(except PING, PONG and QUIT) are silently ignored. This is a softer alternative
+to KLINE and KILL, for clients that would otherwise immediately reconnect.
+Operators are never affected by shuns. If the duration is given then only for
+that long. Shuns are saved across subsequent launches of the server.
+
+[duration] can be of the following forms:
+	1y 12mo 31d 10h 8m 13s
+
+<mask> is specified in typical IRC format. For example:
+	dan
+	dan!5*@127.*`,
+	},
+	"stats": {
+		text: `STATS <query>
+
+Returns statistics about the server. Supported queries:
+
+  k  |  KLINEs (operators with the ban capability only)
+  l  |  connection information (sendq length, time connected, and PING
+        latency) for every session, or for the sessions of a single client
+        with STATS L <nick> (operators only)
+  m  |  per-command invocation counts, error counts, and latency histograms
+        (operators only)
+  o  |  operator blocks and their classes (operators only)
+  p  |  listeners and their types (operators only)
+  u  |  server uptime`,
 	},
 	"summon": {
 		text: `SUMMON [parameters]
@@ -474,6 +625,13 @@ The SUMMON command is not implemented.`,
 
 Sends the given client-only tags to the given targets as a TAGMSG. See the IRCv3
 specs for more info: http://ircv3.net/specs/core/message-tags-3.3.html`,
+	},
+	"protoctl": {
+		text: `PROTOCTL <token>{ <token>}
+
+PROTOCTL is a legacy mechanism for enabling protocol extensions. The
+supported tokens are NAMESX (equivalent to the multi-prefix capability)
+and UHNAMES (equivalent to the userhost-in-names capability).`,
 	},
 	"quit": {
 		text: `QUIT [reason]
@@ -490,6 +648,11 @@ Registers an account in accordance with the draft/register capability.`,
 		text: `REHASH
 
 Reloads the config file and updates TLS certificates on listeners`,
+	},
+	"rules": {
+		text: `RULES [server]
+
+Returns the rules of this, or the given, server.`,
 	},
 	"time": {
 		text: `TIME [server]
@@ -534,6 +697,12 @@ Removes an existing ban on a mask.
 For example:
 	dan
 	dan!5*@127.*`,
+	},
+	"unshun": {
+		oper: true,
+		text: `UNSHUN <mask>
+
+Removes an existing shun on a mask.`,
 	},
 	"user": {
 		text: `USER <username> 0 * <realname>
@@ -544,7 +713,9 @@ values (though your username may also be looked up with Ident).`,
 	"uninvite": {
 		text: `UNINVITE <nickname> <channel>
 
-UNINVITE rescinds a channel invitation sent for an invite-only channel.`,
+UNINVITE rescinds a pending channel invitation sent for an invite-only
+channel. The invited user need not be online; if they aren't, give their
+account name.`,
 	},
 	"users": {
 		text: `USERS [parameters]
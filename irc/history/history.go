@@ -24,6 +24,7 @@ const (
 	Nick
 	Topic
 	Invite
+	Redact // tombstone for a redacted message
 )
 
 const (
@@ -53,6 +54,18 @@ func (item *Item) HasMsgid(msgid string) bool {
 	return item.Message.Msgid == msgid
 }
 
+// Redact turns the item into a tombstone: the content is discarded, but the
+// msgid and time are kept, so that the item can still be used as a selector.
+func (item *Item) Redact(reason string) {
+	item.Type = Redact
+	item.Message = utils.SplitMessage{
+		Msgid: item.Message.Msgid,
+		Time:  item.Message.Time,
+	}
+	item.Tags = nil
+	item.Params[0] = reason
+}
+
 type Predicate func(item *Item) (matches bool)
 
 func Reverse(results []Item) {
@@ -374,6 +387,36 @@ func (list *Buffer) Delete(predicate Predicate) (count int) {
 	return
 }
 
+// Redact replaces the message with the given msgid by a tombstone, if
+// `authorize` (which must not acquire any locks) returns nil for it.
+func (list *Buffer) Redact(msgid, reason string, authorize func(item *Item) error) (found bool, err error) {
+	list.Lock()
+	defer list.Unlock()
+
+	if list.start == -1 || len(list.buffer) == 0 {
+		return
+	}
+
+	pos := list.start
+	stop := list.prev(list.end)
+
+	for {
+		item := &list.buffer[pos]
+		if item.HasMsgid(msgid) {
+			if err = authorize(item); err == nil {
+				item.Redact(reason)
+			}
+			return true, err
+		}
+		if pos == stop {
+			break
+		}
+		pos = list.next(pos)
+	}
+
+	return
+}
+
 // latest returns the items most recently added, up to `limit`. If `limit` is 0,
 // it returns all items.
 func (list *Buffer) latest(limit int) (results []Item) {
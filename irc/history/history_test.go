@@ -4,6 +4,7 @@
 package history
 
 import (
+	"errors"
 	"reflect"
 	"strconv"
 	"testing"
@@ -145,6 +146,38 @@ func TestBuffer(t *testing.T) {
 	assertEqual(toNicks(since), []string{"testnick2", "testnick3"}, t)
 }
 
+func TestRedact(t *testing.T) {
+	buf := NewHistoryBuffer(8, 0)
+	for i := 0; i < 3; i++ {
+		item := easyItem("testnick"+strconv.Itoa(i), "2006-01-01 15:04:05Z")
+		item.Type = Privmsg
+		item.Message.Msgid = "msgid" + strconv.Itoa(i)
+		item.Message.Message = "hello"
+		buf.Add(item)
+	}
+
+	allow := func(item *Item) error { return nil }
+	forbidden := errors.New("forbidden")
+	deny := func(item *Item) error { return forbidden }
+
+	found, err := buf.Redact("msgid1", "oops", deny)
+	assertEqual(found, true, t)
+	assertEqual(err, forbidden, t)
+	found, err = buf.Redact("msgid3", "oops", allow)
+	assertEqual(found, false, t)
+	found, err = buf.Redact("msgid1", "oops", allow)
+	assertEqual(found, true, t)
+	assertEqual(err, nil, t)
+
+	item, _ := buf.lookup("msgid1")
+	assertEqual(item.Type, Redact, t)
+	assertEqual(item.Message.Message, "", t)
+	assertEqual(item.Params[0], "oops", t)
+	assertEqual(item.Message.Time, easyParse("2006-01-01 15:04:05Z"), t)
+	item, _ = buf.lookup("msgid2")
+	assertEqual(item.Message.Message, "hello", t)
+}
+
 func autoItem(id int, t time.Time) (result Item) {
 	result.Message.Time = t
 	result.Nick = strconv.Itoa(id)
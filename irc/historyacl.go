@@ -0,0 +1,126 @@
+// Copyright (c) 2021 Shivaram Lingamneni <slingamn@cs.stanford.edu>
+// released under the MIT license
+
+package irc
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/tidwall/buntdb"
+
+	"github.com/ergochat/ergo/irc/history"
+)
+
+// CHATHISTORY for a channel is only available to its current members, except
+// that always-on clients can also retrieve the history of the period when
+// they were members of a channel they've since left. to support this, the
+// most recent membership of each channel an always-on client leaves is
+// recorded in the datastore.
+
+const (
+	maxDepartedChannels = 100
+)
+
+type departedMembership struct {
+	Joined   time.Time
+	Departed time.Time
+}
+
+func (am *AccountManager) loadDepartedChannels(tx *buntdb.Tx, account string) (result map[string]departedMembership) {
+	if val, err := tx.Get(fmt.Sprintf(keyAccountDepartedChannels, account)); err == nil {
+		json.Unmarshal([]byte(val), &result)
+	}
+	return
+}
+
+// saveDepartedChannel records that an always-on client left a channel
+func (am *AccountManager) saveDepartedChannel(account, chname string, joined time.Time) {
+	now := time.Now().UTC()
+	var expiration time.Time
+	if expireTime := am.server.Config().History.Restrictions.ExpireTime; expireTime != 0 {
+		expiration = now.Add(-time.Duration(expireTime))
+	}
+
+	am.server.store.Update(func(tx *buntdb.Tx) error {
+		departed := am.loadDepartedChannels(tx, account)
+		if departed == nil {
+			departed = make(map[string]departedMembership)
+		}
+		departed[chname] = departedMembership{Joined: joined, Departed: now}
+		// discard memberships whose history has expired anyway, then the oldest
+		// ones if there are still too many:
+		for name, membership := range departed {
+			if membership.Departed.Before(expiration) {
+				delete(departed, name)
+			}
+		}
+		for len(departed) > maxDepartedChannels {
+			var oldest string
+			for name, membership := range departed {
+				if oldest == "" || membership.Departed.Before(departed[oldest].Departed) {
+					oldest = name
+				}
+			}
+			delete(departed, oldest)
+		}
+		val, _ := json.Marshal(departed)
+		tx.Set(fmt.Sprintf(keyAccountDepartedChannels, account), string(val), nil)
+		return nil
+	})
+}
+
+// departedMembership returns the client's most recent past membership of
+// the channel, if any
+func (am *AccountManager) departedMembership(client *Client, channel *Channel) (result departedMembership, ok bool) {
+	account := client.Account()
+	if account == "" {
+		return
+	}
+	chname := channel.NameCasefolded()
+	am.server.store.View(func(tx *buntdb.Tx) error {
+		result, ok = am.loadDepartedChannels(tx, account)[chname]
+		return nil
+	})
+	return
+}
+
+// departedSequence restricts a history sequence to messages sent before
+// a former member left the channel (the lower bound is handled by the
+// sequence's own cutoff)
+type departedSequence struct {
+	history.Sequence
+	departed time.Time
+}
+
+func (seq *departedSequence) clamp(selector history.Selector) history.Selector {
+	if selector.Msgid == "" && (selector.Time.IsZero() || selector.Time.After(seq.departed)) {
+		return history.Selector{Time: seq.departed}
+	}
+	return selector
+}
+
+func (seq *departedSequence) Between(start, end history.Selector, limit int) (results []history.Item, err error) {
+	if !start.Time.IsZero() && !end.Time.IsZero() && end.Time.Before(start.Time) {
+		// BETWEEN going backwards: `start` is the upper bound
+		start = seq.clamp(start)
+	} else if start.Time.After(seq.departed) {
+		return nil, nil
+	} else {
+		end = seq.clamp(end)
+	}
+	results, err = seq.Sequence.Between(start, end, limit)
+	// selectors by msgid can't be clamped, so filter the results as well:
+	filtered := results[:0]
+	for _, item := range results {
+		if !item.Message.Time.After(seq.departed) {
+			filtered = append(filtered, item)
+		}
+	}
+	return filtered, err
+}
+
+func (seq *departedSequence) Around(start history.Selector, limit int) (results []history.Item, err error) {
+	return history.GenericAround(seq, start, limit)
+}
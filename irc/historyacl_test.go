@@ -0,0 +1,51 @@
+// Copyright (c) 2021 Shivaram Lingamneni <slingamn@cs.stanford.edu>
+// released under the MIT license
+
+package irc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ergochat/ergo/irc/history"
+)
+
+func TestDepartedSequence(t *testing.T) {
+	base := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	buf := history.NewHistoryBuffer(16, 0)
+	for i := 0; i < 6; i++ {
+		var item history.Item
+		item.Message.Time = base.Add(time.Duration(i) * time.Hour)
+		item.Message.Msgid = string(rune('a' + i))
+		buf.Add(item)
+	}
+	// joined at 0:30, departed at 3:30
+	seq := &departedSequence{
+		Sequence: buf.MakeSequence("", base.Add(30*time.Minute)),
+		departed: base.Add(3*time.Hour + 30*time.Minute),
+	}
+	msgids := func(items []history.Item) (result []string) {
+		for _, item := range items {
+			result = append(result, item.Message.Msgid)
+		}
+		return
+	}
+
+	// LATEST
+	items, _ := seq.Between(history.Selector{}, history.Selector{}, 10)
+	assertEqual(msgids(items), []string{"b", "c", "d"}, t)
+	// AFTER
+	items, _ = seq.Between(history.Selector{Time: base.Add(90 * time.Minute)}, history.Selector{}, 10)
+	assertEqual(msgids(items), []string{"c", "d"}, t)
+	items, _ = seq.Between(history.Selector{Time: base.Add(4 * time.Hour)}, history.Selector{}, 10)
+	assertEqual(len(items), 0, t)
+	// BEFORE
+	items, _ = seq.Between(history.Selector{}, history.Selector{Time: base.Add(5 * time.Hour)}, 10)
+	assertEqual(msgids(items), []string{"b", "c", "d"}, t)
+	// BETWEEN, backwards
+	items, _ = seq.Between(history.Selector{Time: base.Add(5 * time.Hour)}, history.Selector{Time: base}, 10)
+	assertEqual(msgids(items), []string{"b", "c", "d"}, t)
+	// AFTER a msgid
+	items, _ = seq.Between(history.Selector{Msgid: "c"}, history.Selector{}, 10)
+	assertEqual(msgids(items), []string{"d"}, t)
+}
@@ -7,6 +7,7 @@ import (
 	"errors"
 	"fmt"
 	"regexp"
+	"strings"
 
 	"github.com/ergochat/irc-go/ircfmt"
 
@@ -158,6 +159,23 @@ func validateVhost(server *Server, vhost string, oper bool) error {
 	return nil
 }
 
+// the auto-vhost template is expanded with the account name, giving logged-in
+// users who don't have an approved vhost of their own a stable one
+const autoVHostPlaceholder = "<account>"
+
+// autoVHost returns the automatic vhost for an account, or "" if it's
+// disabled or the account name can't be used in a vhost
+func (vhconfig *VHostConfig) autoVHost(accountName string) (vhost string) {
+	if !vhconfig.AutoVHost.Enabled || accountName == "" || accountName == "*" {
+		return
+	}
+	vhost = strings.Replace(vhconfig.AutoVHost.Template, autoVHostPlaceholder, accountName, -1)
+	if len(vhost) > vhconfig.MaxLength || !vhconfig.validRegexp.MatchString(vhost) {
+		return ""
+	}
+	return
+}
+
 func hsSetHandler(service *ircService, server *Server, client *Client, command string, params []string, rb *ResponseBuffer) {
 	user := params[0]
 	var vhost string
@@ -0,0 +1,100 @@
+// Copyright (c) 2021 Shivaram Lingamneni <slingamn@cs.stanford.edu>
+// released under the MIT license
+
+package irc
+
+import (
+	"fmt"
+	"runtime/debug"
+	"time"
+)
+
+// idle-away (/NS SET IDLE-AWAY) marks users away automatically once they
+// haven't been active (see Client.UpdateActive) for the period they chose,
+// and marks them back as soon as they are active again.
+
+const (
+	idleAwayPollPeriod = 30 * time.Second
+)
+
+type IdleAwayConfig struct {
+	Enabled     bool
+	MinimumIdle time.Duration `yaml:"minimum-idle"`
+	Message     string
+}
+
+// idleAwayPeriod returns the effective idle period for the account settings,
+// or 0 if idle-away is disabled
+func idleAwayPeriod(config *Config, settings AccountSettings) time.Duration {
+	if !config.Accounts.IdleAway.Enabled || settings.IdleAway == 0 {
+		return 0
+	}
+	if settings.IdleAway < config.Accounts.IdleAway.MinimumIdle {
+		return config.Accounts.IdleAway.MinimumIdle
+	}
+	return settings.IdleAway
+}
+
+func (server *Server) handleIdleAway() {
+	defer func() {
+		if r := recover(); r != nil {
+			server.logger.Error("internal",
+				fmt.Sprintf("Panic in idle-away: %v\n%s", r, debug.Stack()))
+		}
+		// either way, reschedule
+		time.AfterFunc(idleAwayPollPeriod, server.handleIdleAway)
+	}()
+
+	config := server.Config()
+	if !config.Accounts.IdleAway.Enabled {
+		return
+	}
+	now := time.Now().UTC()
+	for _, client := range server.clients.AllClients() {
+		if sessions := client.checkIdleAway(config, now); len(sessions) != 0 {
+			client.setIdleAway(sessions, config.Accounts.IdleAway.Message)
+		}
+	}
+}
+
+// checkIdleAway returns the sessions that should be marked away because
+// the client has been idle for too long
+func (client *Client) checkIdleAway(config *Config, now time.Time) (sessions []*Session) {
+	client.stateMutex.RLock()
+	defer client.stateMutex.RUnlock()
+
+	period := idleAwayPeriod(config, client.accountSettings)
+	if period == 0 || !client.registered || now.Sub(client.lastActive) < period {
+		return nil
+	}
+	for _, session := range client.sessions {
+		if session.awayMessage == "" {
+			sessions = append(sessions, session)
+		}
+	}
+	return
+}
+
+// setIdleAway marks the sessions away (or back, if awayMessage is empty)
+// through the same per-session path as AWAY, then informs the sessions
+// that changed and the client's friends
+func (client *Client) setIdleAway(sessions []*Session, awayMessage string) {
+	isAway := awayMessage != ""
+	nick := client.Nick()
+	notify := false
+	for _, session := range sessions {
+		if !session.setAway(awayMessage, true) {
+			continue
+		}
+		notify = true
+		if isAway {
+			session.Send(nil, client.server.name, RPL_NOWAWAY, nick, client.t("You have been marked as being away"))
+		} else {
+			session.Send(nil, client.server.name, RPL_UNAWAY, nick, client.t("You are no longer marked as being away"))
+		}
+	}
+	if notify {
+		clientAway, clientAwayMessage := client.Away()
+		dispatchAwayNotify(client, clientAway, clientAwayMessage)
+	}
+}
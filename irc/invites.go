@@ -0,0 +1,216 @@
+// Copyright (c) 2021 Shivaram Lingamneni <slingamn@cs.stanford.edu>
+// released under the MIT license
+
+package irc
+
+import (
+	"fmt"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"time"
+)
+
+// pending INVITEs to invite-only channels are tracked per channel, so that
+// channel operators can list and revoke them. An invite lasts until it is
+// used or expires (channels.invite-expiration); it survives the inviter
+// disconnecting, and for invitees who are logged in, reconnecting too;
+// guests' invites are forgotten when they quit.
+
+const (
+	invitePurgePeriod = 10 * time.Minute
+)
+
+// an invite is consumed by the account if the invitee was logged in,
+// otherwise by the exact client
+type inviteeKey struct {
+	account string
+	client  *Client
+}
+
+func inviteeKeyFor(client *Client, account string) inviteeKey {
+	if account != "" {
+		return inviteeKey{account: account}
+	}
+	return inviteeKey{client: client}
+}
+
+type channelInvite struct {
+	invitee   string // nick at the time of the invite, for display only
+	inviter   string // nickmask of the inviter
+	invitedAt time.Time
+}
+
+type channelInviteList struct {
+	// invites are invalidated if the channel is destroyed and recreated:
+	channelCreatedAt time.Time
+	invites          map[inviteeKey]channelInvite
+}
+
+// InviteManager tracks pending invites for all channels.
+type InviteManager struct {
+	sync.Mutex // tier 1
+	channels   map[string]*channelInviteList
+}
+
+func (im *InviteManager) Initialize() {
+	im.channels = make(map[string]*channelInviteList)
+}
+
+// getList returns the invites for a channel, if they are still current;
+// it must be called with the mutex held
+func (im *InviteManager) getList(chcfname string, createdAt time.Time, create bool) (list *channelInviteList) {
+	list = im.channels[chcfname]
+	if list != nil && !list.channelCreatedAt.Equal(createdAt) {
+		delete(im.channels, chcfname)
+		list = nil
+	}
+	if list == nil && create {
+		list = &channelInviteList{
+			channelCreatedAt: createdAt,
+			invites:          make(map[inviteeKey]channelInvite),
+		}
+		im.channels[chcfname] = list
+	}
+	return
+}
+
+// removeKey deletes an invite, and the list too if that was the last one;
+// it must be called with the mutex held
+func (im *InviteManager) removeKey(chcfname string, list *channelInviteList, key inviteeKey) (found bool) {
+	_, found = list.invites[key]
+	delete(list.invites, key)
+	if len(list.invites) == 0 {
+		delete(im.channels, chcfname)
+	}
+	return
+}
+
+// purgeExpired deletes expired invites; it must be called with the mutex held
+func (im *InviteManager) purgeExpired(chcfname string, list *channelInviteList, expiration time.Duration, now time.Time) {
+	if expiration == 0 {
+		return
+	}
+	for key, invite := range list.invites {
+		if expiration <= now.Sub(invite.invitedAt) {
+			delete(list.invites, key)
+		}
+	}
+	if len(list.invites) == 0 {
+		delete(im.channels, chcfname)
+	}
+}
+
+// PurgeExpired deletes expired invites to all channels
+func (im *InviteManager) PurgeExpired(expiration time.Duration) {
+	if expiration == 0 {
+		return
+	}
+	now := time.Now().UTC()
+	im.Lock()
+	defer im.Unlock()
+	for chcfname, list := range im.channels {
+		im.purgeExpired(chcfname, list, expiration, now)
+	}
+}
+
+// Add records that `invitee` was invited to the channel by `inviter`
+func (im *InviteManager) Add(chcfname string, createdAt time.Time, invitee *Client, inviter string) {
+	details := invitee.Details()
+	invite := channelInvite{
+		invitee:   details.nick,
+		inviter:   inviter,
+		invitedAt: time.Now().UTC(),
+	}
+
+	im.Lock()
+	defer im.Unlock()
+	list := im.getList(chcfname, createdAt, true)
+	// a client has at most one pending invite per channel, even across nick changes:
+	list.invites[inviteeKeyFor(invitee, details.account)] = invite
+}
+
+// Consume checks whether the client has a valid invite to the channel;
+// joining an invited channel "uses up" the invite, so you can't rejoin on kick
+func (im *InviteManager) Consume(chcfname string, createdAt time.Time, client *Client, expiration time.Duration) (invited bool) {
+	account := client.Account()
+
+	im.Lock()
+	defer im.Unlock()
+	list := im.getList(chcfname, createdAt, false)
+	if list == nil {
+		return false
+	}
+	// the client may have logged in since it was invited as a guest:
+	for _, key := range []inviteeKey{inviteeKeyFor(client, account), {client: client}} {
+		if invite, ok := list.invites[key]; ok {
+			im.removeKey(chcfname, list, key)
+			return expiration == 0 || time.Since(invite.invitedAt) < expiration
+		}
+	}
+	return false
+}
+
+// Remove revokes the invite for a client (if online) or an account (if not),
+// returning whether there was one
+func (im *InviteManager) Remove(chcfname string, createdAt time.Time, invitee *Client, account string) (found bool) {
+	im.Lock()
+	defer im.Unlock()
+	list := im.getList(chcfname, createdAt, false)
+	if list == nil {
+		return false
+	}
+	return im.removeKey(chcfname, list, inviteeKeyFor(invitee, account))
+}
+
+// RemoveClient forgets the invites of a guest client when it quits;
+// the invites of logged-in clients belong to the account, and survive
+func (im *InviteManager) RemoveClient(client *Client) {
+	key := inviteeKey{client: client}
+	im.Lock()
+	defer im.Unlock()
+	for chcfname, list := range im.channels {
+		if _, ok := list.invites[key]; ok {
+			im.removeKey(chcfname, list, key)
+		}
+	}
+}
+
+// List returns the unexpired invites for a channel, oldest first
+func (im *InviteManager) List(chcfname string, createdAt time.Time, expiration time.Duration) (result []channelInvite) {
+	im.Lock()
+	defer im.Unlock()
+	list := im.getList(chcfname, createdAt, false)
+	if list == nil {
+		return nil
+	}
+	im.purgeExpired(chcfname, list, expiration, time.Now().UTC())
+	result = make([]channelInvite, 0, len(list.invites))
+	for _, invite := range list.invites {
+		result = append(result, invite)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].invitedAt.Before(result[j].invitedAt)
+	})
+	return
+}
+
+// ClearChannel forgets all invites to a channel, e.g., when it is destroyed
+func (im *InviteManager) ClearChannel(chcfname string) {
+	im.Lock()
+	defer im.Unlock()
+	delete(im.channels, chcfname)
+}
+
+func (server *Server) handleInviteExpirations() {
+	defer func() {
+		if r := recover(); r != nil {
+			server.logger.Error("internal",
+				fmt.Sprintf("Panic in invite expiration: %v\n%s", r, debug.Stack()))
+		}
+		// either way, reschedule
+		time.AfterFunc(invitePurgePeriod, server.handleInviteExpirations)
+	}()
+
+	server.invites.PurgeExpired(time.Duration(server.Config().Channels.InviteExpiration))
+}
@@ -0,0 +1,62 @@
+// Copyright (c) 2021 Shivaram Lingamneni <slingamn@cs.stanford.edu>
+// released under the MIT license
+
+package irc
+
+import (
+	"testing"
+	"time"
+)
+
+func TestInviteManager(t *testing.T) {
+	var im InviteManager
+	im.Initialize()
+	createdAt := time.Now().UTC()
+
+	guest := &Client{nick: "Guest", nickCasefolded: "guest"}
+	impostor := &Client{nick: "Guest", nickCasefolded: "guest"}
+	alice := &Client{nick: "alice", nickCasefolded: "alice", account: "alice"}
+	// alice reconnecting under a different nick:
+	alice2 := &Client{nick: "alice_", nickCasefolded: "alice_", account: "alice"}
+
+	im.Add("#chan", createdAt, guest, "op!op@localhost")
+	im.Add("#chan", createdAt, alice, "op!op@localhost")
+	assertEqual(len(im.List("#chan", createdAt, 0)), 2, t)
+
+	// guest invites are bound to the client, not the nickname:
+	assertEqual(im.Consume("#chan", createdAt, impostor, 0), false, t)
+	assertEqual(im.Consume("#chan", createdAt, guest, 0), true, t)
+	// invites are used up by joining:
+	assertEqual(im.Consume("#chan", createdAt, guest, 0), false, t)
+	// invites are invalidated if the channel is recreated:
+	assertEqual(im.Consume("#chan", createdAt.Add(time.Second), alice2, 0), false, t)
+
+	im.Add("#chan", createdAt, alice, "op!op@localhost")
+	assertEqual(im.Remove("#chan", createdAt, guest, ""), false, t)
+	// revocation goes by account, whatever nick was used at invite time:
+	assertEqual(im.Remove("#chan", createdAt, alice2, "alice"), true, t)
+	assertEqual(im.Consume("#chan", createdAt, alice2, 0), false, t)
+
+	// guest invites are forgotten when the guest quits:
+	im.Add("#chan", createdAt, guest, "op!op@localhost")
+	im.Add("#other", createdAt, guest, "op!op@localhost")
+	im.RemoveClient(guest)
+	assertEqual(len(im.channels), 0, t)
+
+	// account invites survive reconnection:
+	im.Add("#chan", createdAt, alice, "op!op@localhost")
+	assertEqual(im.Consume("#chan", createdAt, alice2, 0), true, t)
+
+	// expiration:
+	im.Add("#chan", createdAt, guest, "op!op@localhost")
+	time.Sleep(time.Millisecond)
+	assertEqual(len(im.List("#chan", createdAt, time.Nanosecond)), 0, t)
+	im.Add("#chan", createdAt, guest, "op!op@localhost")
+	time.Sleep(time.Millisecond)
+	assertEqual(im.Consume("#chan", createdAt, guest, time.Nanosecond), false, t)
+	// expired invites are purged without anyone reading them:
+	im.Add("#chan", createdAt, guest, "op!op@localhost")
+	time.Sleep(time.Millisecond)
+	im.PurgeExpired(time.Nanosecond)
+	assertEqual(len(im.channels), 0, t)
+}
@@ -18,6 +18,7 @@ import (
 
 const (
 	keyKlineEntry = "bans.klinev2 %s"
+	keyShunEntry  = "bans.shun %s"
 )
 
 // KLineInfo contains the address itself and expiration time for a given network.
@@ -31,6 +32,7 @@ type KLineInfo struct {
 }
 
 // KLineManager manages and klines.
+// (it also manages shuns, which are matched against nickmasks in the same way)
 type KLineManager struct {
 	sync.RWMutex                // tier 1
 	persistenceMutex sync.Mutex // tier 2
@@ -38,14 +40,25 @@ type KLineManager struct {
 	entries          map[string]KLineInfo
 	expirationTimers map[string]*time.Timer
 	server           *Server
+	keyFormat        string // datastore key format for entries
 }
 
 // NewKLineManager returns a new KLineManager.
 func NewKLineManager(s *Server) *KLineManager {
+	return newMaskBanManager(s, keyKlineEntry)
+}
+
+// NewShunManager returns a new KLineManager that manages shuns.
+func NewShunManager(s *Server) *KLineManager {
+	return newMaskBanManager(s, keyShunEntry)
+}
+
+func newMaskBanManager(s *Server, keyFormat string) *KLineManager {
 	var km KLineManager
 	km.entries = make(map[string]KLineInfo)
 	km.expirationTimers = make(map[string]*time.Timer)
 	km.server = s
+	km.keyFormat = keyFormat
 
 	km.loadFromDatastore()
 
@@ -136,7 +149,7 @@ func (km *KLineManager) cancelTimer(id string) {
 
 func (km *KLineManager) persistKLine(mask string, info IPBanInfo) error {
 	// save in datastore
-	klineKey := fmt.Sprintf(keyKlineEntry, mask)
+	klineKey := fmt.Sprintf(km.keyFormat, mask)
 	// assemble json from ban info
 	b, err := json.Marshal(info)
 	if err != nil {
@@ -159,7 +172,7 @@ func (km *KLineManager) persistKLine(mask string, info IPBanInfo) error {
 
 func (km *KLineManager) unpersistKLine(mask string) error {
 	// save in datastore
-	klineKey := fmt.Sprintf(keyKlineEntry, mask)
+	klineKey := fmt.Sprintf(km.keyFormat, mask)
 	return km.server.store.Update(func(tx *buntdb.Tx) error {
 		_, err := tx.Delete(klineKey)
 		return err
@@ -189,6 +202,13 @@ func (km *KLineManager) RemoveMask(mask string) error {
 	return km.unpersistKLine(mask)
 }
 
+// Empty returns whether there are no entries at all.
+func (km *KLineManager) Empty() bool {
+	km.RLock()
+	defer km.RUnlock()
+	return len(km.entries) == 0
+}
+
 func (km *KLineManager) ContainsMask(mask string) (isBanned bool, info IPBanInfo) {
 	km.RLock()
 	defer km.RUnlock()
@@ -220,7 +240,7 @@ func (km *KLineManager) CheckMasks(masks ...string) (isBanned bool, info IPBanIn
 
 func (km *KLineManager) loadFromDatastore() {
 	// load from datastore
-	klinePrefix := fmt.Sprintf(keyKlineEntry, "")
+	klinePrefix := fmt.Sprintf(km.keyFormat, "")
 	km.server.store.View(func(tx *buntdb.Tx) error {
 		tx.AscendGreaterOrEqual("", klinePrefix, func(key, value string) bool {
 			if !strings.HasPrefix(key, klinePrefix) {
@@ -255,4 +275,5 @@ func (km *KLineManager) loadFromDatastore() {
 
 func (s *Server) loadKLines() {
 	s.klines = NewKLineManager(s)
+	s.shuns = NewShunManager(s)
 }
@@ -0,0 +1,80 @@
+// Copyright (c) 2021 Shivaram Lingamneni <slingamn@cs.stanford.edu>
+// released under the MIT license
+
+package irc
+
+import (
+	"sort"
+	"time"
+)
+
+// latency is measured as the round-trip time of the keepalive PINGs sent
+// to idle sessions (see handleIdleTimeout); a session that is never idle
+// long enough to be PINGed has no measurement.
+
+// recordPong completes the measurement of an outstanding keepalive PING.
+func (session *Session) recordPong(now time.Time) {
+	session.client.stateMutex.Lock()
+	defer session.client.stateMutex.Unlock()
+	if !session.pingSentAt.IsZero() {
+		session.latency = now.Sub(session.pingSentAt)
+		session.pingSentAt = time.Time{}
+	}
+}
+
+// Latency returns the last measured PING round-trip time of the session,
+// or 0 if there is no measurement yet.
+func (session *Session) Latency() time.Duration {
+	session.client.stateMutex.RLock()
+	defer session.client.stateMutex.RUnlock()
+	return session.latency
+}
+
+// LatencyPercentiles is a summary of the latencies of all measured sessions.
+type LatencyPercentiles struct {
+	Sessions int
+	P50      time.Duration
+	P95      time.Duration
+}
+
+func (server *Server) LatencyPercentiles() (result LatencyPercentiles) {
+	var latencies []time.Duration
+	for _, client := range server.clients.AllClients() {
+		for _, session := range client.Sessions() {
+			if latency := session.Latency(); latency != 0 {
+				latencies = append(latencies, latency)
+			}
+		}
+	}
+	return computeLatencyPercentiles(latencies)
+}
+
+func computeLatencyPercentiles(latencies []time.Duration) (result LatencyPercentiles) {
+	result.Sessions = len(latencies)
+	if len(latencies) == 0 {
+		return
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	// nearest-rank method
+	percentile := func(p int) time.Duration {
+		rank := (p*len(latencies) + 99) / 100
+		if rank < 1 {
+			rank = 1
+		}
+		return latencies[rank-1]
+	}
+	result.P50 = percentile(50)
+	result.P95 = percentile(95)
+	return
+}
+
+// latencyExpvarValue is the JSON-serializable representation of the
+// latency percentiles, exported via expvar on the pprof listener.
+func (server *Server) latencyExpvarValue() interface{} {
+	percentiles := server.LatencyPercentiles()
+	return map[string]interface{}{
+		"sessions":    percentiles.Sessions,
+		"p50_seconds": percentiles.P50.Seconds(),
+		"p95_seconds": percentiles.P95.Seconds(),
+	}
+}
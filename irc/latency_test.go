@@ -0,0 +1,25 @@
+// Copyright (c) 2021 Shivaram Lingamneni <slingamn@cs.stanford.edu>
+// released under the MIT license
+
+package irc
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLatencyPercentiles(t *testing.T) {
+	assertEqual(computeLatencyPercentiles(nil), LatencyPercentiles{}, t)
+
+	single := computeLatencyPercentiles([]time.Duration{time.Second})
+	assertEqual(single, LatencyPercentiles{Sessions: 1, P50: time.Second, P95: time.Second}, t)
+
+	var latencies []time.Duration
+	for i := 100; i >= 1; i-- {
+		latencies = append(latencies, time.Duration(i)*time.Millisecond)
+	}
+	result := computeLatencyPercentiles(latencies)
+	assertEqual(result.Sessions, 100, t)
+	assertEqual(result.P50, 50*time.Millisecond, t)
+	assertEqual(result.P95, 95*time.Millisecond, t)
+}
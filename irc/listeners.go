@@ -96,7 +96,8 @@ func (nl *NetListener) serve() {
 			wConn, ok := conn.(*utils.WrappedConn)
 			if ok {
 				confirmProxyData(wConn, "", "", "", nl.server.Config())
-				go nl.server.RunClient(NewIRCStreamConn(wConn))
+				ircConn := NewIRCStreamConn(wConn)
+				go nl.server.RunClient(ircConn, nl.addr)
 			} else {
 				nl.server.logger.Error("internal", "invalid connection type", nl.addr)
 			}
@@ -187,7 +188,8 @@ func (wl *WSListener) handle(w http.ResponseWriter, r *http.Request) {
 	// avoid a DoS attack from buffering excessively large messages:
 	conn.SetReadLimit(int64(maxReadQBytes()))
 
-	go wl.server.RunClient(NewIRCWSConn(conn))
+	ircConn := NewIRCWSConn(conn)
+	go wl.server.RunClient(ircConn, wl.addr)
 }
 
 // validate conn.ProxiedIP and conn.Secure against config, HTTP headers, etc.
@@ -84,6 +84,10 @@ type LoggingConfig struct {
 	ExcludedTypes []string `yaml:"real-excluded-types"`
 	LevelString   string   `yaml:"level"`
 	Level         Level    `yaml:"level-real"`
+	// rotate the file once it reaches this size (0 to disable rotation),
+	// keeping this many of the previous files:
+	MaxSizeMB  int `yaml:"max-size-mb"`
+	MaxBackups int `yaml:"max-backups"`
 }
 
 // NewManager returns a new log manager.
@@ -125,9 +129,11 @@ func (logger *Manager) ApplyConfig(config []LoggingConfig) error {
 		sLogger := singleLogger{
 			MethodSTDOUT: logConfig.MethodStdout,
 			MethodSTDERR: logConfig.MethodStderr,
-			MethodFile: fileMethod{
-				Enabled:  logConfig.MethodFile,
-				Filename: logConfig.Filename,
+			MethodFile: &fileMethod{
+				Enabled:    logConfig.MethodFile,
+				Filename:   logConfig.Filename,
+				MaxSize:    int64(logConfig.MaxSizeMB) * 1024 * 1024,
+				MaxBackups: logConfig.MaxBackups,
 			},
 			Level:           logConfig.Level,
 			Types:           typeMap,
@@ -141,13 +147,9 @@ func (logger *Manager) ApplyConfig(config []LoggingConfig) error {
 			atomic.StoreUint32(&logger.loggingRawIO, 1)
 		}
 		if sLogger.MethodFile.Enabled {
-			file, err := os.OpenFile(sLogger.MethodFile.Filename, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0666)
-			if err != nil {
+			if err := sLogger.MethodFile.open(); err != nil {
 				lastErr = fmt.Errorf("Could not open log file %s [%s]", sLogger.MethodFile.Filename, err.Error())
 			}
-			writer := bufio.NewWriter(file)
-			sLogger.MethodFile.File = file
-			sLogger.MethodFile.Writer = writer
 		}
 		logger.loggers = append(logger.loggers, sLogger)
 	}
@@ -191,10 +193,59 @@ func (logger *Manager) Error(logType string, messageParts ...string) {
 }
 
 type fileMethod struct {
-	Enabled  bool
-	Filename string
-	File     *os.File
-	Writer   *bufio.Writer
+	Enabled    bool
+	Filename   string
+	File       *os.File
+	Writer     *bufio.Writer
+	MaxSize    int64
+	MaxBackups int
+	size       int64 // current size of the file
+}
+
+func (method *fileMethod) open() error {
+	file, err := os.OpenFile(method.Filename, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0666)
+	method.File = file
+	method.Writer = bufio.NewWriter(file)
+	method.size = 0
+	if err != nil {
+		return err
+	}
+	if info, err := file.Stat(); err == nil {
+		method.size = info.Size()
+	}
+	return nil
+}
+
+// rotate renames the file to Filename.1 (shifting the existing backups,
+// Filename.1 to Filename.2 and so on, and discarding the oldest) and starts
+// a new file. the caller must hold fileWriteLock.
+func (method *fileMethod) rotate() error {
+	method.Writer.Flush()
+	method.File.Close()
+	backupName := func(i int) string {
+		return fmt.Sprintf("%s.%d", method.Filename, i)
+	}
+	if method.MaxBackups <= 0 {
+		os.Remove(method.Filename)
+	} else {
+		os.Remove(backupName(method.MaxBackups))
+		for i := method.MaxBackups - 1; 0 < i; i-- {
+			os.Rename(backupName(i), backupName(i+1))
+		}
+		os.Rename(method.Filename, backupName(1))
+	}
+	return method.open()
+}
+
+func (method *fileMethod) write(line []byte) {
+	n, _ := method.Writer.Write(line)
+	method.Writer.Flush()
+	method.size += int64(n)
+	if method.MaxSize != 0 && method.MaxSize <= method.size {
+		if err := method.rotate(); err != nil {
+			fmt.Fprintf(os.Stderr, "Could not rotate log file %s [%s]\n", method.Filename, err.Error())
+		}
+	}
 }
 
 // singleLogger represents a single logger instance.
@@ -203,7 +254,7 @@ type singleLogger struct {
 	fileWriteLock   *sync.Mutex
 	MethodSTDOUT    bool
 	MethodSTDERR    bool
-	MethodFile      fileMethod
+	MethodFile      *fileMethod
 	Level           Level
 	Types           map[string]bool
 	ExcludedTypes   map[string]bool
@@ -267,8 +318,7 @@ func (logger *singleLogger) Log(level Level, logType string, messageParts ...str
 	}
 	if logger.MethodFile.Enabled {
 		logger.fileWriteLock.Lock()
-		logger.MethodFile.Writer.Write(rawBuf.Bytes())
-		logger.MethodFile.Writer.Flush()
+		logger.MethodFile.write(rawBuf.Bytes())
 		logger.fileWriteLock.Unlock()
 	}
 }
@@ -0,0 +1,43 @@
+// Copyright (c) 2021 Shivaram Lingamneni <slingamn@cs.stanford.edu>
+// released under the MIT license
+
+package logger
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileRotation(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "ircd.log")
+	method := fileMethod{
+		Enabled:    true,
+		Filename:   filename,
+		MaxSize:    100,
+		MaxBackups: 2,
+	}
+	if err := method.open(); err != nil {
+		t.Fatal(err)
+	}
+	line := []byte(strings.Repeat("x", 59) + "\n")
+	// every second line triggers a rotation
+	for i := 0; i < 7; i++ {
+		method.write(line)
+	}
+	method.File.Close()
+
+	sizes := make(map[string]int64)
+	for _, name := range []string{filename, filename + ".1", filename + ".2", filename + ".3"} {
+		if info, err := os.Stat(name); err == nil {
+			sizes[name] = info.Size()
+		}
+	}
+	if sizes[filename] != 60 || sizes[filename+".1"] != 120 || sizes[filename+".2"] != 120 {
+		t.Errorf("unexpected file sizes after rotation: %v", sizes)
+	}
+	if _, ok := sizes[filename+".3"]; ok {
+		t.Errorf("too many backups were kept")
+	}
+}
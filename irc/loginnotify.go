@@ -0,0 +1,65 @@
+// Copyright (c) 2021 Shivaram Lingamneni <slingamn@cs.stanford.edu>
+// released under the MIT license
+
+package irc
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ergochat/ergo/irc/email"
+)
+
+// when a session logs into an account, the account's other clients are told
+// where the login came from, so that the owner can spot the use of stolen
+// credentials. accounts can also opt into an e-mail for every login
+// (NS SET LOGIN-NOTIFY-EMAIL).
+
+// loginDescription describes the origin of a login, e.g.,
+// "IP 192.0.2.1, hostname example.com, certificate fingerprint abcd..."
+func loginDescription(session *Session) (result string) {
+	result = fmt.Sprintf("IP %s", session.IP().String())
+	if session.rawHostname != "" && session.rawHostname != session.IP().String() {
+		result += fmt.Sprintf(", hostname %s", session.rawHostname)
+	}
+	if session.certfp != "" {
+		result += fmt.Sprintf(", certificate fingerprint %s", session.certfp)
+	}
+	return
+}
+
+// notifyLogin sends login notifications for a successful login by session
+func (server *Server) notifyLogin(client *Client, session *Session) {
+	details := client.Details()
+	description := loginDescription(session)
+
+	for _, other := range server.accounts.AccountToClients(details.account) {
+		if other == client {
+			continue
+		}
+		message := fmt.Sprintf(other.t("Your account %[1]s was just logged into from %[2]s. If this wasn't you, change your password immediately."), details.accountName, description)
+		for _, otherSession := range other.Sessions() {
+			otherSession.Send(nil, server.name, "NOTICE", other.Nick(), message)
+		}
+	}
+
+	settings := client.AccountSettings()
+	emailConfig := server.Config().Accounts.Registration.EmailVerification
+	if settings.LoginNotifyEmail && settings.Email != "" && emailConfig.Enabled {
+		go server.sendLoginNotifyEmail(details.accountName, settings.Email, description, time.Now().UTC())
+	}
+}
+
+func (server *Server) sendLoginNotifyEmail(accountName, address, description string, loginTime time.Time) {
+	emailConfig := server.Config().Accounts.Registration.EmailVerification
+	subject := fmt.Sprintf("New login to your account on %s", server.name)
+	message := email.ComposeMail(emailConfig, address, subject)
+	fmt.Fprintf(&message, "Your account %s on %s was logged into at %s, from %s.\r\n", accountName, server.name, loginTime.Format(time.RFC1123), description)
+	message.WriteString("\r\n")
+	message.WriteString("If this wasn't you, change your password immediately (/MSG NickServ PASSWD).\r\n")
+	message.WriteString("To stop receiving these messages, use /MSG NickServ SET LOGIN-NOTIFY-EMAIL OFF\r\n")
+
+	if err := email.SendMail(emailConfig, address, message.Bytes()); err != nil {
+		server.logger.Error("internal", "Failed to dispatch login notification to", address, err.Error())
+	}
+}
@@ -0,0 +1,21 @@
+// Copyright (c) 2021 Shivaram Lingamneni <slingamn@cs.stanford.edu>
+// released under the MIT license
+
+package irc
+
+import (
+	"net"
+	"testing"
+)
+
+func TestLoginDescription(t *testing.T) {
+	session := &Session{realIP: net.ParseIP("192.0.2.1")}
+	assertEqual(loginDescription(session), "IP 192.0.2.1", t)
+
+	session.rawHostname = "192.0.2.1"
+	assertEqual(loginDescription(session), "IP 192.0.2.1", t)
+
+	session.rawHostname = "host.example.com"
+	session.certfp = "abcd"
+	assertEqual(loginDescription(session), "IP 192.0.2.1, hostname host.example.com, certificate fingerprint abcd", t)
+}
@@ -0,0 +1,102 @@
+// Copyright (c) 2021 Shivaram Lingamneni <slingamn@cs.stanford.edu>
+// released under the MIT license
+
+package irc
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// bound on the memory used by each cache; once it's full,
+	// new results aren't cached until some entries expire
+	maxLookupCacheEntries = 65536
+)
+
+// LookupCache remembers the results of hostname or ident lookups, keyed by
+// IP, so that a reconnect storm from the same hosts doesn't issue the same
+// queries over and over. Failed lookups (the empty string) are cached too,
+// since those are typically the slow ones (timeouts).
+type LookupCache struct {
+	sync.Mutex // tier 1
+
+	entries map[string]lookupCacheEntry
+
+	hits   uint64 // atomic
+	misses uint64 // atomic
+}
+
+type lookupCacheEntry struct {
+	result  string
+	expires time.Time
+}
+
+func (lc *LookupCache) Initialize() {
+	lc.entries = make(map[string]lookupCacheEntry)
+}
+
+// Get returns the cached result for `ip`, if it's present and unexpired.
+func (lc *LookupCache) Get(ip string) (result string, found bool) {
+	lc.Lock()
+	entry, found := lc.entries[ip]
+	if found && time.Now().After(entry.expires) {
+		delete(lc.entries, ip)
+		found = false
+	}
+	lc.Unlock()
+
+	if found {
+		atomic.AddUint64(&lc.hits, 1)
+	} else {
+		atomic.AddUint64(&lc.misses, 1)
+	}
+	return entry.result, found
+}
+
+// Set caches the result of a lookup for `ip` for the duration `ttl`;
+// a ttl of 0 means the result is not cached.
+func (lc *LookupCache) Set(ip, result string, ttl time.Duration) {
+	if ttl <= 0 {
+		return
+	}
+	now := time.Now()
+
+	lc.Lock()
+	defer lc.Unlock()
+
+	if maxLookupCacheEntries <= len(lc.entries) {
+		for key, entry := range lc.entries {
+			if now.After(entry.expires) {
+				delete(lc.entries, key)
+			}
+		}
+		if maxLookupCacheEntries <= len(lc.entries) {
+			return
+		}
+	}
+	lc.entries[ip] = lookupCacheEntry{
+		result:  result,
+		expires: now.Add(ttl),
+	}
+}
+
+// Stats returns the number of cache hits and misses so far.
+func (lc *LookupCache) Stats() (hits, misses uint64) {
+	return atomic.LoadUint64(&lc.hits), atomic.LoadUint64(&lc.misses)
+}
+
+// lookupCacheExpvarValue is the JSON-serializable representation of the
+// lookup cache metrics, exported via expvar on the pprof listener.
+func (server *Server) lookupCacheExpvarValue() interface{} {
+	result := make(map[string]map[string]uint64, 2)
+	for name, cache := range map[string]*LookupCache{"hostname": &server.hostnameCache, "ident": &server.identCache} {
+		hits, misses := cache.Stats()
+		result[name] = map[string]uint64{
+			"hits":   hits,
+			"misses": misses,
+		}
+	}
+	return result
+}
@@ -0,0 +1,41 @@
+// Copyright (c) 2021 Shivaram Lingamneni <slingamn@cs.stanford.edu>
+// released under the MIT license
+
+package irc
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLookupCache(t *testing.T) {
+	var lc LookupCache
+	lc.Initialize()
+
+	_, found := lc.Get("127.0.0.1")
+	assertEqual(found, false, t)
+
+	lc.Set("127.0.0.1", "localhost", time.Minute)
+	// negative caching:
+	lc.Set("10.0.0.1", "", time.Minute)
+	// ttl of 0 disables caching:
+	lc.Set("10.0.0.2", "example.com", 0)
+	// expired:
+	lc.Set("10.0.0.3", "example.com", time.Nanosecond)
+	time.Sleep(time.Millisecond)
+
+	result, found := lc.Get("127.0.0.1")
+	assertEqual(found, true, t)
+	assertEqual(result, "localhost", t)
+	result, found = lc.Get("10.0.0.1")
+	assertEqual(found, true, t)
+	assertEqual(result, "", t)
+	_, found = lc.Get("10.0.0.2")
+	assertEqual(found, false, t)
+	_, found = lc.Get("10.0.0.3")
+	assertEqual(found, false, t)
+
+	hits, misses := lc.Stats()
+	assertEqual(hits, uint64(2), t)
+	assertEqual(misses, uint64(3), t)
+}
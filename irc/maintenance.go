@@ -0,0 +1,225 @@
+// Copyright (c) 2021 Shivaram Lingamneni <slingamn@cs.stanford.edu>
+// released under the MIT license
+
+package irc
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ergochat/irc-go/ircmsg"
+
+	"github.com/ergochat/ergo/irc/custime"
+	"github.com/ergochat/ergo/irc/sno"
+	"github.com/ergochat/ergo/irc/utils"
+)
+
+// maintenance mode stops a listener (or the whole server) from accepting
+// new connections, which receive an ERROR with an estimated return time,
+// while clients that are already connected are unaffected. This is meant
+// for draining a server that sits behind a load balancer.
+
+const (
+	// key for server-wide maintenance, as opposed to a single listener:
+	maintenanceAllListeners = ""
+)
+
+type maintenanceInfo struct {
+	Reason string    `json:"reason,omitempty"`
+	Until  time.Time `json:"until"`
+	SetBy  string    `json:"set-by"`
+}
+
+// Message returns the ERROR text sent to clients that try to connect
+func (info maintenanceInfo) Message() string {
+	message := "This server is down for maintenance"
+	if info.Reason != "" {
+		message = fmt.Sprintf("%s (%s)", message, info.Reason)
+	}
+	if !info.Until.IsZero() {
+		remaining := time.Until(info.Until).Round(time.Minute)
+		if remaining < time.Minute {
+			message = fmt.Sprintf("%s; it should be back shortly", message)
+		} else {
+			message = fmt.Sprintf("%s; it should be back in about %v, at %s", message, remaining, info.Until.Format(time.RFC1123))
+		}
+	}
+	return message
+}
+
+// MaintenanceManager tracks which listeners are in maintenance mode.
+// State is not persisted and is not affected by rehash.
+type MaintenanceManager struct {
+	sync.RWMutex // tier 1
+	entries      map[string]maintenanceInfo
+}
+
+func (mm *MaintenanceManager) Initialize() {
+	mm.entries = make(map[string]maintenanceInfo)
+}
+
+// Set puts a listener, or all listeners if addr is empty, into maintenance mode
+func (mm *MaintenanceManager) Set(addr string, info maintenanceInfo) {
+	mm.Lock()
+	defer mm.Unlock()
+	mm.entries[addr] = info
+}
+
+// Unset takes a listener out of maintenance mode; it returns whether it was in it
+func (mm *MaintenanceManager) Unset(addr string) (found bool) {
+	mm.Lock()
+	defer mm.Unlock()
+	_, found = mm.entries[addr]
+	delete(mm.entries, addr)
+	return
+}
+
+// Check returns whether new connections to addr should be refused
+func (mm *MaintenanceManager) Check(addr string) (info maintenanceInfo, inMaintenance bool) {
+	mm.RLock()
+	defer mm.RUnlock()
+	if len(mm.entries) == 0 {
+		return
+	}
+	if info, inMaintenance = mm.entries[maintenanceAllListeners]; inMaintenance {
+		return
+	}
+	info, inMaintenance = mm.entries[addr]
+	return
+}
+
+func (mm *MaintenanceManager) All() (result map[string]maintenanceInfo) {
+	mm.RLock()
+	defer mm.RUnlock()
+	result = make(map[string]maintenanceInfo, len(mm.entries))
+	for addr, info := range mm.entries {
+		result[addr] = info
+	}
+	return
+}
+
+// rejectForMaintenance closes a new connection to addr with an ERROR if
+// the listener is in maintenance mode; it returns whether it did so.
+// (for TLS listeners, writing the ERROR also performs the handshake,
+// hence the deadline.)
+func (server *Server) rejectForMaintenance(conn IRCConn, addr string) bool {
+	info, inMaintenance := server.maintenance.Check(addr)
+	if !inMaintenance {
+		return false
+	}
+	conn.UnderlyingConn().SetDeadline(time.Now().Add(RegisterTimeout))
+	conn.WriteLine([]byte(fmt.Sprintf(errorMsg, info.Message())))
+	conn.Close()
+	return true
+}
+
+// serveMaintenanceStatus is a health check for load balancers, served at
+// /maintenance on the pprof listener: it returns 503 while the whole server
+// is in maintenance mode, and 200 otherwise
+func (server *Server) serveMaintenanceStatus(w http.ResponseWriter, r *http.Request) {
+	entries := server.maintenance.All()
+	w.Header().Set("Content-Type", "application/json")
+	if _, ok := entries[maintenanceAllListeners]; ok {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	if err := json.NewEncoder(w).Encode(entries); err != nil {
+		server.logger.Error("internal", "couldn't render maintenance status", err.Error())
+	}
+}
+
+// MAINTENANCE [ON <listener|*> [duration] [reason]]
+// MAINTENANCE OFF <listener|*>
+func maintenanceHandler(server *Server, client *Client, msg ircmsg.Message, rb *ResponseBuffer) bool {
+	details := client.Details()
+	operName := client.Oper().Name
+
+	// ON and OFF take the address of a configured listener, or * for all of
+	// them; an unknown address is an error, so that a typo can't put the whole
+	// server into maintenance mode. since a parameter can't start with a colon,
+	// `*:6697` refers to `:6697`
+	parseListener := func(index int) (addr string, ok bool) {
+		if len(msg.Params) <= index {
+			rb.Add(nil, server.name, ERR_NEEDMOREPARAMS, details.nick, msg.Command, client.t("Not enough parameters"))
+			return "", false
+		}
+		addr = msg.Params[index]
+		if addr == "*" {
+			return maintenanceAllListeners, true
+		}
+		if strings.HasPrefix(addr, "*:") {
+			addr = addr[1:]
+		}
+		if _, ok := server.Config().Server.trueListeners[addr]; !ok {
+			rb.Add(nil, server.name, ERR_UNKNOWNERROR, details.nick, msg.Command, fmt.Sprintf(client.t("No such listener: %s"), utils.SafeErrorParam(msg.Params[index])))
+			return "", false
+		}
+		return addr, true
+	}
+	describe := func(addr string) string {
+		if addr == maintenanceAllListeners {
+			return client.t("all listeners")
+		}
+		return fmt.Sprintf(client.t("listener %s"), addr)
+	}
+
+	var subcommand string
+	if len(msg.Params) != 0 {
+		subcommand = strings.ToUpper(msg.Params[0])
+	}
+	switch subcommand {
+	case "ON":
+		addr, ok := parseListener(1)
+		if !ok {
+			return false
+		}
+		currentArg := 2
+		info := maintenanceInfo{SetBy: operName}
+		if currentArg < len(msg.Params) {
+			if duration, err := custime.ParseDuration(msg.Params[currentArg]); err == nil {
+				info.Until = time.Now().UTC().Add(duration)
+				currentArg++
+			}
+		}
+		info.Reason = strings.TrimSpace(strings.Join(msg.Params[currentArg:], " "))
+		server.maintenance.Set(addr, info)
+		rb.Notice(fmt.Sprintf(client.t("Enabled maintenance mode for %s"), describe(addr)))
+		server.snomasks.Send(sno.LocalAnnouncements, fmt.Sprintf("%s [%s] enabled maintenance mode for %s", details.nick, operName, describe(addr)))
+		server.logger.Info("server", "Maintenance mode enabled by", operName, describe(addr))
+	case "OFF":
+		addr, ok := parseListener(1)
+		if !ok {
+			return false
+		}
+		if !server.maintenance.Unset(addr) {
+			rb.Add(nil, server.name, ERR_UNKNOWNERROR, details.nick, msg.Command, fmt.Sprintf(client.t("Maintenance mode is not enabled for %s"), describe(addr)))
+			return false
+		}
+		rb.Notice(fmt.Sprintf(client.t("Disabled maintenance mode for %s"), describe(addr)))
+		server.snomasks.Send(sno.LocalAnnouncements, fmt.Sprintf("%s [%s] disabled maintenance mode for %s", details.nick, operName, describe(addr)))
+		server.logger.Info("server", "Maintenance mode disabled by", operName, describe(addr))
+	case "":
+		entries := server.maintenance.All()
+		if len(entries) == 0 {
+			rb.Notice(client.t("Maintenance mode is not enabled"))
+			return false
+		}
+		addrs := make([]string, 0, len(entries))
+		for addr := range entries {
+			addrs = append(addrs, addr)
+		}
+		sort.Strings(addrs)
+		for _, addr := range addrs {
+			info := entries[addr]
+			rb.Notice(fmt.Sprintf(client.t("Maintenance mode is enabled for %[1]s (set by %[2]s): %[3]s"), describe(addr), info.SetBy, info.Message()))
+			rb.Notice(fmt.Sprintf(client.t("Connections still open on %[1]s: %[2]d"), describe(addr), server.connEvents.OpenConnections(addr)))
+		}
+	default:
+		rb.Add(nil, server.name, ERR_UNKNOWNERROR, details.nick, msg.Command, client.t("Invalid parameters"))
+	}
+	return false
+}
@@ -0,0 +1,38 @@
+// Copyright (c) 2021 Shivaram Lingamneni <slingamn@cs.stanford.edu>
+// released under the MIT license
+
+package irc
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMaintenanceManager(t *testing.T) {
+	var mm MaintenanceManager
+	mm.Initialize()
+
+	_, inMaintenance := mm.Check(":6667")
+	assertEqual(inMaintenance, false, t)
+
+	mm.Set(":6697", maintenanceInfo{Reason: "certificate rotation"})
+	_, inMaintenance = mm.Check(":6667")
+	assertEqual(inMaintenance, false, t)
+	info, inMaintenance := mm.Check(":6697")
+	assertEqual(inMaintenance, true, t)
+	assertEqual(info.Message(), "This server is down for maintenance (certificate rotation)", t)
+
+	mm.Set(maintenanceAllListeners, maintenanceInfo{Until: time.Now().Add(time.Hour)})
+	info, inMaintenance = mm.Check(":6667")
+	assertEqual(inMaintenance, true, t)
+	if !strings.Contains(info.Message(), "back in about 1h0m0s") {
+		t.Errorf("unexpected maintenance message: %s", info.Message())
+	}
+
+	assertEqual(mm.Unset(maintenanceAllListeners), true, t)
+	assertEqual(mm.Unset(maintenanceAllListeners), false, t)
+	_, inMaintenance = mm.Check(":6667")
+	assertEqual(inMaintenance, false, t)
+	assertEqual(len(mm.All()), 1, t)
+}
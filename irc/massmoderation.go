@@ -0,0 +1,186 @@
+// Copyright (c) 2021 Shivaram Lingamneni <slingamn@cs.stanford.edu>
+// released under the MIT license
+
+package irc
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ergochat/ergo/irc/custime"
+	"github.com/ergochat/ergo/irc/modes"
+	"github.com/ergochat/ergo/irc/sno"
+	"github.com/ergochat/irc-go/ircfmt"
+)
+
+// leaves room in a 512-byte MODE line for the source, channel name and modestring
+const maxModeParamBytes = 350
+
+// tools for dealing with a channel emergency (e.g., a spam wave or a rogue
+// op) in one step: CS CLEAR can remove all bans, strip op status that isn't
+// backed by the access list, or kick everyone who isn't logged in, and
+// CS LOCKDOWN sets +m for a limited time. each of these changes the channel
+// under a single acquisition of its state mutex, so it can't interleave with
+// concurrent MODE commands, and each is logged.
+
+// clearBans removes all +b masks, returning the masks that were removed
+func (channel *Channel) clearBans() (removed []string) {
+	defer channel.MarkDirty(IncludeLists)
+
+	channel.stateMutex.Lock()
+	defer channel.stateMutex.Unlock()
+	bans := channel.lists[modes.BanMask]
+	for mask := range bans.Masks() {
+		removed = append(removed, mask)
+	}
+	bans.SetMasks(make(map[string]MaskInfo))
+	return
+}
+
+// deopUnlisted removes channel privileges (+q, +a, +o and +h) from members
+// who aren't entitled to them by the channel's access list (AMODE)
+func (channel *Channel) deopUnlisted() (applied modes.ModeChanges, deopped []*Client) {
+	// capture client details before taking the channel lock (lock tiers)
+	members := channel.Members()
+	details := make(map[*Client]ClientDetails, len(members))
+	for _, member := range members {
+		details[member] = member.Details()
+	}
+
+	channel.stateMutex.Lock()
+	defer channel.stateMutex.Unlock()
+	for member, memberData := range channel.members {
+		memberDetails, ok := details[member]
+		if !ok {
+			continue // joined after the snapshot
+		}
+		amode := channel.accountToUMode[memberDetails.account]
+		changed := false
+		for _, mode := range []modes.Mode{modes.ChannelFounder, modes.ChannelAdmin, modes.ChannelOperator, modes.Halfop} {
+			if amode == mode || umodeGreaterThan(amode, mode) {
+				continue
+			}
+			if memberData.modes.SetMode(mode, false) {
+				applied = append(applied, modes.ModeChange{Op: modes.Remove, Mode: mode, Arg: memberDetails.nick})
+				changed = true
+			}
+		}
+		if changed {
+			memberData.opGranted = 0
+			channel.members[member] = memberData
+			deopped = append(deopped, member)
+		}
+	}
+	return
+}
+
+// startLockdown sets +m until the duration elapses, or extends a lockdown
+// already in progress. it fails if the channel was already moderated
+// by other means. source is the origin of the eventual -m.
+func (channel *Channel) startLockdown(duration time.Duration, source string) (applied modes.ModeChanges, ok bool) {
+	defer func() {
+		if ok {
+			// persist the expiration along with the +m, so that the lockdown
+			// is resumed (or lifted) if the server restarts in the meantime
+			channel.MarkDirty(IncludeModes)
+		}
+	}()
+
+	channel.stateMutex.Lock()
+	defer channel.stateMutex.Unlock()
+
+	if channel.lockdownTimer != nil {
+		channel.lockdownTimer.Stop()
+	} else if channel.flags.HasMode(modes.Moderated) {
+		return nil, false
+	} else {
+		channel.flags.SetMode(modes.Moderated, true)
+		applied = modes.ModeChanges{{Op: modes.Add, Mode: modes.Moderated}}
+	}
+	channel.armLockdown(time.Now().UTC().Add(duration), source)
+	return applied, true
+}
+
+// armLockdown schedules the end of the lockdown; call with the state mutex held.
+// each lockdown gets a new serial number, so that a timer that fires after
+// its lockdown was extended or lifted has no effect
+func (channel *Channel) armLockdown(until time.Time, source string) {
+	channel.lockdownSerial++
+	serial := channel.lockdownSerial
+	channel.lockdownTimer = time.AfterFunc(time.Until(until), func() {
+		channel.endLockdown(serial, source)
+	})
+	channel.lockdownUntil = until
+}
+
+// endLockdown lifts the lockdown (if `serial` is nonzero, only if it is
+// still the one in progress) and announces the removal of +m from source
+func (channel *Channel) endLockdown(serial uint64, source string) (ended bool) {
+	channel.stateMutex.Lock()
+	if channel.lockdownTimer == nil || (serial != 0 && serial != channel.lockdownSerial) {
+		channel.stateMutex.Unlock()
+		return false
+	}
+	channel.lockdownTimer.Stop()
+	channel.lockdownTimer = nil
+	channel.lockdownUntil = time.Time{}
+	removed := channel.flags.SetMode(modes.Moderated, false)
+	channel.stateMutex.Unlock()
+
+	channel.MarkDirty(IncludeModes)
+	if removed {
+		announceCmodeChanges(channel, modes.ModeChanges{{Op: modes.Remove, Mode: modes.Moderated}}, source, "*", "", false, nil)
+	}
+	return true
+}
+
+// announceModeChangesInBatches announces changes made by a service,
+// which may have arbitrarily many parameters, over as many MODE lines
+// as are needed to respect the MODES limit and the line length limit
+func announceModeChangesInBatches(channel *Channel, changes modes.ModeChanges, source string) {
+	for _, batch := range changes.Batches(channel.server.Config().Limits.Modes, maxModeParamBytes) {
+		announceCmodeChanges(channel, batch, source, "*", "", false, nil)
+	}
+}
+
+func logMassModeration(server *Server, client *Client, operation, chname string) {
+	server.logger.Info("services", fmt.Sprintf("Client %s ran CS %s on channel %s", client.Nick(), operation, chname))
+	server.snomasks.Send(sno.LocalChannels, fmt.Sprintf(ircfmt.Unescape("Client $c[grey][$r%s$c[grey]] ran CS %s on channel $c[grey][$r%s$c[grey]]"), client.NickMaskString(), operation, chname))
+}
+
+func csLockdownHandler(service *ircService, server *Server, client *Client, command string, params []string, rb *ResponseBuffer) {
+	channel := server.channels.Get(params[0])
+	if channel == nil {
+		service.Notice(rb, client.t("Channel does not exist"))
+		return
+	}
+	if !csPrivsCheck(service, channel.ExportRegistration(0), client, rb) {
+		return
+	}
+	chname := channel.Name()
+
+	if strings.EqualFold(params[1], "off") {
+		if channel.endLockdown(0, service.prefix) {
+			logMassModeration(server, client, "LOCKDOWN OFF", chname)
+			service.Notice(rb, fmt.Sprintf(client.t("Lifted the lockdown of %s"), chname))
+		} else {
+			service.Notice(rb, fmt.Sprintf(client.t("Channel %s is not locked down"), chname))
+		}
+		return
+	}
+
+	duration, err := custime.ParseDuration(params[1])
+	if err != nil || duration <= 0 {
+		service.Notice(rb, client.t("Invalid duration"))
+		return
+	}
+	applied, ok := channel.startLockdown(duration, service.prefix)
+	if !ok {
+		service.Notice(rb, fmt.Sprintf(client.t("Channel %s is already moderated"), chname))
+		return
+	}
+	announceCmodeChanges(channel, applied, service.prefix, "*", "", false, nil)
+	logMassModeration(server, client, "LOCKDOWN", chname)
+	service.Notice(rb, fmt.Sprintf(client.t("Channel %[1]s is locked down (+m) for %[2]v"), chname, duration))
+}
@@ -0,0 +1,38 @@
+// Copyright (c) 2021 Shivaram Lingamneni <slingamn@cs.stanford.edu>
+// released under the MIT license
+
+package irc
+
+import (
+	"testing"
+
+	"github.com/ergochat/ergo/irc/modes"
+)
+
+func TestDeopUnlisted(t *testing.T) {
+	alice, _ := makeTestClient()
+	alice.account = "alice"
+	bob, _ := makeTestClient()
+	bob.account = "bob"
+	carol, _ := makeTestClient()
+	channel := makeTestChannel(alice, bob, carol)
+	channel.initializeLists()
+	channel.accountToUMode["alice"] = modes.ChannelOperator
+	channel.accountToUMode["bob"] = modes.Halfop
+	for _, member := range []*Client{alice, bob, carol} {
+		channel.members[member].modes.SetMode(modes.ChannelOperator, true)
+	}
+	channel.members[bob].modes.SetMode(modes.Halfop, true)
+	channel.members[carol].modes.SetMode(modes.ChannelAdmin, true)
+	channel.members[carol].modes.SetMode(modes.ChannelFounder, true)
+
+	_, deopped := channel.deopUnlisted()
+	assertEqual(len(deopped), 2, t)
+	assertEqual(channel.members[alice].modes.HasMode(modes.ChannelOperator), true, t)
+	// bob keeps the halfop the access list entitles them to
+	assertEqual(channel.members[bob].modes.HasMode(modes.ChannelOperator), false, t)
+	assertEqual(channel.members[bob].modes.HasMode(modes.Halfop), true, t)
+	assertEqual(channel.members[carol].modes.HasMode(modes.ChannelOperator), false, t)
+	assertEqual(channel.members[carol].modes.HasMode(modes.ChannelAdmin), false, t)
+	assertEqual(channel.members[carol].modes.HasMode(modes.ChannelFounder), false, t)
+}
@@ -0,0 +1,400 @@
+// Copyright (c) 2021 Shivaram Lingamneni <slingamn@cs.stanford.edu>
+// released under the MIT license
+
+package irc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tidwall/buntdb"
+)
+
+const (
+	memoservHelp = `MemoServ lets you leave messages for other registered users,
+which they receive the next time they log in.`
+
+	maxMemoIgnores = 100
+)
+
+var (
+	errMemoIgnored   = errors.New("That user is not accepting memos from you")
+	errMemoInboxFull = errors.New("That user's memo inbox is full")
+	errMemoTooLong   = errors.New("Memo is too long")
+	errNoSuchMemo    = errors.New("No such memo")
+)
+
+// Memo is a message left for a registered user
+type Memo struct {
+	Sender string // display name of the sending account, or of a service
+	SentAt time.Time
+	Text   string
+	Read   bool
+}
+
+func memoservEnabled(config *Config) bool {
+	return config.Accounts.AuthenticationEnabled && config.Accounts.Memos.Enabled
+}
+
+var (
+	memoservCommands = map[string]*serviceCommand{
+		"send": {
+			handler: msSendHandler,
+			help: `Syntax: $bSEND <account> <message>$b
+
+SEND leaves a memo for a registered user, which they will receive the next
+time they log in (or immediately, if they're logged in now).`,
+			helpShort:         `$bSEND$b leaves a memo for another user.`,
+			authRequired:      true,
+			enabled:           memoservEnabled,
+			minParams:         2,
+			maxParams:         2,
+			unsplitFinalParam: true,
+		},
+		"list": {
+			handler: msListHandler,
+			help: `Syntax: $bLIST$b
+
+LIST lists the memos you have received.`,
+			helpShort:    `$bLIST$b lists your memos.`,
+			authRequired: true,
+			enabled:      memoservEnabled,
+		},
+		"read": {
+			handler: msReadHandler,
+			help: `Syntax: $bREAD <number|new>$b
+
+READ shows the memo with the given number (as displayed by LIST), or all
+your unread memos.`,
+			helpShort:    `$bREAD$b reads your memos.`,
+			authRequired: true,
+			enabled:      memoservEnabled,
+			minParams:    1,
+			maxParams:    1,
+		},
+		"del": {
+			handler: msDelHandler,
+			help: `Syntax: $bDEL <number|all>$b
+
+DEL deletes the memo with the given number (as displayed by LIST), or all
+your memos.`,
+			helpShort:    `$bDEL$b deletes your memos.`,
+			authRequired: true,
+			enabled:      memoservEnabled,
+			minParams:    1,
+			maxParams:    1,
+		},
+		"delete": {
+			aliasOf: "del",
+		},
+		"ignore": {
+			handler: msIgnoreHandler,
+			help: `Syntax: $bIGNORE <ADD|DEL|LIST> [account]$b
+
+IGNORE manages the list of accounts you refuse memos from.`,
+			helpShort:    `$bIGNORE$b refuses memos from certain accounts.`,
+			authRequired: true,
+			enabled:      memoservEnabled,
+			minParams:    1,
+			maxParams:    2,
+		},
+	}
+)
+
+func (am *AccountManager) loadMemos(tx *buntdb.Tx, casefoldedAccount string) (memos []Memo) {
+	memosStr, err := tx.Get(fmt.Sprintf(keyAccountMemos, casefoldedAccount))
+	if err == nil {
+		json.Unmarshal([]byte(memosStr), &memos)
+	}
+	return
+}
+
+func (am *AccountManager) storeMemos(tx *buntdb.Tx, casefoldedAccount string, memos []Memo) {
+	key := fmt.Sprintf(keyAccountMemos, casefoldedAccount)
+	if len(memos) == 0 {
+		tx.Delete(key)
+		return
+	}
+	memosBytes, _ := json.Marshal(memos)
+	tx.Set(key, string(memosBytes), nil)
+}
+
+func stringSliceContains(slice []string, str string) bool {
+	for _, s := range slice {
+		if s == str {
+			return true
+		}
+	}
+	return false
+}
+
+func (am *AccountManager) loadMemoIgnores(tx *buntdb.Tx, casefoldedAccount string) (ignores []string) {
+	ignoresStr, err := tx.Get(fmt.Sprintf(keyAccountMemoIgnores, casefoldedAccount))
+	if err == nil {
+		json.Unmarshal([]byte(ignoresStr), &ignores)
+	}
+	return
+}
+
+// Memos returns the account's inbox, oldest first
+func (am *AccountManager) Memos(account string) (memos []Memo) {
+	am.server.store.View(func(tx *buntdb.Tx) error {
+		memos = am.loadMemos(tx, account)
+		return nil
+	})
+	return
+}
+
+// ModifyMemos atomically updates the account's inbox
+func (am *AccountManager) ModifyMemos(account string, munger func([]Memo) ([]Memo, error)) (err error) {
+	am.server.store.Update(func(tx *buntdb.Tx) error {
+		var memos []Memo
+		memos, err = munger(am.loadMemos(tx, account))
+		if err == nil {
+			am.storeMemos(tx, account, memos)
+		}
+		return nil
+	})
+	return
+}
+
+// SendMemo stores a memo for `recipient`; `senderAccount` is the casefolded
+// sending account, or empty for memos sent by services (which bypass the
+// length limit and the recipient's ignore list)
+func (am *AccountManager) SendMemo(senderAccount, senderName, recipient, text string) (recipientName string, memoNumber int, err error) {
+	config := am.server.Config()
+	if senderAccount != "" && config.Accounts.Memos.MaxLength < len(text) {
+		return "", 0, errMemoTooLong
+	}
+	account, err := am.LoadAccount(recipient)
+	if err != nil || !account.Verified {
+		return "", 0, errAccountDoesNotExist
+	}
+
+	memo := Memo{
+		Sender: senderName,
+		SentAt: time.Now().UTC(),
+		Text:   text,
+	}
+	am.server.store.Update(func(tx *buntdb.Tx) error {
+		if senderAccount != "" && stringSliceContains(am.loadMemoIgnores(tx, account.NameCasefolded), senderAccount) {
+			err = errMemoIgnored
+			return nil
+		}
+		memos := am.loadMemos(tx, account.NameCasefolded)
+		if config.Accounts.Memos.MaxMemos <= len(memos) {
+			err = errMemoInboxFull
+			return nil
+		}
+		memos = append(memos, memo)
+		memoNumber = len(memos)
+		am.storeMemos(tx, account.NameCasefolded, memos)
+		return nil
+	})
+	return account.Name, memoNumber, err
+}
+
+// ModifyMemoIgnores adds or removes an account from the ignore list
+func (am *AccountManager) ModifyMemoIgnores(account, target string, add bool) (err error) {
+	key := fmt.Sprintf(keyAccountMemoIgnores, account)
+	am.server.store.Update(func(tx *buntdb.Tx) error {
+		ignores := am.loadMemoIgnores(tx, account)
+		present := stringSliceContains(ignores, target)
+		if add {
+			if present {
+				return nil
+			}
+			if maxMemoIgnores <= len(ignores) {
+				err = errLimitExceeded
+				return nil
+			}
+			ignores = append(ignores, target)
+		} else {
+			if !present {
+				err = errNoop
+				return nil
+			}
+			for i, ignored := range ignores {
+				if ignored == target {
+					ignores = append(ignores[:i], ignores[i+1:]...)
+					break
+				}
+			}
+		}
+		if len(ignores) == 0 {
+			tx.Delete(key)
+		} else {
+			ignoresBytes, _ := json.Marshal(ignores)
+			tx.Set(key, string(ignoresBytes), nil)
+		}
+		return nil
+	})
+	return
+}
+
+func (am *AccountManager) MemoIgnores(account string) (ignores []string) {
+	am.server.store.View(func(tx *buntdb.Tx) error {
+		ignores = am.loadMemoIgnores(tx, account)
+		return nil
+	})
+	return
+}
+
+// unreadMemosNotice returns a notice for a client that just logged in,
+// or the empty string if they have no unread memos
+func (server *Server) unreadMemosNotice(client *Client) string {
+	account := client.Account()
+	if account == "" || !memoservEnabled(server.Config()) {
+		return ""
+	}
+	unread := 0
+	for _, memo := range server.accounts.Memos(account) {
+		if !memo.Read {
+			unread++
+		}
+	}
+	if unread == 0 {
+		return ""
+	}
+	return fmt.Sprintf(client.t("You have %d unread memo(s). To read them, /MS READ NEW"), unread)
+}
+
+func msSendHandler(service *ircService, server *Server, client *Client, command string, params []string, rb *ResponseBuffer) {
+	details := client.Details()
+	recipientName, memoNumber, err := server.accounts.SendMemo(details.account, details.accountName, params[0], params[1])
+	switch err {
+	case nil:
+		service.Notice(rb, fmt.Sprintf(client.t("Sent a memo to %s"), recipientName))
+		for _, recipient := range server.accounts.AccountToClients(recipientName) {
+			recipient.Send(nil, service.prefix, "NOTICE", recipient.Nick(), fmt.Sprintf(recipient.t("You have a new memo from %[1]s. To read it, /MS READ %[2]d"), details.accountName, memoNumber))
+		}
+	case errAccountDoesNotExist, errMemoIgnored, errMemoInboxFull:
+		service.Notice(rb, client.t(err.Error()))
+	case errMemoTooLong:
+		service.Notice(rb, fmt.Sprintf(client.t("Memos can be at most %d bytes long"), server.Config().Accounts.Memos.MaxLength))
+	default:
+		service.Notice(rb, client.t("An error occurred"))
+	}
+}
+
+func msListHandler(service *ircService, server *Server, client *Client, command string, params []string, rb *ResponseBuffer) {
+	memos := server.accounts.Memos(client.Account())
+	if len(memos) == 0 {
+		service.Notice(rb, client.t("You have no memos"))
+		return
+	}
+	service.Notice(rb, fmt.Sprintf(client.t("You have %[1]d memo(s) (at most %[2]d can be stored):"), len(memos), server.Config().Accounts.Memos.MaxMemos))
+	for i, memo := range memos {
+		status := ""
+		if !memo.Read {
+			status = client.t(" [new]")
+		}
+		service.Notice(rb, fmt.Sprintf(client.t("%[1]d.%[2]s From %[3]s at %[4]s"), i+1, status, memo.Sender, memo.SentAt.Format(time.RFC1123)))
+	}
+}
+
+// parseMemoIndex parses a 1-based memo number, as displayed by LIST
+func parseMemoIndex(param string, memos []Memo) (index int, err error) {
+	index, err = strconv.Atoi(param)
+	if err != nil || index < 1 || len(memos) < index {
+		return 0, errNoSuchMemo
+	}
+	return index - 1, nil
+}
+
+func msReadHandler(service *ircService, server *Server, client *Client, command string, params []string, rb *ResponseBuffer) {
+	var shown []Memo
+	readAll := strings.ToLower(params[0]) == "new"
+	err := server.accounts.ModifyMemos(client.Account(), func(memos []Memo) ([]Memo, error) {
+		if readAll {
+			for i := range memos {
+				if !memos[i].Read {
+					shown = append(shown, memos[i])
+					memos[i].Read = true
+				}
+			}
+			return memos, nil
+		}
+		index, err := parseMemoIndex(params[0], memos)
+		if err != nil {
+			return nil, err
+		}
+		shown = append(shown, memos[index])
+		memos[index].Read = true
+		return memos, nil
+	})
+	if err != nil {
+		service.Notice(rb, client.t(err.Error()))
+		return
+	}
+	if len(shown) == 0 {
+		service.Notice(rb, client.t("You have no unread memos"))
+		return
+	}
+	for _, memo := range shown {
+		service.Notice(rb, fmt.Sprintf(client.t("From %[1]s at %[2]s: %[3]s"), memo.Sender, memo.SentAt.Format(time.RFC1123), memo.Text))
+	}
+}
+
+func msDelHandler(service *ircService, server *Server, client *Client, command string, params []string, rb *ResponseBuffer) {
+	deleteAll := strings.ToLower(params[0]) == "all"
+	err := server.accounts.ModifyMemos(client.Account(), func(memos []Memo) ([]Memo, error) {
+		if deleteAll {
+			return nil, nil
+		}
+		index, err := parseMemoIndex(params[0], memos)
+		if err != nil {
+			return nil, err
+		}
+		return append(memos[:index], memos[index+1:]...), nil
+	})
+	if err != nil {
+		service.Notice(rb, client.t(err.Error()))
+	} else if deleteAll {
+		service.Notice(rb, client.t("Deleted all your memos"))
+	} else {
+		service.Notice(rb, client.t("Deleted the memo"))
+	}
+}
+
+func msIgnoreHandler(service *ircService, server *Server, client *Client, command string, params []string, rb *ResponseBuffer) {
+	account := client.Account()
+	subcommand := strings.ToLower(params[0])
+	if subcommand == "list" {
+		ignores := server.accounts.MemoIgnores(account)
+		if len(ignores) == 0 {
+			service.Notice(rb, client.t("You aren't ignoring memos from anyone"))
+		} else {
+			service.Notice(rb, fmt.Sprintf(client.t("You're ignoring memos from: %s"), strings.Join(ignores, ", ")))
+		}
+		return
+	}
+	if len(params) < 2 || (subcommand != "add" && subcommand != "del") {
+		service.Notice(rb, client.t("Invalid parameters"))
+		return
+	}
+	target, err := CasefoldName(params[1])
+	if err != nil {
+		service.Notice(rb, client.t("Invalid account name"))
+		return
+	}
+	err = server.accounts.ModifyMemoIgnores(account, target, subcommand == "add")
+	switch err {
+	case nil:
+		if subcommand == "add" {
+			service.Notice(rb, fmt.Sprintf(client.t("You will no longer receive memos from %s"), params[1]))
+		} else {
+			service.Notice(rb, fmt.Sprintf(client.t("You will receive memos from %s again"), params[1]))
+		}
+	case errNoop:
+		service.Notice(rb, fmt.Sprintf(client.t("You weren't ignoring memos from %s"), params[1]))
+	case errLimitExceeded:
+		service.Notice(rb, client.t("Your ignore list is full"))
+	default:
+		service.Notice(rb, client.t("An error occurred"))
+	}
+}
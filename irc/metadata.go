@@ -0,0 +1,525 @@
+// Copyright (c) 2021 Shivaram Lingamneni <slingamn@cs.stanford.edu>
+// released under the MIT license
+
+package irc
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ergochat/irc-go/ircmsg"
+
+	"github.com/ergochat/ergo/irc/caps"
+	"github.com/ergochat/ergo/irc/modes"
+	"github.com/ergochat/ergo/irc/utils"
+)
+
+// draft/metadata-2 lets clients attach key-value data to users and channels
+// (avatar URLs, display names, channel descriptions). Clients subscribe to the
+// keys they understand, and are then notified of changes to those keys on
+// themselves, on channels they're in, and on users they share a channel with.
+// Metadata on a logged-in user is stored with the account, and metadata on a
+// registered channel is stored with the channel registration.
+
+const (
+	defaultMetadataMaxSubs       = 100
+	defaultMetadataMaxKeys       = 100
+	defaultMetadataMaxValueBytes = 1024
+
+	// we don't implement any restricted keys, so all values are public:
+	metadataVisibility = "*"
+)
+
+var (
+	errMetadataTooManyKeys = errors.New("too many metadata keys")
+	errMetadataTooManySubs = errors.New("too many metadata subscriptions")
+)
+
+// metadataKeyIsValid checks a key name against the spec's allowed characters
+func metadataKeyIsValid(key string) bool {
+	if key == "" || key[0] == '/' {
+		return false
+	}
+	for _, r := range key {
+		if !(('a' <= r && r <= 'z') || ('0' <= r && r <= '9') || r == '_' || r == '.' || r == '/' || r == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+func copyMetadata(metadata map[string]string) (result map[string]string) {
+	if len(metadata) == 0 {
+		return nil
+	}
+	result = make(map[string]string, len(metadata))
+	for key, value := range metadata {
+		result[key] = value
+	}
+	return
+}
+
+// setMetadataEntry sets or (if value is nil) deletes a key in a metadata map;
+// the caller is responsible for synchronization
+func setMetadataEntry(metadata *map[string]string, key string, value *string, maxKeys int) (changed bool, err error) {
+	oldValue, exists := (*metadata)[key]
+	if value == nil {
+		delete(*metadata, key)
+		return exists, nil
+	}
+	if exists && oldValue == *value {
+		return false, nil
+	}
+	if !exists && maxKeys <= len(*metadata) {
+		return false, errMetadataTooManyKeys
+	}
+	if *metadata == nil {
+		*metadata = make(map[string]string)
+	}
+	(*metadata)[key] = *value
+	return true, nil
+}
+
+func sortedMetadataKeys(metadata map[string]string) (keys []string) {
+	keys = make([]string, 0, len(metadata))
+	for key := range metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return
+}
+
+// user metadata:
+
+func (client *Client) Metadata() map[string]string {
+	client.stateMutex.RLock()
+	defer client.stateMutex.RUnlock()
+	return copyMetadata(client.metadata)
+}
+
+// SetMetadata sets or (if value is nil) deletes a key, persisting the change
+// if the client is logged in
+func (client *Client) SetMetadata(key string, value *string, maxKeys int) (changed bool, err error) {
+	client.stateMutex.Lock()
+	changed, err = setMetadataEntry(&client.metadata, key, value, maxKeys)
+	account := client.account
+	metadata := copyMetadata(client.metadata)
+	client.stateMutex.Unlock()
+
+	if changed && account != "" {
+		client.server.accounts.saveMetadata(account, metadata)
+	}
+	return
+}
+
+// ClearMetadata deletes all keys, returning the ones that were deleted
+func (client *Client) ClearMetadata() (deleted map[string]string) {
+	client.stateMutex.Lock()
+	deleted = client.metadata
+	client.metadata = nil
+	account := client.account
+	client.stateMutex.Unlock()
+
+	if len(deleted) != 0 && account != "" {
+		client.server.accounts.saveMetadata(account, nil)
+	}
+	return
+}
+
+// applyMetadata restores the metadata stored with an account on login; if the
+// account has none, whatever the client set before logging in is stored instead
+func (am *AccountManager) applyMetadata(client *Client, account string) {
+	if !am.server.Config().Metadata.Enabled {
+		return
+	}
+	stored := am.loadMetadata(account)
+	client.stateMutex.Lock()
+	if len(stored) != 0 {
+		client.metadata = stored
+	} else {
+		stored = copyMetadata(client.metadata)
+	}
+	client.stateMutex.Unlock()
+	if len(stored) != 0 {
+		am.saveMetadata(account, stored)
+	}
+}
+
+// channel metadata:
+
+func (channel *Channel) Metadata() map[string]string {
+	channel.stateMutex.RLock()
+	defer channel.stateMutex.RUnlock()
+	return copyMetadata(channel.metadata)
+}
+
+func (channel *Channel) SetMetadata(key string, value *string, maxKeys int) (changed bool, err error) {
+	channel.stateMutex.Lock()
+	changed, err = setMetadataEntry(&channel.metadata, key, value, maxKeys)
+	channel.stateMutex.Unlock()
+
+	if changed {
+		channel.MarkDirty(IncludeMetadata)
+	}
+	return
+}
+
+func (channel *Channel) ClearMetadata() (deleted map[string]string) {
+	channel.stateMutex.Lock()
+	deleted = channel.metadata
+	channel.metadata = nil
+	channel.stateMutex.Unlock()
+
+	if len(deleted) != 0 {
+		channel.MarkDirty(IncludeMetadata)
+	}
+	return
+}
+
+// subscriptions:
+
+func (session *Session) MetadataSubscriptions() (result []string) {
+	session.client.stateMutex.RLock()
+	defer session.client.stateMutex.RUnlock()
+	result = make([]string, 0, len(session.metadataSubscriptions))
+	for key := range session.metadataSubscriptions {
+		result = append(result, key)
+	}
+	sort.Strings(result)
+	return
+}
+
+func (session *Session) isSubscribedToMetadata(key string) bool {
+	session.client.stateMutex.RLock()
+	defer session.client.stateMutex.RUnlock()
+	_, ok := session.metadataSubscriptions[key]
+	return ok
+}
+
+func (session *Session) SubscribeMetadata(key string, maxSubs int) (err error) {
+	session.client.stateMutex.Lock()
+	defer session.client.stateMutex.Unlock()
+	if _, ok := session.metadataSubscriptions[key]; ok {
+		return nil
+	}
+	if maxSubs <= len(session.metadataSubscriptions) {
+		return errMetadataTooManySubs
+	}
+	if session.metadataSubscriptions == nil {
+		session.metadataSubscriptions = make(utils.StringSet)
+	}
+	session.metadataSubscriptions.Add(key)
+	return nil
+}
+
+func (session *Session) UnsubscribeMetadata(key string) {
+	session.client.stateMutex.Lock()
+	defer session.client.stateMutex.Unlock()
+	delete(session.metadataSubscriptions, key)
+}
+
+// sendMetadata sends a METADATA message for each subscribed key in `metadata`
+func (session *Session) sendMetadata(rb *ResponseBuffer, source, target string, metadata map[string]string) {
+	for _, key := range sortedMetadataKeys(metadata) {
+		if session.isSubscribedToMetadata(key) {
+			rb.Add(nil, source, "METADATA", target, key, metadataVisibility, metadata[key])
+		}
+	}
+}
+
+// notifyMetadata sends a change to every subscribed session in `recipients`,
+// except for `origin`, which receives a numeric reply instead
+func notifyMetadata(recipients SessionSet, origin *Session, source, target, key string, value *string) {
+	params := []string{target, key, metadataVisibility}
+	if value != nil {
+		params = append(params, *value)
+	}
+	for session := range recipients {
+		if session != origin && session.isSubscribedToMetadata(key) {
+			session.Send(nil, source, "METADATA", params...)
+		}
+	}
+}
+
+func channelMetadataRecipients(channel *Channel) (result SessionSet) {
+	result = make(SessionSet)
+	for _, member := range channel.Members() {
+		result.AddClient(member, caps.Metadata)
+	}
+	return
+}
+
+// syncJoinMetadata runs after a successful JOIN: the joining session learns
+// the channel's metadata and that of the other members, and the other members
+// learn the joining client's metadata
+func (channel *Channel) syncJoinMetadata(client *Client, rb *ResponseBuffer) {
+	if !channel.server.Config().Metadata.Enabled {
+		return
+	}
+	chname := channel.Name()
+	// (in the case of SAJOIN, rb.session belongs to the operator)
+	if rb.session.client == client && rb.session.capabilities.Has(caps.Metadata) && len(rb.session.MetadataSubscriptions()) != 0 {
+		rb.session.sendMetadata(rb, channel.server.name, chname, channel.Metadata())
+		for _, member := range channel.auditoriumFriends(client) {
+			if member != client {
+				rb.session.sendMetadata(rb, channel.server.name, member.Nick(), member.Metadata())
+			}
+		}
+	}
+
+	metadata := client.Metadata()
+	if len(metadata) == 0 {
+		return
+	}
+	nick := client.Nick()
+	recipients := make(SessionSet)
+	for _, member := range channel.Members() {
+		if member != client {
+			recipients.AddClient(member, caps.Metadata)
+		}
+	}
+	for _, key := range sortedMetadataKeys(metadata) {
+		value := metadata[key]
+		notifyMetadata(recipients, nil, channel.server.name, nick, key, &value)
+	}
+}
+
+// startMetadataBatch starts a `metadata` batch, if the client supports batches
+func startMetadataBatch(rb *ResponseBuffer, params ...string) (batchID string) {
+	if rb.session.capabilities.Has(caps.Batch) {
+		batchID = rb.StartNestedBatch("metadata", params...)
+	}
+	return
+}
+
+// METADATA <target> <subcommand> [<param> ...]
+func metadataHandler(server *Server, client *Client, msg ircmsg.Message, rb *ResponseBuffer) bool {
+	config := server.Config()
+	if !config.Metadata.Enabled {
+		rb.Add(nil, server.name, "FAIL", "METADATA", "NOT_ENABLED", client.t("Metadata has been disabled"))
+		return false
+	}
+
+	subcommand := strings.ToUpper(msg.Params[1])
+	switch subcommand {
+	case "SUB", "UNSUB", "SUBS":
+		metadataSubscriptionHandler(server, client, subcommand, msg.Params[2:], rb)
+		return false
+	case "GET", "LIST", "SET", "CLEAR", "SYNC":
+	default:
+		rb.Add(nil, server.name, "FAIL", "METADATA", "SUBCOMMAND_INVALID", utils.SafeErrorParam(msg.Params[1]), client.t("Invalid subcommand"))
+		return false
+	}
+
+	// resolve the target; * refers to the client itself
+	targetName := msg.Params[0]
+	var targetClient *Client
+	var targetChannel *Channel
+	if targetName == "*" {
+		targetClient = client
+	} else if targetChannel = server.channels.Get(targetName); targetChannel == nil {
+		targetClient = server.clients.Get(targetName)
+	}
+	if targetClient == nil && targetChannel == nil {
+		rb.Add(nil, server.name, "FAIL", "METADATA", "INVALID_TARGET", utils.SafeErrorParam(targetName), client.t("Invalid metadata target"))
+		return false
+	}
+
+	var metadata map[string]string
+	if targetChannel != nil {
+		targetName = targetChannel.Name()
+		// metadata of a secret channel is only visible to its members
+		if targetChannel.flags.HasMode(modes.Secret) && !targetChannel.hasClient(client) {
+			rb.Add(nil, server.name, "FAIL", "METADATA", "KEY_NO_PERMISSION", targetName, "*", client.t("You're not on that channel"))
+			return false
+		}
+		metadata = targetChannel.Metadata()
+	} else {
+		targetName = targetClient.Nick()
+		metadata = targetClient.Metadata()
+	}
+
+	switch subcommand {
+	case "GET":
+		if len(msg.Params) < 3 {
+			rb.Add(nil, server.name, ERR_NEEDMOREPARAMS, client.Nick(), msg.Command, client.t("Not enough parameters"))
+			return false
+		}
+		batchID := startMetadataBatch(rb, targetName)
+		defer rb.EndNestedBatch(batchID)
+		for _, key := range msg.Params[2:] {
+			if !metadataKeyIsValid(key) {
+				rb.Add(nil, server.name, "FAIL", "METADATA", "KEY_INVALID", utils.SafeErrorParam(key), client.t("Invalid key name"))
+			} else if value, ok := metadata[key]; ok {
+				rb.Add(nil, server.name, RPL_KEYVALUE, client.Nick(), targetName, key, metadataVisibility, value)
+			} else {
+				rb.Add(nil, server.name, RPL_KEYNOTSET, client.Nick(), targetName, key, client.t("Key not set"))
+			}
+		}
+	case "LIST":
+		batchID := startMetadataBatch(rb, targetName)
+		defer rb.EndNestedBatch(batchID)
+		for _, key := range sortedMetadataKeys(metadata) {
+			rb.Add(nil, server.name, RPL_KEYVALUE, client.Nick(), targetName, key, metadataVisibility, metadata[key])
+		}
+	case "SYNC":
+		batchID := startMetadataBatch(rb, targetName)
+		defer rb.EndNestedBatch(batchID)
+		rb.session.sendMetadata(rb, server.name, targetName, metadata)
+		if targetChannel != nil {
+			for _, member := range targetChannel.auditoriumFriends(client) {
+				rb.session.sendMetadata(rb, server.name, member.Nick(), member.Metadata())
+			}
+		}
+	case "SET", "CLEAR":
+		if !metadataCanModify(client, targetClient, targetChannel) {
+			key := "*"
+			if subcommand == "SET" && len(msg.Params) > 2 {
+				key = utils.SafeErrorParam(msg.Params[2])
+			}
+			rb.Add(nil, server.name, "FAIL", "METADATA", "KEY_NO_PERMISSION", targetName, key, client.t("You may not modify metadata on that target"))
+			return false
+		}
+		if subcommand == "SET" {
+			metadataSetHandler(server, client, msg, targetName, targetClient, targetChannel, rb)
+		} else {
+			metadataClearHandler(server, client, targetName, targetClient, targetChannel, rb)
+		}
+	}
+	return false
+}
+
+// users can modify their own metadata, and channel operators that of their channel
+func metadataCanModify(client, targetClient *Client, targetChannel *Channel) bool {
+	if targetChannel != nil {
+		return targetChannel.ClientIsAtLeast(client, modes.ChannelOperator)
+	}
+	return targetClient == client
+}
+
+// METADATA <target> SET <key> [<value>]
+func metadataSetHandler(server *Server, client *Client, msg ircmsg.Message, targetName string, targetClient *Client, targetChannel *Channel, rb *ResponseBuffer) {
+	config := server.Config()
+	if len(msg.Params) < 3 {
+		rb.Add(nil, server.name, ERR_NEEDMOREPARAMS, client.Nick(), msg.Command, client.t("Not enough parameters"))
+		return
+	}
+	key := msg.Params[2]
+	if !metadataKeyIsValid(key) {
+		rb.Add(nil, server.name, "FAIL", "METADATA", "KEY_INVALID", utils.SafeErrorParam(key), client.t("Invalid key name"))
+		return
+	}
+	// a missing value means the key should be deleted
+	var value *string
+	if len(msg.Params) > 3 {
+		value = &msg.Params[3]
+		if len(*value) > config.Metadata.MaxValueBytes || !utf8.ValidString(*value) {
+			rb.Add(nil, server.name, "FAIL", "METADATA", "VALUE_INVALID", client.t("Invalid metadata value"))
+			return
+		}
+	}
+
+	var changed bool
+	var err error
+	var recipients SessionSet
+	if targetChannel != nil {
+		changed, err = targetChannel.SetMetadata(key, value, config.Metadata.MaxKeys)
+	} else {
+		changed, err = targetClient.SetMetadata(key, value, config.Metadata.MaxKeys)
+	}
+	if err == errMetadataTooManyKeys {
+		rb.Add(nil, server.name, "FAIL", "METADATA", "LIMIT_REACHED", targetName, client.t("Too many metadata keys"))
+		return
+	} else if value == nil && !changed {
+		rb.Add(nil, server.name, "FAIL", "METADATA", "KEY_NOT_SET", targetName, key, client.t("Key not set"))
+		return
+	}
+
+	if value != nil {
+		rb.Add(nil, server.name, RPL_KEYVALUE, client.Nick(), targetName, key, metadataVisibility, *value)
+	} else {
+		rb.Add(nil, server.name, RPL_KEYNOTSET, client.Nick(), targetName, key, client.t("Key not set"))
+	}
+	if changed {
+		if targetChannel != nil {
+			recipients = channelMetadataRecipients(targetChannel)
+		} else {
+			recipients = targetClient.Friends(caps.Metadata)
+		}
+		notifyMetadata(recipients, rb.session, client.NickMaskString(), targetName, key, value)
+	}
+}
+
+// METADATA <target> CLEAR
+func metadataClearHandler(server *Server, client *Client, targetName string, targetClient *Client, targetChannel *Channel, rb *ResponseBuffer) {
+	var deleted map[string]string
+	var recipients SessionSet
+	if targetChannel != nil {
+		deleted = targetChannel.ClearMetadata()
+		recipients = channelMetadataRecipients(targetChannel)
+	} else {
+		deleted = targetClient.ClearMetadata()
+		recipients = targetClient.Friends(caps.Metadata)
+	}
+
+	batchID := startMetadataBatch(rb, targetName)
+	defer rb.EndNestedBatch(batchID)
+	source := client.NickMaskString()
+	for _, key := range sortedMetadataKeys(deleted) {
+		rb.Add(nil, server.name, RPL_KEYNOTSET, client.Nick(), targetName, key, client.t("Key not set"))
+		notifyMetadata(recipients, rb.session, source, targetName, key, nil)
+	}
+}
+
+// METADATA * SUB <key> [<key> ...]
+// METADATA * UNSUB <key> [<key> ...]
+// METADATA * SUBS
+func metadataSubscriptionHandler(server *Server, client *Client, subcommand string, keys []string, rb *ResponseBuffer) {
+	nick := client.Nick()
+	if subcommand == "SUBS" {
+		batchID := startMetadataBatch(rb)
+		defer rb.EndNestedBatch(batchID)
+		subs := rb.session.MetadataSubscriptions()
+		for len(subs) != 0 {
+			// keep each line well under the length limit
+			chunk := subs
+			if len(chunk) > 10 {
+				chunk = chunk[:10]
+			}
+			subs = subs[len(chunk):]
+			rb.Add(nil, server.name, RPL_METADATASUBS, append([]string{nick}, chunk...)...)
+		}
+		return
+	}
+
+	if len(keys) == 0 {
+		rb.Add(nil, server.name, ERR_NEEDMOREPARAMS, nick, "METADATA", client.t("Not enough parameters"))
+		return
+	}
+	maxSubs := server.Config().Metadata.MaxSubs
+	var ok []string
+	for _, key := range keys {
+		if !metadataKeyIsValid(key) {
+			rb.Add(nil, server.name, "FAIL", "METADATA", "KEY_INVALID", utils.SafeErrorParam(key), client.t("Invalid key name"))
+			continue
+		}
+		if subcommand == "SUB" {
+			if err := rb.session.SubscribeMetadata(key, maxSubs); err != nil {
+				rb.Add(nil, server.name, "FAIL", "METADATA", "TOO_MANY_SUBS", key, client.t("Too many metadata subscriptions"))
+				break
+			}
+		} else {
+			rb.session.UnsubscribeMetadata(key)
+		}
+		ok = append(ok, key)
+	}
+	if len(ok) != 0 {
+		numeric := RPL_METADATASUBOK
+		if subcommand == "UNSUB" {
+			numeric = RPL_METADATAUNSUBOK
+		}
+		rb.Add(nil, server.name, numeric, append([]string{nick}, ok...)...)
+	}
+}
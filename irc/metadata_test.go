@@ -0,0 +1,43 @@
+// Copyright (c) 2021 Shivaram Lingamneni <slingamn@cs.stanford.edu>
+// released under the MIT license
+
+package irc
+
+import (
+	"testing"
+)
+
+func TestMetadataKeyIsValid(t *testing.T) {
+	for _, key := range []string{"avatar", "display-name", "chat.example/color", "a_b.c"} {
+		assertEqual(metadataKeyIsValid(key), true, t)
+	}
+	for _, key := range []string{"", "Avatar", "/avatar", "with space", "emoji🙂", "a:b"} {
+		assertEqual(metadataKeyIsValid(key), false, t)
+	}
+}
+
+func TestSetMetadataEntry(t *testing.T) {
+	var metadata map[string]string
+	value := "https://example.com/a.png"
+
+	changed, err := setMetadataEntry(&metadata, "avatar", &value, 2)
+	assertEqual(changed, true, t)
+	assertEqual(err, nil, t)
+	changed, _ = setMetadataEntry(&metadata, "avatar", &value, 2)
+	assertEqual(changed, false, t)
+
+	setMetadataEntry(&metadata, "display-name", &value, 2)
+	_, err = setMetadataEntry(&metadata, "color", &value, 2)
+	assertEqual(err, errMetadataTooManyKeys, t)
+	// overwriting an existing key doesn't count against the limit:
+	other := "https://example.com/b.png"
+	changed, err = setMetadataEntry(&metadata, "avatar", &other, 2)
+	assertEqual(changed, true, t)
+	assertEqual(err, nil, t)
+
+	changed, _ = setMetadataEntry(&metadata, "avatar", nil, 2)
+	assertEqual(changed, true, t)
+	changed, _ = setMetadataEntry(&metadata, "avatar", nil, 2)
+	assertEqual(changed, false, t)
+	assertEqual(metadata, map[string]string{"display-name": value}, t)
+}
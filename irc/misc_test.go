@@ -6,6 +6,8 @@ package irc
 import (
 	"testing"
 	"time"
+
+	"github.com/ergochat/ergo/irc/history"
 )
 
 func TestZncTimestampParser(t *testing.T) {
@@ -15,3 +17,16 @@ func TestZncTimestampParser(t *testing.T) {
 	assertEqual(zncWireTimeToTime(".988"), time.Unix(0, 988000000).UTC(), t)
 	assertEqual(zncWireTimeToTime("garbage"), time.Unix(0, 0).UTC(), t)
 }
+
+func TestItemInConversation(t *testing.T) {
+	// ephemeral buffers record the other party to the conversation
+	item := history.Item{Nick: "Alice!u@h", CfCorrespondent: "bob"}
+	assertEqual(itemInConversation(&item, "bob", "alice", "bob"), true, t)
+	assertEqual(itemInConversation(&item, "carol", "alice", "carol"), false, t)
+
+	// the database records the sender and the recipient
+	item = history.Item{Nick: "Alice!u@h", Params: [1]string{"Carol"}}
+	assertEqual(itemInConversation(&item, "", "alice", "carol"), true, t)
+	assertEqual(itemInConversation(&item, "", "carol", "alice"), true, t)
+	assertEqual(itemInConversation(&item, "", "alice", "bob"), false, t)
+}
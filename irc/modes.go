@@ -37,7 +37,15 @@ func ApplyUserModeChanges(client *Client, changes modes.ModeChanges, force bool,
 	present := len(client.Sessions()) != 0
 
 	for _, change := range changes {
-		if change.Mode != modes.ServerNotice {
+		if change.Mode == modes.Cloaked {
+			oldNickMask := client.NickMaskString()
+			if client.SetCloaked(change.Op == modes.Add) {
+				applied = append(applied, change)
+				if client.Registered() {
+					client.sendChghost(oldNickMask, client.Hostname())
+				}
+			}
+		} else if change.Mode != modes.ServerNotice {
 			switch change.Op {
 			case modes.Add:
 				if (change.Mode == modes.Operator) && !(force && oper != nil) {
@@ -160,7 +168,13 @@ func (channel *Channel) ApplyChannelModeChanges(client *Client, isSamode bool, c
 
 	maskOpCount := 0
 	chname := channel.Name()
+
+	// apply the whole batch of changes without interleaving with others
+	channel.modeMutex.Lock()
+	defer channel.modeMutex.Unlock()
 	details := client.Details()
+	// list queries reveal channel state, so they are restricted to members
+	isMember := isSamode || channel.hasClient(client) || client.HasRoleCapabs("sajoin")
 
 	hasPrivs := func(change modes.ModeChange) bool {
 		if isSamode {
@@ -187,12 +201,19 @@ func (channel *Channel) ApplyChannelModeChanges(client *Client, isSamode bool, c
 			// listing these requires privileges
 			return channel.ClientIsAtLeast(client, modes.ChannelOperator)
 		default:
-			// #163: allow unprivileged users to list ban masks, and any other modes
+			// #163: allow unprivileged members to list ban masks, and any other modes
 			return change.Op == modes.List || channel.ClientIsAtLeast(client, modes.ChannelOperator)
 		}
 	}
 
 	for _, change := range changes {
+		if change.Op == modes.List && !isMember {
+			if !alreadySentPrivError {
+				alreadySentPrivError = true
+				rb.Add(nil, client.server.name, ERR_NOTONCHANNEL, details.nick, chname, client.t("You're not on that channel"))
+			}
+			continue
+		}
 		if !hasPrivs(change) {
 			if !alreadySentPrivError {
 				alreadySentPrivError = true
@@ -280,6 +301,51 @@ func (channel *Channel) ApplyChannelModeChanges(client *Client, isSamode bool, c
 				applied = append(applied, change)
 			}
 
+		case modes.JoinThrottle:
+			switch change.Op {
+			case modes.Add:
+				limit, duration, err := parseJoinThrottle(change.Arg)
+				if err == nil {
+					channel.setJoinThrottle(limit, duration)
+					applied = append(applied, change)
+				} else {
+					rb.Add(nil, client.server.name, ERR_INVALIDMODEPARAM, details.nick, chname, string(change.Mode), utils.SafeErrorParam(change.Arg), fmt.Sprintf(client.t("Invalid mode %[1]s parameter: %[2]s"), string(change.Mode), change.Arg))
+				}
+			case modes.Remove:
+				channel.setJoinThrottle(0, 0)
+				applied = append(applied, change)
+			}
+
+		case modes.RepeatLimit:
+			switch change.Op {
+			case modes.Add:
+				lines, duration, err := parseRepeatLimit(change.Arg)
+				if err == nil {
+					channel.setRepeatLimit(lines, duration)
+					applied = append(applied, change)
+				} else {
+					rb.Add(nil, client.server.name, ERR_INVALIDMODEPARAM, details.nick, chname, string(change.Mode), utils.SafeErrorParam(change.Arg), fmt.Sprintf(client.t("Invalid repeat limit %s: the parameter is the number of repeats of a message to allow, and the window in seconds in which to count them, e.g., 3:30"), change.Arg))
+				}
+			case modes.Remove:
+				channel.setRepeatLimit(0, 0)
+				applied = append(applied, change)
+			}
+
+		case modes.SlowMode:
+			switch change.Op {
+			case modes.Add:
+				interval, err := parseSlowMode(change.Arg)
+				if err == nil {
+					channel.setSlowMode(interval)
+					applied = append(applied, change)
+				} else {
+					rb.Add(nil, client.server.name, ERR_INVALIDMODEPARAM, details.nick, chname, string(change.Mode), utils.SafeErrorParam(change.Arg), fmt.Sprintf(client.t("Invalid mode %[1]s parameter: %[2]s"), string(change.Mode), change.Arg))
+				}
+			case modes.Remove:
+				channel.setSlowMode(0)
+				applied = append(applied, change)
+			}
+
 		case modes.Key:
 			switch change.Op {
 			case modes.Add:
@@ -308,6 +374,11 @@ func (channel *Channel) ApplyChannelModeChanges(client *Client, isSamode bool, c
 			success, change := channel.applyModeToMember(client, change, rb)
 			if success {
 				applied = append(applied, change)
+				if change.Mode == modes.ChannelOperator {
+					if target := client.server.clients.Get(change.Arg); target != nil {
+						channel.recordManualOp(target, change.Op == modes.Add)
+					}
+				}
 			}
 
 		default:
@@ -17,14 +17,15 @@ var (
 	// SupportedUserModes are the user modes that we actually support (modifying).
 	SupportedUserModes = Modes{
 		Bot, Invisible, Operator, RegisteredOnly, ServerNotice, UserRoleplaying,
-		UserNoCTCP,
+		UserNoCTCP, CallerID, Cloaked,
 	}
 
 	// SupportedChannelModes are the channel modes that we support.
 	SupportedChannelModes = Modes{
 		BanMask, ChanRoleplaying, ExceptMask, InviteMask, InviteOnly, Key,
 		Moderated, NoOutside, OpOnlyTopic, RegisteredOnly, RegisteredOnlySpeak,
-		Secret, UserLimit, NoCTCP, Auditorium, OpModerated, Forward,
+		Secret, UserLimit, NoCTCP, Auditorium, OpModerated, Forward, JoinThrottle,
+		RepeatLimit, SlowMode,
 	}
 )
 
@@ -86,6 +87,47 @@ func (changes ModeChanges) Strings() (result []string) {
 	return
 }
 
+// LimitParameters returns the changes, excluding any parameterized changes
+// beyond the first `max` (as advertised by the MODES isupport token).
+func (changes ModeChanges) LimitParameters(max int) (result ModeChanges) {
+	result = changes[:0:0]
+	count := 0
+	for _, change := range changes {
+		if change.Arg != "" {
+			if count == max {
+				continue
+			}
+			count++
+		}
+		result = append(result, change)
+	}
+	return
+}
+
+// Batches splits the changes into consecutive batches, each of which has at
+// most maxParams parameters totalling at most maxParamBytes bytes (a single
+// oversized parameter still gets a batch of its own), so that each batch can
+// be sent as a single MODE line.
+func (changes ModeChanges) Batches(maxParams, maxParamBytes int) (result []ModeChanges) {
+	var batch ModeChanges
+	count, size := 0, 0
+	for _, change := range changes {
+		if change.Arg != "" {
+			if len(batch) != 0 && (count == maxParams || maxParamBytes < size+len(change.Arg)+1) {
+				result = append(result, batch)
+				batch, count, size = nil, 0, 0
+			}
+			count++
+			size += len(change.Arg) + 1
+		}
+		batch = append(batch, change)
+	}
+	if len(batch) != 0 {
+		result = append(result, batch)
+	}
+	return
+}
+
 // Modes is just a raw list of modes
 type Modes []Mode
 
@@ -100,6 +142,8 @@ func (modes Modes) String() string {
 // User Modes
 const (
 	Bot             Mode = 'B'
+	CallerID        Mode = 'g'
+	Cloaked         Mode = 'x'
 	Invisible       Mode = 'i'
 	Operator        Mode = 'o'
 	Restricted      Mode = 'r'
@@ -130,6 +174,9 @@ const (
 	NoCTCP              Mode = 'C' // flag
 	OpModerated         Mode = 'U' // flag
 	Forward             Mode = 'f' // flag arg
+	JoinThrottle        Mode = 'j' // flag arg
+	RepeatLimit         Mode = 'K' // flag arg
+	SlowMode            Mode = 'S' // flag arg
 )
 
 var (
@@ -152,6 +199,11 @@ var (
 		Halfop:          "%",
 		Voice:           "+",
 	}
+
+	// ChannelListModes holds the modes that maintain a list of masks
+	ChannelListModes = Modes{
+		BanMask, ExceptMask, InviteMask,
+	}
 )
 
 //
@@ -275,7 +327,7 @@ func ParseChannelModeChanges(params ...string) (ModeChanges, map[rune]bool) {
 				} else {
 					continue
 				}
-			case UserLimit, Forward:
+			case UserLimit, Forward, JoinThrottle, RepeatLimit, SlowMode:
 				// don't require value when removing
 				if change.Op == Add {
 					if len(params) > skipArgs {
@@ -443,7 +495,7 @@ func RplMyInfo() (param1, param2, param3 string) {
 	sort.Sort(ByCodepoint(channelModes))
 
 	// XXX enumerate these by hand, i can't see any way to DRY this
-	channelParametrizedModes := Modes{BanMask, ExceptMask, InviteMask, Key, UserLimit, Forward}
+	channelParametrizedModes := Modes{BanMask, ExceptMask, InviteMask, Key, UserLimit, Forward, JoinThrottle, RepeatLimit, SlowMode}
 	channelParametrizedModes = append(channelParametrizedModes, ChannelUserModes...)
 	sort.Sort(ByCodepoint(channelParametrizedModes))
 
@@ -453,11 +505,12 @@ func RplMyInfo() (param1, param2, param3 string) {
 func ChanmodesToken() (result string) {
 	// https://modern.ircdocs.horse#chanmodes-parameter
 	// type A: listable modes with parameters
-	A := Modes{BanMask, ExceptMask, InviteMask}
+	A := make(Modes, len(ChannelListModes))
+	copy(A, ChannelListModes)
 	// type B: modes with parameters
 	B := Modes{Key}
 	// type C: modes that take a parameter only when set, never when unset
-	C := Modes{UserLimit, Forward}
+	C := Modes{UserLimit, Forward, JoinThrottle, RepeatLimit, SlowMode}
 	// type D: modes without parameters
 	D := Modes{InviteOnly, Moderated, NoOutside, OpOnlyTopic, ChanRoleplaying, Secret, NoCTCP, RegisteredOnly, RegisteredOnlySpeak, Auditorium, OpModerated}
 
@@ -468,3 +521,24 @@ func ChanmodesToken() (result string) {
 
 	return fmt.Sprintf("%s,%s,%s,%s", A.String(), B.String(), C.String(), D.String())
 }
+
+// PrefixToken returns the value of the PREFIX isupport token, e.g., (qaohv)~&@%+
+func PrefixToken() string {
+	return fmt.Sprintf("(%s)%s", ChannelUserModes.String(), StatusmsgToken())
+}
+
+// StatusmsgToken returns the value of the STATUSMSG isupport token, i.e.,
+// the prefixes of all channel user modes in descending order of precedence
+func StatusmsgToken() string {
+	var builder strings.Builder
+	for _, mode := range ChannelUserModes {
+		builder.WriteString(ChannelModePrefixes[mode])
+	}
+	return builder.String()
+}
+
+// MaxlistToken returns the value of the MAXLIST isupport token, given
+// the shared limit on the number of entries in the list modes
+func MaxlistToken(limit int) string {
+	return fmt.Sprintf("%s:%d", ChannelListModes.String(), limit)
+}
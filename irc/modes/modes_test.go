@@ -277,6 +277,32 @@ func TestModeChangesString(t *testing.T) {
 	assertEqual(m.Strings(), []string{"+R-k+b", "beer", "shivaram"}, t)
 }
 
+func TestLimitParameters(t *testing.T) {
+	changes, _ := ParseChannelModeChanges("+ovbn", "alice", "bob", "*!*@example.com")
+	assertEqual(changes.LimitParameters(3), changes, t)
+	assertEqual(changes.LimitParameters(2).Strings(), []string{"+ovn", "alice", "bob"}, t)
+	assertEqual(changes.LimitParameters(0).Strings(), []string{"+n"}, t)
+	// listing a mask list doesn't consume a parameter:
+	changes, _ = ParseChannelModeChanges("+ob", "alice")
+	assertEqual(changes.LimitParameters(1), changes, t)
+}
+
+func TestBatches(t *testing.T) {
+	changes, _ := ParseChannelModeChanges("-bbbn", "a!*@*", "b!*@*", "c!*@*")
+	batches := changes.Batches(2, 400)
+	assertEqual(len(batches), 2, t)
+	assertEqual(batches[0].Strings(), []string{"-bb", "a!*@*", "b!*@*"}, t)
+	assertEqual(batches[1].Strings(), []string{"-bn", "c!*@*"}, t)
+
+	// byte limit: each argument costs its length plus a separating space
+	batches = changes.Batches(20, 12)
+	assertEqual(len(batches), 2, t)
+	assertEqual(batches[0].Strings(), []string{"-bb", "a!*@*", "b!*@*"}, t)
+
+	assertEqual(len(changes.Batches(20, 400)), 1, t)
+	assertEqual(len(ModeChanges(nil).Batches(20, 400)), 0, t)
+}
+
 func BenchmarkModeString(b *testing.B) {
 	set := NewModeSet()
 	set.SetMode('A', true)
@@ -289,3 +315,15 @@ func BenchmarkModeString(b *testing.B) {
 		_ = set.String()
 	}
 }
+
+func TestISupportTokens(t *testing.T) {
+	if tok := PrefixToken(); tok != "(qaohv)~&@%+" {
+		t.Errorf("unexpected PREFIX token: %s", tok)
+	}
+	if tok := StatusmsgToken(); tok != "~&@%+" {
+		t.Errorf("unexpected STATUSMSG token: %s", tok)
+	}
+	if tok := MaxlistToken(60); tok != "beI:60" {
+		t.Errorf("unexpected MAXLIST token: %s", tok)
+	}
+}
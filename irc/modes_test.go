@@ -6,7 +6,9 @@ package irc
 import (
 	"reflect"
 	"testing"
+	"time"
 
+	"github.com/ergochat/ergo/irc/custime"
 	"github.com/ergochat/ergo/irc/modes"
 )
 
@@ -92,3 +94,88 @@ func TestChannelUserModeHasPrivsOver(t *testing.T) {
 	assertEqual(channelUserModeHasPrivsOver(modes.ChannelFounder, modes.ChannelAdmin), true, t)
 	assertEqual(channelUserModeHasPrivsOver(modes.ChannelOperator, modes.ChannelOperator), true, t)
 }
+
+func TestParseJoinThrottle(t *testing.T) {
+	limit, duration, err := parseJoinThrottle("5:10")
+	assertEqual(err, nil, t)
+	assertEqual(limit, 5, t)
+	assertEqual(duration, 10*time.Second, t)
+
+	for _, invalid := range []string{"", "5", "5:", ":10", "0:10", "5:0", "-1:10", "a:b", "5:10:15"} {
+		if _, _, err := parseJoinThrottle(invalid); err == nil {
+			t.Errorf("expected %s to be an invalid +j parameter", invalid)
+		}
+	}
+}
+
+func TestRepeatLimit(t *testing.T) {
+	lines, duration, err := parseRepeatLimit("3:30")
+	assertEqual(err, nil, t)
+	assertEqual(lines, 3, t)
+	assertEqual(duration, 30*time.Second, t)
+	for _, invalid := range []string{"", "3", "3:", ":30", "0:30", "3:0", "-1:30", "a:b"} {
+		if _, _, err := parseRepeatLimit(invalid); err == nil {
+			t.Errorf("expected %s to be an invalid +K parameter", invalid)
+		}
+	}
+
+	assertEqual(normalizeRepeatedMessage("\x02Buy NOW!!\x02  at example.com"), "buynowatexamplecom", t)
+	// messages without letters or digits are still counted:
+	assertEqual(normalizeRepeatedMessage("!!! \x02!!!\x02"), "!!!!!!", t)
+	assertEqual(normalizeRepeatedMessage("\U0001F4A9 \U0001F4A9"), "\U0001F4A9\U0001F4A9", t)
+
+	var rs repeatState
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		assertEqual(rs.check("spam", 3, 10*time.Second, now), false, t)
+	}
+	// a different message resets the count:
+	assertEqual(rs.check("ham", 3, 10*time.Second, now), false, t)
+	for i := 0; i < 2; i++ {
+		assertEqual(rs.check("spam", 3, 10*time.Second, now), false, t)
+	}
+	assertEqual(rs.check("spam", 3, 10*time.Second, now.Add(11*time.Second)), false, t)
+	assertEqual(rs.check("spam", 3, 10*time.Second, now.Add(12*time.Second)), false, t)
+	assertEqual(rs.check("spam", 3, 10*time.Second, now.Add(13*time.Second)), false, t)
+	assertEqual(rs.check("spam", 3, 10*time.Second, now.Add(14*time.Second)), true, t)
+	// while muted, every message is refused:
+	assertEqual(rs.check("ham", 3, 10*time.Second, now.Add(20*time.Second)), true, t)
+	assertEqual(rs.check("ham", 3, 10*time.Second, now.Add(24*time.Second)), false, t)
+}
+
+func TestSlowMode(t *testing.T) {
+	interval, err := parseSlowMode("10")
+	assertEqual(err, nil, t)
+	assertEqual(interval, 10*time.Second, t)
+	for _, invalid := range []string{"", "0", "-5", "a", "5:10"} {
+		if _, err := parseSlowMode(invalid); err == nil {
+			t.Errorf("expected %s to be an invalid +S parameter", invalid)
+		}
+	}
+
+	alice, _ := makeTestClient()
+	bob, _ := makeTestClient()
+	channel := makeTestChannel(alice, bob)
+	channel.members[bob].modes.SetMode(modes.Voice, true)
+	config := &Config{}
+
+	assertEqual(channel.checkSlowMode(alice, config), time.Duration(0), t)
+	assertEqual(channel.checkSlowMode(alice, config), time.Duration(0), t)
+	channel.setSlowMode(interval)
+	assertEqual(channel.checkSlowMode(alice, config), time.Duration(0), t)
+	if wait := channel.checkSlowMode(alice, config); wait <= 0 || interval < wait {
+		t.Errorf("expected a wait of up to %v, got %v", interval, wait)
+	}
+	// voiced members are exempt:
+	assertEqual(channel.checkSlowMode(bob, config), time.Duration(0), t)
+	assertEqual(channel.checkSlowMode(bob, config), time.Duration(0), t)
+
+	// channels.default-slow-mode applies when +S is unset:
+	carol, _ := makeTestClient()
+	channel = makeTestChannel(carol)
+	config.Channels.DefaultSlowMode = custime.Duration(interval)
+	assertEqual(channel.checkSlowMode(carol, config), time.Duration(0), t)
+	if wait := channel.checkSlowMode(carol, config); wait <= 0 {
+		t.Errorf("expected the default slow mode to apply, got %v", wait)
+	}
+}
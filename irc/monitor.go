@@ -26,7 +26,7 @@ func (mm *MonitorManager) Initialize() {
 }
 
 // AddMonitors adds clients using extended-monitor monitoring `client`'s nick to the passed user set.
-func (manager *MonitorManager) AddMonitors(users map[*Session]empty, cfnick string, capabs ...caps.Capability) {
+func (manager *MonitorManager) AddMonitors(users SessionSet, cfnick string, capabs ...caps.Capability) {
 	manager.RLock()
 	defer manager.RUnlock()
 	for session := range manager.watchedby[cfnick] {
@@ -750,6 +750,54 @@ func (mysql *MySQL) DeleteMsgid(msgid, accountName string) (err error) {
 	return
 }
 
+// RedactMsgid replaces the message with the given msgid, which must belong
+// to the history of `target`, by a tombstone, if `authorize` returns nil for it.
+func (mysql *MySQL) RedactMsgid(target, msgid, reason string, authorize func(item *history.Item) error) (found bool, err error) {
+	if mysql.db == nil {
+		return
+	}
+
+	decoded, err := decodeMsgid(msgid)
+	if err != nil {
+		return false, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), mysql.getTimeout())
+	defer cancel()
+
+	var id uint64
+	var data []byte
+	err = mysql.db.QueryRowContext(ctx, `
+		SELECT history.id, history.data FROM history
+		LEFT JOIN sequence ON history.id = sequence.history_id
+		LEFT JOIN conversations ON history.id = conversations.history_id
+		WHERE history.msgid = ? AND (sequence.target = ? OR conversations.target = ?) LIMIT 1;`,
+		decoded, target, target).Scan(&id, &data)
+	if err == sql.ErrNoRows {
+		return false, nil
+	} else if mysql.logError("could not look up redacted msgid", err) {
+		return
+	}
+
+	var item history.Item
+	if err = unmarshalItem(data, &item); err != nil {
+		mysql.logError("could not unmarshal redacted item", err)
+		return
+	}
+	found = true
+	if err = authorize(&item); err != nil {
+		return
+	}
+	item.Redact(reason)
+	data, err = marshalItem(&item)
+	if err != nil {
+		return
+	}
+	_, err = mysql.db.ExecContext(ctx, `UPDATE history SET data = ? WHERE id = ?;`, data, id)
+	mysql.logError("could not redact msgid", err)
+	return
+}
+
 func (mysql *MySQL) Export(account string, writer io.Writer) {
 	if mysql.db == nil {
 		return
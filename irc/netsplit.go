@@ -0,0 +1,65 @@
+// Copyright (c) 2021 Shivaram Lingamneni <slingamn@cs.stanford.edu>
+// released under the MIT license
+
+package irc
+
+import (
+	"sync"
+
+	"github.com/ergochat/ergo/irc/caps"
+)
+
+const (
+	netsplitBatchType = "netsplit"
+)
+
+// quitBatch groups the QUITs caused by a mass disconnection (for example,
+// a KLINE or DLINE that kills many clients at once) into one IRCv3 netsplit
+// batch per recipient session, so that clients supporting batches can
+// collapse them into a single event instead of displaying them line by line.
+// Sessions that don't support batches receive the plain QUITs as usual.
+type quitBatch struct {
+	sync.Mutex // tier 1
+
+	server   *Server
+	batchIDs map[*Session]string
+}
+
+func newQuitBatch(server *Server) *quitBatch {
+	return &quitBatch{
+		server:   server,
+		batchIDs: make(map[*Session]string),
+	}
+}
+
+// Send relays a QUIT to session, opening its batch if necessary.
+func (qb *quitBatch) Send(session *Session, quit *MessageCache) {
+	if qb == nil || !session.capabilities.Has(caps.Batch) {
+		quit.Send(session)
+		return
+	}
+
+	qb.Lock()
+	batchID, ok := qb.batchIDs[session]
+	if !ok {
+		batchID = session.generateBatchID()
+		qb.batchIDs[session] = batchID
+		// there is no linking, so both sides of the "split" are this server
+		session.Send(nil, qb.server.name, "BATCH", "+"+batchID, netsplitBatchType, qb.server.name, qb.server.name)
+	}
+	qb.Unlock()
+
+	session.sendFromClientInternal(false, quit.time, quit.msgid, quit.source, quit.accountName, quit.isBot, map[string]string{"batch": batchID}, quit.command, quit.params...)
+}
+
+// End closes all the batches that were opened.
+func (qb *quitBatch) End() {
+	qb.Lock()
+	batchIDs := qb.batchIDs
+	qb.batchIDs = make(map[*Session]string)
+	qb.Unlock()
+
+	for session, batchID := range batchIDs {
+		session.Send(nil, qb.server.name, "BATCH", "-"+batchID)
+	}
+}
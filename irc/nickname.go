@@ -64,6 +64,8 @@ func performNickChange(server *Server, client *Client, target *Client, session *
 		} else {
 			rb.Add(nil, server.name, "FAIL", "SANICK", "UNKNOWN_ERROR", utils.SafeErrorParam(nickname), client.t("This user's nickname and account name need to be equal"))
 		}
+	} else if err == errTooManySessions {
+		rb.Add(nil, server.name, "FAIL", "NICK", "TOO_MANY_SESSIONS", utils.SafeErrorParam(nickname), client.t("Too many sessions are attached to this account"))
 	} else if err == errNickMissing {
 		if !isSanick {
 			rb.Add(nil, server.name, ERR_NONICKNAMEGIVEN, details.nick, client.t("No nickname given"))
@@ -167,6 +169,7 @@ func fixupNickEqualsAccount(client *Client, rb *ResponseBuffer, config *Config,
 	err := performNickChange(client.server, client, client, rb.session, client.AccountName(), rb)
 	if err != nil && err != errNoop {
 		client.server.accounts.Logout(client)
+		dispatchAccountNotify(client, client.NickMaskString(), "*", rb)
 		if source == "" {
 			source = client.server.name
 		}
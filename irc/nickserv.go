@@ -4,7 +4,9 @@
 package irc
 
 import (
+	"encoding/json"
 	"fmt"
+	"os"
 	"regexp"
 	"sort"
 	"strconv"
@@ -54,10 +56,15 @@ the server's multiclient functionality, to your nickname. An administrator
 can use this command to list another user's clients.
 
 Syntax: $bCLIENTS LOGOUT [nickname] [client_id/all]$b
+        $bCLIENTS KILL [nickname] [client_id/all]$b
 
 CLIENTS LOGOUT detaches a single client, or all clients currently attached
-to your nickname. An administrator can use this command to logout another
-user's clients.`,
+to your nickname, e.g., a login you forgot to close on a shared computer.
+The client IDs are the ones displayed by CLIENTS LIST. An administrator can
+use this command to logout another user's clients.
+
+CLIENTS KILL does exactly the same thing as CLIENTS LOGOUT, under the name
+other services packages use for it.`,
 			helpShort: `$bCLIENTS$b can list and logout the sessions attached to a nickname.`,
 			enabled:   servCmdRequiresBouncerEnabled,
 			minParams: 1,
@@ -81,6 +88,29 @@ entry for $bSET$b for more information.`,
 			authRequired: true,
 			enabled:      servCmdRequiresNickRes,
 		},
+		"export": {
+			handler: nsExportHandler,
+			help: `Syntax: $bEXPORT$b
+
+EXPORT sends you all the information the server stores about your account,
+as JSON. (Passwords and other secrets are omitted.) The messages you have sent
+can be exported by the server administrators.`,
+			helpShort:    `$bEXPORT$b exports the data stored about your account.`,
+			authRequired: true,
+		},
+		"saexport": {
+			handler: nsSaexportHandler,
+			help: `Syntax: $bSAEXPORT <account>$b
+
+SAEXPORT writes all the information the server stores about an account to a
+file on the server, as JSON, for use in answering a request from the account
+holder. If history is stored persistently and indexed by account, the file
+also includes all the messages sent by the account.`,
+			helpShort: `$bSAEXPORT$b exports the data stored about an account to a file.`,
+			capabs:    []string{"accreg"},
+			minParams: 1,
+			maxParams: 1,
+		},
 		"ghost": {
 			handler: nsGhostHandler,
 			help: `Syntax: $bGHOST <nickname>$b
@@ -123,6 +153,20 @@ If no regex is provided, all registered nicknames are returned.`,
 			capabs:    []string{"accreg"},
 			minParams: 0,
 		},
+		"ignore": {
+			handler: nsIgnoreHandler,
+			help: `Syntax: $bIGNORE LIST$b
+        $bIGNORE ADD <mask>$b
+        $bIGNORE DEL <mask>$b
+
+IGNORE manages your account's ignore list, which is the same as the list
+managed by the SILENCE command: direct messages and invites from users matching
+a nick!user@host mask on the list are silently dropped, on all your connections.`,
+			helpShort:    `$bIGNORE$b manages your account's ignore list.`,
+			enabled:      servCmdRequiresAuthEnabled,
+			authRequired: true,
+			minParams:    1,
+		},
 		"info": {
 			handler: nsInfoHandler,
 			help: `Syntax: $bINFO [username]$b
@@ -130,6 +174,17 @@ If no regex is provided, all registered nicknames are returned.`,
 INFO gives you information about the given (or your own) user account.`,
 			helpShort: `$bINFO$b gives you information on a user account.`,
 		},
+		"seen": {
+			handler: nsSeenHandler,
+			help: `Syntax: $bSEEN <nickname>$b
+
+SEEN tells you when the owner of a registered nickname was last connected,
+and the message they quit with. Users can hide this information with
+$bSET HIDE-LAST-SEEN$b.`,
+			helpShort: `$bSEEN$b shows when a user was last connected.`,
+			enabled:   servCmdRequiresNickRes,
+			minParams: 1,
+		},
 		"register": {
 			handler: nsRegisterHandler,
 			// TODO: "email" is an oversimplification here; it's actually any callback, e.g.,
@@ -172,9 +227,11 @@ an administrator can set use this command to set up user accounts.`,
 			hidden:  true,
 			handler: nsClientsHandler,
 			help: `Syntax: $bSESSIONS [nickname]$b
+Syntax: $bSESSIONS KILL [nickname] [client_id/all]$b
 
-SESSIONS is an alias for $bCLIENTS LIST$b. See the help entry for $bCLIENTS$b
-for more information.`,
+SESSIONS is an alias for $bCLIENTS$b: with no subcommand, it lists the clients
+attached to your nickname. See the help entry for $bCLIENTS$b for more
+information.`,
 			enabled: servCmdRequiresBouncerEnabled,
 		},
 		"unregister": {
@@ -184,7 +241,9 @@ for more information.`,
 UNREGISTER lets you delete your user account (or someone else's, if you're an
 IRC operator with the correct permissions). To prevent accidental
 unregistrations, a verification code is required; invoking the command without
-a code will display the necessary code.`,
+a code will display the necessary code. Unregistering an account logs out all
+its clients, releases its grouped nicknames, unregisters the channels it founded,
+and removes its privileges on other channels.`,
 			helpShort: `$bUNREGISTER$b lets you delete your user account.`,
 			enabled:   servCmdRequiresAuthEnabled,
 			minParams: 1,
@@ -196,7 +255,8 @@ a code will display the necessary code.`,
 ERASE deletes all records of an account, allowing it to be re-registered.
 This should be used with caution, because it violates an expectation that
 account names are permanent identifiers. Typically, UNREGISTER should be
-used instead. A confirmation code is required; invoking the command
+used instead. ERASE also deletes the stored history of messages sent by
+the account. A confirmation code is required; invoking the command
 without a code will display the necessary code.`,
 			helpShort: `$bERASE$b erases all records of an account, allowing reuse.`,
 			enabled:   servCmdRequiresAuthEnabled,
@@ -307,6 +367,24 @@ how the history of your direct messages is stored. Your options are:
 'auto-away' is only effective for always-on clients. If enabled, you will
 automatically be marked away when all your sessions are disconnected, and
 automatically return from away when you connect again.`,
+				`$bDM-POLICY$b
+'dm-policy' controls who can send you direct messages. Your options are:
+1. 'anyone'          [no restrictions; this is the default]
+2. 'registered'      [only users who are logged into an account]
+3. 'shared-channel'  [only users who share a channel with you]
+IRC operators, and users on your /ACCEPT list, are exempt from this setting.`,
+				`$bIDLE-AWAY$b
+'idle-away' marks you away automatically after you haven't sent any
+messages for the given period of time (for example, '30m'), and marks
+you back as soon as you do. Your options are a period of time, or 'off'.`,
+				`$bHIDE-LAST-SEEN$b
+'hide-last-seen' controls whether other users can see when you were last
+connected, and your last quit message, via WHOIS, INFO or SEEN while you're
+offline. Your options are 'on' and 'off' (the default).`,
+				`$bLOGIN-NOTIFY-EMAIL$b
+'login-notify-email' controls whether you are sent an e-mail whenever someone
+logs into your account (your other connected clients are always notified).
+Your options are 'on' and 'off' (the default).`,
 				`$bEMAIL$b
 'email' controls the e-mail address associated with your account (if the
 server operator allows it, this address can be used for password resets).
@@ -497,6 +575,33 @@ func displaySetting(service *ircService, settingName string, settings AccountSet
 		effectiveValue := historyEnabled(config.History.Persistent.DirectMessages, settings.DMHistory)
 		service.Notice(rb, fmt.Sprintf(client.t("Your stored direct message history setting is: %s"), historyStatusToString(settings.DMHistory)))
 		service.Notice(rb, fmt.Sprintf(client.t("Given current server settings, your direct message history setting is: %s"), historyStatusToString(effectiveValue)))
+	case "dm-policy":
+		switch settings.DMPolicy {
+		case DMPolicyAnyone:
+			service.Notice(rb, client.t("Anyone can send you direct messages"))
+		case DMPolicyRegistered:
+			service.Notice(rb, client.t("Only users who are logged into an account can send you direct messages"))
+		case DMPolicySharedChannel:
+			service.Notice(rb, client.t("Only users who share a channel with you can send you direct messages"))
+		}
+	case "idle-away":
+		if period := idleAwayPeriod(config, settings); period != 0 {
+			service.Notice(rb, fmt.Sprintf(client.t("You will be marked away automatically after being idle for %v"), period))
+		} else {
+			service.Notice(rb, client.t("You will not be marked away automatically when idle"))
+		}
+	case "hide-last-seen":
+		if settings.HideLastSeen {
+			service.Notice(rb, client.t("Only you and server operators can see when you were last connected"))
+		} else {
+			service.Notice(rb, client.t("Anyone can see when you were last connected"))
+		}
+	case "login-notify-email":
+		if settings.LoginNotifyEmail {
+			service.Notice(rb, client.t("You will be sent an e-mail whenever someone logs into your account"))
+		} else {
+			service.Notice(rb, client.t("You will not be sent an e-mail when someone logs into your account"))
+		}
 	case "email":
 		if settings.Email != "" {
 			service.Notice(rb, fmt.Sprintf(client.t("Your stored e-mail address is: %s"), settings.Email))
@@ -655,6 +760,57 @@ func nsSetHandler(service *ircService, server *Server, client *Client, command s
 				return
 			}
 		}
+	case "dm-policy":
+		var newValue DMPolicy
+		newValue, err = dmPolicyFromString(params[1])
+		if err == nil {
+			munger = func(in AccountSettings) (out AccountSettings, err error) {
+				out = in
+				out.DMPolicy = newValue
+				return
+			}
+		}
+	case "idle-away":
+		if !server.Config().Accounts.IdleAway.Enabled {
+			err = errFeatureDisabled
+			break
+		}
+		var newValue time.Duration
+		if enabled, boolErr := utils.StringToBool(params[1]); boolErr == nil && !enabled {
+			newValue = 0
+		} else {
+			newValue, err = custime.ParseDuration(params[1])
+			if err != nil || newValue < 0 {
+				err = errInvalidParams
+			}
+		}
+		if err == nil {
+			munger = func(in AccountSettings) (out AccountSettings, err error) {
+				out = in
+				out.IdleAway = newValue
+				return
+			}
+		}
+	case "hide-last-seen":
+		var newValue bool
+		newValue, err = utils.StringToBool(params[1])
+		if err == nil {
+			munger = func(in AccountSettings) (out AccountSettings, err error) {
+				out = in
+				out.HideLastSeen = newValue
+				return
+			}
+		}
+	case "login-notify-email":
+		var newValue bool
+		newValue, err = utils.StringToBool(params[1])
+		if err == nil {
+			munger = func(in AccountSettings) (out AccountSettings, err error) {
+				out = in
+				out.LoginNotifyEmail = newValue
+				return
+			}
+		}
 	case "email":
 		newValue := params[1]
 		munger = func(in AccountSettings) (out AccountSettings, err error) {
@@ -886,6 +1042,80 @@ func nsListHandler(service *ircService, server *Server, client *Client, command
 	service.Notice(rb, ircfmt.Unescape(client.t("*** $bEnd of NickServ LIST$b ***")))
 }
 
+func nsSeenHandler(service *ircService, server *Server, client *Client, command string, params []string, rb *ResponseBuffer) {
+	nick := params[0]
+	if target := server.clients.Get(nick); target != nil {
+		service.Notice(rb, fmt.Sprintf(client.t("%s is online right now"), target.Nick()))
+		return
+	}
+
+	accountName := server.accounts.NickToAccount(nick)
+	if accountName == "" {
+		service.Notice(rb, client.t("That nickname is not registered"))
+		return
+	}
+	account, err := server.accounts.LoadAccount(accountName)
+	if err != nil || !account.Verified {
+		service.Notice(rb, client.t("That nickname is not registered"))
+		return
+	}
+	if len(server.accounts.AccountToClients(account.NameCasefolded)) != 0 {
+		service.Notice(rb, fmt.Sprintf(client.t("The owner of %[1]s is online right now, as account %[2]s"), nick, account.Name))
+		return
+	}
+	if !account.lastConnectedVisibleTo(client) || account.LastConnected.IsZero() {
+		service.Notice(rb, fmt.Sprintf(client.t("I don't know when the owner of %s was last seen"), nick))
+		return
+	}
+	ago := time.Since(account.LastConnected).Truncate(time.Second)
+	service.Notice(rb, fmt.Sprintf(client.t("Account %[1]s was last seen %[2]s (%[3]v ago)"), account.Name, account.LastConnected.Format(time.RFC1123), ago))
+	if quitMessage := server.accounts.loadLastQuit(account.NameCasefolded); quitMessage != "" {
+		service.Notice(rb, fmt.Sprintf(client.t("Their quit message was: %s"), quitMessage))
+	}
+}
+
+func nsIgnoreHandler(service *ircService, server *Server, client *Client, command string, params []string, rb *ResponseBuffer) {
+	subcommand := strings.ToLower(params[0])
+	if subcommand == "list" {
+		masks := client.SilenceList()
+		if len(masks) == 0 {
+			service.Notice(rb, client.t("You aren't ignoring anyone"))
+			return
+		}
+		service.Notice(rb, client.t("You are ignoring:"))
+		for _, mask := range masks {
+			service.Notice(rb, fmt.Sprintf("    %s", mask))
+		}
+		return
+	}
+	if !(subcommand == "add" || subcommand == "del") || len(params) < 2 {
+		service.Notice(rb, client.t("Invalid parameters"))
+		return
+	}
+
+	mask, err := server.modifySilenceList(client, params[1], subcommand == "add")
+	switch err {
+	case nil:
+		if subcommand == "add" {
+			service.Notice(rb, fmt.Sprintf(client.t("You are now ignoring %s"), mask))
+		} else {
+			service.Notice(rb, fmt.Sprintf(client.t("You are no longer ignoring %s"), mask))
+		}
+	case errNoop:
+		if subcommand == "add" {
+			service.Notice(rb, fmt.Sprintf(client.t("You were already ignoring %s"), mask))
+		} else {
+			service.Notice(rb, fmt.Sprintf(client.t("You weren't ignoring %s"), mask))
+		}
+	case errLimitExceeded:
+		service.Notice(rb, client.t("Your ignore list is full"))
+	case errInvalidParams:
+		service.Notice(rb, client.t("Invalid mask"))
+	default:
+		service.Notice(rb, client.t("An error occurred"))
+	}
+}
+
 func nsInfoHandler(service *ircService, server *Server, client *Client, command string, params []string, rb *ResponseBuffer) {
 	if !server.Config().Accounts.AuthenticationEnabled && !client.HasRoleCapabs("accreg") {
 		service.Notice(rb, client.t("This command has been disabled by the server administrators"))
@@ -928,6 +1158,14 @@ func nsInfoHandler(service *ircService, server *Server, client *Client, command
 		}
 	}
 
+	if account.lastConnectedVisibleTo(client) {
+		if len(server.accounts.AccountToClients(account.Name)) != 0 {
+			service.Notice(rb, client.t("Last seen: now (currently connected)"))
+		} else if !account.LastConnected.IsZero() {
+			service.Notice(rb, fmt.Sprintf(client.t("Last seen: %s"), account.LastConnected.Format(time.RFC1123)))
+		}
+	}
+
 	// TODO nicer formatting for this
 	for _, nick := range account.AdditionalNicks {
 		service.Notice(rb, fmt.Sprintf(client.t("Additional grouped nick: %s"), nick))
@@ -1086,6 +1324,21 @@ func nsUnregisterHandler(service *ircService, server *Server, client *Client, co
 			service.Notice(rb, ircfmt.Unescape(client.t("$bNote that an unregistered account name remains reserved and cannot be re-registered.$b")))
 			service.Notice(rb, ircfmt.Unescape(client.t("$bIf you are having problems with your account, contact an administrator.$b")))
 		}
+		var dropped, inherited []string
+		for _, chname := range server.accounts.ChannelsForAccount(accountName) {
+			if channel := server.channels.Get(chname); channel != nil && channel.Settings().Successor != "" {
+				inherited = append(inherited, chname)
+			} else {
+				dropped = append(dropped, chname)
+			}
+		}
+		if len(inherited) != 0 {
+			service.Notice(rb, fmt.Sprintf(client.t("The following channels will be transferred to their designated successors: %s"), strings.Join(inherited, ", ")))
+		}
+		if len(dropped) != 0 {
+			service.Notice(rb, fmt.Sprintf(client.t("The following channels will also be unregistered: %s"), strings.Join(dropped, ", ")))
+			service.Notice(rb, ircfmt.Unescape(client.t("To keep a channel, first transfer it to another account with $b/CS TRANSFER$b")))
+		}
 		service.Notice(rb, fmt.Sprintf(client.t("To confirm, run this command: %s"), fmt.Sprintf("/NS %s %s %s", strings.ToUpper(command), accountName, expectedCode)))
 		return
 	}
@@ -1216,18 +1469,23 @@ func nsEnforceHandler(service *ircService, server *Server, client *Client, comma
 func nsClientsHandler(service *ircService, server *Server, client *Client, command string, params []string, rb *ResponseBuffer) {
 	var verb string
 
-	if command == "sessions" {
-		// Legacy "SESSIONS" command is an alias for CLIENTS LIST.
-		verb = "list"
-	} else if len(params) > 0 {
+	if len(params) > 0 {
 		verb = strings.ToLower(params[0])
+	}
+	switch verb {
+	case "list", "logout", "kill":
 		params = params[1:]
+	default:
+		if command == "sessions" {
+			// SESSIONS [nickname] is an alias for CLIENTS LIST [nickname]
+			verb = "list"
+		}
 	}
 
 	switch verb {
 	case "list":
 		nsClientsListHandler(service, server, client, params, rb)
-	case "logout":
+	case "logout", "kill":
 		nsClientsLogoutHandler(service, server, client, params, rb)
 	default:
 		service.Notice(rb, client.t("Invalid parameters"))
@@ -1276,6 +1534,23 @@ func nsClientsListHandler(service *ircService, server *Server, client *Client, p
 			}
 		}
 	}
+
+	deviceLastSeen := target.DeviceLastSeen()
+	if len(deviceLastSeen) != 0 {
+		deviceIDs := make([]string, 0, len(deviceLastSeen))
+		for deviceID := range deviceLastSeen {
+			deviceIDs = append(deviceIDs, deviceID)
+		}
+		sort.Strings(deviceIDs)
+		service.Notice(rb, fmt.Sprintf(client.t("Nickname %[1]s has %[2]d known device ID(s):"), target.Nick(), len(deviceIDs)))
+		for _, deviceID := range deviceIDs {
+			name := deviceID
+			if name == "" {
+				name = client.t("(none)")
+			}
+			service.Notice(rb, fmt.Sprintf(client.t("Device %[1]s last seen at %[2]s"), name, deviceLastSeen[deviceID].Format(time.RFC1123)))
+		}
+	}
 }
 
 func nsClientsLogoutHandler(service *ircService, server *Server, client *Client, params []string, rb *ResponseBuffer) {
@@ -1599,3 +1874,56 @@ func nsRenameHandler(service *ircService, server *Server, client *Client, comman
 		}
 	}
 }
+
+func nsExportHandler(service *ircService, server *Server, client *Client, command string, params []string, rb *ResponseBuffer) {
+	export, err := server.accounts.Export(client.Account())
+	if err != nil {
+		service.Notice(rb, client.t("Could not export account data"))
+		return
+	}
+	data, err := json.MarshalIndent(export, "", "  ")
+	if err != nil {
+		service.Notice(rb, client.t("Could not export account data"))
+		return
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		service.Notice(rb, line)
+	}
+}
+
+func nsSaexportHandler(service *ircService, server *Server, client *Client, command string, params []string, rb *ResponseBuffer) {
+	export, err := server.accounts.Export(params[0])
+	if err != nil {
+		service.Notice(rb, fmt.Sprintf(client.t("Could not export account data: %v"), err))
+		return
+	}
+	data, err := json.Marshal(export)
+	if err != nil {
+		service.Notice(rb, fmt.Sprintf(client.t("Could not export account data: %v"), err))
+		return
+	}
+
+	// don't include the account name in the filename because of escaping concerns
+	filename := fmt.Sprintf("%s-%s.json", utils.GenerateSecretToken(), time.Now().UTC().Format(IRCv3TimestampFormat))
+	outfile, err := os.Create(server.Config().getOutputPath(filename))
+	if err != nil {
+		service.Notice(rb, fmt.Sprintf(client.t("Error opening export file: %v"), err))
+		return
+	}
+
+	if !historyComplianceEnabled(server.Config()) {
+		outfile.Write(data)
+		outfile.Write([]byte{'\n'})
+		outfile.Close()
+		service.Notice(rb, fmt.Sprintf(client.t("Data export for %[1]s completed and written to %[2]s"), export.Name, filename))
+		return
+	}
+
+	// the account record goes on the first line, followed by the messages,
+	// in the same format as HistServ EXPORT
+	service.Notice(rb, fmt.Sprintf(client.t("Started exporting data for account %[1]s to file %[2]s"), export.Name, filename))
+	outfile.Write(data)
+	outfile.Write([]byte{'\n'})
+	cfAccount, _ := CasefoldName(export.Name)
+	go histservExportAndNotify(service, server, cfAccount, outfile, filename, client.Nick())
+}
@@ -32,8 +32,11 @@ const (
 	RPL_TRACERECONNECT            = "210"
 	RPL_STATSLINKINFO             = "211"
 	RPL_STATSCOMMANDS             = "212"
+	RPL_STATSKLINE                = "216"
 	RPL_ENDOFSTATS                = "219"
+	RPL_STATSPLINE                = "220"
 	RPL_UMODEIS                   = "221"
+	RPL_RULES                     = "232"
 	RPL_SERVLIST                  = "234"
 	RPL_SERVLISTEND               = "235"
 	RPL_STATSUPTIME               = "242"
@@ -52,12 +55,18 @@ const (
 	RPL_TRYAGAIN                  = "263"
 	RPL_LOCALUSERS                = "265"
 	RPL_GLOBALUSERS               = "266"
+	RPL_SILELIST                  = "271"
+	RPL_ENDOFSILELIST             = "272"
 	RPL_WHOISCERTFP               = "276"
+	RPL_ACCEPTLIST                = "281"
+	RPL_ENDOFACCEPT               = "282"
 	RPL_AWAY                      = "301"
 	RPL_USERHOST                  = "302"
 	RPL_ISON                      = "303"
 	RPL_UNAWAY                    = "305"
 	RPL_NOWAWAY                   = "306"
+	RPL_RULESTART                 = "308"
+	RPL_ENDOFRULES                = "309"
 	RPL_WHOISUSER                 = "311"
 	RPL_WHOISSERVER               = "312"
 	RPL_WHOISOPERATOR             = "313"
@@ -66,10 +75,12 @@ const (
 	RPL_WHOISIDLE                 = "317"
 	RPL_ENDOFWHOIS                = "318"
 	RPL_WHOISCHANNELS             = "319"
+	RPL_WHOISSPECIAL              = "320"
 	RPL_LIST                      = "322"
 	RPL_LISTEND                   = "323"
 	RPL_CHANNELMODEIS             = "324"
 	RPL_UNIQOPIS                  = "325"
+	RPL_CHANNEL_URL               = "328"
 	RPL_CREATIONTIME              = "329"
 	RPL_WHOISACCOUNT              = "330"
 	RPL_NOTOPIC                   = "331"
@@ -79,6 +90,7 @@ const (
 	RPL_WHOISACTUALLY             = "338"
 	RPL_INVITING                  = "341"
 	RPL_SUMMONING                 = "342"
+	RPL_INVITED                   = "345"
 	RPL_INVITELIST                = "346"
 	RPL_ENDOFINVITELIST           = "347"
 	RPL_EXCEPTLIST                = "348"
@@ -131,8 +143,10 @@ const (
 	ERR_NONICKNAMEGIVEN           = "431"
 	ERR_ERRONEUSNICKNAME          = "432"
 	ERR_NICKNAMEINUSE             = "433"
+	ERR_NORULES                   = "434"
 	ERR_NICKCOLLISION             = "436"
 	ERR_UNAVAILRESOURCE           = "437"
+	ERR_NICKTOOFAST               = "438"
 	ERR_REG_UNAVAILABLE           = "440"
 	ERR_USERNOTINCHANNEL          = "441"
 	ERR_NOTONCHANNEL              = "442"
@@ -141,6 +155,9 @@ const (
 	ERR_SUMMONDISABLED            = "445"
 	ERR_USERSDISABLED             = "446"
 	ERR_NOTREGISTERED             = "451"
+	ERR_ACCEPTFULL                = "456"
+	ERR_ACCEPTEXIST               = "457"
+	ERR_ACCEPTNOT                 = "458"
 	ERR_NEEDMOREPARAMS            = "461"
 	ERR_ALREADYREGISTRED          = "462"
 	ERR_NOPERMFORHOST             = "463"
@@ -166,6 +183,7 @@ const (
 	ERR_NOOPERHOST                = "491"
 	ERR_UMODEUNKNOWNFLAG          = "501"
 	ERR_USERSDONTMATCH            = "502"
+	ERR_SILELISTFULL              = "511"
 	ERR_HELPNOTFOUND              = "524"
 	ERR_CANNOTSENDRP              = "573"
 	RPL_WHOWASIP                  = "652"
@@ -177,12 +195,21 @@ const (
 	RPL_HELPSTART                 = "704"
 	RPL_HELPTXT                   = "705"
 	RPL_ENDOFHELP                 = "706"
+	RPL_TARGUMODEG                = "716"
+	RPL_TARGNOTIFY                = "717"
+	RPL_UMODEGMSG                 = "718"
 	ERR_NOPRIVS                   = "723"
 	RPL_MONONLINE                 = "730"
 	RPL_MONOFFLINE                = "731"
 	RPL_MONLIST                   = "732"
 	RPL_ENDOFMONLIST              = "733"
 	ERR_MONLISTFULL               = "734"
+	RPL_WHOISKEYVALUE             = "760"
+	RPL_KEYVALUE                  = "761"
+	RPL_KEYNOTSET                 = "766"
+	RPL_METADATASUBOK             = "770"
+	RPL_METADATAUNSUBOK           = "771"
+	RPL_METADATASUBS              = "772"
 	RPL_LOGGEDIN                  = "900"
 	RPL_LOGGEDOUT                 = "901"
 	ERR_NICKLOCKED                = "902"
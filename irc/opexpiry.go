@@ -0,0 +1,92 @@
+// Copyright (c) 2021 Shivaram Lingamneni <slingamn@cs.stanford.edu>
+// released under the MIT license
+
+package irc
+
+import (
+	"fmt"
+	"runtime/debug"
+	"time"
+
+	"github.com/ergochat/ergo/irc/modes"
+)
+
+// a registered channel can make manually granted operator status temporary
+// (CS SET OP-EXPIRY): +o given with MODE is revoked once it has been held for
+// the configured duration. ops that come from the channel's access list
+// (AMODE) never expire. like any membership mode, +o is also lost when the
+// holder parts the channel.
+
+const (
+	opExpiryPollPeriod = 30 * time.Second
+)
+
+// recordManualOp records that +o was granted to (or removed from) a member
+// via MODE, starting or cancelling its expiration
+func (channel *Channel) recordManualOp(target *Client, granted bool) {
+	var grantTime int64
+	if granted {
+		switch channel.getAmode(target.Account()) {
+		case modes.ChannelFounder, modes.ChannelAdmin, modes.ChannelOperator:
+			// the access list entitles them to op anyway
+		default:
+			grantTime = time.Now().UnixNano()
+		}
+	}
+
+	channel.stateMutex.Lock()
+	defer channel.stateMutex.Unlock()
+	if memberData, ok := channel.members[target]; ok {
+		memberData.opGranted = grantTime
+		channel.members[target] = memberData
+	}
+}
+
+// expireOps removes manually granted +o that has outlived the channel's
+// op-expiry setting, returning the members it was removed from
+func (channel *Channel) expireOps(now time.Time) (expired []*Client) {
+	channel.stateMutex.Lock()
+	defer channel.stateMutex.Unlock()
+
+	expiry := channel.settings.OpExpiry
+	if expiry == 0 {
+		return
+	}
+	cutoff := now.Add(-expiry).UnixNano()
+	for member, memberData := range channel.members {
+		if memberData.opGranted == 0 || cutoff < memberData.opGranted {
+			continue
+		}
+		memberData.opGranted = 0
+		channel.members[member] = memberData
+		if memberData.modes.SetMode(modes.ChannelOperator, false) {
+			expired = append(expired, member)
+		}
+	}
+	return
+}
+
+func (server *Server) handleOpExpirations() {
+	defer func() {
+		if r := recover(); r != nil {
+			server.logger.Error("internal",
+				fmt.Sprintf("Panic in op expiration: %v\n%s", r, debug.Stack()))
+		}
+		// either way, reschedule
+		time.AfterFunc(opExpiryPollPeriod, server.handleOpExpirations)
+	}()
+
+	now := time.Now()
+	for _, channel := range server.channels.Channels() {
+		expired := channel.expireOps(now)
+		if len(expired) == 0 {
+			continue
+		}
+		changes := make(modes.ModeChanges, len(expired))
+		for i, member := range expired {
+			member.markDirty(IncludeChannels)
+			changes[i] = modes.ModeChange{Op: modes.Remove, Mode: modes.ChannelOperator, Arg: member.Nick()}
+		}
+		announceCmodeChanges(channel, changes, server.name, "*", "", false, nil)
+	}
+}
@@ -0,0 +1,40 @@
+// Copyright (c) 2021 Shivaram Lingamneni <slingamn@cs.stanford.edu>
+// released under the MIT license
+
+package irc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ergochat/ergo/irc/modes"
+)
+
+func TestExpireOps(t *testing.T) {
+	alice, _ := makeTestClient()
+	bob, _ := makeTestClient()
+	channel := makeTestChannel(alice, bob)
+	for _, member := range []*Client{alice, bob} {
+		channel.members[member].modes.SetMode(modes.ChannelOperator, true)
+	}
+	channel.recordManualOp(alice, true)
+
+	now := time.Now()
+	// no expiration unless the channel enables it
+	assertEqual(len(channel.expireOps(now.Add(time.Hour))), 0, t)
+
+	channel.settings.OpExpiry = time.Hour
+	assertEqual(len(channel.expireOps(now.Add(time.Minute))), 0, t)
+
+	// bob's op wasn't recorded as manual, so it never expires
+	expired := channel.expireOps(now.Add(2 * time.Hour))
+	assertEqual(expired, []*Client{alice}, t)
+	assertEqual(channel.members[alice].modes.HasMode(modes.ChannelOperator), false, t)
+	assertEqual(channel.members[bob].modes.HasMode(modes.ChannelOperator), true, t)
+
+	// a deop cancels the expiration
+	channel.members[alice].modes.SetMode(modes.ChannelOperator, true)
+	channel.recordManualOp(alice, true)
+	channel.recordManualOp(alice, false)
+	assertEqual(len(channel.expireOps(now.Add(2*time.Hour))), 0, t)
+}
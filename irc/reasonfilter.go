@@ -0,0 +1,91 @@
+// Copyright (c) 2021 Shivaram Lingamneni <slingamn@cs.stanford.edu>
+// released under the MIT license
+
+package irc
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/ergochat/irc-go/ircfmt"
+)
+
+// quit, part, and kick messages are displayed to entire channels, but they
+// aren't subject to the restrictions on channel messages, which makes them
+// a common vector for spam. reason filtering strips formatting from them,
+// and replaces them entirely if they contain URLs or match a spamfilter.
+// it's configured server-wide (channels.reason-filtering.enabled), and
+// channels can opt in or out with /CS SET #channel REASON-FILTER.
+
+var reasonURLRegexp = regexp.MustCompile(`(?i)\b([a-z][a-z0-9+.-]*://|www\.)\S`)
+
+type ReasonFilterConfig struct {
+	Enabled         PersistentStatus
+	StripFormatting bool `yaml:"strip-formatting"`
+	FilterURLs      bool `yaml:"filter-urls"`
+	Spamfilters     []string
+	Replacement     string
+
+	spamfilters []*regexp.Regexp
+}
+
+func (rf *ReasonFilterConfig) prepare() error {
+	if rf.Enabled == PersistentUnspecified {
+		rf.Enabled = PersistentDisabled
+	}
+	rf.spamfilters = make([]*regexp.Regexp, len(rf.Spamfilters))
+	for i, spamfilter := range rf.Spamfilters {
+		re, err := regexp.Compile(spamfilter)
+		if err != nil {
+			return fmt.Errorf("invalid reason-filtering spamfilter `%s`: %w", spamfilter, err)
+		}
+		rf.spamfilters[i] = re
+	}
+	return nil
+}
+
+// filter returns the scrubbed reason, or the replacement (which may be
+// the empty string) if the reason must be discarded
+func (rf *ReasonFilterConfig) filter(reason string) string {
+	if reason == "" {
+		return reason
+	}
+	if rf.StripFormatting {
+		reason = ircfmt.Strip(reason)
+	}
+	if rf.FilterURLs && reasonURLRegexp.MatchString(reason) {
+		return rf.Replacement
+	}
+	for _, spamfilter := range rf.spamfilters {
+		if spamfilter.MatchString(reason) {
+			return rf.Replacement
+		}
+	}
+	return reason
+}
+
+func (channel *Channel) reasonFilterEnabled(config *Config) bool {
+	return persistenceEnabled(config.Channels.ReasonFiltering.Enabled, channel.Settings().ReasonFilter)
+}
+
+// filterReason filters a part or kick message for the channel
+func (channel *Channel) filterReason(config *Config, reason string) string {
+	if channel.reasonFilterEnabled(config) {
+		return config.Channels.ReasonFiltering.filter(reason)
+	}
+	return reason
+}
+
+// filterQuitReason filters a quit message; since it's displayed in all the
+// client's channels, it's filtered if any of them has filtering enabled
+func (client *Client) filterQuitReason(config *Config, reason string) string {
+	if config.Channels.ReasonFiltering.Enabled == PersistentDisabled {
+		return reason
+	}
+	for _, channel := range client.Channels() {
+		if channel.reasonFilterEnabled(config) {
+			return config.Channels.ReasonFiltering.filter(reason)
+		}
+	}
+	return reason
+}
@@ -0,0 +1,37 @@
+// Copyright (c) 2021 Shivaram Lingamneni <slingamn@cs.stanford.edu>
+// released under the MIT license
+
+package irc
+
+import (
+	"testing"
+)
+
+func TestReasonFilter(t *testing.T) {
+	rf := ReasonFilterConfig{
+		StripFormatting: true,
+		FilterURLs:      true,
+		Spamfilters:     []string{`(?i)free bitcoin`},
+	}
+	if err := rf.prepare(); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(rf.Enabled, PersistentDisabled, t)
+
+	assertEqual(rf.filter(""), "", t)
+	assertEqual(rf.filter("gotta go"), "gotta go", t)
+	assertEqual(rf.filter("\x02gotta\x02 \x034go"), "gotta go", t)
+	assertEqual(rf.filter("join us at https://example.com"), "", t)
+	assertEqual(rf.filter("WWW.EXAMPLE.COM"), "", t)
+	assertEqual(rf.filter("FREE BITCOIN"), "", t)
+	// not a URL:
+	assertEqual(rf.filter("be right back: 5 mins"), "be right back: 5 mins", t)
+
+	rf.Replacement = "[filtered]"
+	assertEqual(rf.filter("irc://irc.example.com/#spam"), "[filtered]", t)
+
+	rf.Spamfilters = []string{`(`}
+	if rf.prepare() == nil {
+		t.Errorf("invalid spamfilter should be rejected")
+	}
+}
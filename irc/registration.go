@@ -0,0 +1,114 @@
+// Copyright (c) 2021 Shivaram Lingamneni <slingamn@cs.stanford.edu>
+// released under the MIT license
+
+package irc
+
+// registrationState tracks the progress of a session through connection
+// registration. IRC lets PASS, NICK, USER, CAP and AUTHENTICATE arrive in
+// almost any order, so each step is recorded independently; registration can
+// complete once NICK and USER have both been accepted, as long as CAP
+// negotiation isn't in progress. Handlers report what they saw as events,
+// and events that make no sense in the current state are rejected.
+type registrationState struct {
+	steps      registrationStep
+	registered bool
+}
+
+type registrationStep uint
+
+const (
+	regStepCapNegotiating registrationStep = 1 << iota // CAP LS or CAP REQ, but no CAP END yet
+	regStepPass                                        // PASS was sent
+	regStepNick                                        // NICK was sent and not rejected
+	regStepUser                                        // USER was sent and accepted
+	regStepSASL                                        // AUTHENTICATE exchange in progress
+)
+
+type registrationEvent uint
+
+const (
+	regEventCapStart registrationEvent = iota
+	regEventCapEnd
+	regEventPass
+	regEventNick
+	regEventNickRejected
+	regEventUser
+	regEventSASLStart
+	regEventSASLEnd
+	regEventRegister
+)
+
+// Transition applies `event` to the state, or returns an error (leaving the
+// state unchanged) if the event is invalid in the current state.
+func (r *registrationState) Transition(event registrationEvent) error {
+	switch event {
+	case regEventCapStart:
+		// CAP is also usable after registration, but then it doesn't block anything
+		if !r.registered {
+			r.steps |= regStepCapNegotiating
+		}
+	case regEventCapEnd:
+		r.steps &^= regStepCapNegotiating
+	case regEventPass:
+		if r.registered {
+			return errAlreadyRegistered
+		}
+		r.steps |= regStepPass
+	case regEventNick, regEventNickRejected:
+		// after registration, NICK is a nick change and not a registration event
+		if r.registered {
+			return errAlreadyRegistered
+		}
+		if event == regEventNick {
+			r.steps |= regStepNick
+		} else {
+			r.steps &^= regStepNick
+		}
+	case regEventUser:
+		if r.registered {
+			return errAlreadyRegistered
+		}
+		r.steps |= regStepUser
+	case regEventSASLStart:
+		// SASL is permitted after registration, for clients that aren't logged in
+		if r.Has(regStepSASL) {
+			return errInvalidRegistrationTransition
+		}
+		r.steps |= regStepSASL
+	case regEventSASLEnd:
+		// aborting or failing a SASL exchange that never started is harmless
+		r.steps &^= regStepSASL
+	case regEventRegister:
+		if r.registered {
+			return errAlreadyRegistered
+		} else if !r.Ready() {
+			return errRegistrationIncomplete
+		}
+		r.registered = true
+		r.steps &^= regStepCapNegotiating
+	default:
+		return errInvalidRegistrationTransition
+	}
+	return nil
+}
+
+// Has returns whether `step` is currently set.
+func (r *registrationState) Has(step registrationStep) bool {
+	return r.steps&step != 0
+}
+
+// Ready returns whether the session can attempt to complete registration.
+func (r *registrationState) Ready() bool {
+	return !r.registered && r.Has(regStepNick) && r.Has(regStepUser) && !r.Has(regStepCapNegotiating)
+}
+
+// Registered returns whether registration has completed.
+func (r *registrationState) Registered() bool {
+	return r.registered
+}
+
+// endSASL discards the state of any SASL exchange in progress.
+func (session *Session) endSASL() {
+	session.sasl.Clear()
+	session.registration.Transition(regEventSASLEnd)
+}
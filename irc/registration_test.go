@@ -0,0 +1,66 @@
+// Copyright (c) 2021 Shivaram Lingamneni <slingamn@cs.stanford.edu>
+// released under the MIT license
+
+package irc
+
+import (
+	"testing"
+)
+
+func TestRegistrationNickUser(t *testing.T) {
+	var r registrationState
+	assertEqual(r.Ready(), false, t)
+	assertEqual(r.Transition(regEventRegister), errRegistrationIncomplete, t)
+
+	assertEqual(r.Transition(regEventUser), nil, t)
+	assertEqual(r.Ready(), false, t)
+	assertEqual(r.Transition(regEventNick), nil, t)
+	assertEqual(r.Ready(), true, t)
+
+	// the nick was taken: registration must wait for another NICK
+	assertEqual(r.Transition(regEventNickRejected), nil, t)
+	assertEqual(r.Ready(), false, t)
+	assertEqual(r.Transition(regEventNick), nil, t)
+
+	assertEqual(r.Transition(regEventRegister), nil, t)
+	assertEqual(r.Registered(), true, t)
+	assertEqual(r.Ready(), false, t)
+
+	assertEqual(r.Transition(regEventRegister), errAlreadyRegistered, t)
+	assertEqual(r.Transition(regEventPass), errAlreadyRegistered, t)
+	assertEqual(r.Transition(regEventUser), errAlreadyRegistered, t)
+	assertEqual(r.Transition(regEventNick), errAlreadyRegistered, t)
+}
+
+func TestRegistrationCapNegotiation(t *testing.T) {
+	var r registrationState
+	assertEqual(r.Transition(regEventCapStart), nil, t)
+	assertEqual(r.Transition(regEventNick), nil, t)
+	assertEqual(r.Transition(regEventUser), nil, t)
+	assertEqual(r.Ready(), false, t)
+	assertEqual(r.Transition(regEventRegister), errRegistrationIncomplete, t)
+
+	assertEqual(r.Transition(regEventCapEnd), nil, t)
+	assertEqual(r.Ready(), true, t)
+	assertEqual(r.Transition(regEventRegister), nil, t)
+
+	// CAP after registration doesn't block anything
+	assertEqual(r.Transition(regEventCapStart), nil, t)
+	assertEqual(r.Has(regStepCapNegotiating), false, t)
+}
+
+func TestRegistrationSASL(t *testing.T) {
+	var r registrationState
+	assertEqual(r.Transition(regEventPass), nil, t)
+	assertEqual(r.Has(regStepPass), true, t)
+
+	assertEqual(r.Transition(regEventSASLStart), nil, t)
+	assertEqual(r.Transition(regEventSASLStart), errInvalidRegistrationTransition, t)
+	assertEqual(r.Has(regStepSASL), true, t)
+	assertEqual(r.Transition(regEventSASLEnd), nil, t)
+	assertEqual(r.Has(regStepSASL), false, t)
+	// ending a nonexistent exchange is a no-op
+	assertEqual(r.Transition(regEventSASLEnd), nil, t)
+
+	assertEqual(r.Transition(registrationEvent(1000)), errInvalidRegistrationTransition, t)
+}
@@ -0,0 +1,106 @@
+// Copyright (c) 2021 Shivaram Lingamneni <slingamn@cs.stanford.edu>
+// released under the MIT license
+
+package irc
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/ergochat/ergo/irc/utils"
+)
+
+const (
+	defaultResolverTimeout = 5 * time.Second
+)
+
+// ResolverConfig controls the DNS resolver used for hostname lookups.
+type ResolverConfig struct {
+	// upstream nameservers; if empty, use the system configuration
+	Servers []string
+	Timeout time.Duration
+}
+
+// dnsResolver wraps a net.Resolver with a per-lookup timeout.
+type dnsResolver struct {
+	resolver *net.Resolver
+	timeout  time.Duration
+}
+
+// newDNSResolver validates the `dns-resolver` config section
+func newDNSResolver(config ResolverConfig) (result *dnsResolver, err error) {
+	result = &dnsResolver{
+		resolver: net.DefaultResolver,
+		timeout:  config.Timeout,
+	}
+	if result.timeout == 0 {
+		result.timeout = defaultResolverTimeout
+	}
+	if len(config.Servers) == 0 {
+		return
+	}
+
+	servers := make([]string, len(config.Servers))
+	for i, server := range config.Servers {
+		servers[i], err = normalizeNameserver(server)
+		if err != nil {
+			return nil, err
+		}
+	}
+	// bypass resolv.conf entirely, sending every query to one of the
+	// configured servers in turn (the Go resolver retries on failure):
+	var next uint32
+	result.resolver = &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			server := servers[int(atomic.AddUint32(&next, 1)-1)%len(servers)]
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, network, server)
+		},
+	}
+	return
+}
+
+// normalizeNameserver accepts `host` or `host:port` and returns `host:port`
+func normalizeNameserver(server string) (result string, err error) {
+	if net.ParseIP(strings.Trim(server, "[]")) != nil {
+		return net.JoinHostPort(strings.Trim(server, "[]"), "53"), nil
+	}
+	host, port, err := net.SplitHostPort(server)
+	if err != nil || net.ParseIP(host) == nil || port == "" {
+		return "", fmt.Errorf("invalid DNS server (must be an IP address, optionally with a port): `%s`", server)
+	}
+	return server, nil
+}
+
+// LookupHostname performs a reverse DNS lookup of ipString, forward-confirming
+// the result if requested; it returns the empty string on any failure.
+func (r *dnsResolver) LookupHostname(ipString string, forwardConfirm bool) (hostname string) {
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	var candidate string
+	names, err := r.resolver.LookupAddr(ctx, ipString)
+	if err == nil && 0 < len(names) {
+		candidate = strings.TrimSuffix(names[0], ".")
+	}
+	if !utils.IsHostname(candidate) {
+		return ""
+	}
+	if !forwardConfirm {
+		return candidate
+	}
+	addrs, err := r.resolver.LookupHost(ctx, candidate)
+	if err == nil {
+		for _, addr := range addrs {
+			if addr == ipString {
+				return candidate // successful forward confirmation
+			}
+		}
+	}
+	return ""
+}
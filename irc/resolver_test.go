@@ -0,0 +1,29 @@
+// Copyright (c) 2021 Shivaram Lingamneni <slingamn@cs.stanford.edu>
+// released under the MIT license
+
+package irc
+
+import (
+	"testing"
+)
+
+func TestNormalizeNameserver(t *testing.T) {
+	check := func(input, expected string) {
+		result, err := normalizeNameserver(input)
+		if err != nil {
+			t.Errorf("unexpected error for %s: %v", input, err)
+		}
+		assertEqual(result, expected, t)
+	}
+	check("1.1.1.1", "1.1.1.1:53")
+	check("1.1.1.1:5353", "1.1.1.1:5353")
+	check("2606:4700:4700::1111", "[2606:4700:4700::1111]:53")
+	check("[2606:4700:4700::1111]", "[2606:4700:4700::1111]:53")
+	check("[2606:4700:4700::1111]:5353", "[2606:4700:4700::1111]:5353")
+
+	for _, invalid := range []string{"", "dns.example.com", "dns.example.com:53", "1.1.1.1:"} {
+		if _, err := normalizeNameserver(invalid); err == nil {
+			t.Errorf("accepted invalid nameserver %s", invalid)
+		}
+	}
+}
@@ -40,6 +40,10 @@ type ResponseBuffer struct {
 	finalized bool
 	target    *Client
 	session   *Session
+
+	// whether an error reply (FAIL, or a numeric in the 400 or 500 range)
+	// was added; this is used for instrumentation
+	sawError bool
 }
 
 // GetLabel returns the label from the given message.
@@ -69,9 +73,22 @@ func (rb *ResponseBuffer) AddMessage(msg ircmsg.Message) {
 	rb.session.setTimeTag(&msg, time.Time{})
 	rb.setNestedBatchTag(&msg)
 
+	if !rb.sawError && isErrorReply(msg.Command) {
+		rb.sawError = true
+	}
+
 	rb.messages = append(rb.messages, msg)
 }
 
+// isErrorReply returns whether the command is FAIL or an error numeric
+func isErrorReply(command string) bool {
+	if command == "FAIL" {
+		return true
+	}
+	return len(command) == 3 && (command[0] == '4' || command[0] == '5') &&
+		'0' <= command[1] && command[1] <= '9' && '0' <= command[2] && command[2] <= '9'
+}
+
 func (rb *ResponseBuffer) setNestedBatchTag(msg *ircmsg.Message) {
 	if 0 < len(rb.nestedBatches) {
 		msg.SetTag("batch", rb.nestedBatches[len(rb.nestedBatches)-1])
@@ -124,15 +124,11 @@ func sendRoleplayMessage(server *Server, client *Client, source string, targetSt
 			return
 		}
 
-		cnick := client.Nick()
 		tnick := user.Nick()
 		isBot := client.HasMode(modes.Bot)
 		for _, session := range user.Sessions() {
 			session.sendSplitMsgFromClientInternal(false, sourceMask, "*", isBot, nil, "PRIVMSG", tnick, splitMessage)
 		}
-		if away, awayMessage := user.Away(); away {
-			//TODO(dan): possibly implement cooldown of away notifications to users
-			rb.Add(nil, server.name, RPL_AWAY, cnick, tnick, awayMessage)
-		}
+		addAwayReply(rb, "PRIVMSG", client, user)
 	}
 }
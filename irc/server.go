@@ -6,6 +6,7 @@
 package irc
 
 import (
+	"expvar"
 	"fmt"
 	"net"
 	"net/http"
@@ -57,15 +58,27 @@ var (
 	// will also need to be reflected in CasefoldChannel
 	chanTypes = "#"
 
+	// expvar.Publish and http.HandleFunc can only be called once per name
+	publishMetricsOnce sync.Once
+
 	throttleMessage = "You have attempted to connect too many times within a short duration. Wait a while, and you will be able to connect."
 )
 
 // Server is the main Oragono server.
 type Server struct {
 	accounts          AccountManager
+	adminConsole      *adminConsole
+	autoReplies       AutoReplyLimiter
 	channels          ChannelManager
 	channelRegistry   ChannelRegistry
 	clients           ClientManager
+	commandStats      CommandStats
+	connEvents        ConnectionEvents
+	diagnostics       diagnosticsState
+	hostnameCache     LookupCache
+	identCache        LookupCache
+	maintenance       MaintenanceManager
+	invites           InviteManager
 	config            unsafe.Pointer
 	configFilename    string
 	connectionLimiter connection_limits.Limiter
@@ -80,10 +93,13 @@ type Server struct {
 	nameCasefolded    string
 	rehashMutex       sync.Mutex // tier 4
 	rehashSignal      chan os.Signal
+	shuns             *KLineManager
 	pprofServer       *http.Server
 	exitSignals       chan os.Signal
 	snomasks          SnoManager
 	store             *buntdb.DB
+	ticketKeys        SessionTicketKeys
+	tlsStats          TLSStats
 	historyDB         mysql.MySQL
 	torLimiter        connection_limits.TorLimiter
 	whoWas            WhoWasList
@@ -105,6 +121,15 @@ func NewServer(config *Config, logger *logger.Manager) (*Server, error) {
 	}
 
 	server.clients.Initialize()
+	server.commandStats.Initialize()
+	server.connEvents.Initialize()
+	server.hostnameCache.Initialize()
+	server.identCache.Initialize()
+	server.maintenance.Initialize()
+	server.ticketKeys.Initialize()
+	server.tlsStats.Initialize()
+	server.invites.Initialize()
+	server.autoReplies.Initialize()
 	server.semaphores.Initialize()
 	server.whoWas.Initialize(config.Limits.WhowasEntries)
 	server.monitorManager.Initialize()
@@ -119,6 +144,14 @@ func NewServer(config *Config, logger *logger.Manager) (*Server, error) {
 	signal.Notify(server.rehashSignal, syscall.SIGHUP)
 
 	time.AfterFunc(alwaysOnExpirationPollPeriod, server.handleAlwaysOnExpirations)
+	time.AfterFunc(channelExpirationPollPeriod, server.handleChannelExpirations)
+	time.AfterFunc(delayedNickPurgePeriod, server.handleDelayedNickExpirations)
+	time.AfterFunc(idleAwayPollPeriod, server.handleIdleAway)
+	time.AfterFunc(invitePurgePeriod, server.handleInviteExpirations)
+	time.AfterFunc(opExpiryPollPeriod, server.handleOpExpirations)
+	time.AfterFunc(ticketKeyRotationPeriod, server.handleTicketKeyRotation)
+
+	go server.Diagnostics()
 
 	return server, nil
 }
@@ -136,6 +169,10 @@ func (server *Server) Shutdown() {
 		}
 	}
 
+	if server.adminConsole != nil {
+		server.adminConsole.Stop()
+	}
+
 	if err := server.store.Close(); err != nil {
 		server.logger.Error("shutdown", fmt.Sprintln("Could not close datastore:", err))
 	}
@@ -275,16 +312,26 @@ func (server *Server) handleAlwaysOnExpirations() {
 func (server *Server) tryRegister(c *Client, session *Session) (exiting bool) {
 	// XXX PROXY or WEBIRC MUST be sent as the first line of the session;
 	// if we are here at all that means we have the final value of the IP
-	if session.rawHostname == "" {
-		session.client.lookupHostname(session, false)
+	if session.hostnameLookup == nil {
+		// the IP may have been changed by WEBIRC since the connection was accepted
+		session.updateConnectionClass(server.Config())
+		// look up the hostname in the background, so that the client's
+		// remaining registration lines are processed in the meantime
+		session.hostnameLookup = make(chan struct{})
+		go func() {
+			defer close(session.hostnameLookup)
+			session.client.lookupHostname(session, false)
+			server.connectionEvent(session, connStageLookupFinished, session.rawHostname)
+		}()
 	}
 
 	// try to complete registration normally
-	// XXX(#1057) username can be filled in by an ident query without the client
-	// having sent USER: check for both username and realname to ensure they did
-	if c.preregNick == "" || c.username == "" || c.realname == "" || session.capState == caps.NegotiatingState {
+	// (#1057: username can be filled in by an ident query without the client
+	// having sent USER, so we rely on the registration state and not the username)
+	if !session.registration.Ready() {
 		return
 	}
+	<-session.hostnameLookup
 
 	if c.isSTSOnly {
 		server.playSTSBurst(session)
@@ -312,6 +359,8 @@ func (server *Server) tryRegister(c *Client, session *Session) (exiting bool) {
 		return true
 	}
 	c.requireSASLMessage = ""
+	// SASL may have changed the connection class:
+	session.updateConnectionClass(config)
 
 	rb := NewResponseBuffer(session)
 	nickError := performNickChange(server, c, c, session, c.preregNick, rb)
@@ -319,11 +368,23 @@ func (server *Server) tryRegister(c *Client, session *Session) (exiting bool) {
 	if nickError == errInsecureReattach {
 		c.Quit(c.t("You can't mix secure and insecure connections to this account"), nil)
 		return true
+	} else if nickError == errTooManySessions {
+		c.Quit(c.t("Too many sessions are attached to this account"), nil)
+		return true
 	} else if nickError != nil {
 		c.preregNick = ""
+		session.registration.Transition(regEventNickRejected)
 		return false
 	}
 
+	// if a SASL exchange is still in progress, registration aborts it
+	if session.registration.Has(regStepSASL) {
+		session.endSASL()
+		session.Send(nil, server.name, ERR_SASLABORTED, c.Nick(), c.t("SASL authentication aborted"))
+	}
+	session.registration.Transition(regEventRegister)
+	server.connectionEvent(session, connStageRegistered, c.preregNick)
+
 	if session.client != c {
 		// reattached, bail out.
 		// we'll play the reg burst later, on the new goroutine associated with
@@ -332,12 +393,18 @@ func (server *Server) tryRegister(c *Client, session *Session) (exiting bool) {
 		return false
 	}
 
+	c.stateMutex.Lock()
+	c.connectionClass = session.connectionClass
+	c.stateMutex.Unlock()
+
 	// Apply default user modes (without updating the invisible counter)
 	// The number of invisible users will be updated by server.stats.Register
 	// if we're using default user mode +i.
 	for _, defaultMode := range config.Accounts.defaultUserModes {
 		c.SetMode(defaultMode, true)
 	}
+	// clients with an IP cloak start out with +x
+	c.SetCloaked(true)
 
 	// count new user in statistics (before checking KLINEs, see #1303)
 	server.stats.Register(c.HasMode(modes.Invisible))
@@ -391,6 +458,9 @@ func (server *Server) playRegistrationBurst(session *Session) {
 	server.RplISupport(c, rb)
 	server.Lusers(c, rb)
 	server.MOTD(c, rb)
+	if config.Server.RulesOnConnect && len(config.Server.rulesLines) != 0 {
+		server.Rules(c, rb)
+	}
 	rb.Send(true)
 
 	modestring := c.ModeString()
@@ -400,6 +470,14 @@ func (server *Server) playRegistrationBurst(session *Session) {
 
 	c.attemptAutoOper(session)
 
+	if warning := config.Server.InsecureConnections.Warning; warning != "" && !c.HasMode(modes.TLS) {
+		session.Send(nil, server.name, "NOTICE", d.nick, warning)
+	}
+
+	if memoNotice := server.unreadMemosNotice(c); memoNotice != "" {
+		session.Send(nil, memoservService.prefix, "NOTICE", d.nick, memoNotice)
+	}
+
 	if server.logger.IsLoggingRawIO() {
 		session.Send(nil, c.server.name, "NOTICE", d.nick, c.t("This server is in debug mode and is logging all user I/O. If you do not wish for everything you send to be readable by the server owner(s), please disconnect."))
 	}
@@ -451,6 +529,22 @@ func (server *Server) MOTD(client *Client, rb *ResponseBuffer) {
 	rb.Add(nil, server.name, RPL_ENDOFMOTD, client.nick, client.t("End of MOTD command"))
 }
 
+// Rules sends the server's rules to the client.
+func (server *Server) Rules(client *Client, rb *ResponseBuffer) {
+	rulesLines := server.Config().Server.rulesLines
+
+	if len(rulesLines) < 1 {
+		rb.Add(nil, server.name, ERR_NORULES, client.nick, client.t("RULES File is missing"))
+		return
+	}
+
+	rb.Add(nil, server.name, RPL_RULESTART, client.nick, fmt.Sprintf(client.t("- %s Server Rules - "), server.name))
+	for _, line := range rulesLines {
+		rb.Add(nil, server.name, RPL_RULES, client.nick, line)
+	}
+	rb.Add(nil, server.name, RPL_ENDOFRULES, client.nick, client.t("End of RULES command"))
+}
+
 func (client *Client) whoisChannelsNames(target *Client, multiPrefix bool, hasPrivs bool) []string {
 	var chstrs []string
 	targetInvis := target.HasMode(modes.Invisible)
@@ -488,7 +582,8 @@ func (client *Client) getWhoisOf(target *Client, hasPrivs bool, rb *ResponseBuff
 	if client == target || oper.HasRoleCapab("samode") {
 		rb.Add(nil, client.server.name, RPL_WHOISMODES, cnick, tnick, fmt.Sprintf(client.t("is using modes +%s"), target.modes.String()))
 	}
-	if target.HasMode(modes.TLS) {
+	showSessionInfo := client == target || oper.HasRoleCapab("ban")
+	if target.HasMode(modes.TLS) && !showSessionInfo {
 		rb.Add(nil, client.server.name, RPL_WHOISSECURE, cnick, tnick, client.t("is using a secure connection"))
 	}
 	if targetInfo.accountName != "*" {
@@ -498,8 +593,13 @@ func (client *Client) getWhoisOf(target *Client, hasPrivs bool, rb *ResponseBuff
 		rb.Add(nil, client.server.name, RPL_WHOISBOT, cnick, tnick, fmt.Sprintf(ircfmt.Unescape(client.t("is a $bBot$b on %s")), client.server.Config().Network.Name))
 	}
 
-	if client == target || oper.HasRoleCapab("ban") {
+	if showSessionInfo {
 		for _, session := range target.Sessions() {
+			if session.tlsInfo != "" {
+				rb.Add(nil, client.server.name, RPL_WHOISSECURE, cnick, tnick, fmt.Sprintf(client.t("is using a secure connection (%s)"), session.tlsInfo))
+			} else if target.HasMode(modes.TLS) {
+				rb.Add(nil, client.server.name, RPL_WHOISSECURE, cnick, tnick, client.t("is using a secure connection"))
+			}
 			if session.certfp != "" {
 				rb.Add(nil, client.server.name, RPL_WHOISCERTFP, cnick, tnick, fmt.Sprintf(client.t("has client certificate fingerprint %s"), session.certfp))
 			}
@@ -509,6 +609,24 @@ func (client *Client) getWhoisOf(target *Client, hasPrivs bool, rb *ResponseBuff
 	if away, awayMessage := target.Away(); away {
 		rb.Add(nil, client.server.name, RPL_AWAY, cnick, tnick, awayMessage)
 	}
+	if client != target && target.HasMode(modes.Operator) && client.server.Config().Server.WhoisNotifications {
+		details := client.Details()
+		client.server.snomasks.SendTo(target, sno.LocalWhois, fmt.Sprintf(ircfmt.Unescape("%s$r (%s@%s) did a /WHOIS on you"), details.nick, details.username, details.hostname))
+	}
+}
+
+// backupDatastore snapshots the datastore while the server is running. If path
+// is empty, a timestamped file is created under server.output-path.
+func (server *Server) backupDatastore(path string) (string, error) {
+	if path == "" {
+		filename := fmt.Sprintf("ergo-backup-%s.db", time.Now().UTC().Format("20060102-150405"))
+		path = server.Config().getOutputPath(filename)
+	}
+	err := BackupDB(server.store, path)
+	if err == nil {
+		server.logger.Info("server", "Wrote datastore backup to", path)
+	}
+	return path, err
 }
 
 // rehash reloads the config and applies the changes from the config file.
@@ -704,6 +822,7 @@ func (server *Server) applyConfig(config *Config) (err error) {
 	}
 
 	server.setupPprofListener(config)
+	server.setupAdminConsole(config)
 
 	// set RPL_ISUPPORT
 	var newISupportReplies [][]string
@@ -757,6 +876,18 @@ func (server *Server) setupPprofListener(config *Config) {
 		}
 	}
 	if pprofListener != "" && server.pprofServer == nil {
+		// the pprof listener also serves expvar metrics at /debug/vars,
+		// the status page at /status, and the maintenance status at /maintenance:
+		publishMetricsOnce.Do(func() {
+			expvar.Publish("commands", expvar.Func(server.commandStats.ExpvarValue))
+			expvar.Publish("latency", expvar.Func(server.latencyExpvarValue))
+			expvar.Publish("lookup_cache", expvar.Func(server.lookupCacheExpvarValue))
+			expvar.Publish("connections", expvar.Func(server.connEvents.ExpvarValue))
+			expvar.Publish("tls_handshakes", expvar.Func(server.tlsStats.ExpvarValue))
+			expvar.Publish("diagnostics", expvar.Func(server.diagnostics.ExpvarValue))
+			http.HandleFunc("/status", server.serveStatusPage)
+			http.HandleFunc("/maintenance", server.serveMaintenanceStatus)
+		})
 		ps := http.Server{
 			Addr: pprofListener,
 		}
@@ -821,6 +952,9 @@ func (server *Server) setupListeners(config *Config) (err error) {
 		)
 	}
 
+	// keep TLS sessions resumable across rehashes:
+	server.ticketKeys.Apply(config)
+
 	// update or destroy all existing listeners
 	for addr := range server.listeners {
 		currentListener := server.listeners[addr]
@@ -897,15 +1031,21 @@ func (server *Server) GetHistorySequence(providedChannel *Channel, client *Clien
 			}
 		}
 	}
-	var joinTimeCutoff time.Time
+	var joinTimeCutoff, departedTime time.Time
 	if channel != nil {
 		if present, cutoff := channel.joinTimeCutoff(client); present {
 			joinTimeCutoff = cutoff
+		} else if membership, ok := server.accounts.departedMembership(client, channel); ok && client.AlwaysOn() {
+			// a former member can read what was sent while they were present
+			joinTimeCutoff, departedTime = membership.Joined, membership.Departed
 		} else {
 			err = errInsufficientPrivs
 			return
 		}
 		status, target, restriction = channel.historyStatus(config)
+		if !departedTime.IsZero() {
+			restriction = HistoryCutoffJoinTime
+		}
 		switch status {
 		case HistoryEphemeral:
 			hist = &channel.history
@@ -959,6 +1099,9 @@ func (server *Server) GetHistorySequence(providedChannel *Channel, client *Clien
 	} else if target != "" {
 		sequence = server.historyDB.MakeSequence(target, correspondent, cutoff)
 	}
+	if sequence != nil && !departedTime.IsZero() {
+		sequence = &departedSequence{Sequence: sequence, departed: departedTime}
+	}
 	return
 }
 
@@ -1032,36 +1175,112 @@ func (server *Server) DeleteMessage(target, msgid, accountName string) (err erro
 	return
 }
 
-func (server *Server) UnfoldName(cfname string) (name string) {
-	if strings.HasPrefix(cfname, "#") {
-		return server.channels.UnfoldName(cfname)
+// RedactMessage replaces a message in the history of a channel, or of a
+// conversation between `client` and `target`, by a tombstone. unless the
+// client is privileged (e.g., a channel operator), it must be the author.
+func (server *Server) RedactMessage(channel *Channel, client, target *Client, msgid, reason string, privileged bool) (err error) {
+	config := server.Config()
+	details := client.Details()
+	window := time.Duration(config.History.Redaction.Window)
+	// correspondent is the casefolded nick of the other party to the DM
+	// conversation, as recorded in the history buffer being searched,
+	// or "" for a channel or the history database
+	authorize := func(item *history.Item, correspondent string) error {
+		switch item.Type {
+		case history.Privmsg, history.Notice, history.Tagmsg:
+		default:
+			return errNoop
+		}
+		if channel == nil && !itemInConversation(item, correspondent, details.nickCasefolded, target.NickCasefolded()) {
+			return errNoop
+		}
+		if privileged {
+			return nil
+		}
+		if !(details.account != "" && item.AccountName == details.accountName) && item.Nick != details.nickMask {
+			return errRedactForbidden
+		}
+		if window != 0 && time.Since(item.Message.Time) > window {
+			return errRedactWindowExpired
+		}
+		return nil
 	}
-	return server.clients.UnfoldNick(cfname)
-}
 
-// elistMatcher takes and matches ELIST conditions
-type elistMatcher struct {
-	MinClientsActive bool
-	MinClients       int
-	MaxClientsActive bool
-	MaxClients       int
-}
-
-// Matches checks whether the given channel matches our matches.
-func (matcher *elistMatcher) Matches(channel *Channel) bool {
-	if matcher.MinClientsActive {
-		if len(channel.Members()) < matcher.MinClients {
-			return false
+	type redactionBuffer struct {
+		buffer        *history.Buffer
+		correspondent string
+	}
+	var buffers []redactionBuffer
+	var dbTargets []string
+	if channel != nil {
+		buffers = append(buffers, redactionBuffer{buffer: &channel.history})
+		if status, dbTarget, _ := channel.historyStatus(config); status == HistoryPersistent {
+			dbTargets = append(dbTargets, dbTarget)
+		}
+	} else {
+		// DMs are stored separately for the sender and the recipient
+		for _, pair := range [][2]*Client{{client, target}, {target, client}} {
+			participant, other := pair[0], pair[1]
+			buffers = append(buffers, redactionBuffer{buffer: &participant.history, correspondent: other.NickCasefolded()})
+			if status, dbTarget := participant.historyStatus(config); status == HistoryPersistent {
+				dbTargets = append(dbTargets, dbTarget)
+			}
 		}
 	}
 
-	if matcher.MaxClientsActive {
-		if len(channel.Members()) < len(channel.members) {
-			return false
+	var anyFound bool
+	for _, rBuffer := range buffers {
+		found, bErr := rBuffer.buffer.Redact(msgid, reason, func(item *history.Item) error {
+			return authorize(item, rBuffer.correspondent)
+		})
+		if bErr == errNoop {
+			continue // not part of this conversation; keep looking
+		} else if bErr != nil {
+			return bErr
+		}
+		anyFound = anyFound || found
+	}
+	for _, dbTarget := range dbTargets {
+		found, dbErr := server.historyDB.RedactMsgid(dbTarget, msgid, reason, func(item *history.Item) error {
+			return authorize(item, "")
+		})
+		if dbErr == errNoop {
+			continue
+		} else if dbErr != nil {
+			return dbErr
 		}
+		anyFound = anyFound || found
+	}
+	if !anyFound {
+		return errNoop
 	}
+	return nil
+}
 
-	return true
+// itemInConversation checks that a DM history item was exchanged between the
+// two (casefolded) nicks. in the ephemeral history buffers, the item records
+// the other party relative to the owner of the buffer; in the database, it
+// records the sender and the recipient instead.
+func itemInConversation(item *history.Item, correspondent, cfnick1, cfnick2 string) bool {
+	if correspondent != "" {
+		return item.CfCorrespondent == correspondent
+	}
+	sender, err := CasefoldName(NUHToNick(item.Nick))
+	if err != nil {
+		return false
+	}
+	recipient, err := CasefoldName(item.Params[0])
+	if err != nil {
+		return false
+	}
+	return (sender == cfnick1 && recipient == cfnick2) || (sender == cfnick2 && recipient == cfnick1)
+}
+
+func (server *Server) UnfoldName(cfname string) (name string) {
+	if strings.HasPrefix(cfname, "#") {
+		return server.channels.UnfoldName(cfname)
+	}
+	return server.clients.UnfoldNick(cfname)
 }
 
 var (
@@ -89,6 +89,13 @@ var (
 		Commands:       histservCommands,
 		HelpBanner:     histservHelp,
 	}
+	memoservService = &ircService{
+		Name:           "MemoServ",
+		ShortName:      "MS",
+		CommandAliases: []string{"MEMOSERV", "MS"},
+		Commands:       memoservCommands,
+		HelpBanner:     memoservHelp,
+	}
 )
 
 // all services, by lowercase name
@@ -97,6 +104,7 @@ var OragonoServices = map[string]*ircService{
 	"chanserv": chanservService,
 	"hostserv": hostservService,
 	"histserv": histservService,
+	"memoserv": memoservService,
 }
 
 func (service *ircService) Notice(rb *ResponseBuffer, text string) {
@@ -182,7 +190,7 @@ func serviceCTCPHandler(service *ircService, client *Client, message string) {
 		ctcpOut = time.Now().UTC().Format(time.RFC1123)
 	}
 
-	if ctcpOut != "" {
+	if ctcpOut != "" && client.server.autoReplies.Allow(autoReplyCTCP, "PRIVMSG", client.NickCasefolded(), service.prefix) {
 		client.Send(nil, service.prefix, "NOTICE", client.Nick(), fmt.Sprintf("\x01%s %s\x01", ctcpCmd, ctcpOut))
 	}
 }
@@ -0,0 +1,121 @@
+// Copyright (c) 2021 Shivaram Lingamneni <slingamn@cs.stanford.edu>
+// released under the MIT license
+
+package irc
+
+import (
+	"fmt"
+
+	"github.com/ergochat/irc-go/ircfmt"
+	"github.com/ergochat/irc-go/ircmsg"
+
+	"github.com/ergochat/ergo/irc/custime"
+	"github.com/ergochat/ergo/irc/sno"
+	"github.com/ergochat/ergo/irc/utils"
+)
+
+// a shun is a softer alternative to a KLINE: a shunned client stays connected,
+// but all of its commands are silently ignored, except for the ones it needs
+// to keep the connection alive or to leave. Since nothing visibly happens,
+// the client has no reason to reconnect and try to evade it.
+
+var shunExemptCommands = map[string]bool{
+	"PING": true,
+	"PONG": true,
+	"QUIT": true,
+}
+
+// isShunned returns whether `command` from `client` should be ignored
+func (server *Server) isShunned(client *Client, command string) bool {
+	if !client.registered || shunExemptCommands[command] || server.shuns.Empty() {
+		return false
+	}
+	if client.Oper() != nil {
+		return false
+	}
+	isShunned, _ := server.shuns.CheckMasks(client.AllNickmasks()...)
+	return isShunned
+}
+
+// SHUN [duration] <mask> [reason [| oper reason]]
+// SHUN LIST
+func shunHandler(server *Server, client *Client, msg ircmsg.Message, rb *ResponseBuffer) bool {
+	details := client.Details()
+
+	if len(msg.Params) == 1 && msg.Params[0] == "LIST" {
+		bans := server.shuns.AllBans()
+		if len(bans) == 0 {
+			rb.Notice(client.t("No SHUNs have been set!"))
+		}
+		for key, info := range bans {
+			rb.Notice(formatBanForListing(client, key, info))
+		}
+		return false
+	}
+
+	currentArg := 0
+	duration, err := custime.ParseDuration(msg.Params[currentArg])
+	if err != nil {
+		duration = 0
+	} else {
+		currentArg++
+	}
+
+	if len(msg.Params) < currentArg+1 {
+		rb.Add(nil, server.name, ERR_NEEDMOREPARAMS, details.nick, msg.Command, client.t("Not enough parameters"))
+		return false
+	}
+	mask, err := CanonicalizeMaskWildcard(msg.Params[currentArg])
+	if err == nil {
+		_, err = utils.CompileGlob(mask, false)
+	}
+	if err != nil {
+		rb.Add(nil, server.name, ERR_UNKNOWNERROR, details.nick, msg.Command, client.t("Erroneous nickname"))
+		return false
+	}
+	currentArg++
+
+	operName := client.Oper().Name
+	if operName == "" {
+		operName = server.name
+	}
+	reason, operReason := getReasonsFromParams(msg.Params, currentArg)
+
+	err = server.shuns.AddMask(mask, duration, reason, operReason, operName)
+	if err != nil {
+		rb.Notice(fmt.Sprintf(client.t("Could not successfully save new SHUN: %s"), err.Error()))
+		return false
+	}
+
+	var snoDescription string
+	if duration != 0 {
+		rb.Notice(fmt.Sprintf(client.t("Added temporary (%[1]s) SHUN for %[2]s"), duration.String(), mask))
+		snoDescription = fmt.Sprintf(ircfmt.Unescape("%s [%s]$r added temporary (%s) SHUN for %s"), details.nick, operName, duration.String(), mask)
+	} else {
+		rb.Notice(fmt.Sprintf(client.t("Added SHUN for %s"), mask))
+		snoDescription = fmt.Sprintf(ircfmt.Unescape("%s [%s]$r added SHUN for %s"), details.nick, operName, mask)
+	}
+	server.snomasks.Send(sno.LocalXline, snoDescription)
+	return false
+}
+
+// UNSHUN <mask>
+func unshunHandler(server *Server, client *Client, msg ircmsg.Message, rb *ResponseBuffer) bool {
+	details := client.Details()
+
+	mask, err := CanonicalizeMaskWildcard(msg.Params[0])
+	if err != nil {
+		rb.Add(nil, server.name, ERR_UNKNOWNERROR, details.nick, msg.Command, client.t("Erroneous nickname"))
+		return false
+	}
+
+	err = server.shuns.RemoveMask(mask)
+	if err != nil {
+		rb.Add(nil, server.name, ERR_UNKNOWNERROR, details.nick, msg.Command, fmt.Sprintf(client.t("Could not remove SHUN [%s]"), err.Error()))
+		return false
+	}
+
+	rb.Notice(fmt.Sprintf(client.t("Removed SHUN for %s"), mask))
+	server.snomasks.Send(sno.LocalXline, fmt.Sprintf(ircfmt.Unescape("%s$r removed SHUN for %s"), details.nick, mask))
+	return false
+}
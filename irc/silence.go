@@ -0,0 +1,94 @@
+// Copyright (c) 2021 Shivaram Lingamneni <slingamn@cs.stanford.edu>
+// released under the MIT license
+
+package irc
+
+import (
+	"github.com/ergochat/ergo/irc/utils"
+)
+
+// SILENCE is a server-side ignore list of nick!user@host masks; direct
+// messages and invites from matching users are silently dropped. for a
+// logged-in client, the list is stored in the account settings, so it applies
+// to every session (and every client logged into the account) and survives
+// reconnection. clients that aren't logged in have a transient list of their own.
+
+// setSilenceNoMutex replaces the silence list; the caller must hold stateMutex
+func (client *Client) setSilenceNoMutex(masks []string) {
+	client.silenceMasks = masks
+	client.silenceRegexp = nil
+	if len(masks) != 0 {
+		client.silenceRegexp, _ = utils.CompileMasks(masks)
+	}
+}
+
+// SilenceList returns the client's silence masks.
+func (client *Client) SilenceList() (result []string) {
+	client.stateMutex.RLock()
+	defer client.stateMutex.RUnlock()
+	result = make([]string, len(client.silenceMasks))
+	copy(result, client.silenceMasks)
+	return
+}
+
+// isSilencing returns whether the client is ignoring the sender
+func (client *Client) isSilencing(sender *Client) bool {
+	client.stateMutex.RLock()
+	silenceRegexp := client.silenceRegexp
+	client.stateMutex.RUnlock()
+	if silenceRegexp == nil {
+		return false
+	}
+	return silenceRegexp.MatchString(sender.NickMaskCasefolded())
+}
+
+// modifySilenceList adds a mask to, or removes it from, the client's silence
+// list, returning the canonicalized mask
+func (server *Server) modifySilenceList(client *Client, mask string, add bool) (canonical string, err error) {
+	canonical, err = CanonicalizeMaskWildcard(mask)
+	if err != nil {
+		return "", errInvalidParams
+	}
+	maxEntries := server.Config().Limits.SilenceEntries
+
+	modify := func(masks []string) (result []string, err error) {
+		present := stringSliceContains(masks, canonical)
+		if add {
+			if present {
+				return nil, errNoop
+			}
+			if maxEntries <= len(masks) {
+				return nil, errLimitExceeded
+			}
+			result = make([]string, len(masks), len(masks)+1)
+			copy(result, masks)
+			return append(result, canonical), nil
+		}
+		if !present {
+			return nil, errNoop
+		}
+		for _, existing := range masks {
+			if existing != canonical {
+				result = append(result, existing)
+			}
+		}
+		return result, nil
+	}
+
+	if account := client.Account(); account != "" {
+		_, err = server.accounts.ModifyAccountSettings(account, func(settings AccountSettings) (AccountSettings, error) {
+			newMasks, err := modify(settings.Silence)
+			settings.Silence = newMasks
+			return settings, err
+		})
+		return
+	}
+
+	client.stateMutex.Lock()
+	defer client.stateMutex.Unlock()
+	newMasks, err := modify(client.silenceMasks)
+	if err == nil {
+		client.setSilenceNoMutex(newMasks)
+	}
+	return
+}
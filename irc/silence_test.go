@@ -0,0 +1,27 @@
+// Copyright (c) 2021 Shivaram Lingamneni <slingamn@cs.stanford.edu>
+// released under the MIT license
+
+package irc
+
+import (
+	"testing"
+)
+
+func TestIsSilencing(t *testing.T) {
+	alice, _ := makeTestClient()
+	bob, _ := makeTestClient()
+	bob.nickMaskCasefolded = "bob!~u@spam.example.com"
+	assertEqual(alice.isSilencing(bob), false, t)
+
+	mask, err := CanonicalizeMaskWildcard("*@*.example.com")
+	assertEqual(err, nil, t)
+	alice.setSilenceNoMutex([]string{mask})
+	assertEqual(alice.isSilencing(bob), true, t)
+
+	bob.nickMaskCasefolded = "bob!~u@example.org"
+	assertEqual(alice.isSilencing(bob), false, t)
+
+	alice.setSilenceNoMutex(nil)
+	bob.nickMaskCasefolded = "bob!~u@spam.example.com"
+	assertEqual(alice.isSilencing(bob), false, t)
+}
@@ -14,6 +14,7 @@ const (
 	LocalAnnouncements Mask = 'a'
 	LocalConnects      Mask = 'c'
 	LocalDisconnects   Mask = 'd'
+	LocalConnEvents    Mask = 'e'
 	LocalChannels      Mask = 'j'
 	LocalKills         Mask = 'k'
 	LocalNicks         Mask = 'n'
@@ -22,6 +23,7 @@ const (
 	Stats              Mask = 't'
 	LocalAccounts      Mask = 'u'
 	LocalVhosts        Mask = 'v'
+	LocalWhois         Mask = 'w'
 	LocalXline         Mask = 'x'
 )
 
@@ -31,6 +33,7 @@ var (
 		LocalAnnouncements: "ANNOUNCEMENT",
 		LocalConnects:      "CONNECT",
 		LocalDisconnects:   "DISCONNECT",
+		LocalConnEvents:    "CONNEVENT",
 		LocalChannels:      "CHANNEL",
 		LocalKills:         "KILL",
 		LocalNicks:         "NICK",
@@ -40,6 +43,7 @@ var (
 		LocalAccounts:      "ACCOUNT",
 		LocalXline:         "XLINE",
 		LocalVhosts:        "VHOST",
+		LocalWhois:         "WHOIS",
 	}
 
 	// ValidMasks contains the snomasks that we support.
@@ -47,6 +51,7 @@ var (
 		LocalAnnouncements,
 		LocalConnects,
 		LocalDisconnects,
+		LocalConnEvents,
 		LocalChannels,
 		LocalKills,
 		LocalNicks,
@@ -55,6 +60,12 @@ var (
 		Stats,
 		LocalAccounts,
 		LocalVhosts,
+		LocalWhois,
 		LocalXline,
 	}
+
+	// OptInMasks are too noisy to be included in `*`, and must be set explicitly.
+	OptInMasks = Masks{
+		LocalConnEvents,
+	}
 )
@@ -41,7 +41,7 @@ func (masks Masks) Sort() {
 
 // Evaluate changes to snomasks made with MODE. There are several cases:
 // adding snomasks with `/mode +s a` or `/mode +s +a`, removing them with `/mode +s -a`,
-// adding all with `/mode +s *` or `/mode +s +*`, removing all with `/mode +s -*` or `/mode -s`
+// adding all (except OptInMasks) with `/mode +s *` or `/mode +s +*`, removing all with `/mode +s -*` or `/mode -s`
 func EvaluateSnomaskChanges(add bool, arg string, currentMasks Masks) (addMasks, removeMasks Masks, newArg string) {
 	if add {
 		if len(arg) == 0 {
@@ -60,7 +60,7 @@ func EvaluateSnomaskChanges(add bool, arg string, currentMasks Masks) (addMasks,
 		if strings.IndexByte(arg, '*') != -1 {
 			if add {
 				for _, mask := range ValidMasks {
-					if !currentMasks.Contains(mask) {
+					if !currentMasks.Contains(mask) && !OptInMasks.Contains(mask) {
 						addMasks = append(addMasks, mask)
 					}
 				}
@@ -17,14 +17,20 @@ func assertEqual(supplied, expected interface{}, t *testing.T) {
 
 func TestEvaluateSnomaskChanges(t *testing.T) {
 	add, remove, newArg := EvaluateSnomaskChanges(true, "*", nil)
-	assertEqual(add, Masks{'a', 'c', 'd', 'j', 'k', 'n', 'o', 'q', 't', 'u', 'v', 'x'}, t)
+	assertEqual(add, Masks{'a', 'c', 'd', 'j', 'k', 'n', 'o', 'q', 't', 'u', 'v', 'w', 'x'}, t)
 	assertEqual(len(remove), 0, t)
-	assertEqual(newArg, "+acdjknoqtuvx", t)
+	assertEqual(newArg, "+acdjknoqtuvwx", t)
 
 	add, remove, newArg = EvaluateSnomaskChanges(true, "*", Masks{'a', 'u'})
-	assertEqual(add, Masks{'c', 'd', 'j', 'k', 'n', 'o', 'q', 't', 'v', 'x'}, t)
+	assertEqual(add, Masks{'c', 'd', 'j', 'k', 'n', 'o', 'q', 't', 'v', 'w', 'x'}, t)
 	assertEqual(len(remove), 0, t)
-	assertEqual(newArg, "+cdjknoqtvx", t)
+	assertEqual(newArg, "+cdjknoqtvwx", t)
+
+	// opt-in masks must be set explicitly:
+	add, remove, newArg = EvaluateSnomaskChanges(true, "+e", Masks{'a', 'u'})
+	assertEqual(add, Masks{'e'}, t)
+	assertEqual(len(remove), 0, t)
+	assertEqual(newArg, "+e", t)
 
 	add, remove, newArg = EvaluateSnomaskChanges(true, "-a", Masks{'a', 'u'})
 	assertEqual(len(add), 0, t)
@@ -96,6 +96,23 @@ func (m *SnoManager) Send(mask sno.Mask, content string) {
 	}
 }
 
+// SendTo sends the given snomask to a single client, if they are signed up for it.
+func (m *SnoManager) SendTo(client *Client, mask sno.Mask, content string) {
+	m.sendListMutex.RLock()
+	subscribed := m.sendLists[mask][client]
+	m.sendListMutex.RUnlock()
+
+	if !subscribed {
+		return
+	}
+
+	name := sno.NoticeMaskNames[mask]
+	if name == "" {
+		name = string(mask)
+	}
+	client.Notice(fmt.Sprintf(ircfmt.Unescape("$c[grey]-$r%s$c[grey]-$c %s"), name, content))
+}
+
 // MasksEnabled returns the snomasks currently enabled.
 func (m *SnoManager) MasksEnabled(client *Client) (result sno.Masks) {
 	m.sendListMutex.RLock()
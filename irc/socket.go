@@ -18,6 +18,12 @@ var (
 	sendQExceededMessage = []byte("\r\nERROR :SendQ Exceeded\r\n")
 )
 
+const (
+	// the normal lane is written in chunks of at most this many lines,
+	// so that priority lines never wait behind an entire large burst
+	maxLinesPerWrite = 32
+)
+
 // Socket represents an IRC socket.
 type Socket struct {
 	sync.Mutex
@@ -29,12 +35,15 @@ type Socket struct {
 	// this is a trylock enforcing that only one goroutine can write to `conn` at a time
 	writerSemaphore utils.Semaphore
 
-	buffers       [][]byte
-	totalLength   int
-	closed        bool
-	sendQExceeded bool
-	finalData     []byte // what to send when we die
-	finalized     bool
+	// outgoing lines are queued in two lanes; the priority lane (PING, PONG)
+	// is always written before the normal lane (everything else)
+	priorityBuffers [][]byte
+	buffers         [][]byte
+	totalLength     int
+	closed          bool
+	sendQExceeded   bool
+	finalData       []byte // what to send when we die
+	finalized       bool
 }
 
 // NewSocket returns a new Socket.
@@ -56,6 +65,21 @@ func (socket *Socket) Close() {
 	socket.wakeWriter()
 }
 
+// SendQLength returns the number of bytes currently queued for writing.
+func (socket *Socket) SendQLength() (length int) {
+	socket.Lock()
+	length = socket.totalLength
+	socket.Unlock()
+	return
+}
+
+// SetMaxSendQ changes the sendq limit, e.g., when the connection class changes.
+func (socket *Socket) SetMaxSendQ(maxSendQBytes int) {
+	socket.Lock()
+	socket.maxSendQBytes = maxSendQBytes
+	socket.Unlock()
+}
+
 // Read returns a single IRC line from a Socket.
 func (socket *Socket) Read() (string, error) {
 	// immediately fail if Close() has been called, even if there's
@@ -80,6 +104,18 @@ func (socket *Socket) Read() (string, error) {
 // 3. MUST provide mutual exclusion for socket.conn.Write
 // 4. SHOULD NOT tie up additional goroutines, beyond the one blocked on socket.conn.Write
 func (socket *Socket) Write(data []byte) (err error) {
+	return socket.write(data, false)
+}
+
+// WritePriority is like Write, except that the data is queued in the priority
+// lane, ahead of everything in the normal lane that hasn't been written yet.
+// (This relaxes requirement 2 of Write: it must only be used for lines whose
+// ordering relative to other lines doesn't matter.)
+func (socket *Socket) WritePriority(data []byte) (err error) {
+	return socket.write(data, true)
+}
+
+func (socket *Socket) write(data []byte, priority bool) (err error) {
 	if len(data) == 0 {
 		return
 	}
@@ -94,7 +130,11 @@ func (socket *Socket) Write(data []byte) (err error) {
 			socket.closed = true
 			err = errSendQExceeded
 		} else {
-			socket.buffers = append(socket.buffers, data)
+			if priority {
+				socket.priorityBuffers = append(socket.priorityBuffers, data)
+			} else {
+				socket.buffers = append(socket.buffers, data)
+			}
 			socket.totalLength = prospectiveLen
 		}
 	}
@@ -105,12 +145,13 @@ func (socket *Socket) Write(data []byte) (err error) {
 }
 
 // BlockingWrite sends the given string out of Socket. Requirements:
-// 1. MUST block until the message is sent
-// 2. MUST bypass sendq (calls to BlockingWrite cannot, on their own, cause a sendq overflow)
-// 3. MUST provide mutual exclusion for socket.conn.Write
-// 4. MUST respect the same ordering guarantees as Write (i.e., if a call to Write that sends
-//    message m1 happens-before a call to BlockingWrite that sends message m2,
-//    m1 must be sent on the wire before m2
+//  1. MUST block until the message is sent
+//  2. MUST bypass sendq (calls to BlockingWrite cannot, on their own, cause a sendq overflow)
+//  3. MUST provide mutual exclusion for socket.conn.Write
+//  4. MUST respect the same ordering guarantees as Write (i.e., if a call to Write that sends
+//     message m1 happens-before a call to BlockingWrite that sends message m2,
+//     m1 must be sent on the wire before m2
+//
 // Callers MUST be writing to the client's socket from the client's own goroutine;
 // other callers must use the nonblocking Write call instead. Otherwise, a client
 // with a slow/unreliable connection risks stalling the progress of the system as a whole.
@@ -198,24 +239,48 @@ func (socket *Socket) send() {
 // write the contents of the buffer, then see if we need to close
 // returns whether we closed
 func (socket *Socket) performWrite() (closed bool) {
-	// retrieve the buffered data, clear the buffer
-	socket.Lock()
-	buffers := socket.buffers
-	socket.buffers = nil
-	socket.totalLength = 0
-	closed = socket.closed
-	socket.Unlock()
+	for {
+		// retrieve the buffered data: all of the priority lane, then a chunk of
+		// the normal lane. priority lines queued while we write the chunk will
+		// be written before the rest of the normal lane.
+		socket.Lock()
+		buffers := socket.priorityBuffers
+		socket.priorityBuffers = nil
+		closed = socket.closed
+		normal := socket.buffers
+		if maxLinesPerWrite < len(normal) {
+			normal = normal[:maxLinesPerWrite]
+			socket.buffers = socket.buffers[maxLinesPerWrite:]
+		} else {
+			socket.buffers = nil
+		}
+		buffers = append(buffers, normal...)
+		more := len(socket.buffers) != 0
+		if more {
+			for _, line := range buffers {
+				socket.totalLength -= len(line)
+			}
+		} else {
+			socket.totalLength = 0
+		}
+		socket.Unlock()
 
-	var err error
-	if 0 < len(buffers) {
-		err = socket.conn.WriteLines(buffers)
-	}
+		var err error
+		if 0 < len(buffers) {
+			err = socket.conn.WriteLines(buffers)
+		}
 
-	closed = closed || err != nil
-	if closed {
-		socket.finalize()
+		// if we're disconnecting, everything queued is written before the final
+		// data (QUIT and ERROR), so that the client sees all the output that
+		// preceded it
+		if err != nil || (closed && !more) {
+			socket.finalize()
+			return true
+		}
+		if !more {
+			return
+		}
 	}
-	return
 }
 
 // mark closed and send final data. you must be holding the semaphore to call this:
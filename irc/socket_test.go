@@ -0,0 +1,103 @@
+// Copyright (c) 2021 Shivaram Lingamneni <slingamn@cs.stanford.edu>
+// released under the MIT license
+
+package irc
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/ergochat/ergo/irc/utils"
+)
+
+// fakeConn records the batches of lines written to it
+type fakeConn struct {
+	writes  [][]string
+	onWrite func()
+	closed  bool
+}
+
+func (c *fakeConn) UnderlyingConn() *utils.WrappedConn { return nil }
+func (c *fakeConn) ReadLine() ([]byte, error)          { return nil, nil }
+func (c *fakeConn) Close() error                       { c.closed = true; return nil }
+
+func (c *fakeConn) WriteLine(line []byte) error {
+	return c.WriteLines([][]byte{line})
+}
+
+func (c *fakeConn) WriteLines(lines [][]byte) error {
+	var batch []string
+	for _, line := range lines {
+		batch = append(batch, string(line))
+	}
+	c.writes = append(c.writes, batch)
+	if c.onWrite != nil {
+		onWrite := c.onWrite
+		c.onWrite = nil
+		onWrite()
+	}
+	return nil
+}
+
+func newTestSocket(conn *fakeConn) *Socket {
+	socket := NewSocket(conn, 1<<20)
+	// hold the trylock so that writes are queued but not written
+	// until the test calls performWrite
+	socket.writerSemaphore.Acquire()
+	return socket
+}
+
+func TestSocketPriorityLane(t *testing.T) {
+	conn := new(fakeConn)
+	socket := newTestSocket(conn)
+
+	for i := 0; i < maxLinesPerWrite+10; i++ {
+		socket.Write([]byte(fmt.Sprintf("line %d", i)))
+	}
+	socket.WritePriority([]byte("PONG 1"))
+	// queued during the first write, so it must precede the second chunk
+	conn.onWrite = func() { socket.WritePriority([]byte("PONG 2")) }
+
+	closed := socket.performWrite()
+	assertEqual(closed, false, t)
+	assertEqual(len(conn.writes), 2, t)
+	assertEqual(len(conn.writes[0]), maxLinesPerWrite+1, t)
+	assertEqual(conn.writes[0][0], "PONG 1", t)
+	assertEqual(conn.writes[0][1], "line 0", t)
+	assertEqual(len(conn.writes[1]), 11, t)
+	assertEqual(conn.writes[1][0], "PONG 2", t)
+	assertEqual(conn.writes[1][1], fmt.Sprintf("line %d", maxLinesPerWrite), t)
+	assertEqual(socket.SendQLength(), 0, t)
+}
+
+func TestSocketCloseFlushesQueue(t *testing.T) {
+	conn := new(fakeConn)
+	socket := newTestSocket(conn)
+	socket.SetFinalData([]byte("ERROR :bye"))
+	socket.Write([]byte("FAIL * ACCOUNT_REQUIRED"))
+	socket.Close()
+	socket.performWrite()
+	assertEqual(conn.writes, [][]string{{"FAIL * ACCOUNT_REQUIRED"}, {"ERROR :bye"}}, t)
+	assertEqual(conn.closed, true, t)
+
+	// a burst larger than a single write is still flushed in full,
+	// in chunks, before the final data
+	conn = new(fakeConn)
+	socket = newTestSocket(conn)
+	socket.SetFinalData([]byte("ERROR :bye"))
+	for i := 0; i < 2*maxLinesPerWrite+1; i++ {
+		socket.Write([]byte(fmt.Sprintf("history %d", i)))
+	}
+	socket.Close()
+	socket.performWrite()
+	var written []string
+	for _, batch := range conn.writes {
+		written = append(written, batch...)
+	}
+	assertEqual(len(written), 2*maxLinesPerWrite+2, t)
+	assertEqual(written[0], "history 0", t)
+	assertEqual(written[2*maxLinesPerWrite], fmt.Sprintf("history %d", 2*maxLinesPerWrite), t)
+	assertEqual(written[2*maxLinesPerWrite+1], "ERROR :bye", t)
+	assertEqual(len(conn.writes[0]), maxLinesPerWrite, t)
+	assertEqual(conn.closed, true, t)
+}
@@ -0,0 +1,95 @@
+// Copyright (c) 2021 Shivaram Lingamneni <slingamn@cs.stanford.edu>
+// released under the MIT license
+
+package irc
+
+import (
+	"html/template"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/ergochat/ergo/irc/modes"
+)
+
+// the status page is a public summary of the network, served at /status
+// on the pprof listener if `debug.status-page` is enabled.
+
+type statusPageChannel struct {
+	Name    string
+	Members int
+	Topic   string
+}
+
+type statusPageData struct {
+	Network    string
+	Server     string
+	Version    string
+	Uptime     time.Duration
+	Users      int
+	MaxUsers   int
+	Operators  int
+	NumChannel int
+	Channels   []statusPageChannel
+}
+
+var statusPageTemplate = template.Must(template.New("status").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Network}} status</title>
+</head>
+<body>
+<h1>{{.Network}}</h1>
+<p>{{.Server}} running {{.Version}}, up {{.Uptime}}</p>
+<p>{{.Users}} users online (maximum {{.MaxUsers}}), {{.Operators}} operators, {{.NumChannel}} channels</p>
+<table>
+<tr><th>Channel</th><th>Users</th><th>Topic</th></tr>
+{{range .Channels}}<tr><td>{{.Name}}</td><td>{{.Members}}</td><td>{{.Topic}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+func (server *Server) serveStatusPage(w http.ResponseWriter, r *http.Request) {
+	config := server.Config()
+	if !config.Debug.StatusPage {
+		http.NotFound(w, r)
+		return
+	}
+
+	stats := server.stats.GetValues()
+	data := statusPageData{
+		Network:   config.Network.Name,
+		Server:    server.name,
+		Version:   Ver,
+		Uptime:    time.Since(server.ctime).Truncate(time.Second),
+		Users:     stats.Total,
+		MaxUsers:  stats.Max,
+		Operators: stats.Operators,
+	}
+	for _, channel := range server.channels.Channels() {
+		// this page is public, so secret channels are hidden (and not counted)
+		if channel.flags.HasMode(modes.Secret) {
+			continue
+		}
+		data.NumChannel++
+		members, name, topic := channel.listData()
+		data.Channels = append(data.Channels, statusPageChannel{
+			Name:    name,
+			Members: members,
+			Topic:   topic,
+		})
+	}
+	sort.Slice(data.Channels, func(i, j int) bool {
+		if data.Channels[i].Members != data.Channels[j].Members {
+			return data.Channels[i].Members > data.Channels[j].Members
+		}
+		return data.Channels[i].Name < data.Channels[j].Name
+	})
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := statusPageTemplate.Execute(w, data); err != nil {
+		server.logger.Error("internal", "couldn't render status page", err.Error())
+	}
+}
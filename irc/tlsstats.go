@@ -0,0 +1,126 @@
+// Copyright (c) 2021 Shivaram Lingamneni <slingamn@cs.stanford.edu>
+// released under the MIT license
+
+package irc
+
+import (
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// handshake latencies share the buckets of the command latency histogram
+// (see cmdstats.go); a full TLS handshake typically lands in the 10-100ms
+// bucket, a resumed one well below it.
+
+const (
+	tlsFailureTimeout  = "timeout"
+	tlsFailureEOF      = "eof"
+	tlsFailureNotTLS   = "not-tls"
+	tlsFailureProtocol = "protocol-error"
+)
+
+// TLSHandshakeMetrics is a snapshot of the TLS handshake counters.
+type TLSHandshakeMetrics struct {
+	Full      uint64
+	Resumed   uint64
+	TotalTime time.Duration
+	Histogram []uint64 // len(commandLatencyBuckets) + 1 buckets
+	Failures  map[string]uint64
+}
+
+// TLSStats tracks the outcomes and latencies of TLS handshakes.
+type TLSStats struct {
+	sync.Mutex
+	metrics TLSHandshakeMetrics
+}
+
+func (ts *TLSStats) Initialize() {
+	ts.Lock()
+	defer ts.Unlock()
+	ts.metrics = TLSHandshakeMetrics{
+		Histogram: make([]uint64, len(commandLatencyBuckets)+1),
+		Failures:  make(map[string]uint64),
+	}
+}
+
+// Record records the result of a single handshake on conn.
+func (ts *TLSStats) Record(conn *tls.Conn, elapsed time.Duration, err error) {
+	var resumed bool
+	if err == nil {
+		resumed = conn.ConnectionState().DidResume
+	}
+
+	ts.Lock()
+	defer ts.Unlock()
+	if err != nil {
+		ts.metrics.Failures[tlsFailureReason(err)]++
+		return
+	}
+	if resumed {
+		ts.metrics.Resumed++
+	} else {
+		ts.metrics.Full++
+	}
+	ts.metrics.TotalTime += elapsed
+	ts.metrics.Histogram[latencyBucket(elapsed)]++
+}
+
+func tlsFailureReason(err error) string {
+	var netErr net.Error
+	var recordErr tls.RecordHeaderError
+	switch {
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return tlsFailureTimeout
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return tlsFailureEOF
+	case errors.As(err, &recordErr):
+		// e.g., a plaintext client connecting to a TLS port
+		return tlsFailureNotTLS
+	default:
+		return tlsFailureProtocol
+	}
+}
+
+// Snapshot returns a copy of the current counters.
+func (ts *TLSStats) Snapshot() (result TLSHandshakeMetrics) {
+	ts.Lock()
+	defer ts.Unlock()
+	result = ts.metrics
+	result.Histogram = make([]uint64, len(ts.metrics.Histogram))
+	copy(result.Histogram, ts.metrics.Histogram)
+	result.Failures = make(map[string]uint64, len(ts.metrics.Failures))
+	for reason, count := range ts.metrics.Failures {
+		result.Failures[reason] = count
+	}
+	return
+}
+
+// MeanLatency returns the mean duration of the successful handshakes.
+func (m *TLSHandshakeMetrics) MeanLatency() time.Duration {
+	total := m.Full + m.Resumed
+	if total == 0 {
+		return 0
+	}
+	return m.TotalTime / time.Duration(total)
+}
+
+// ExpvarValue is the JSON-serializable representation of the metrics,
+// exported via expvar on the pprof listener.
+func (ts *TLSStats) ExpvarValue() interface{} {
+	metrics := ts.Snapshot()
+	latency := make(map[string]uint64, len(metrics.Histogram))
+	for i, count := range metrics.Histogram {
+		latency[latencyBucketName(i)] = count
+	}
+	return map[string]interface{}{
+		"full":          metrics.Full,
+		"resumed":       metrics.Resumed,
+		"total_seconds": metrics.TotalTime.Seconds(),
+		"latency":       latency,
+		"failures":      metrics.Failures,
+	}
+}
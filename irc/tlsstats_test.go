@@ -0,0 +1,36 @@
+// Copyright (c) 2021 Shivaram Lingamneni <slingamn@cs.stanford.edu>
+// released under the MIT license
+
+package irc
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"testing"
+)
+
+func TestTLSFailureReason(t *testing.T) {
+	assertEqual(tlsFailureReason(os.ErrDeadlineExceeded), tlsFailureTimeout, t)
+	assertEqual(tlsFailureReason(io.EOF), tlsFailureEOF, t)
+	assertEqual(tlsFailureReason(fmt.Errorf("read: %w", io.ErrUnexpectedEOF)), tlsFailureEOF, t)
+	assertEqual(tlsFailureReason(tls.RecordHeaderError{Msg: "first record does not look like a TLS handshake"}), tlsFailureNotTLS, t)
+	assertEqual(tlsFailureReason(errors.New("tls: no cipher suite supported by both client and server")), tlsFailureProtocol, t)
+}
+
+func TestSessionTicketKeyRotation(t *testing.T) {
+	var tk SessionTicketKeys
+	tk.Initialize()
+	first := tk.keys[0]
+	for i := 0; i < 2*maxTicketKeys; i++ {
+		tk.Rotate()
+	}
+	assertEqual(len(tk.keys), maxTicketKeys, t)
+	for _, key := range tk.keys {
+		if key == first {
+			t.Error("the oldest key should have been retired")
+		}
+	}
+}
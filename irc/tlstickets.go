@@ -0,0 +1,85 @@
+// Copyright (c) 2021 Shivaram Lingamneni <slingamn@cs.stanford.edu>
+// released under the MIT license
+
+package irc
+
+import (
+	"crypto/rand"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// TLS session resumption lets reconnecting clients skip the full handshake.
+// crypto/tls generates session ticket keys per tls.Config, so every rehash
+// (which reloads the listener configs) would invalidate all outstanding
+// tickets; instead, the server owns the keys and installs them on each new
+// config. Keys are rotated periodically, and retired keys are kept for a
+// while so that tickets issued under them can still be redeemed.
+
+const (
+	ticketKeyRotationPeriod = 24 * time.Hour
+	// the current key plus the ones it replaced, i.e., tickets remain valid
+	// for between 6 and 7 rotation periods:
+	maxTicketKeys = 7
+)
+
+type SessionTicketKeys struct {
+	sync.Mutex
+	keys [][32]byte // keys[0] is used to issue new tickets
+}
+
+func (tk *SessionTicketKeys) Initialize() {
+	tk.Lock()
+	defer tk.Unlock()
+	tk.keys = nil
+	tk.rotate()
+}
+
+func (tk *SessionTicketKeys) rotate() {
+	var key [32]byte
+	if _, err := rand.Read(key[:]); err != nil {
+		panic(err)
+	}
+	tk.keys = append([][32]byte{key}, tk.keys...)
+	if len(tk.keys) > maxTicketKeys {
+		tk.keys = tk.keys[:maxTicketKeys]
+	}
+}
+
+// Rotate generates a new key for issuing tickets, retiring the oldest one.
+func (tk *SessionTicketKeys) Rotate() {
+	tk.Lock()
+	defer tk.Unlock()
+	tk.rotate()
+}
+
+// Apply installs the current keys on the TLS configs of all the listeners.
+func (tk *SessionTicketKeys) Apply(config *Config) {
+	tk.Lock()
+	keys := make([][32]byte, len(tk.keys))
+	copy(keys, tk.keys)
+	tk.Unlock()
+
+	for _, listenerConfig := range config.Server.trueListeners {
+		// this is safe to call on a config that is already serving connections
+		if listenerConfig.TLSConfig != nil {
+			listenerConfig.TLSConfig.SetSessionTicketKeys(keys)
+		}
+	}
+}
+
+func (server *Server) handleTicketKeyRotation() {
+	defer func() {
+		if r := recover(); r != nil {
+			server.logger.Error("internal",
+				fmt.Sprintf("Panic in session ticket key rotation: %v\n%s", r, debug.Stack()))
+		}
+		// either way, reschedule
+		time.AfterFunc(ticketKeyRotationPeriod, server.handleTicketKeyRotation)
+	}()
+
+	server.ticketKeys.Rotate()
+	server.ticketKeys.Apply(server.Config())
+}
@@ -0,0 +1,103 @@
+// Copyright (c) 2021 Shivaram Lingamneni <slingamn@cs.stanford.edu>
+// released under the MIT license
+
+package irc
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ergochat/ergo/irc/modes"
+)
+
+// registered channels remember the topics that were replaced, up to
+// channels.registration.topic-history-length of them, so that an
+// accidental overwrite can be reverted with CS TOPIC RESTORE.
+
+type TopicHistoryEntry struct {
+	Topic string
+	SetBy string
+	SetAt time.Time
+}
+
+// recordTopicReplacementNoMutex saves the current topic to the history,
+// ahead of its replacement; the caller must hold stateMutex
+func (channel *Channel) recordTopicReplacementNoMutex(maxLength int) {
+	if channel.registeredFounder == "" || channel.topic == "" || maxLength <= 0 {
+		return
+	}
+	entry := TopicHistoryEntry{
+		Topic: channel.topic,
+		SetBy: channel.topicSetBy,
+		SetAt: channel.topicSetTime,
+	}
+	// newest first
+	channel.topicHistory = append([]TopicHistoryEntry{entry}, channel.topicHistory...)
+	if len(channel.topicHistory) > maxLength {
+		channel.topicHistory = channel.topicHistory[:maxLength]
+	}
+}
+
+// TopicHistory returns the replaced topics of the channel, newest first.
+func (channel *Channel) TopicHistory() (result []TopicHistoryEntry) {
+	channel.stateMutex.RLock()
+	defer channel.stateMutex.RUnlock()
+	result = make([]TopicHistoryEntry, len(channel.topicHistory))
+	copy(result, channel.topicHistory)
+	return
+}
+
+func csTopicHandler(service *ircService, server *Server, client *Client, command string, params []string, rb *ResponseBuffer) {
+	channel := server.channels.Get(params[0])
+	if channel == nil {
+		service.Notice(rb, client.t("No such channel"))
+		return
+	}
+	if channel.Founder() == "" {
+		service.Notice(rb, client.t("That channel is not registered"))
+		return
+	}
+	isOper := client.HasRoleCapabs("chanreg")
+
+	switch strings.ToLower(params[1]) {
+	case "history":
+		if !(isOper || channel.hasClient(client)) {
+			service.Notice(rb, client.t("You're not on that channel"))
+			return
+		}
+		entries := channel.TopicHistory()
+		if len(entries) == 0 {
+			service.Notice(rb, fmt.Sprintf(client.t("Channel %s has no topic history"), channel.Name()))
+			return
+		}
+		service.Notice(rb, fmt.Sprintf(client.t("Previous topics of %s, newest first:"), channel.Name()))
+		for i, entry := range entries {
+			service.Notice(rb, fmt.Sprintf(client.t("%[1]d. set by %[2]s at %[3]s: %[4]s"), i+1, entry.SetBy, entry.SetAt.Format(time.RFC1123), entry.Topic))
+		}
+	case "restore":
+		if !(isOper || channel.ClientIsAtLeast(client, modes.ChannelOperator)) {
+			service.Notice(rb, client.t("Insufficient privileges"))
+			return
+		}
+		entries := channel.TopicHistory()
+		index := 1
+		if len(params) > 2 {
+			var err error
+			index, err = strconv.Atoi(params[2])
+			if err != nil {
+				index = 0
+			}
+		}
+		if index < 1 || len(entries) < index {
+			service.Notice(rb, client.t("Invalid parameters"))
+			return
+		}
+		topic := entries[index-1].Topic
+		channel.applyTopic(client, topic, nil)
+		service.Notice(rb, fmt.Sprintf(client.t("Restored the topic of %[1]s to: %[2]s"), channel.Name(), topic))
+	default:
+		service.Notice(rb, client.t("Invalid parameters"))
+	}
+}
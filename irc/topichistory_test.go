@@ -0,0 +1,28 @@
+// Copyright (c) 2021 Shivaram Lingamneni <slingamn@cs.stanford.edu>
+// released under the MIT license
+
+package irc
+
+import (
+	"testing"
+)
+
+func TestRecordTopicReplacement(t *testing.T) {
+	channel := makeTestChannel()
+	channel.topic = "first"
+	// unregistered channels have no history
+	channel.recordTopicReplacementNoMutex(2)
+	assertEqual(len(channel.TopicHistory()), 0, t)
+
+	channel.registeredFounder = "alice"
+	for _, topic := range []string{"second", "third", ""} {
+		channel.recordTopicReplacementNoMutex(2)
+		channel.topic = topic
+	}
+	// the empty topic isn't recorded, and only the newest 2 are kept
+	channel.recordTopicReplacementNoMutex(2)
+	history := channel.TopicHistory()
+	assertEqual(len(history), 2, t)
+	assertEqual(history[0].Topic, "third", t)
+	assertEqual(history[1].Topic, "second", t)
+}
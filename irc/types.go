@@ -8,6 +8,7 @@ package irc
 import (
 	"time"
 
+	"github.com/ergochat/ergo/irc/caps"
 	"github.com/ergochat/ergo/irc/modes"
 )
 
@@ -35,6 +36,10 @@ func (clients ClientSet) Has(client *Client) bool {
 type memberData struct {
 	modes    *modes.ModeSet
 	joinTime int64
+	repeats  repeatState
+	lastMsg  time.Time // for +S
+	// when +o was last granted via MODE, for op expiry (see opexpiry.go)
+	opGranted int64
 }
 
 // MemberSet is a set of members with modes.
@@ -59,5 +64,31 @@ func (members MemberSet) Has(member *Client) bool {
 	return ok
 }
 
+// SessionSet is a set of sessions, typically the recipients of a broadcast.
+// Since it's a set, a recipient that shares several channels with the source
+// still receives exactly one copy.
+type SessionSet map[*Session]empty
+
+// AddClient adds the client's sessions that have all of `capabs`.
+func (set SessionSet) AddClient(client *Client, capabs ...caps.Capability) {
+	client.stateMutex.RLock()
+	defer client.stateMutex.RUnlock()
+	for _, session := range client.sessions {
+		if session.capabilities.HasAll(capabs...) {
+			set[session] = empty{}
+		}
+	}
+}
+
+// AddChannelFriends adds the sessions (with all of `capabs`) of the other
+// members of the channel who can see `source`.
+func (set SessionSet) AddChannelFriends(channel *Channel, source *Client, capabs ...caps.Capability) {
+	for _, member := range channel.auditoriumFriends(source) {
+		if member != source {
+			set.AddClient(member, capabs...)
+		}
+	}
+}
+
 // ChannelSet is a set of channels.
 type ChannelSet map[*Channel]empty
@@ -228,10 +228,12 @@ func ubanAddCIDR(client *Client, target ubanTarget, duration time.Duration, requ
 	}
 
 	sessions, nicks := sessionsForCIDR(client.server, target.cidr, rb.session, requireSASL)
+	qb := newQuitBatch(client.server)
 	for _, session := range sessions {
 		session.client.Quit("You have been banned from this server", session)
-		session.client.destroy(session)
+		session.client.destroyInBatch(session, qb)
 	}
+	qb.End()
 
 	if len(sessions) != 0 {
 		rb.Notice(fmt.Sprintf(client.t("Killed %[1]d active client(s) from %[2]s, associated with %[3]d nickname(s):"), len(sessions), target.cidr.String(), len(nicks)))
@@ -254,17 +256,19 @@ func ubanAddNickmask(client *Client, target ubanTarget, duration time.Duration,
 
 	var killed []string
 	var alwaysOn []string
+	qb := newQuitBatch(client.server)
 	for _, mcl := range client.server.clients.AllClients() {
 		if mcl != client && target.matcher.MatchString(mcl.NickMaskCasefolded()) {
 			if !mcl.AlwaysOn() {
 				killed = append(killed, mcl.Nick())
 				mcl.Quit("You have been banned from this server", nil)
-				mcl.destroy(nil)
+				mcl.destroyInBatch(nil, qb)
 			} else {
 				alwaysOn = append(alwaysOn, mcl.Nick())
 			}
 		}
 	}
+	qb.End()
 	if len(killed) != 0 {
 		rb.Notice(fmt.Sprintf(client.t("Killed %d clients:"), len(killed)))
 		for _, line := range utils.BuildTokenLines(400, killed, " ") {
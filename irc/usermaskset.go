@@ -108,6 +108,19 @@ func (set *UserMaskSet) Masks() (result map[string]MaskInfo) {
 	return
 }
 
+// extbans are list-mode masks of the form `type:mask`; we have no extban
+// prefix character, so the EXTBAN isupport token is `,` followed by the types
+var extbanTypes = []byte{
+	'm', // mute: m:nick!user@host can join, but not speak
+}
+
+const extbanMutePrefix = "m:"
+
+// extbanToken returns the value of the EXTBAN isupport token
+func extbanToken() string {
+	return "," + string(extbanTypes)
+}
+
 // Match matches the given n!u@h against the standard (non-ext) bans.
 func (set *UserMaskSet) Match(userhost string) bool {
 	regexp := (*regexp.Regexp)(atomic.LoadPointer(&set.regexp))
@@ -143,8 +156,8 @@ func (set *UserMaskSet) setRegexp() {
 	maskExprs := make([]string, 0, len(set.masks))
 	var muteExprs []string
 	for mask := range set.masks {
-		if strings.HasPrefix(mask, "m:") {
-			muteExprs = append(muteExprs, mask[2:])
+		if strings.HasPrefix(mask, extbanMutePrefix) {
+			muteExprs = append(muteExprs, mask[len(extbanMutePrefix):])
 		} else {
 			maskExprs = append(maskExprs, mask)
 		}
@@ -13,6 +13,7 @@ import (
 	"encoding/base64"
 	"encoding/hex"
 	"errors"
+	"fmt"
 	"net"
 	"strings"
 	"time"
@@ -118,3 +119,36 @@ func GetCertFP(conn net.Conn, handshakeTimeout time.Duration) (fingerprint strin
 
 	return fingerprint, peerCerts, nil
 }
+
+var tlsVersionNames = map[uint16]string{
+	tls.VersionTLS10: "TLSv1.0",
+	tls.VersionTLS11: "TLSv1.1",
+	tls.VersionTLS12: "TLSv1.2",
+	tls.VersionTLS13: "TLSv1.3",
+}
+
+// TLSDescription describes the negotiated parameters of a TLS connection
+// (protocol version, cipher suite, SNI server name, and ALPN protocol),
+// or returns "" if it isn't TLS or the handshake hasn't completed.
+func TLSDescription(conn net.Conn) (result string) {
+	tlsConn, isTLS := conn.(*tls.Conn)
+	if !isTLS {
+		return
+	}
+	state := tlsConn.ConnectionState()
+	if !state.HandshakeComplete {
+		return
+	}
+	version, ok := tlsVersionNames[state.Version]
+	if !ok {
+		version = fmt.Sprintf("0x%04x", state.Version)
+	}
+	result = fmt.Sprintf("%s %s", version, tls.CipherSuiteName(state.CipherSuite))
+	if state.ServerName != "" {
+		result = fmt.Sprintf("%s sni=%s", result, state.ServerName)
+	}
+	if state.NegotiatedProtocol != "" {
+		result = fmt.Sprintf("%s alpn=%s", result, state.NegotiatedProtocol)
+	}
+	return
+}
@@ -52,6 +52,11 @@ type ListenerConfig struct {
 	STSOnly   bool
 	WebSocket bool
 	HideSTS   bool
+	Password  []byte // hashed listener-specific server password
+	// require a client certificate whose fingerprint was added to an account:
+	RequireCertAccount bool
+	// reject plaintext connections unless they're from a secure net:
+	RejectInsecure bool
 }
 
 // read a PROXY header (either v1 or v2), ensuring we don't read anything beyond